@@ -2,18 +2,33 @@
 package conversion
 
 import (
+	"fmt"
+
 	"github.com/dhconnelly/rtreego"
 	"github.com/ungerik/go3d/float64/vec3"
 )
 
-// BoxToRect converts from vec3.Box to rtreego.Rect
+// minRectExtent is the smallest extent along any axis of rects created by
+// BoxToRect. rtreego does not accept rects with zero extent.
+const minRectExtent = 1e-9
+
+// BoxToRect converts from vec3.Box to rtreego.Rect. Boxes that are flat or
+// inverted along an axis are given an extent of minRectExtent along it.
 func BoxToRect(box *vec3.Box) *rtreego.Rect {
 	min := box.Min
 	lengths := vec3.Sub(&box.Max, &min)
+	for i := range lengths {
+		if lengths[i] < minRectExtent {
+			lengths[i] = minRectExtent
+		}
+	}
 
 	p0 := rtreego.Point{min[0], min[1], min[2]}
 	l := rtreego.Point{lengths[0], lengths[1], lengths[2]}
-	rect, _ := rtreego.NewRect(p0, l)
+	rect, err := rtreego.NewRect(p0, l)
+	if err != nil {
+		panic(fmt.Sprintf("conversion: invalid box %v (%v)", *box, err))
+	}
 	return rect
 }
 
@@ -26,6 +26,20 @@ func TestBoxRect_MinIsNegative_ReturnsCorrect(t *testing.T) {
 	assert.Equal(t, expected, rect)
 }
 
+func TestBoxToRect_ZeroExtent_ReturnsMinimalExtent(t *testing.T) {
+	rect := BoxToRect(&vec3.Box{vec3.T{1, 1, 1}, vec3.T{2, 1, 2}})
+	assert.NotNil(t, rect)
+	assert.Equal(t, 1.0, rect.LengthsCoord(0))
+	assert.InDelta(t, minRectExtent, rect.LengthsCoord(1), 1e-12)
+}
+
+func TestBoxToRect_Inverted_ReturnsMinimalExtent(t *testing.T) {
+	rect := BoxToRect(&vec3.Box{vec3.T{0, 0, 0}, vec3.T{-1, 1, 1}})
+	assert.NotNil(t, rect)
+	assert.Equal(t, 0.0, rect.PointCoord(0))
+	assert.InDelta(t, minRectExtent, rect.LengthsCoord(0), 1e-12)
+}
+
 func TestRectToBox_MinIsOrigo_ReturnsCorrect(t *testing.T) {
 	rect, _ := rtreego.NewRect(rtreego.Point{0, 0, 0}, rtreego.Point{1, 2, 3})
 	expected := &vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 2, 3}}
@@ -53,3 +53,18 @@ func Get(tx *sqlx.Tx, constructor constructorFunc, query string, ids ...interfac
 	}
 	return prototype, nil
 }
+
+// ExecAll is an internal function for executing a sequence of statements that
+// take the same parameters, e.g. to delete an element and all its children.
+// Stops on the first error.
+// - tx is a transaction used to execute the SQL
+// - queries is the SQL statements to execute (in order)
+// - params is the parameters used to replace the placeholders in each statement
+func ExecAll(tx *sqlx.Tx, queries []string, params ...interface{}) error {
+	for _, q := range queries {
+		if _, err := tx.Exec(q, params...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
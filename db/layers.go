@@ -3,6 +3,7 @@ package db
 import (
 	"github.com/jmoiron/sqlx"
 	"github.com/larsmoa/renderdb/db/helpers"
+	"github.com/larsmoa/renderdb/protobuf"
 )
 
 // Layer represents a collection of scenes that combined form 'a layer'.
@@ -18,6 +19,13 @@ type Layer struct {
 	Name    string `db:"name"`
 }
 
+// MarshalProto writes the layer as the message 'Layer' in renderdb.proto.
+func (l *Layer) MarshalProto(e *protobuf.Encoder) {
+	e.WriteInt64(1, l.ID)
+	e.WriteInt64(2, l.WorldID)
+	e.WriteString(3, l.Name)
+}
+
 // Layers provide functionality for accessing layers from a database.
 type Layers interface {
 	// GetAll returns all layers of the given world.
@@ -26,7 +34,8 @@ type Layers interface {
 	Get(layerid int64) (*Layer, error)
 	// Add creates a new layer and returns the ID, or an error.
 	Add(layer *Layer) (int64, error)
-	// Delete deletes the layer with the given ID.
+	// Delete deletes the layer with the given ID. Deletes all
+	// scenes and objects in the layer.
 	Delete(layerid int64) error
 }
 
@@ -34,9 +43,18 @@ const (
 	getAllLayersSQL string = "SELECT id, world_id, name FROM layers WHERE world_id = ? ORDER BY name"
 	getLayerSQL     string = "SELECT id, world_id, name FROM layers WHERE id = ? AND world_id = ?"
 	addLayerSQL     string = "INSERT INTO layers(world_id, name) VALUES (:world_id, :name)"
-	deleteLayerSQL  string = "DELETE FROM layers WHERE id = ? AND world_id = ?"
 )
 
+// deleteLayerSQL deletes a layer and all its children. Each statement
+// takes the ID of the layer and the ID of the world as parameters.
+var deleteLayerSQL = []string{
+	"DELETE FROM scene_materials WHERE scene_id IN (SELECT s.id FROM scenes s INNER JOIN layers l ON l.id = s.layer_id WHERE l.id = ? AND l.world_id = ?)",
+	"DELETE FROM geometry_lods WHERE object_id IN (SELECT id FROM geometry_objects WHERE layer_id = ? AND world_id = ?)",
+	"DELETE FROM geometry_objects WHERE layer_id = ? AND world_id = ?",
+	"DELETE FROM scenes WHERE layer_id IN (SELECT id FROM layers WHERE id = ? AND world_id = ?)",
+	"DELETE FROM layers WHERE id = ? AND world_id = ?",
+}
+
 type layersDb struct {
 	tx      *sqlx.Tx
 	worldID int64
@@ -47,7 +65,7 @@ func layerConstructor() interface{} {
 }
 
 func (db *layersDb) GetAll() ([]*Layer, error) {
-	items, err := helpers.GetAll(db.tx, sceneConstructor, getAllLayersSQL, db.worldID)
+	items, err := helpers.GetAll(db.tx, layerConstructor, getAllLayersSQL, db.worldID)
 	layers := make([]*Layer, len(items))
 	for i, s := range items {
 		layers[i] = s.(*Layer)
@@ -56,17 +74,24 @@ func (db *layersDb) GetAll() ([]*Layer, error) {
 }
 
 func (db *layersDb) Get(layerid int64) (*Layer, error) {
-	item, err := helpers.Get(db.tx, sceneConstructor, getLayerSQL, layerid, db.worldID)
-	return item.(*Layer), err
+	item, err := helpers.Get(db.tx, layerConstructor, getLayerSQL, layerid, db.worldID)
+	if err != nil {
+		return nil, err
+	} else if item == nil {
+		return nil, nil
+	}
+	return item.(*Layer), nil
 }
 
 func (db *layersDb) Add(layer *Layer) (int64, error) {
 	layer.WorldID = db.worldID
-	result, _ := db.tx.NamedExec(addLayerSQL, layer)
+	result, err := db.tx.NamedExec(addLayerSQL, layer)
+	if err != nil {
+		return -1, err
+	}
 	return result.LastInsertId()
 }
 
 func (db *layersDb) Delete(id int64) error {
-	_, err := db.tx.Exec(deleteLayerSQL, id)
-	return err
+	return helpers.ExecAll(db.tx, deleteLayerSQL, id, db.worldID)
 }
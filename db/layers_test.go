@@ -0,0 +1,47 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayersDb_Delete_PopulatedLayer_DeletesChildren(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	worldID, layerID, _ := addWorldWithObject(t, &f)
+
+	// Act
+	err := NewLayersDB(f.tx, worldID).Delete(layerID)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, countRows(t, &f, "worlds"))
+	assert.Equal(t, 0, countRows(t, &f, "layers"))
+	assert.Equal(t, 0, countRows(t, &f, "scenes"))
+	assert.Equal(t, 0, countRows(t, &f, "geometry_objects"))
+	assert.Equal(t, 0, countRows(t, &f, "geometry_lods"))
+	assert.Equal(t, 0, countRows(t, &f, "scene_materials"))
+}
+
+func TestLayersDb_Delete_LayerInOtherWorld_DeletesNothing(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	worldID, _, _ := addWorldWithObject(t, &f)
+	_, otherLayerID, _ := addWorldWithObject(t, &f)
+
+	// Act
+	err := NewLayersDB(f.tx, worldID).Delete(otherLayerID)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 2, countRows(t, &f, "layers"))
+	assert.Equal(t, 2, countRows(t, &f, "scenes"))
+	assert.Equal(t, 2, countRows(t, &f, "geometry_objects"))
+	assert.Equal(t, 2, countRows(t, &f, "geometry_lods"))
+	assert.Equal(t, 2, countRows(t, &f, "scene_materials"))
+}
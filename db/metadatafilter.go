@@ -0,0 +1,434 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MetadataFilter selects objects based on their metadata using a filter
+// expression, e.g.
+//   metadata.system == "HVAC" && metadata.diameter > 50
+// Supported syntax:
+// - Comparisons between a metadata field and a literal using ==, !=, <, <=,
+//   > or >=. Fields are given as metadata.key1.key2 and so on to access
+//   nested JSON objects. Literals are strings in double quotes, numbers,
+//   true, false and null.
+// - Logical operators && and ||, negation (!) and parentheses.
+// Comparisons with fields that do not exist or that have a different type
+// than the literal are false, except for != which is true. Ordering
+// operators only apply to numbers and strings.
+//
+// The filter is partially evaluated in SQL, so only objects that may match are
+// retrieved from the database. The exact evaluation is done by Matches.
+type MetadataFilter struct {
+	expression string
+	root       filterNode
+}
+
+// ParseMetadataFilter parses the filter expression given. Returns an error if
+// the expression is invalid.
+func ParseMetadataFilter(expression string) (MetadataFilter, error) {
+	tokens, err := tokenizeFilter(expression)
+	if err != nil {
+		return MetadataFilter{}, err
+	}
+	p := filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return MetadataFilter{}, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return MetadataFilter{}, fmt.Errorf("Unexpected '%s' at position %d", t.text, t.pos)
+	}
+	return MetadataFilter{expression, root}, nil
+}
+
+// String returns the filter expression.
+func (f MetadataFilter) String() string {
+	return f.expression
+}
+
+// Matches returns true if the metadata of the object satisfies the filter.
+func (f MetadataFilter) Matches(o Object) bool {
+	metadata := o.Metadata()
+	if _, isMap := metadata.(map[string]interface{}); !isMap && metadata != nil {
+		// Convert to the same representation as metadata read from the database
+		buf, err := json.Marshal(metadata)
+		metadata = nil
+		if err != nil || json.Unmarshal(buf, &metadata) != nil {
+			return f.root.evaluate(nil)
+		}
+	}
+	return f.root.evaluate(metadata)
+}
+
+// CreateWhereClause returns a SQL expression that rejects objects that cannot
+// match the filter. Note that the expression may accept objects that do not
+// match the filter.
+func (f MetadataFilter) CreateWhereClause() (string, []interface{}) {
+	clause, args := f.root.prefilter()
+	if clause == "" {
+		return "1 = 1", nil
+	}
+	return clause, args
+}
+
+// filterNode is a node in the syntax tree of a filter expression.
+type filterNode interface {
+	// evaluate returns true if the metadata satisfies the expression.
+	evaluate(metadata interface{}) bool
+	// prefilter returns a SQL expression on the metadata column that is true for
+	// all objects that satisfy the expression, or "" if no such expression exists.
+	prefilter() (string, []interface{})
+}
+
+type andNode struct {
+	left, right filterNode
+}
+
+func (n andNode) evaluate(metadata interface{}) bool {
+	return n.left.evaluate(metadata) && n.right.evaluate(metadata)
+}
+
+func (n andNode) prefilter() (string, []interface{}) {
+	left, leftArgs := n.left.prefilter()
+	right, rightArgs := n.right.prefilter()
+	switch {
+	case left == "":
+		return right, rightArgs
+	case right == "":
+		return left, leftArgs
+	}
+	return "(" + left + ") AND (" + right + ")", append(leftArgs, rightArgs...)
+}
+
+type orNode struct {
+	left, right filterNode
+}
+
+func (n orNode) evaluate(metadata interface{}) bool {
+	return n.left.evaluate(metadata) || n.right.evaluate(metadata)
+}
+
+func (n orNode) prefilter() (string, []interface{}) {
+	left, leftArgs := n.left.prefilter()
+	right, rightArgs := n.right.prefilter()
+	if left == "" || right == "" {
+		return "", nil
+	}
+	return "(" + left + ") OR (" + right + ")", append(leftArgs, rightArgs...)
+}
+
+type notNode struct {
+	operand filterNode
+}
+
+func (n notNode) evaluate(metadata interface{}) bool {
+	return !n.operand.evaluate(metadata)
+}
+
+func (n notNode) prefilter() (string, []interface{}) {
+	return "", nil
+}
+
+type comparisonNode struct {
+	path     []string
+	operator string
+	// value is a string, float64, bool or nil
+	value interface{}
+}
+
+func (n comparisonNode) evaluate(metadata interface{}) bool {
+	field, found := lookupPath(metadata, n.path)
+	if n.operator == "!=" {
+		return !found || !isEqual(field, n.value)
+	}
+	if !found {
+		return false
+	}
+	if n.operator == "==" {
+		return isEqual(field, n.value)
+	}
+
+	var cmp int
+	switch value := n.value.(type) {
+	case float64:
+		f, ok := field.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case f < value:
+			cmp = -1
+		case f > value:
+			cmp = 1
+		}
+	case string:
+		s, ok := field.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(s, value)
+	default:
+		return false
+	}
+
+	switch n.operator {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// prefilter creates a LIKE-expression for equality comparisons with
+// non-numeric literals. Metadata is stored as compact JSON (see Objects.Add),
+// so a matching object must contain the key and value as a substring.
+func (n comparisonNode) prefilter() (string, []interface{}) {
+	if n.operator != "==" {
+		return "", nil
+	}
+	if _, isNumber := n.value.(float64); isNumber {
+		// Numbers may have several textual representations
+		return "", nil
+	}
+	key, _ := json.Marshal(n.path[len(n.path)-1])
+	value, _ := json.Marshal(n.value)
+	escaper := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	pattern := "%" + escaper.Replace(string(key)+":"+string(value)) + "%"
+	return `metadata LIKE ? ESCAPE '\'`, []interface{}{pattern}
+}
+
+// lookupPath returns the value of the (nested) field given by path.
+func lookupPath(metadata interface{}, path []string) (interface{}, bool) {
+	value := metadata
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// isEqual compares a JSON value with a literal.
+func isEqual(field, literal interface{}) bool {
+	switch field.(type) {
+	case string, float64, bool, nil:
+		return field == literal
+	}
+	return false
+}
+
+// Tokenizer and parser below
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenIdentifier
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// tokenizeFilter splits the expression into tokens. The last token is
+// always a tokenEnd.
+func tokenizeFilter(expression string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '_' || unicode.IsLetter(r):
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokenIdentifier, string(runes[start:i]), start})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			for i++; i < len(runes) && isNumberRune(runes[i], runes[i-1]); i++ {
+			}
+			tokens = append(tokens, filterToken{tokenNumber, string(runes[start:i]), start})
+		case r == '"':
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("Unterminated string at position %d", start)
+			}
+			i++
+			tokens = append(tokens, filterToken{tokenString, string(runes[start:i]), start})
+		default:
+			operator := ""
+			for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "."} {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					operator = op
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("Unexpected character '%c' at position %d", r, start)
+			}
+			i += len(operator)
+			tokens = append(tokens, filterToken{tokenOperator, operator, start})
+		}
+	}
+	return append(tokens, filterToken{tokenEnd, "end of filter", len(runes)}), nil
+}
+
+// isNumberRune returns true if r is part of a number given the previous rune.
+func isNumberRune(r, previous rune) bool {
+	return strings.ContainsRune("0123456789.eE", r) ||
+		strings.ContainsRune("+-", r) && strings.ContainsRune("eE", previous)
+}
+
+// filterParser is a recursive descent parser for filter expressions:
+//   or         := and ('||' and)*
+//   and        := unary ('&&' unary)*
+//   unary      := '!' unary | '(' or ')' | comparison
+//   comparison := 'metadata' ('.' identifier)+ operator literal
+type filterParser struct {
+	tokens []filterToken
+	next   int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.next]
+}
+
+func (p *filterParser) consume() filterToken {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+func (p *filterParser) isOperator(text string) bool {
+	t := p.peek()
+	return t.kind == tokenOperator && t.text == text
+}
+
+func (p *filterParser) expect(kind tokenKind, text, description string) (filterToken, error) {
+	t := p.consume()
+	if t.kind != kind || (text != "" && t.text != text) {
+		return t, fmt.Errorf("Expected %s at position %d, but got '%s'", description, t.pos, t.text)
+	}
+	return t, nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.isOperator("||") {
+		p.consume()
+		var right filterNode
+		if right, err = p.parseAnd(); err == nil {
+			left = orNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.isOperator("&&") {
+		p.consume()
+		var right filterNode
+		if right, err = p.parseUnary(); err == nil {
+			left = andNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	switch {
+	case p.isOperator("!"):
+		p.consume()
+		operand, err := p.parseUnary()
+		return notNode{operand}, err
+	case p.isOperator("("):
+		p.consume()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.expect(tokenOperator, ")", "')'")
+		return node, err
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	if _, err := p.expect(tokenIdentifier, "metadata", "'metadata'"); err != nil {
+		return nil, err
+	}
+	node := comparisonNode{}
+	for p.isOperator(".") {
+		p.consume()
+		key, err := p.expect(tokenIdentifier, "", "field name")
+		if err != nil {
+			return nil, err
+		}
+		node.path = append(node.path, key.text)
+	}
+	if len(node.path) == 0 {
+		t := p.peek()
+		return nil, fmt.Errorf("Expected '.' at position %d, but got '%s'", t.pos, t.text)
+	}
+
+	operator := p.consume()
+	switch operator.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		if operator.kind == tokenOperator {
+			node.operator = operator.text
+		}
+	}
+	if node.operator == "" {
+		return nil, fmt.Errorf("Expected comparison operator at position %d, but got '%s'", operator.pos, operator.text)
+	}
+
+	literal := p.consume()
+	var err error
+	switch {
+	case literal.kind == tokenString:
+		node.value, err = strconv.Unquote(literal.text)
+	case literal.kind == tokenNumber:
+		node.value, err = strconv.ParseFloat(literal.text, 64)
+	case literal.kind == tokenIdentifier && literal.text == "true":
+		node.value = true
+	case literal.kind == tokenIdentifier && literal.text == "false":
+		node.value = false
+	case literal.kind == tokenIdentifier && literal.text == "null":
+		node.value = nil
+	default:
+		err = fmt.Errorf("Expected literal")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid literal '%s' at position %d", literal.text, literal.pos)
+	}
+	return node, nil
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func createObjectWithMetadata(metadata interface{}) Object {
+	return NewSimpleObject(vec3.Box{}, nil, metadata)
+}
+
+func TestParseMetadataFilter_InvalidExpressions_ReturnsError(t *testing.T) {
+	expressions := []string{
+		"",
+		"metadata",
+		"metadata.system",
+		"metadata.system ==",
+		"metadata.system == HVAC",
+		"system == \"HVAC\"",
+		"metadata.system = \"HVAC\"",
+		"metadata.system == \"HVAC",
+		"(metadata.a == 1",
+		"metadata.a == 1 &&",
+		"metadata.a == 1 metadata.b == 2",
+		"metadata.a == 1 # 2",
+	}
+	for _, expr := range expressions {
+		_, err := ParseMetadataFilter(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestMetadataFilter_Matches_Expressions_ReturnsExpected(t *testing.T) {
+	// Arrange
+	o := createObjectWithMetadata(map[string]interface{}{
+		"system":   "HVAC",
+		"diameter": 80.0,
+		"floor":    map[string]interface{}{"level": 3.0, "name": "Third"},
+		"active":   true,
+		"status":   nil,
+	})
+	cases := map[string]bool{
+		`metadata.system == "HVAC"`:                             true,
+		`metadata.system == "Electrical"`:                       false,
+		`metadata.system != "Electrical"`:                       true,
+		`metadata.diameter > 50`:                                true,
+		`metadata.diameter <= 8e1`:                              true,
+		`metadata.diameter < -1`:                                false,
+		`metadata.system == "HVAC" && metadata.diameter > 50`:   true,
+		`metadata.system == "HVAC" && metadata.diameter > 100`:  false,
+		`metadata.diameter > 100 || metadata.active == true`:    true,
+		`!(metadata.diameter > 100 || metadata.active == true)`: false,
+		`metadata.floor.level == 3`:                             true,
+		`metadata.floor.name >= "Second"`:                       true,
+		`metadata.status == null`:                               true,
+		`metadata.missing == null`:                              false,
+		`metadata.missing != "x"`:                               true,
+		`metadata.system > 5`:                                   false,
+		`metadata.floor == "x"`:                                 false,
+		`metadata.floor.level.x == 3`:                           false,
+	}
+
+	for expr, expected := range cases {
+		filter, err := ParseMetadataFilter(expr)
+		if assert.NoError(t, err, expr) {
+			// Act
+			matches := filter.Matches(o)
+
+			// Assert
+			assert.Equal(t, expected, matches, expr)
+		}
+	}
+}
+
+func TestMetadataFilter_Matches_StructMetadata_UsesJSONRepresentation(t *testing.T) {
+	// Arrange
+	metadata := struct {
+		System string `json:"system"`
+	}{"HVAC"}
+	filter, _ := ParseMetadataFilter(`metadata.system == "HVAC"`)
+
+	// Act
+	matches := filter.Matches(createObjectWithMetadata(metadata))
+
+	// Assert
+	assert.True(t, matches)
+}
+
+func TestMetadataFilter_CreateWhereClause_EqualityAndComparison_OnlyEqualityIsPushedDown(t *testing.T) {
+	// Arrange
+	filter, _ := ParseMetadataFilter(`metadata.system == "H_V%" && metadata.diameter > 50`)
+
+	// Act
+	clause, args := filter.CreateWhereClause()
+
+	// Assert
+	assert.Equal(t, `metadata LIKE ? ESCAPE '\'`, clause)
+	assert.Equal(t, []interface{}{`%"system":"H\_V\%"%`}, args)
+}
+
+func TestMetadataFilter_CreateWhereClause_OrWithComparison_IsNotPushedDown(t *testing.T) {
+	// Arrange
+	filter, _ := ParseMetadataFilter(`metadata.system == "HVAC" || metadata.diameter > 50`)
+
+	// Act
+	clause, args := filter.CreateWhereClause()
+
+	// Assert
+	assert.Equal(t, "1 = 1", clause)
+	assert.Empty(t, args)
+}
@@ -96,6 +96,50 @@ func (_m *MockObject) GeometryData() []byte {
 	return r0
 }
 
+// GeometryFormat provides a mock function with given fields:
+func (_m *MockObject) GeometryFormat() string {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// TriangleCount provides a mock function with given fields:
+func (_m *MockObject) TriangleCount() int {
+	ret := _m.Called()
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func() int); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	return r0
+}
+
+// LODs provides a mock function with given fields:
+func (_m *MockObject) LODs() []LOD {
+	ret := _m.Called()
+
+	var r0 []LOD
+	if rf, ok := ret.Get(0).(func() []LOD); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]LOD)
+		}
+	}
+
+	return r0
+}
+
 // Metadata provides a mock function with given fields:
 func (_m *MockObject) Metadata() interface{} {
 	ret := _m.Called()
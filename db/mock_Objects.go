@@ -27,13 +27,43 @@ func (_m *MockObjects) Add(o Object) (int64, error) {
 	return r0, r1
 }
 
-// GetMany provides a mock function with given fields: ids
-func (_m *MockObjects) GetMany(ids []int64) (<-chan Object, <-chan error) {
-	ret := _m.Called(ids)
+// AddMany provides a mock function with given fields: objects
+func (_m *MockObjects) AddMany(objects []Object) ([]int64, error) {
+	ret := _m.Called(objects)
+
+	var r0 []int64
+	if rf, ok := ret.Get(0).(func([]Object) []int64); ok {
+		r0 = rf(objects)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]int64)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]Object) error); ok {
+		r1 = rf(objects)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetMany provides a mock function with given fields: done, ids, selectors
+func (_m *MockObjects) GetMany(done <-chan struct{}, ids []int64, selectors ...ObjectSelector) (<-chan Object, <-chan error) {
+	_va := make([]interface{}, len(selectors))
+	for _i := range selectors {
+		_va[_i] = selectors[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, done, ids)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	var r0 <-chan Object
-	if rf, ok := ret.Get(0).(func([]int64) <-chan Object); ok {
-		r0 = rf(ids)
+	if rf, ok := ret.Get(0).(func(<-chan struct{}, []int64, ...ObjectSelector) <-chan Object); ok {
+		r0 = rf(done, ids, selectors...)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(<-chan Object)
@@ -41,8 +71,8 @@ func (_m *MockObjects) GetMany(ids []int64) (<-chan Object, <-chan error) {
 	}
 
 	var r1 <-chan error
-	if rf, ok := ret.Get(1).(func([]int64) <-chan error); ok {
-		r1 = rf(ids)
+	if rf, ok := ret.Get(1).(func(<-chan struct{}, []int64, ...ObjectSelector) <-chan error); ok {
+		r1 = rf(done, ids, selectors...)
 	} else {
 		if ret.Get(1) != nil {
 			r1 = ret.Get(1).(<-chan error)
@@ -52,13 +82,20 @@ func (_m *MockObjects) GetMany(ids []int64) (<-chan Object, <-chan error) {
 	return r0, r1
 }
 
-// GetAll provides a mock function with given fields:
-func (_m *MockObjects) GetAll() (<-chan Object, <-chan error) {
-	ret := _m.Called()
+// GetAll provides a mock function with given fields: done, selectors
+func (_m *MockObjects) GetAll(done <-chan struct{}, selectors ...ObjectSelector) (<-chan Object, <-chan error) {
+	_va := make([]interface{}, len(selectors))
+	for _i := range selectors {
+		_va[_i] = selectors[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, done)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	var r0 <-chan Object
-	if rf, ok := ret.Get(0).(func() <-chan Object); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(<-chan struct{}, ...ObjectSelector) <-chan Object); ok {
+		r0 = rf(done, selectors...)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(<-chan Object)
@@ -66,8 +103,8 @@ func (_m *MockObjects) GetAll() (<-chan Object, <-chan error) {
 	}
 
 	var r1 <-chan error
-	if rf, ok := ret.Get(1).(func() <-chan error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(<-chan struct{}, ...ObjectSelector) <-chan error); ok {
+		r1 = rf(done, selectors...)
 	} else {
 		if ret.Get(1) != nil {
 			r1 = ret.Get(1).(<-chan error)
@@ -76,3 +113,126 @@ func (_m *MockObjects) GetAll() (<-chan Object, <-chan error) {
 
 	return r0, r1
 }
+
+// GetIDs provides a mock function with given fields: selectors
+func (_m *MockObjects) GetIDs(selectors ...ObjectSelector) ([]int64, error) {
+	_va := make([]interface{}, len(selectors))
+	for _i := range selectors {
+		_va[_i] = selectors[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 []int64
+	if rf, ok := ret.Get(0).(func(...ObjectSelector) []int64); ok {
+		r0 = rf(selectors...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]int64)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(...ObjectSelector) error); ok {
+		r1 = rf(selectors...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FilterIDs provides a mock function with given fields: ids, selectors
+func (_m *MockObjects) FilterIDs(ids []int64, selectors ...ObjectSelector) ([]int64, error) {
+	_va := make([]interface{}, len(selectors))
+	for _i := range selectors {
+		_va[_i] = selectors[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ids)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 []int64
+	if rf, ok := ret.Get(0).(func([]int64, ...ObjectSelector) []int64); ok {
+		r0 = rf(ids, selectors...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]int64)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]int64, ...ObjectSelector) error); ok {
+		r1 = rf(ids, selectors...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Delete provides a mock function with given fields: selectors
+func (_m *MockObjects) Delete(selectors ...ObjectSelector) error {
+	_va := make([]interface{}, len(selectors))
+	for _i := range selectors {
+		_va[_i] = selectors[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(...ObjectSelector) error); ok {
+		r0 = rf(selectors...)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetLODs provides a mock function with given fields: levels
+func (_m *MockObjects) GetLODs(levels map[int64]int) (map[int64]LOD, error) {
+	ret := _m.Called(levels)
+
+	var r0 map[int64]LOD
+	if rf, ok := ret.Get(0).(func(map[int64]int) map[int64]LOD); ok {
+		r0 = rf(levels)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[int64]LOD)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(map[int64]int) error); ok {
+		r1 = rf(levels)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Version provides a mock function with given fields:
+func (_m *MockObjects) Version() (ObjectsVersion, error) {
+	ret := _m.Called()
+
+	var r0 ObjectsVersion
+	if rf, ok := ret.Get(0).(func() ObjectsVersion); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(ObjectsVersion)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
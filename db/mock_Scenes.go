@@ -86,3 +86,38 @@ func (_m *MockScenes) Delete(sceneid int64) error {
 
 	return r0
 }
+
+// GetMaterials provides a mock function with given fields: sceneID
+func (_m *MockScenes) GetMaterials(sceneID int64) (interface{}, error) {
+	ret := _m.Called(sceneID)
+
+	var r0 interface{}
+	if rf, ok := ret.Get(0).(func(int64) interface{}); ok {
+		r0 = rf(sceneID)
+	} else {
+		r0 = ret.Get(0)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int64) error); ok {
+		r1 = rf(sceneID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetMaterials provides a mock function with given fields: sceneID, materials
+func (_m *MockScenes) SetMaterials(sceneID int64, materials interface{}) error {
+	ret := _m.Called(sceneID, materials)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(int64, interface{}) error); ok {
+		r0 = rf(sceneID, materials)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
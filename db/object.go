@@ -2,6 +2,14 @@ package db
 
 import "github.com/ungerik/go3d/float64/vec3"
 
+// LOD holds a simplified version of the geometry of an object (level of detail).
+type LOD struct {
+	GeometryData  []byte
+	TriangleCount int
+	// GeometryFormat is the format of GeometryData, see Object.GeometryFormat
+	GeometryFormat string
+}
+
 type Object interface {
 	// ID returns an unique ID of the object
 	ID() int64
@@ -17,19 +25,32 @@ type Object interface {
 	Bounds() *vec3.Box
 	// GeometryData returns raw geometry data of the object
 	GeometryData() []byte
+	// GeometryFormat returns the name (and version) of the format of
+	// GeometryData, e.g. "obj". Empty if unknown.
+	GeometryFormat() string
+	// TriangleCount returns the number of triangles in the geometry
+	// of the object, or 0 if unknown.
+	TriangleCount() int
+	// LODs returns simplified versions of the geometry, from the most to
+	// the least detailed. Level n is LODs()[n-1], level 0 is GeometryData().
+	// Objects retrieved from the database have no LODs, see Objects.GetLODs.
+	LODs() []LOD
 	// Metadata returns arbitrary JSON-convertible metadata for
 	// the object.
 	Metadata() interface{}
 }
 
 type SimpleObject struct {
-	id           int64
-	worldID      int64
-	layerID      int64
-	sceneID      int64
-	bounds       *vec3.Box
-	geometryData []byte
-	metadata     interface{}
+	id             int64
+	worldID        int64
+	layerID        int64
+	sceneID        int64
+	bounds         *vec3.Box
+	geometryData   []byte
+	geometryFormat string
+	triangleCount  int
+	lods           []LOD
+	metadata       interface{}
 }
 
 func NewSimpleObject(bounds vec3.Box, geometryData []byte, metadata interface{}) *SimpleObject {
@@ -44,6 +65,22 @@ func NewSimpleObject(bounds vec3.Box, geometryData []byte, metadata interface{})
 	return o
 }
 
+// NewSceneObject creates a new object that is part of the given
+// world, layer and scene. geometryFormat is the format of geometryData,
+// triangleCount is the number of triangles in the geometry and lods holds
+// simplified versions of the geometry (may be nil).
+func NewSceneObject(worldID, layerID, sceneID int64, bounds vec3.Box, geometryData []byte, geometryFormat string,
+	triangleCount int, lods []LOD, metadata interface{}) *SimpleObject {
+	o := NewSimpleObject(bounds, geometryData, metadata)
+	o.geometryFormat = geometryFormat
+	o.triangleCount = triangleCount
+	o.lods = lods
+	o.worldID = worldID
+	o.layerID = layerID
+	o.sceneID = sceneID
+	return o
+}
+
 func (o *SimpleObject) ID() int64 {
 	return o.id
 }
@@ -66,6 +103,18 @@ func (o *SimpleObject) GeometryData() []byte {
 	return o.geometryData
 }
 
+func (o *SimpleObject) GeometryFormat() string {
+	return o.geometryFormat
+}
+
+func (o *SimpleObject) TriangleCount() int {
+	return o.triangleCount
+}
+
+func (o *SimpleObject) LODs() []LOD {
+	return o.lods
+}
+
 func (o *SimpleObject) Metadata() interface{} {
 	return o.metadata
 }
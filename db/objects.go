@@ -14,32 +14,82 @@ const (
             world_id, layer_id, scene_id,
             bounds_x_min, bounds_y_min, bounds_z_min, 
             bounds_x_max, bounds_y_max, bounds_z_max, 
-            geometry_data, metadata) 
+            geometry_data, geometry_format, triangle_count, metadata) 
           VALUES (?, ?, ?, 
                   ?, ?, ?, 
                   ?, ?, ?,
-				  ?, ?)`
+				  ?, ?, ?, ?)`
 	selectGeometrySQL string = `SELECT id,
                 world_id, layer_id, scene_id,
                 bounds_x_min, bounds_y_min, bounds_z_min, 
                 bounds_x_max, bounds_y_max, bounds_z_max,
-                geometry_data, metadata 
+                geometry_data, geometry_format, triangle_count, metadata 
             FROM geometry_objects WHERE world_id = ?`
+	deleteGeometrySQL string = "DELETE FROM geometry_objects WHERE world_id = ?"
+	selectIDsSQL      string = "SELECT id FROM geometry_objects WHERE world_id = ?"
+	selectMetadataSQL string = "SELECT id, metadata FROM geometry_objects WHERE world_id = ?"
+	insertLODSQL      string = `INSERT INTO geometry_lods(
+            object_id, level, geometry_data, geometry_format, triangle_count)
+          VALUES (?, ?, ?, ?, ?)`
+	selectLODsSQL string = `SELECT l.object_id, l.level, l.geometry_data, l.geometry_format, l.triangle_count
+            FROM geometry_lods l INNER JOIN geometry_objects o ON o.id = l.object_id
+            WHERE o.world_id = ? AND l.level <= ? AND l.object_id IN (?)
+            ORDER BY l.object_id, l.level`
+	deleteLODsSQL    string = "DELETE FROM geometry_lods WHERE object_id IN (%s)"
+	selectVersionSQL string = "SELECT COUNT(*), COALESCE(MAX(id), 0) FROM geometry_objects WHERE world_id = ?"
 )
 
-type ObjectSelector interface {
-	CreateWhereClause() (string, []interface{})
-}
-
 // Objects represents a collection of geometric entities assosciated with
 // a 'world'. Note that this collection holds all objects for all
 // layers and scenes in a world. To restrict the result from the
 // queries to only include certain layers and/or scenes 'ObjectSelector's
 // can be used.
 type Objects interface {
+	// Add inserts the object in the database and returns the ID of the object.
 	Add(o Object) (int64, error)
-	GetMany(ids []int64) (<-chan Object, <-chan error)
-	GetAll() (<-chan Object, <-chan error)
+	// AddMany inserts the objects in the database using prepared statements,
+	// which is faster than calling Add for each object. Returns the IDs of the
+	// objects in the same order as the objects.
+	AddMany(objects []Object) ([]int64, error)
+	// GetMany returns the objects with the given IDs. If selectors are
+	// provided only the objects matching all the selectors are returned.
+	// Closing done stops the operation and closes the object channel, e.g.
+	// when the receiver stops reading. done may be nil.
+	GetMany(done <-chan struct{}, ids []int64, selectors ...ObjectSelector) (<-chan Object, <-chan error)
+	// GetAll returns all objects in the world, or only the objects matching
+	// all the selectors provided. done is used as for GetMany.
+	GetAll(done <-chan struct{}, selectors ...ObjectSelector) (<-chan Object, <-chan error)
+	// GetIDs returns the IDs of the objects in the world matching all the
+	// selectors provided. Selectors implementing ObjectMatcher are only
+	// given the metadata of the objects.
+	GetIDs(selectors ...ObjectSelector) ([]int64, error)
+	// FilterIDs returns the IDs among ids of the objects matching all the
+	// selectors provided, in the order of ids. Selectors implementing
+	// ObjectMatcher are only given the metadata of the objects.
+	FilterIDs(ids []int64, selectors ...ObjectSelector) ([]int64, error)
+	// GetLODs returns simplified geometry for the objects given. levels maps
+	// from object ID to the requested level of detail (1 is the most detailed
+	// simplified version). If an object has fewer levels than requested, the
+	// least detailed level is returned. Objects without simplified geometry
+	// are not included in the result.
+	GetLODs(levels map[int64]int) (map[int64]LOD, error)
+	// Delete deletes all objects in the world matching all the selectors
+	// provided. Note that if no selectors are provided all objects in the
+	// world are deleted. Selectors implementing ObjectMatcher are not supported.
+	Delete(selectors ...ObjectSelector) error
+	// Version returns the version of the objects in the world, which changes
+	// whenever objects are added or deleted.
+	Version() (ObjectsVersion, error)
+}
+
+// ObjectsVersion identifies the set of objects in a world, e.g. to decide
+// if data derived from the objects is stale. Object IDs are never reused
+// and objects are never modified, so the number of objects and the largest
+// ID identifies the objects: adding objects increases the largest ID, and
+// deleting objects (without adding) decreases the count.
+type ObjectsVersion struct {
+	Count int64
+	MaxID int64
 }
 
 type objectsDb struct {
@@ -48,6 +98,37 @@ type objectsDb struct {
 }
 
 func (db *objectsDb) Add(o Object) (int64, error) {
+	ids, err := db.AddMany([]Object{o})
+	if err != nil {
+		return -1, err
+	}
+	return ids[0], nil
+}
+
+func (db *objectsDb) AddMany(objects []Object) ([]int64, error) {
+	insertGeometry, err := db.tx.Preparex(insertGeometrySQL)
+	if err != nil {
+		return nil, err
+	}
+	defer insertGeometry.Close()
+	insertLOD, err := db.tx.Preparex(insertLODSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer insertLOD.Close()
+
+	ids := make([]int64, len(objects))
+	for i, o := range objects {
+		if ids[i], err = addObject(insertGeometry, insertLOD, o); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// addObject inserts the object and its LODs using the prepared
+// statements for insertGeometrySQL and insertLODSQL.
+func addObject(insertGeometry, insertLOD *sqlx.Stmt, o Object) (int64, error) {
 	if o == nil {
 		return -1, fmt.Errorf("Cannot add nil")
 	}
@@ -59,18 +140,27 @@ func (db *objectsDb) Add(o Object) (int64, error) {
 	jsonTxt := strings.Trim(string(jsonBuf), "\"")
 	boundsMin := o.Bounds().Min
 	boundsMax := o.Bounds().Max
-	result, err := db.tx.Exec(insertGeometrySQL,
+	result, err := insertGeometry.Exec(
 		o.WorldID(), o.LayerID(), o.SceneID(),
 		boundsMin[0], boundsMin[1], boundsMin[2],
 		boundsMax[0], boundsMax[1], boundsMax[2],
-		o.GeometryData(), jsonTxt)
+		o.GeometryData(), o.GeometryFormat(), o.TriangleCount(), jsonTxt)
+	if err != nil {
+		return -1, err
+	}
+	id, err := result.LastInsertId()
 	if err != nil {
 		return -1, err
 	}
-	return result.LastInsertId()
+	for i, lod := range o.LODs() {
+		if _, err = insertLOD.Exec(id, i+1, lod.GeometryData, lod.GeometryFormat, lod.TriangleCount); err != nil {
+			return -1, err
+		}
+	}
+	return id, nil
 }
 
-func (db *objectsDb) GetMany(ids []int64) (<-chan Object, <-chan error) {
+func (db *objectsDb) GetMany(done <-chan struct{}, ids []int64, selectors ...ObjectSelector) (<-chan Object, <-chan error) {
 	bufferSize := 200
 	dataChan := make(chan Object, bufferSize)
 	errChan := make(chan error)
@@ -84,15 +174,16 @@ func (db *objectsDb) GetMany(ids []int64) (<-chan Object, <-chan error) {
 			if lastElement > len(ids) {
 				lastElement = len(ids)
 			}
-			chunkIds := append([]int64{db.worldID}, ids[i:lastElement]...)
+			chunkIds := ids[i:lastElement]
 
 			// TODO: Consider if this should be optimized by creating a temporary table
 			// http://explainextended.com/2009/08/18/passing-parameters-in-mysql-in-list-vs-temporary-table/
 			q, args, _ := sqlx.In(fmt.Sprintf("%s AND id IN (?)", selectGeometrySQL), db.worldID, chunkIds)
+			q, args = appendWhereClauses(q, args, selectors)
 			q = sqlx.Rebind(sqlx.QUESTION, q)
 			rows, err := db.tx.Queryx(q, args...)
 			if err != nil {
-				errChan <- err
+				sendError(done, errChan, err)
 				return
 			}
 			defer rows.Close()
@@ -102,31 +193,40 @@ func (db *objectsDb) GetMany(ids []int64) (<-chan Object, <-chan error) {
 			for rows.Next() {
 				result, err = parseDataRow(rows)
 				if err != nil {
-					errChan <- err
+					sendError(done, errChan, err)
+					return
+				}
+				if !matchesAll(result, selectors) {
+					continue
+				}
+				select {
+				case dataChan <- result:
+				case <-done:
 					return
 				}
-				dataChan <- result
 				retrievedCount++
 			}
 		}
-		if retrievedCount < len(ids) {
-			errChan <- fmt.Errorf("Expected %d rows, but got %d", len(ids), retrievedCount)
+		// Selectors may legitimately filter away some of the objects
+		if len(selectors) == 0 && retrievedCount < len(ids) {
+			sendError(done, errChan, fmt.Errorf("Expected %d rows, but got %d", len(ids), retrievedCount))
 			return
 		}
 	}()
 	return dataChan, errChan
 }
 
-func (db *objectsDb) GetAll() (<-chan Object, <-chan error) {
+func (db *objectsDb) GetAll(done <-chan struct{}, selectors ...ObjectSelector) (<-chan Object, <-chan error) {
 	bufferSize := 200
 	dataChan := make(chan Object, bufferSize)
 	errChan := make(chan error)
 	go func() {
 		defer close(dataChan)
 
-		rows, err := db.tx.Queryx(selectGeometrySQL, db.worldID)
+		q, args := appendWhereClauses(selectGeometrySQL, []interface{}{db.worldID}, selectors)
+		rows, err := db.tx.Queryx(q, args...)
 		if err != nil {
-			errChan <- err
+			sendError(done, errChan, err)
 			return
 		}
 		defer rows.Close()
@@ -136,29 +236,197 @@ func (db *objectsDb) GetAll() (<-chan Object, <-chan error) {
 		for rows.Next() {
 			result, err = parseDataRow(rows)
 			if err != nil {
-				errChan <- err
+				sendError(done, errChan, err)
+				return
+			}
+			if !matchesAll(result, selectors) {
+				continue
+			}
+			select {
+			case dataChan <- result:
+			case <-done:
 				return
 			}
-			dataChan <- result
 		}
 	}()
 	return dataChan, errChan
 }
 
+func (db *objectsDb) GetIDs(selectors ...ObjectSelector) ([]int64, error) {
+	hasMatchers := false
+	for _, s := range selectors {
+		if _, isMatcher := s.(ObjectMatcher); isMatcher {
+			hasMatchers = true
+		}
+	}
+	if !hasMatchers {
+		q, args := appendWhereClauses(selectIDsSQL, []interface{}{db.worldID}, selectors)
+		ids := []int64{}
+		if err := db.tx.Select(&ids, q, args...); err != nil {
+			return nil, err
+		}
+		return ids, nil
+	}
+
+	// Evaluate matchers on the metadata of the objects passing the prefilter
+	q, args := appendWhereClauses(selectMetadataSQL, []interface{}{db.worldID}, selectors)
+	return db.selectMatchingIDs(q, args, selectors)
+}
+
+func (db *objectsDb) FilterIDs(ids []int64, selectors ...ObjectSelector) ([]int64, error) {
+	// Split into several fetch operations
+	chunkSize := 200
+	matching := make(map[int64]bool, len(ids))
+	for i := 0; i < len(ids); i = i + chunkSize {
+		lastElement := i + chunkSize
+		if lastElement > len(ids) {
+			lastElement = len(ids)
+		}
+		q, args, err := sqlx.In(fmt.Sprintf("%s AND id IN (?)", selectMetadataSQL), db.worldID, ids[i:lastElement])
+		if err != nil {
+			return nil, err
+		}
+		q, args = appendWhereClauses(q, args, selectors)
+		chunkMatching, err := db.selectMatchingIDs(q, args, selectors)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range chunkMatching {
+			matching[id] = true
+		}
+	}
+
+	result := []int64{}
+	for _, id := range ids {
+		if matching[id] {
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
+
+// Internals below:
+
+// selectMatchingIDs runs a query selecting the ID and metadata of objects
+// and returns the IDs of the objects accepted by the matchers among the
+// selectors.
+func (db *objectsDb) selectMatchingIDs(q string, args []interface{}, selectors []ObjectSelector) ([]int64, error) {
+	rows, err := db.tx.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		var jsonTxt string
+		if err := rows.Scan(&id, &jsonTxt); err != nil {
+			return nil, err
+		}
+		var metadata map[string]interface{}
+		if jsonTxt != "" {
+			if err := json.Unmarshal([]byte(jsonTxt), &metadata); err != nil {
+				return nil, err
+			}
+		}
+		if matchesAll(NewSimpleObject(vec3.Box{}, nil, metadata), selectors) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
 // Internals below:
 
+// sendError sends err on errChan unless done is closed first.
+func sendError(done <-chan struct{}, errChan chan<- error, err error) {
+	select {
+	case errChan <- err:
+	case <-done:
+	}
+}
+
 type row interface {
 	Scan(dest ...interface{}) error
 }
 
 type objectData struct {
-	id           int64
-	worldID      int64
-	layerID      int64
-	sceneID      int64
-	bounds       vec3.Box
-	geometryData []byte
-	metadata     map[string]interface{}
+	id             int64
+	worldID        int64
+	layerID        int64
+	sceneID        int64
+	bounds         vec3.Box
+	geometryData   []byte
+	geometryFormat string
+	triangleCount  int
+	metadata       map[string]interface{}
+}
+
+func (db *objectsDb) GetLODs(levels map[int64]int) (map[int64]LOD, error) {
+	ids := make([]int64, 0, len(levels))
+	maxLevel := 0
+	for id, level := range levels {
+		ids = append(ids, id)
+		if level > maxLevel {
+			maxLevel = level
+		}
+	}
+
+	// Split into several fetch operations
+	chunkSize := 200
+	result := make(map[int64]LOD)
+	for i := 0; i < len(ids); i = i + chunkSize {
+		lastElement := i + chunkSize
+		if lastElement > len(ids) {
+			lastElement = len(ids)
+		}
+		q, args, err := sqlx.In(selectLODsSQL, db.worldID, maxLevel, ids[i:lastElement])
+		if err != nil {
+			return nil, err
+		}
+		rows, err := db.tx.Queryx(q, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		// Rows are ordered by level, so the last row within the requested
+		// level is the one to use
+		for rows.Next() {
+			var id int64
+			var level int
+			var lod LOD
+			if err = rows.Scan(&id, &level, &lod.GeometryData, &lod.GeometryFormat, &lod.TriangleCount); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if level <= levels[id] {
+				result[id] = lod
+			}
+		}
+		rows.Close()
+	}
+	return result, nil
+}
+
+func (db *objectsDb) Delete(selectors ...ObjectSelector) error {
+	for _, s := range selectors {
+		if _, isMatcher := s.(ObjectMatcher); isMatcher {
+			return fmt.Errorf("Selector of type %T is not supported by Delete", s)
+		}
+	}
+	idsQuery, args := appendWhereClauses(selectIDsSQL, []interface{}{db.worldID}, selectors)
+	if _, err := db.tx.Exec(fmt.Sprintf(deleteLODsSQL, idsQuery), args...); err != nil {
+		return err
+	}
+	q, args := appendWhereClauses(deleteGeometrySQL, []interface{}{db.worldID}, selectors)
+	_, err := db.tx.Exec(q, args...)
+	return err
+}
+
+func (db *objectsDb) Version() (ObjectsVersion, error) {
+	version := ObjectsVersion{}
+	err := db.tx.QueryRowx(selectVersionSQL, db.worldID).Scan(&version.Count, &version.MaxID)
+	return version, err
 }
 
 func parseDataRow(r row) (Object, error) {
@@ -169,7 +437,7 @@ func parseDataRow(r row) (Object, error) {
 		&data.worldID, &data.layerID, &data.sceneID,
 		&data.bounds.Min[0], &data.bounds.Min[1], &data.bounds.Min[2],
 		&data.bounds.Max[0], &data.bounds.Max[1], &data.bounds.Max[2],
-		&data.geometryData, &jsonTxt)
+		&data.geometryData, &data.geometryFormat, &data.triangleCount, &jsonTxt)
 	if err != nil {
 		return nil, err
 	}
@@ -180,5 +448,9 @@ func parseDataRow(r row) (Object, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewSimpleObject(data.bounds, data.geometryData, data.metadata), nil
+	o := NewSimpleObject(data.bounds, data.geometryData, data.metadata)
+	o.id, o.worldID, o.layerID, o.sceneID = data.id, data.worldID, data.layerID, data.sceneID
+	o.geometryFormat = data.geometryFormat
+	o.triangleCount = data.triangleCount
+	return o, nil
 }
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -83,13 +84,40 @@ func TestObjectsDb_GetMany_NonExistantId_ReturnsError(t *testing.T) {
 	database := objectsDb{worldID: 1, tx: f.tx}
 
 	// Act
-	_, errCh := database.GetMany([]int64{1337})
+	_, errCh := database.GetMany(nil, []int64{1337})
 
 	// Assert
 	err, _ := <-errCh
 	assert.Error(t, err)
 }
 
+func TestObjectsDb_GetMany_DoneClosedMidStream_ClosesChannel(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	objects := make([]Object, 500)
+	for i := range objects {
+		objects[i] = NewSceneObject(1, 2, 3, vec3.Box{}, []byte(""), "obj", 0, nil, nil)
+	}
+	ids, err := database.AddMany(objects)
+	assert.NoError(t, err)
+	done := make(chan struct{})
+
+	// Act
+	dataCh, _ := database.GetMany(done, ids)
+	<-dataCh
+	close(done)
+	count := 0
+	for range dataCh {
+		count++
+	}
+
+	// Assert
+	assert.True(t, count < len(ids)-1, "%d objects received after done was closed", count)
+}
+
 func TestObjectsDb_GetMany_NoIdsRequested_ReturnsEmpty(t *testing.T) {
 	// Arrange
 	f := databaseFixture{}
@@ -98,7 +126,7 @@ func TestObjectsDb_GetMany_NoIdsRequested_ReturnsEmpty(t *testing.T) {
 	database := objectsDb{worldID: 1, tx: f.tx}
 
 	// Act
-	dataCh, errCh := database.GetMany([]int64{})
+	dataCh, errCh := database.GetMany(nil, []int64{})
 
 	// Assert
 	_, dataChOpen := <-dataCh
@@ -116,12 +144,12 @@ func TestObjectsDb_GetMany_ValidId_ReturnsData(t *testing.T) {
 	f.Setup(t)
 	defer f.Teardown(t)
 	database := objectsDb{worldID: 1, tx: f.tx}
-	r, err := f.tx.Exec(insertGeometrySQL, 1, 2, 3, 0, 0, 0, 1, 1, 1, "ABC", "{}")
+	r, err := f.tx.Exec(insertGeometrySQL, 1, 2, 3, 0, 0, 0, 1, 1, 1, "ABC", "obj", 0, "{}")
 	assert.NoError(t, err)
 	id, _ := r.LastInsertId()
 
 	// Act
-	dataCh, errCh := database.GetMany([]int64{id})
+	dataCh, errCh := database.GetMany(nil, []int64{id})
 
 	// Assert
 	select {
@@ -134,17 +162,109 @@ func TestObjectsDb_GetMany_ValidId_ReturnsData(t *testing.T) {
 	}
 }
 
+func TestObjectsDb_Add_WithGeometryFormat_StoresGeometryFormat(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	o := NewSceneObject(1, 2, 3, vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}, []byte("ABC"), "mesh/1", 1, nil, nil)
+
+	// Act
+	id, err := database.Add(o)
+	assert.NoError(t, err)
+	dataCh, errCh := database.GetMany(nil, []int64{id})
+
+	// Assert
+	select {
+	case data := <-dataCh:
+		assert.Equal(t, "mesh/1", data.GeometryFormat())
+	case err := <-errCh:
+		assert.Fail(t, "Did not expect to receive error", "%v", err)
+	case <-makeTimeoutChan(time.Second):
+		assert.Fail(t, "Timeout while waiting for data")
+	}
+}
+
+func TestObjectsDb_Add_WithTriangleCount_StoresTriangleCount(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	o := NewSceneObject(1, 2, 3, vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}, []byte("ABC"), "", 42, nil, nil)
+
+	// Act
+	id, err := database.Add(o)
+	assert.NoError(t, err)
+	dataCh, errCh := database.GetMany(nil, []int64{id})
+
+	// Assert
+	select {
+	case data := <-dataCh:
+		assert.Equal(t, 42, data.TriangleCount())
+	case err := <-errCh:
+		assert.Fail(t, "Did not expect to receive error", "%v", err)
+	case <-makeTimeoutChan(time.Second):
+		assert.Fail(t, "Timeout while waiting for data")
+	}
+}
+
+func TestObjectsDb_AddMany_SeveralObjects_InsertsObjectsAndLODs(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	bounds := vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}
+	lods := []LOD{LOD{GeometryData: []byte("A"), TriangleCount: 1, GeometryFormat: "obj"}}
+	objects := []Object{
+		NewSceneObject(1, 2, 3, bounds, []byte("ABC"), "obj", 3, lods, nil),
+		NewSceneObject(1, 2, 3, bounds, []byte("DEF"), "obj", 3, nil, nil),
+		NewSceneObject(1, 2, 3, bounds, []byte("GHI"), "obj", 3, lods, nil),
+	}
+
+	// Act
+	ids, err := database.AddMany(objects)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.Len(t, ids, 3) {
+		assert.NotEqual(t, ids[0], ids[1])
+		assert.NotEqual(t, ids[1], ids[2])
+		result, err := database.GetLODs(map[int64]int{ids[0]: 1, ids[1]: 1, ids[2]: 1})
+		assert.NoError(t, err)
+		assert.Len(t, result, 2)
+		assert.Equal(t, []byte("A"), result[ids[2]].GeometryData)
+	}
+}
+
+func TestObjectsDb_AddMany_NilElement_ReturnsError(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	bounds := vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}
+
+	// Act
+	_, err := database.AddMany([]Object{NewSceneObject(1, 2, 3, bounds, []byte("ABC"), "obj", 3, nil, nil), nil})
+
+	// Assert
+	assert.Error(t, err)
+}
+
 func TestObjectsDb_GetAll_PopulatedDb_ReturnsData(t *testing.T) {
 	// Arrange
 	f := databaseFixture{}
 	f.Setup(t)
 	defer f.Teardown(t)
 	database := objectsDb{worldID: 1, tx: f.tx}
-	_, err := f.tx.Exec(insertGeometrySQL, 1, 2, 3, 0, 0, 0, 1, 1, 1, "", "{}")
+	_, err := f.tx.Exec(insertGeometrySQL, 1, 2, 3, 0, 0, 0, 1, 1, 1, "", "obj", 0, "{}")
 	assert.NoError(t, err)
 
 	// Act
-	dataCh, errCh := database.GetAll()
+	dataCh, errCh := database.GetAll(nil)
 
 	// Assert
 	select {
@@ -156,3 +276,263 @@ func TestObjectsDb_GetAll_PopulatedDb_ReturnsData(t *testing.T) {
 		assert.Fail(t, "Timeout while waiting for data")
 	}
 }
+
+func TestObjectsDb_GetAll_WithLayersSelector_ReturnsDataInLayer(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	_, err := f.tx.Exec(insertGeometrySQL, 1, 2, 3, 0, 0, 0, 1, 1, 1, "", "obj", 0, "{}")
+	assert.NoError(t, err)
+	_, err = f.tx.Exec(insertGeometrySQL, 1, 4, 5, 0, 0, 0, 1, 1, 1, "", "obj", 0, "{}")
+	assert.NoError(t, err)
+
+	// Act
+	dataCh, errCh := database.GetAll(nil, LayersSelector{LayerIDs: []int64{4}})
+
+	// Assert
+	var layerIDs []int64
+	for done := false; !done; {
+		select {
+		case data, more := <-dataCh:
+			if !more {
+				done = true
+			} else {
+				layerIDs = append(layerIDs, data.LayerID())
+			}
+		case err := <-errCh:
+			assert.Fail(t, "Did not expect to receive error", "%v", err)
+			return
+		case <-makeTimeoutChan(time.Second):
+			assert.Fail(t, "Timeout while waiting for data")
+			return
+		}
+	}
+	assert.Equal(t, []int64{4}, layerIDs)
+}
+
+func TestObjectsDb_Delete_WithScenesSelector_DeletesScene(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	_, err := f.tx.Exec(insertGeometrySQL, 1, 2, 3, 0, 0, 0, 1, 1, 1, "", "obj", 0, "{}")
+	assert.NoError(t, err)
+	_, err = f.tx.Exec(insertGeometrySQL, 1, 2, 4, 0, 0, 0, 1, 1, 1, "", "obj", 0, "{}")
+	assert.NoError(t, err)
+
+	// Act
+	err = database.Delete(ScenesSelector{SceneIDs: []int64{3}})
+
+	// Assert
+	assert.NoError(t, err)
+	var sceneIDs []int64
+	assert.NoError(t, f.tx.Select(&sceneIDs, "SELECT scene_id FROM geometry_objects"))
+	assert.Equal(t, []int64{4}, sceneIDs)
+}
+
+func TestObjectsDb_GetIDs_WithScenesSelector_ReturnsIDsInScene(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	otherWorld := objectsDb{worldID: 2, tx: f.tx}
+	ids, err := database.AddMany([]Object{
+		NewSceneObject(1, 2, 3, vec3.Box{}, []byte(""), "obj", 0, nil, nil),
+		NewSceneObject(1, 2, 4, vec3.Box{}, []byte(""), "obj", 0, nil, nil),
+	})
+	assert.NoError(t, err)
+	_, err = otherWorld.Add(NewSceneObject(2, 2, 3, vec3.Box{}, []byte(""), "obj", 0, nil, nil))
+	assert.NoError(t, err)
+
+	// Act
+	found, err := database.GetIDs(ScenesSelector{SceneIDs: []int64{3}})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{ids[0]}, found)
+}
+
+func TestObjectsDb_GetIDs_WithMetadataFilter_ReturnsIDsOfMatchingObjects(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	ids, err := database.AddMany([]Object{
+		NewSceneObject(1, 2, 3, vec3.Box{}, []byte(""), "obj", 0, nil, map[string]interface{}{"system": "HVAC", "diameter": 60}),
+		NewSceneObject(1, 2, 3, vec3.Box{}, []byte(""), "obj", 0, nil, map[string]interface{}{"system": "HVAC", "diameter": 40}),
+		NewSceneObject(1, 2, 3, vec3.Box{}, []byte(""), "obj", 0, nil, nil),
+	})
+	assert.NoError(t, err)
+	filter, _ := ParseMetadataFilter(`metadata.system == "HVAC" && metadata.diameter > 50`)
+
+	// Act
+	found, err := database.GetIDs(filter)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{ids[0]}, found)
+}
+
+func TestObjectsDb_FilterIDs_WithMetadataFilter_ReturnsMatchingIDsAmongGiven(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	hvac := NewSceneObject(1, 2, 3, vec3.Box{}, []byte(""), "obj", 0, nil, map[string]interface{}{"system": "HVAC"})
+	objects := make([]Object, 450)
+	for i := range objects {
+		objects[i] = hvac
+	}
+	objects[1] = NewSceneObject(1, 2, 3, vec3.Box{}, []byte(""), "obj", 0, nil, map[string]interface{}{"system": "Piping"})
+	ids, err := database.AddMany(objects)
+	assert.NoError(t, err)
+	filter, _ := ParseMetadataFilter(`metadata.system == "HVAC"`)
+	candidates, expected := []int64{}, []int64{}
+	for i := len(ids) - 1; i >= 0; i-- {
+		candidates = append(candidates, ids[i])
+		if i != 1 {
+			expected = append(expected, ids[i])
+		}
+	}
+
+	// Act
+	found, err := database.FilterIDs(candidates, filter)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, expected, found)
+}
+
+func TestObjectsDb_Version_ObjectsAddedAndDeleted_ChangesVersion(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	otherWorld := objectsDb{worldID: 2, tx: f.tx}
+	o := NewSceneObject(1, 2, 3, vec3.Box{}, []byte(""), "obj", 0, nil, nil)
+
+	// Act
+	empty, errEmpty := database.Version()
+	ids, _ := database.AddMany([]Object{o, o})
+	added, errAdded := database.Version()
+	database.Delete(ScenesSelector{SceneIDs: []int64{3}})
+	deleted, errDeleted := database.Version()
+	other, errOther := otherWorld.Version()
+
+	// Assert
+	assert.NoError(t, errEmpty)
+	assert.NoError(t, errAdded)
+	assert.NoError(t, errDeleted)
+	assert.NoError(t, errOther)
+	assert.Equal(t, ObjectsVersion{}, empty)
+	assert.Equal(t, ObjectsVersion{Count: 2, MaxID: ids[1]}, added)
+	assert.Equal(t, ObjectsVersion{}, deleted)
+	assert.Equal(t, ObjectsVersion{}, other)
+}
+
+// addObjectWithLODs adds an object in scene 3 with the given number of LODs.
+func addObjectWithLODs(t *testing.T, database *objectsDb, count int) int64 {
+	lods := make([]LOD, count)
+	for i := range lods {
+		lods[i] = LOD{GeometryData: []byte(fmt.Sprintf("LOD%d", i+1)), TriangleCount: count - i, GeometryFormat: "obj"}
+	}
+	o := NewSceneObject(1, 2, 3, vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}, []byte("LOD0"), "obj", 10, lods, nil)
+	id, err := database.Add(o)
+	assert.NoError(t, err)
+	return id
+}
+
+func TestObjectsDb_GetLODs_ObjectsWithLODs_ReturnsRequestedOrLeastDetailedLevel(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	id1 := addObjectWithLODs(t, &database, 3)
+	id2 := addObjectWithLODs(t, &database, 1)
+	id3 := addObjectWithLODs(t, &database, 0)
+
+	// Act
+	lods, err := database.GetLODs(map[int64]int{id1: 2, id2: 3, id3: 1})
+
+	// Assert
+	assert.NoError(t, err)
+	expected := map[int64]LOD{
+		id1: LOD{[]byte("LOD2"), 2, "obj"},
+		id2: LOD{[]byte("LOD1"), 1, "obj"},
+	}
+	assert.Equal(t, expected, lods)
+}
+
+func TestObjectsDb_Delete_ObjectWithLODs_DeletesLODs(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	addObjectWithLODs(t, &database, 2)
+
+	// Act
+	err := database.Delete(ScenesSelector{SceneIDs: []int64{3}})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 0, countRows(t, &f, "geometry_lods"))
+}
+
+func TestObjectsDb_GetAll_WithMetadataFilter_ReturnsMatchingObjects(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	_, err := f.tx.Exec(insertGeometrySQL, 1, 2, 3, 0, 0, 0, 1, 1, 1, "", "obj", 0, `{"system":"HVAC","diameter":80}`)
+	assert.NoError(t, err)
+	_, err = f.tx.Exec(insertGeometrySQL, 1, 2, 3, 0, 0, 0, 1, 1, 1, "", "obj", 0, `{"system":"HVAC","diameter":20}`)
+	assert.NoError(t, err)
+	_, err = f.tx.Exec(insertGeometrySQL, 1, 2, 3, 0, 0, 0, 1, 1, 1, "", "obj", 0, `{"system":"Electrical","diameter":80}`)
+	assert.NoError(t, err)
+	filter, err := ParseMetadataFilter(`metadata.system == "HVAC" && metadata.diameter > 50`)
+	assert.NoError(t, err)
+
+	// Act
+	dataCh, errCh := database.GetAll(nil, filter)
+
+	// Assert
+	var diameters []interface{}
+	for more := true; more; {
+		var o Object
+		select {
+		case o, more = <-dataCh:
+			if more {
+				diameters = append(diameters, o.Metadata().(map[string]interface{})["diameter"])
+			}
+		case err := <-errCh:
+			assert.Fail(t, "Did not expect to receive error", "%v", err)
+			more = false
+		}
+	}
+	assert.Equal(t, []interface{}{80.0}, diameters)
+}
+
+func TestObjectsDb_Delete_WithMetadataFilter_ReturnsError(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	database := objectsDb{worldID: 1, tx: f.tx}
+	filter, _ := ParseMetadataFilter(`metadata.system == "HVAC"`)
+
+	// Act
+	err := database.Delete(filter)
+
+	// Assert
+	assert.Error(t, err)
+}
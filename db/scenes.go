@@ -1,8 +1,12 @@
 package db
 
 import (
+	"database/sql"
+	"encoding/json"
+
 	"github.com/jmoiron/sqlx"
 	"github.com/larsmoa/renderdb/db/helpers"
+	"github.com/larsmoa/renderdb/protobuf"
 )
 
 // Scene represents a set of geometric objects in a 'layer'.
@@ -14,6 +18,13 @@ type Scene struct {
 	Name    string `db:"name"`
 }
 
+// MarshalProto writes the scene as the message 'Scene' in renderdb.proto.
+func (s *Scene) MarshalProto(e *protobuf.Encoder) {
+	e.WriteInt64(1, s.ID)
+	e.WriteInt64(2, s.LayerID)
+	e.WriteString(3, s.Name)
+}
+
 // Scenes contains functionality for adding and deleting scenes of
 // a layer.
 type Scenes interface {
@@ -23,17 +34,38 @@ type Scenes interface {
 	Get(id int64) (*Scene, error)
 	// Add creates a new scene in the database and returns the ID.
 	Add(scene *Scene) (int64, error)
-	// Delete deletes the scene with the given ID from the database.
+	// Delete deletes the scene with the given ID from the database. Deletes
+	// all objects in the scene.
 	Delete(sceneid int64) error
+	// GetMaterials returns the materials of the scene with the given ID
+	// decoded from JSON, or nil if the scene has no materials.
+	GetMaterials(sceneID int64) (interface{}, error)
+	// SetMaterials stores the materials of the scene with the given ID as
+	// JSON, replacing any existing materials.
+	SetMaterials(sceneID int64, materials interface{}) error
 }
 
 const (
 	getAllScenesSQL string = "SELECT id, layer_id, name FROM scenes WHERE layer_id = ?"
 	getSceneSQL     string = "SELECT id, layer_id, name FROM scenes WHERE id = ? AND layer_id = ?"
 	addSceneSQL     string = "INSERT INTO scenes(layer_id, name) VALUES(:layer_id, :name)"
-	deleteScenesSQL string = "DELETE FROM scenes WHERE id = ? AND layer_id = ?"
+
+	getSceneMaterialsSQL string = `SELECT m.materials FROM scene_materials m
+		INNER JOIN scenes s ON s.id = m.scene_id
+		WHERE m.scene_id = ? AND s.layer_id = ?`
+	setSceneMaterialsSQL string = `INSERT OR REPLACE INTO scene_materials(scene_id, materials)
+		SELECT id, ? FROM scenes WHERE id = ? AND layer_id = ?`
 )
 
+// deleteSceneSQL deletes a scene and all its objects. Each statement
+// takes the ID of the scene and the ID of the layer as parameters.
+var deleteSceneSQL = []string{
+	"DELETE FROM scene_materials WHERE scene_id IN (SELECT id FROM scenes WHERE id = ? AND layer_id = ?)",
+	"DELETE FROM geometry_lods WHERE object_id IN (SELECT id FROM geometry_objects WHERE scene_id = ? AND layer_id = ?)",
+	"DELETE FROM geometry_objects WHERE scene_id = ? AND layer_id = ?",
+	"DELETE FROM scenes WHERE id = ? AND layer_id = ?",
+}
+
 type scenesDb struct {
 	tx      *sqlx.Tx
 	layerID int64
@@ -54,16 +86,47 @@ func (db *scenesDb) GetAll() ([]*Scene, error) {
 
 func (db *scenesDb) Get(id int64) (*Scene, error) {
 	item, err := helpers.Get(db.tx, sceneConstructor, getSceneSQL, id, db.layerID)
-	return item.(*Scene), err
+	if err != nil {
+		return nil, err
+	} else if item == nil {
+		return nil, nil
+	}
+	return item.(*Scene), nil
 }
 
 func (db *scenesDb) Add(scene *Scene) (int64, error) {
 	scene.LayerID = db.layerID
-	result, _ := db.tx.NamedExec(addSceneSQL, scene)
+	result, err := db.tx.NamedExec(addSceneSQL, scene)
+	if err != nil {
+		return -1, err
+	}
 	return result.LastInsertId()
 }
 
 func (db *scenesDb) Delete(id int64) error {
-	_, err := db.tx.Exec(deleteLayerSQL, id, db.layerID)
+	return helpers.ExecAll(db.tx, deleteSceneSQL, id, db.layerID)
+}
+
+func (db *scenesDb) GetMaterials(sceneID int64) (interface{}, error) {
+	var jsonTxt string
+	err := db.tx.Get(&jsonTxt, getSceneMaterialsSQL, sceneID, db.layerID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var materials interface{}
+	if err = json.Unmarshal([]byte(jsonTxt), &materials); err != nil {
+		return nil, err
+	}
+	return materials, nil
+}
+
+func (db *scenesDb) SetMaterials(sceneID int64, materials interface{}) error {
+	jsonBuf, err := json.Marshal(materials)
+	if err != nil {
+		return err
+	}
+	_, err = db.tx.Exec(setSceneMaterialsSQL, string(jsonBuf), sceneID, db.layerID)
 	return err
 }
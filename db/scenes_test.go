@@ -0,0 +1,81 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScenesDb_Delete_PopulatedScene_DeletesSceneAndObjects(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	_, layerID, sceneID := addWorldWithObject(t, &f)
+
+	// Act
+	err := NewScenesDB(f.tx, layerID).Delete(sceneID)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, countRows(t, &f, "layers"))
+	assert.Equal(t, 0, countRows(t, &f, "scenes"))
+	assert.Equal(t, 0, countRows(t, &f, "geometry_objects"))
+	assert.Equal(t, 0, countRows(t, &f, "geometry_lods"))
+	assert.Equal(t, 0, countRows(t, &f, "scene_materials"))
+}
+
+func TestScenesDb_GetMaterials_NoMaterials_ReturnsNil(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	_, layerID, _ := addWorldWithObject(t, &f)
+	scenesDB := NewScenesDB(f.tx, layerID)
+	sceneID, err := scenesDB.Add(&Scene{Name: "empty"})
+	assert.NoError(t, err)
+
+	// Act
+	materials, err := scenesDB.GetMaterials(sceneID)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Nil(t, materials)
+}
+
+func TestScenesDb_SetMaterials_ExistingMaterials_ReplacesMaterials(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	_, layerID, sceneID := addWorldWithObject(t, &f)
+	scenesDB := NewScenesDB(f.tx, layerID)
+
+	// Act
+	err := scenesDB.SetMaterials(sceneID, map[string]string{"name": "steel"})
+
+	// Assert
+	assert.NoError(t, err)
+	materials, err := scenesDB.GetMaterials(sceneID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "steel"}, materials)
+	assert.Equal(t, 1, countRows(t, &f, "scene_materials"))
+}
+
+func TestScenesDb_SetMaterials_SceneInOtherLayer_DoesNotChangeMaterials(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	_, layerID, _ := addWorldWithObject(t, &f)
+	_, otherLayerID, otherSceneID := addWorldWithObject(t, &f)
+
+	// Act
+	err := NewScenesDB(f.tx, layerID).SetMaterials(otherSceneID, []string{"other"})
+
+	// Assert
+	assert.NoError(t, err)
+	materials, err := NewScenesDB(f.tx, otherLayerID).GetMaterials(otherSceneID)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"material"}, materials)
+}
@@ -0,0 +1,77 @@
+package db
+
+import "strings"
+
+// ObjectSelector is used to restrict the objects returned from Objects, e.g.
+// to only include objects in certain layers or scenes.
+type ObjectSelector interface {
+	// CreateWhereClause returns a SQL expression that can be used in
+	// a WHERE-clause, and the arguments for the placeholders in the expression.
+	CreateWhereClause() (string, []interface{})
+}
+
+// ObjectMatcher is implemented by selectors that cannot be fully evaluated
+// using SQL. Objects returned by the database are only returned from Objects
+// if Matches returns true.
+type ObjectMatcher interface {
+	Matches(o Object) bool
+}
+
+// LayersSelector selects objects that are part of one of the given layers.
+type LayersSelector struct {
+	LayerIDs []int64
+}
+
+// CreateWhereClause returns a SQL expression for selecting objects in the layers.
+func (s LayersSelector) CreateWhereClause() (string, []interface{}) {
+	return createInClause("layer_id", s.LayerIDs)
+}
+
+// ScenesSelector selects objects that are part of one of the given scenes.
+type ScenesSelector struct {
+	SceneIDs []int64
+}
+
+// CreateWhereClause returns a SQL expression for selecting objects in the scenes.
+func (s ScenesSelector) CreateWhereClause() (string, []interface{}) {
+	return createInClause("scene_id", s.SceneIDs)
+}
+
+// createInClause creates an expression on the form "column IN (?, ?, ...)".
+// Note that an empty set of values creates an expression that
+// selects nothing.
+func createInClause(column string, values []int64) (string, []interface{}) {
+	if len(values) == 0 {
+		return "0 = 1", nil
+	}
+	placeholders := make([]string, len(values))
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		placeholders[i] = "?"
+		args[i] = v
+	}
+	return column + " IN (" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// matchesAll returns true if the object is accepted by all selectors
+// implementing ObjectMatcher.
+func matchesAll(o Object, selectors []ObjectSelector) bool {
+	for _, s := range selectors {
+		if m, ok := s.(ObjectMatcher); ok && !m.Matches(o) {
+			return false
+		}
+	}
+	return true
+}
+
+// appendWhereClauses adds the expressions of the selectors to query. The
+// query must already have a WHERE-clause. Returns the new query and the
+// arguments to pass along with args.
+func appendWhereClauses(query string, args []interface{}, selectors []ObjectSelector) (string, []interface{}) {
+	for _, s := range selectors {
+		clause, clauseArgs := s.CreateWhereClause()
+		query = query + " AND (" + clause + ")"
+		args = append(args, clauseArgs...)
+	}
+	return query, args
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayersSelector_CreateWhereClause_TwoLayers_ReturnsInClause(t *testing.T) {
+	// Arrange
+	selector := LayersSelector{LayerIDs: []int64{1, 2}}
+
+	// Act
+	clause, args := selector.CreateWhereClause()
+
+	// Assert
+	assert.Equal(t, "layer_id IN (?, ?)", clause)
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, args)
+}
+
+func TestScenesSelector_CreateWhereClause_NoScenes_SelectsNothing(t *testing.T) {
+	// Arrange
+	selector := ScenesSelector{}
+
+	// Act
+	clause, args := selector.CreateWhereClause()
+
+	// Assert
+	assert.Equal(t, "0 = 1", clause)
+	assert.Empty(t, args)
+}
+
+func TestAppendWhereClauses_TwoSelectors_AppendsBoth(t *testing.T) {
+	// Arrange
+	selectors := []ObjectSelector{
+		LayersSelector{LayerIDs: []int64{1}},
+		ScenesSelector{SceneIDs: []int64{2}},
+	}
+
+	// Act
+	query, args := appendWhereClauses("SELECT * FROM t WHERE world_id = ?", []interface{}{int64(3)}, selectors)
+
+	// Assert
+	assert.Equal(t, "SELECT * FROM t WHERE world_id = ? AND (layer_id IN (?)) AND (scene_id IN (?))", query)
+	assert.Equal(t, []interface{}{int64(3), int64(1), int64(2)}, args)
+}
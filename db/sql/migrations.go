@@ -1,6 +1,10 @@
 // Code generated by go-bindata.
 // sources:
 // migrations/0001-initial.sql
+// migrations/0002-triangle-count.sql
+// migrations/0003-geometry-lods.sql
+// migrations/0004-scene-materials.sql
+// migrations/0005-geometry-format.sql
 // DO NOT EDIT!
 
 package sql
@@ -88,6 +92,86 @@ func migrations0001InitialSql() (*asset, error) {
 	return a, nil
 }
 
+var _migrations0002TriangleCountSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x4d\x8d\x31\x0f\x82\x30\x14\x06\x77\x7e\xc5\xb7\x2b\xc6\xdd\x09\x05\x8d\x49\x85\xa8\x65\x26\x08\xcf\x5a\x03\x7d\x4d\xfb\x88\xf1\xdf\x8b\x89\x83\xe3\x5d\x72\xb9\x34\xc5\x62\xb4\x26\xb4\x42\xa8\x7d\x92\x29\x5d\x5c\xa0\xb3\xad\x2a\x60\x88\x47\x92\xf0\x6e\xf8\xf6\xa4\x4e\x22\xb2\x3c\xc7\xae\x52\xf5\xa9\x84\x04\xdb\x3a\x33\x50\xd3\xf1\xe4\x04\xc7\x52\x17\x87\x39\x2c\x2b\x8d\xb2\x56\x0a\x79\xb1\xcf\x6a\xa5\xb1\xde\x24\x49\xfa\xb7\xc8\xf9\xe5\xbe\xe2\x7a\x56\x76\xc6\x9e\x29\xc2\xb1\x20\x4e\xde\x73\x10\xf4\x81\xbd\xb7\xce\xa0\xe3\x61\x1a\x5d\x5c\x42\x1e\xf4\x03\xd8\x88\x81\xee\x02\xeb\xe0\x87\xb6\xa3\x55\xf2\x01\x81\x2e\x57\x25\xbe\x00\x00\x00")
+
+func migrations0002TriangleCountSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_migrations0002TriangleCountSql,
+		"migrations/0002-triangle-count.sql",
+	)
+}
+
+func migrations0002TriangleCountSql() (*asset, error) {
+	bytes, err := migrations0002TriangleCountSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "migrations/0002-triangle-count.sql", size: 190, mode: os.FileMode(420), modTime: time.Unix(1792259788, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _migrations0003GeometryLodsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x75\x90\xcf\x0a\x82\x40\x18\xc4\xcf\xed\x53\x7c\x47\x25\x7d\x02\x4f\xfe\xf9\x14\xc9\x56\xd9\xd6\x83\x27\x31\x5d\xc4\x50\x37\x74\x2b\x7a\xfb\x2c\x41\x23\x72\xae\xbf\x61\x66\x18\xd3\x84\x7d\xd7\xd4\x43\xa1\x04\xa4\x57\xe2\x32\xb4\x39\x02\xb7\x9d\x08\xa1\x16\xb2\x13\x6a\x78\xe6\xad\xac\x46\x8d\xc0\x24\x79\xbe\x88\x52\xe5\x4d\x05\x21\xe5\x18\x20\x03\x1a\x73\xa0\x69\x14\x19\x1f\xde\x8a\xbb\x68\x37\xd8\x12\x57\x15\xaa\x00\x27\x8a\x9d\x1f\x83\x1a\x9a\xa2\xaf\x5b\x91\x97\xf2\xd6\xab\x8d\x94\x84\x85\x47\x9b\x65\x70\xc0\x0c\xb4\x65\x8e\x31\x37\xeb\x06\xd9\xf9\x31\xc3\x30\xa0\x6f\xc3\xca\x75\x60\xe8\x23\x43\xea\xe2\x69\x1d\x32\xe3\x51\x9b\xb8\x6e\x11\x62\x7e\x7d\xe1\xc9\x47\x4f\x3c\x16\x27\xff\xbe\xb0\xc8\x0b\x01\x13\xd2\xbb\x37\x01\x00\x00")
+
+func migrations0003GeometryLodsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_migrations0003GeometryLodsSql,
+		"migrations/0003-geometry-lods.sql",
+	)
+}
+
+func migrations0003GeometryLodsSql() (*asset, error) {
+	bytes, err := migrations0003GeometryLodsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "migrations/0003-geometry-lods.sql", size: 311, mode: os.FileMode(420), modTime: time.Unix(1792259982, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _migrations0004SceneMaterialsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x6d\x8e\xc1\x0e\x82\x30\x10\x44\xcf\xee\x57\xec\x11\x22\xfd\x02\x4e\x15\x16\xd2\x58\x5b\xb2\x94\x03\x27\x43\x84\x18\x12\x41\x43\x4d\xfc\x7d\xab\x44\xe3\xc1\x39\xce\xbc\x99\x8c\x10\xb8\x9d\xc6\xf3\xd2\xdd\x07\x6c\x6e\x90\x31\x49\x47\xe8\xe4\x4e\x13\xfa\xd3\x30\x0f\xc7\x29\x44\xcb\xd8\x5d\x7c\x04\x18\xb4\x9a\x63\x8f\xca\x38\x2a\x89\xb1\x62\x75\x90\xdc\xe2\x9e\xda\xe4\x4d\x7c\x0b\x58\x3b\x56\xa6\x44\x63\x1d\x9a\x46\xeb\x04\x36\x85\x65\x52\xa5\x79\xc1\xd1\x67\x29\x46\xa6\x82\x98\x4c\x46\xf5\x3a\xef\xa3\xe0\xc6\x29\x80\xf8\x79\x97\x5f\x1f\x33\xe4\x6c\xab\xff\xef\x52\x78\x02\x3b\xe8\x01\x8b\xcb\x00\x00\x00")
+
+func migrations0004SceneMaterialsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_migrations0004SceneMaterialsSql,
+		"migrations/0004-scene-materials.sql",
+	)
+}
+
+func migrations0004SceneMaterialsSql() (*asset, error) {
+	bytes, err := migrations0004SceneMaterialsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "migrations/0004-scene-materials.sql", size: 203, mode: os.FileMode(420), modTime: time.Unix(1792260988, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _migrations0005GeometryFormatSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xa5\x8e\xb1\x0e\x82\x30\x18\x84\x77\x9e\xe2\x36\x06\xc5\x17\x70\x42\x41\x63\x52\x4b\x84\x32\x1b\x84\x1f\xc4\x94\xfe\x4d\x29\x31\xbe\xbd\x38\x18\x1d\xdc\x1c\xbf\xbb\xdc\x97\x8b\x22\x2c\x86\xbe\x73\x95\x27\x94\x36\x88\x85\x4a\x73\xa8\x78\x23\x52\x74\xc4\x03\x79\xf7\x38\xf3\xe5\x46\xb5\x1f\x11\x27\x09\xb6\x99\x28\x8f\xf2\xd3\xb5\xec\x86\xca\xa3\x50\xf9\x41\xee\x21\x33\x05\x59\x0a\x81\x24\xdd\xc5\xa5\x50\x08\xe7\x6d\xb8\xfe\xad\xd5\xdc\xfc\xe3\x0c\xa2\xaf\xeb\x09\xdf\xcd\x2b\x28\x4e\xa2\x9f\xb1\x61\x1a\x61\xd8\x63\x9c\xac\x65\xe7\xd1\x38\xb6\xb6\x37\x1d\x6a\xd6\xd3\x60\xc6\x25\xfc\x95\xde\x80\xca\x11\x34\xb5\x1e\xbd\x81\xd5\x55\x4d\xab\xe0\x09\x45\x83\xa5\xab\x18\x01\x00\x00")
+
+func migrations0005GeometryFormatSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_migrations0005GeometryFormatSql,
+		"migrations/0005-geometry-format.sql",
+	)
+}
+
+func migrations0005GeometryFormatSql() (*asset, error) {
+	bytes, err := migrations0005GeometryFormatSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "migrations/0005-geometry-format.sql", size: 280, mode: os.FileMode(420), modTime: time.Unix(1792261908, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 // Asset loads and returns the asset for the given name.
 // It returns an error if the asset could not be found or
 // could not be loaded.
@@ -141,6 +225,10 @@ func AssetNames() []string {
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
 	"migrations/0001-initial.sql": migrations0001InitialSql,
+	"migrations/0002-triangle-count.sql": migrations0002TriangleCountSql,
+	"migrations/0003-geometry-lods.sql": migrations0003GeometryLodsSql,
+	"migrations/0004-scene-materials.sql": migrations0004SceneMaterialsSql,
+	"migrations/0005-geometry-format.sql": migrations0005GeometryFormatSql,
 }
 
 // AssetDir returns the file names below a certain
@@ -185,6 +273,10 @@ type bintree struct {
 var _bintree = &bintree{nil, map[string]*bintree{
 	"migrations": &bintree{nil, map[string]*bintree{
 		"0001-initial.sql": &bintree{migrations0001InitialSql, map[string]*bintree{}},
+		"0002-triangle-count.sql": &bintree{migrations0002TriangleCountSql, map[string]*bintree{}},
+		"0003-geometry-lods.sql": &bintree{migrations0003GeometryLodsSql, map[string]*bintree{}},
+		"0004-scene-materials.sql": &bintree{migrations0004SceneMaterialsSql, map[string]*bintree{}},
+		"0005-geometry-format.sql": &bintree{migrations0005GeometryFormatSql, map[string]*bintree{}},
 	}},
 }}
 
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE geometry_objects ADD COLUMN triangle_count INTEGER NOT NULL DEFAULT 0;
+
+-- +migrate Down
+-- SQLite does not support dropping columns, the column is left in place.
@@ -0,0 +1,11 @@
+-- +migrate Up
+CREATE TABLE geometry_lods(
+    object_id INTEGER NOT NULL,
+    level INTEGER NOT NULL,
+    geometry_data BLOB NOT NULL,
+    triangle_count INTEGER NOT NULL,
+    PRIMARY KEY (object_id, level),
+	FOREIGN KEY(object_id) REFERENCES geometry_objects(id));
+
+-- +migrate Down
+DROP TABLE geometry_lods;
@@ -0,0 +1,8 @@
+-- +migrate Up
+CREATE TABLE scene_materials(
+    scene_id INTEGER PRIMARY KEY,
+    materials STRING NOT NULL,
+	FOREIGN KEY(scene_id) REFERENCES scenes(id));
+
+-- +migrate Down
+DROP TABLE scene_materials;
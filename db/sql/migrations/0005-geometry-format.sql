@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE geometry_objects ADD COLUMN geometry_format STRING NOT NULL DEFAULT 'obj';
+ALTER TABLE geometry_lods ADD COLUMN geometry_format STRING NOT NULL DEFAULT 'obj';
+
+-- +migrate Down
+-- SQLite does not support dropping columns, the columns are left in place.
@@ -3,6 +3,7 @@ package db
 import (
 	"github.com/jmoiron/sqlx"
 	"github.com/larsmoa/renderdb/db/helpers"
+	"github.com/larsmoa/renderdb/protobuf"
 )
 
 // World represents collection of data that relates to each other, but not necessarily
@@ -13,6 +14,12 @@ type World struct {
 	Name string `db:"name"`
 }
 
+// MarshalProto writes the world as the message 'World' in renderdb.proto.
+func (w *World) MarshalProto(e *protobuf.Encoder) {
+	e.WriteInt64(1, w.ID)
+	e.WriteString(2, w.Name)
+}
+
 // Worlds is an interface for retrieving worlds which contains
 // 'layers' which in turn contains 'scenes' of geometric objects.
 type Worlds interface {
@@ -24,7 +31,8 @@ type Worlds interface {
 	// of the world. The ID field provided world is also
 	// updated.
 	Add(world *World) (int64, error)
-	// Delete deletes the world with the given ID.
+	// Delete deletes the world with the given ID. Deletes all
+	// layers, scenes and objects in the world.
 	Delete(worldid int64) error
 }
 
@@ -32,9 +40,19 @@ const (
 	getAllWorldsSQL string = "SELECT id, name FROM worlds ORDER BY name"
 	getWorldSQL     string = "SELECT id, name FROM worlds WHERE id = ?"
 	addWorldSQL     string = "INSERT INTO worlds(name) VALUES (:name)"
-	deleteWorldSQL  string = "DELETE FROM worlds WHERE id = ?"
 )
 
+// deleteWorldSQL deletes a world and all its children. Each statement
+// takes the ID of the world as the only parameter.
+var deleteWorldSQL = []string{
+	"DELETE FROM scene_materials WHERE scene_id IN (SELECT s.id FROM scenes s INNER JOIN layers l ON l.id = s.layer_id WHERE l.world_id = ?)",
+	"DELETE FROM geometry_lods WHERE object_id IN (SELECT id FROM geometry_objects WHERE world_id = ?)",
+	"DELETE FROM geometry_objects WHERE world_id = ?",
+	"DELETE FROM scenes WHERE layer_id IN (SELECT id FROM layers WHERE world_id = ?)",
+	"DELETE FROM layers WHERE world_id = ?",
+	"DELETE FROM worlds WHERE id = ?",
+}
+
 type worldsDb struct {
 	tx *sqlx.Tx
 }
@@ -71,6 +89,5 @@ func (db *worldsDb) Add(world *World) (int64, error) {
 }
 
 func (db *worldsDb) Delete(id int64) error {
-	_, err := db.tx.Exec(deleteWorldSQL, id)
-	return err
+	return helpers.ExecAll(db.tx, deleteWorldSQL, id)
 }
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countRows returns the number of rows in the table given.
+func countRows(t *testing.T, f *databaseFixture, table string) int {
+	var count int
+	assert.NoError(t, f.tx.Get(&count, "SELECT COUNT(*) FROM "+table))
+	return count
+}
+
+// addWorldWithObject adds a world with one layer, one scene with materials and
+// one object with one LOD. Returns the IDs of the world, layer and scene.
+func addWorldWithObject(t *testing.T, f *databaseFixture) (int64, int64, int64) {
+	worldID, err := NewWorldsDB(f.tx).Add(&World{Name: "world"})
+	assert.NoError(t, err)
+	layerID, err := NewLayersDB(f.tx, worldID).Add(&Layer{Name: "layer"})
+	assert.NoError(t, err)
+	sceneID, err := NewScenesDB(f.tx, layerID).Add(&Scene{Name: "scene"})
+	assert.NoError(t, err)
+	r, err := f.tx.Exec(insertGeometrySQL, worldID, layerID, sceneID, 0, 0, 0, 1, 1, 1, "", "obj", 0, "{}")
+	assert.NoError(t, err)
+	objectID, _ := r.LastInsertId()
+	_, err = f.tx.Exec(insertLODSQL, objectID, 1, "", "obj", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, NewScenesDB(f.tx, layerID).SetMaterials(sceneID, []string{"material"}))
+	return worldID, layerID, sceneID
+}
+
+func TestWorldsDb_Delete_PopulatedWorld_DeletesChildren(t *testing.T) {
+	// Arrange
+	f := databaseFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	worldID, _, _ := addWorldWithObject(t, &f)
+	addWorldWithObject(t, &f)
+
+	// Act
+	err := NewWorldsDB(f.tx).Delete(worldID)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, countRows(t, &f, "worlds"))
+	assert.Equal(t, 1, countRows(t, &f, "layers"))
+	assert.Equal(t, 1, countRows(t, &f, "scenes"))
+	assert.Equal(t, 1, countRows(t, &f, "geometry_objects"))
+	assert.Equal(t, 1, countRows(t, &f, "geometry_lods"))
+	assert.Equal(t, 1, countRows(t, &f, "scene_materials"))
+}
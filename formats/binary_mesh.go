@@ -0,0 +1,499 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// The names of the geometry formats used to store the geometry of objects.
+const (
+	// GeometryFormatOBJ is Wavefront OBJ text as written by GeometryGroup.Write.
+	GeometryFormatOBJ = "obj"
+	// GeometryFormatBinaryMesh is the binary mesh encoding written by
+	// GeometryGroup.WriteBinaryMesh, version 1.
+	GeometryFormatBinaryMesh = "mesh/1"
+)
+
+const (
+	binaryMeshMagic   = "RDBM"
+	binaryMeshVersion = 1
+
+	binaryMeshHasNormals   = 1 << 0
+	binaryMeshHasTexCoords = 1 << 1
+	binaryMeshHasColors    = 1 << 2
+)
+
+// BinaryMeshOptions represents options used when writing the binary
+// mesh encoding.
+type BinaryMeshOptions struct {
+	// PositionBits is the number of bits used for each quantized position
+	// component, relative to the bounding box of the geometry. Must be 0 or
+	// between 1 and 31. 0 stores positions as 32-bit floats relative to the
+	// minimum of the bounding box.
+	PositionBits int
+}
+
+// BinaryMeshReader reads geometry in the binary mesh encoding. The
+// encoding is indexed: each unique combination of position, normal
+// and texture coordinate is stored once.
+//
+// All values are little endian and counts are unsigned varints. The
+// encoding is:
+// - Header: "RDBM", version (uint8), flags (uint8), position bits (uint8), 0 (uint8)
+// - Group name and material library (count + bytes)
+// - Vertex count and bounding box (6 float64)
+// - Positions (float32, uint16 or uint32 per component, see BinaryMeshOptions)
+// - Normals (octahedral, 2 int16 per normal) if flags has 0x1
+// - Texture coordinates (2 float32) if flags has 0x2
+// - Vertex colours (3 uint8) if flags has 0x4
+// - Material names (count, then count + bytes for each)
+// - Faces (count, then corner count, material index and vertex indices for each)
+type BinaryMeshReader struct {
+	objBuffer
+}
+
+func (l *BinaryMeshReader) Read(reader io.Reader) error {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	d := binaryMeshDecoder{r: bytes.NewReader(data)}
+	d.decode(&l.objBuffer)
+	if d.err != nil {
+		return fmt.Errorf("Could not read binary mesh (reason: %v)", d.err)
+	}
+	return nil
+}
+
+// indexedMesh holds the faces of an objBuffer with one vertex per unique
+// corner, as used by the binary encodings.
+type indexedMesh struct {
+	hasNormals, hasTexCoords, hasColors bool
+	// corners holds the corner in the objBuffer of each vertex
+	corners []faceCorner
+	// faces holds the vertex indices of each face
+	faces         [][]int
+	faceMaterials []int
+	materials     []string
+}
+
+// buildIndexedMesh creates vertices for the faces in the buffer. Normals and
+// texture coordinates are only included if all corners have one.
+func buildIndexedMesh(b *objBuffer) *indexedMesh {
+	m := &indexedMesh{
+		hasNormals:    len(b.f) > 0,
+		hasTexCoords:  len(b.f) > 0,
+		hasColors:     len(b.vc) > 0,
+		faces:         make([][]int, len(b.f)),
+		faceMaterials: make([]int, len(b.f)),
+	}
+	for _, f := range b.f {
+		for _, c := range f.corners {
+			m.hasNormals = m.hasNormals && c.normalIndex != -1
+			m.hasTexCoords = m.hasTexCoords && c.texCoordIndex != -1
+		}
+	}
+
+	cornerMapping := make(map[faceCorner]int)
+	materialMapping := make(map[string]int)
+	for i, f := range b.f {
+		material, ok := materialMapping[f.material]
+		if !ok {
+			material = len(m.materials)
+			materialMapping[f.material] = material
+			m.materials = append(m.materials, f.material)
+		}
+		m.faceMaterials[i] = material
+
+		m.faces[i] = make([]int, len(f.corners))
+		for j, c := range f.corners {
+			if !m.hasNormals {
+				c.normalIndex = -1
+			}
+			if !m.hasTexCoords {
+				c.texCoordIndex = -1
+			}
+			idx, ok := cornerMapping[c]
+			if !ok {
+				idx = len(m.corners)
+				cornerMapping[c] = idx
+				m.corners = append(m.corners, c)
+			}
+			m.faces[i][j] = idx
+		}
+	}
+	return m
+}
+
+// flags returns the flags of the attributes in the mesh.
+func (m *indexedMesh) flags() uint8 {
+	flags := uint8(0)
+	if m.hasNormals {
+		flags |= binaryMeshHasNormals
+	}
+	if m.hasTexCoords {
+		flags |= binaryMeshHasTexCoords
+	}
+	if m.hasColors {
+		flags |= binaryMeshHasColors
+	}
+	return flags
+}
+
+// bounds returns the bounding box of the vertices in the mesh, or an empty
+// box at origin if there are no vertices.
+func (m *indexedMesh) bounds(b *objBuffer) vec3.Box {
+	if len(m.corners) == 0 {
+		return vec3.Box{}
+	}
+	box := vec3.Box{vec3.MaxVal, vec3.MinVal}
+	for _, c := range m.corners {
+		box.Join(&vec3.Box{b.v[c.vertexIndex], b.v[c.vertexIndex]})
+	}
+	return box
+}
+
+// writeAttributes writes the normals, texture coordinates and colours
+// of the vertices in the mesh (if any).
+func (m *indexedMesh) writeAttributes(e *binaryMeshEncoder, b *objBuffer) {
+	if m.hasNormals {
+		for _, c := range m.corners {
+			x, y := encodeOctahedral(b.vn[c.normalIndex])
+			e.write([]int16{x, y})
+		}
+	}
+	if m.hasTexCoords {
+		for _, c := range m.corners {
+			vt := b.vt[c.texCoordIndex]
+			e.write([]float32{float32(vt[0]), float32(vt[1])})
+		}
+	}
+	if m.hasColors {
+		for _, c := range m.corners {
+			vc := b.vc[c.vertexIndex]
+			e.write([]uint8{encodeColorComponent(vc[0]), encodeColorComponent(vc[1]), encodeColorComponent(vc[2])})
+		}
+	}
+}
+
+// writeBinaryMesh writes all faces of the buffer in the binary mesh
+// encoding. Normals and texture coordinates are only included if all
+// corners have one, and only the first two texture coordinate components
+// are kept.
+func (b *objBuffer) writeBinaryMesh(w io.Writer, options BinaryMeshOptions) error {
+	if options.PositionBits < 0 || options.PositionBits > 31 {
+		return fmt.Errorf("Position bits must be between 0 and 31, but was %d", options.PositionBits)
+	}
+
+	m := buildIndexedMesh(b)
+	e := binaryMeshEncoder{}
+	e.buffer.WriteString(binaryMeshMagic)
+	e.buffer.Write([]byte{binaryMeshVersion, m.flags(), uint8(options.PositionBits), 0})
+	name := ""
+	if len(b.g) > 0 {
+		name = b.g[0].name
+	}
+	e.writeString(name)
+	e.writeString(b.mtllib)
+
+	// Vertex attributes
+	box := m.bounds(b)
+	e.writeUvarint(len(m.corners))
+	e.write([]float64{box.Min[0], box.Min[1], box.Min[2], box.Max[0], box.Max[1], box.Max[2]})
+	for _, c := range m.corners {
+		e.writePosition(b.v[c.vertexIndex], &box, options.PositionBits)
+	}
+	m.writeAttributes(&e, b)
+
+	// Faces
+	e.writeUvarint(len(m.materials))
+	for _, material := range m.materials {
+		e.writeString(material)
+	}
+	e.writeUvarint(len(m.faces))
+	for i, f := range m.faces {
+		e.writeUvarint(len(f))
+		e.writeUvarint(m.faceMaterials[i])
+		for _, idx := range f {
+			e.writeUvarint(idx)
+		}
+	}
+
+	_, err := w.Write(e.buffer.Bytes())
+	return err
+}
+
+// binaryMeshEncoder writes values to a buffer.
+type binaryMeshEncoder struct {
+	buffer bytes.Buffer
+}
+
+func (e *binaryMeshEncoder) write(data interface{}) {
+	binary.Write(&e.buffer, binary.LittleEndian, data)
+}
+
+func (e *binaryMeshEncoder) writeUvarint(v int) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(v))
+	e.buffer.Write(buf[:n])
+}
+
+func (e *binaryMeshEncoder) writeVarint(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	e.buffer.Write(buf[:n])
+}
+
+func (e *binaryMeshEncoder) writeString(s string) {
+	e.writeUvarint(len(s))
+	e.buffer.WriteString(s)
+}
+
+func (e *binaryMeshEncoder) writePosition(v vec3.T, box *vec3.Box, bits int) {
+	for i := 0; i < 3; i++ {
+		switch {
+		case bits == 0:
+			e.write(float32(v[i] - box.Min[i]))
+		case bits <= 16:
+			e.write(uint16(quantize(v[i], box.Min[i], box.Max[i], bits)))
+		default:
+			e.write(quantize(v[i], box.Min[i], box.Max[i], bits))
+		}
+	}
+}
+
+// quantize maps v in [min, max] to an integer in [0, 2^bits - 1].
+func quantize(v, min, max float64, bits int) uint32 {
+	if max <= min {
+		return 0
+	}
+	steps := float64(uint32(1)<<uint(bits) - 1)
+	q := math.Floor((v-min)/(max-min)*steps + 0.5)
+	return uint32(math.Max(0, math.Min(steps, q)))
+}
+
+// dequantize is the inverse of quantize.
+func dequantize(q uint32, min, max float64, bits int) float64 {
+	steps := float64(uint32(1)<<uint(bits) - 1)
+	return min + float64(q)/steps*(max-min)
+}
+
+// encodeOctahedral maps a unit vector to a point on an octahedron unfolded
+// to the square [-1, 1]^2, stored as signed normalized 16-bit integers.
+func encodeOctahedral(n vec3.T) (int16, int16) {
+	sum := math.Abs(n[0]) + math.Abs(n[1]) + math.Abs(n[2])
+	if sum == 0 {
+		return 0, 0
+	}
+	x, y := n[0]/sum, n[1]/sum
+	if n[2] < 0 {
+		x, y = (1-math.Abs(y))*signNotZero(x), (1-math.Abs(x))*signNotZero(y)
+	}
+	return int16(math.Floor(x*math.MaxInt16 + 0.5)), int16(math.Floor(y*math.MaxInt16 + 0.5))
+}
+
+// decodeOctahedral is the inverse of encodeOctahedral.
+func decodeOctahedral(qx, qy int16) vec3.T {
+	x := math.Max(-1, float64(qx)/math.MaxInt16)
+	y := math.Max(-1, float64(qy)/math.MaxInt16)
+	n := vec3.T{x, y, 1 - math.Abs(x) - math.Abs(y)}
+	if t := math.Max(-n[2], 0); t > 0 {
+		n[0] -= t * signNotZero(n[0])
+		n[1] -= t * signNotZero(n[1])
+	}
+	return *n.Normalize()
+}
+
+func signNotZero(v float64) float64 {
+	if v < 0 {
+		return -1
+	}
+	return 1
+}
+
+func encodeColorComponent(c float64) uint8 {
+	return uint8(math.Floor(math.Max(0, math.Min(1, c))*math.MaxUint8 + 0.5))
+}
+
+// binaryMeshDecoder reads values from a binary mesh. The first error
+// encountered is kept in err, and all reads after an error are no-ops.
+type binaryMeshDecoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *binaryMeshDecoder) read(data interface{}) {
+	if d.err == nil {
+		d.err = binary.Read(d.r, binary.LittleEndian, data)
+	}
+}
+
+// readCount reads a count of elements that each take at least elementSize
+// bytes, and verifies that the data is long enough to hold them.
+func (d *binaryMeshDecoder) readCount(elementSize int) int {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.err = err
+		return 0
+	}
+	if v > uint64(d.r.Len()/elementSize) {
+		d.err = fmt.Errorf("Count %d exceeds the size of the data", v)
+		return 0
+	}
+	return int(v)
+}
+
+// readIndex reads an index and verifies that it's less than count.
+func (d *binaryMeshDecoder) readIndex(count int) int {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.err = err
+		return 0
+	}
+	if v >= uint64(count) {
+		d.err = fmt.Errorf("Index %d is out of range, expected less than %d", v, count)
+		return 0
+	}
+	return int(v)
+}
+
+func (d *binaryMeshDecoder) readString() string {
+	buf := make([]byte, d.readCount(1))
+	d.read(buf)
+	return string(buf)
+}
+
+func (d *binaryMeshDecoder) decode(b *objBuffer) {
+	var header [8]byte
+	d.read(&header)
+	if d.err != nil {
+		return
+	}
+	if string(header[:4]) != binaryMeshMagic {
+		d.err = fmt.Errorf("Data is not a binary mesh")
+		return
+	}
+	if header[4] != binaryMeshVersion {
+		d.err = fmt.Errorf("Binary mesh version %d is not supported", header[4])
+		return
+	}
+	flags, bits := header[5], int(header[6])
+	if bits > 31 {
+		d.err = fmt.Errorf("Invalid number of position bits %d", bits)
+		return
+	}
+	name := d.readString()
+	b.mtllib = d.readString()
+
+	// Vertex attributes
+	vertexCount := d.readCount(3)
+	var bounds [6]float64
+	d.read(&bounds)
+	box := vec3.Box{Min: vec3.T{bounds[0], bounds[1], bounds[2]}, Max: vec3.T{bounds[3], bounds[4], bounds[5]}}
+	b.v = make([]vec3.T, vertexCount)
+	for i := range b.v {
+		for c := 0; c < 3; c++ {
+			switch {
+			case bits == 0:
+				var v float32
+				d.read(&v)
+				b.v[i][c] = box.Min[c] + float64(v)
+			case bits <= 16:
+				var q uint16
+				d.read(&q)
+				b.v[i][c] = dequantize(uint32(q), box.Min[c], box.Max[c], bits)
+			default:
+				var q uint32
+				d.read(&q)
+				b.v[i][c] = dequantize(q, box.Min[c], box.Max[c], bits)
+			}
+		}
+	}
+	d.readAttributes(b, flags, vertexCount)
+
+	// Faces
+	materials := d.readMaterials()
+	b.f = make([]face, d.readCount(3))
+	for i := range b.f {
+		corners := make([]faceCorner, d.readCount(1))
+		material := ""
+		if m := d.readIndex(len(materials)); d.err == nil {
+			material = materials[m]
+		}
+		for j := range corners {
+			corners[j] = indexedCorner(b, d.readIndex(vertexCount))
+		}
+		b.f[i] = face{corners, material}
+		if d.err != nil {
+			return
+		}
+	}
+	if d.err == nil && d.r.Len() > 0 {
+		d.err = fmt.Errorf("Unexpected %d bytes after the faces", d.r.Len())
+	}
+	if d.err == nil {
+		b.g = []group{group{name: name, faceCount: len(b.f)}}
+	}
+}
+
+// readAttributes reads the normals, texture coordinates and colours given
+// by flags of vertexCount vertices.
+func (d *binaryMeshDecoder) readAttributes(b *objBuffer, flags uint8, vertexCount int) {
+	if flags&binaryMeshHasNormals != 0 {
+		b.vn = make([]vec3.T, vertexCount)
+		for i := range b.vn {
+			var n [2]int16
+			d.read(&n)
+			b.vn[i] = decodeOctahedral(n[0], n[1])
+		}
+	}
+	if flags&binaryMeshHasTexCoords != 0 {
+		b.vt = make([]vec3.T, vertexCount)
+		for i := range b.vt {
+			var vt [2]float32
+			d.read(&vt)
+			b.vt[i] = vec3.T{float64(vt[0]), float64(vt[1]), 0}
+		}
+	}
+	if flags&binaryMeshHasColors != 0 {
+		b.vc = make([]vec3.T, vertexCount)
+		for i := range b.vc {
+			var vc [3]uint8
+			d.read(&vc)
+			b.vc[i] = vec3.T{float64(vc[0]) / math.MaxUint8, float64(vc[1]) / math.MaxUint8, float64(vc[2]) / math.MaxUint8}
+		}
+	}
+}
+
+func (d *binaryMeshDecoder) readMaterials() []string {
+	materials := make([]string, d.readCount(1))
+	for i := range materials {
+		materials[i] = d.readString()
+	}
+	return materials
+}
+
+// indexedCorner returns the corner of vertex idx in a buffer read from an
+// indexed mesh, where each vertex has its own normal and texture coordinate.
+func indexedCorner(b *objBuffer, idx int) faceCorner {
+	c := faceCorner{idx, -1, -1}
+	if len(b.vt) > 0 {
+		c.texCoordIndex = idx
+	}
+	if len(b.vn) > 0 {
+		c.normalIndex = idx
+	}
+	return c
+}
@@ -0,0 +1,101 @@
+package formats
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// writeBinaryMesh reads the OBJ given and writes the first group in the
+// binary mesh encoding.
+func writeBinaryMesh(t *testing.T, obj string, options BinaryMeshOptions) []byte {
+	reader := WavefrontObjReader{}
+	assert.NoError(t, reader.Read(strings.NewReader(obj)))
+	buffer := bytes.Buffer{}
+	g := <-reader.Groups()
+	assert.NoError(t, g.WriteBinaryMesh(&buffer, options))
+	return buffer.Bytes()
+}
+
+func TestBinaryMeshReader_Read_WrittenMesh_ReturnsSameGeometry(t *testing.T) {
+	// Arrange
+	obj := "mtllib materials.mtl\n" +
+		"v 100 100 0 1 0 0\nv 102 100 0 0 1 0\nv 102 102 0 0 0 1\nv 100 102 0 1 1 1\n" +
+		"vt 0 0\nvt 1 0\nvt 1 1\nvt 0 1\nvn 0 0 1\nvn 0 0.6 -0.8\n" +
+		"g quad\nusemtl red\nf 1/1/1 2/2/1 3/3/2 4/4/2\nusemtl blue\nf 1/1/1 3/3/2 4/4/2\n"
+	data := writeBinaryMesh(t, obj, BinaryMeshOptions{})
+	reader := BinaryMeshReader{}
+
+	// Act
+	err := reader.Read(bytes.NewReader(data))
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []group{group{name: "quad", faceCount: 2}}, reader.g)
+	assert.Equal(t, "materials.mtl", reader.mtllib)
+	assert.Equal(t, []vec3.T{{100, 100, 0}, {102, 100, 0}, {102, 102, 0}, {100, 102, 0}}, reader.v)
+	assert.Equal(t, []vec3.T{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {1, 1, 1}}, reader.vc)
+	assert.Equal(t, vec3.T{1, 1, 0}, reader.vt[2])
+	assert.InDelta(t, 0, vec3.Distance(&vec3.T{0, 0.6, -0.8}, &reader.vn[2]), 1e-4)
+	assert.Equal(t, []face{
+		face{[]faceCorner{{0, 0, 0}, {1, 1, 1}, {2, 2, 2}, {3, 3, 3}}, "red"},
+		face{[]faceCorner{{0, 0, 0}, {2, 2, 2}, {3, 3, 3}}, "blue"},
+	}, reader.f)
+	assert.True(t, len(data) < len(obj))
+}
+
+func TestBinaryMeshReader_Read_QuantizedPositions_ReturnsApproximatePositions(t *testing.T) {
+	// Arrange
+	obj := "v 1000 0 0\nv 1010 0 3\nv 1003.3 7 1\ng points\np 1 2 3\n"
+	data := writeBinaryMesh(t, obj, BinaryMeshOptions{PositionBits: 12})
+	reader := BinaryMeshReader{}
+
+	// Act
+	err := reader.Read(bytes.NewReader(data))
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, vec3.T{1000, 0, 0}, reader.v[0])
+	assert.Equal(t, vec3.T{1010, 0, 3}, reader.v[1])
+	assert.InDelta(t, 0, vec3.Distance(&vec3.T{1003.3, 7, 1}, &reader.v[2]), 10.0/4095)
+	assert.Equal(t, []faceCorner{{2, -1, -1}}, reader.f[2].corners)
+	assert.Nil(t, reader.vn)
+	assert.Nil(t, reader.vt)
+}
+
+func TestEncodeOctahedral_UnitVectors_DecodesToSameVector(t *testing.T) {
+	normals := []vec3.T{{1, 0, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}, {0.48, -0.6, -0.64}, {-0.8, 0.36, 0.48}}
+	for _, n := range normals {
+		decoded := decodeOctahedral(encodeOctahedral(n))
+		assert.InDelta(t, 0, vec3.Distance(&n, &decoded), 1e-4, "%v decoded as %v", n, decoded)
+	}
+}
+
+func TestBinaryMeshReader_Read_InvalidData_ReturnsError(t *testing.T) {
+	data := writeBinaryMesh(t, "v 0 0 0\nv 1 0 0\nv 0 1 0\ng triangle\nf 1 2 3\n", BinaryMeshOptions{})
+	assert.NoError(t, (&BinaryMeshReader{}).Read(bytes.NewReader(data)))
+
+	assert.Error(t, (&BinaryMeshReader{}).Read(strings.NewReader("v 0 0 0\n")))
+	assert.Error(t, (&BinaryMeshReader{}).Read(bytes.NewReader(data[:len(data)-1])))
+	assert.Error(t, (&BinaryMeshReader{}).Read(bytes.NewReader(append(data, 0))))
+	unknownVersion := append([]byte{}, data...)
+	unknownVersion[4] = 2
+	assert.Error(t, (&BinaryMeshReader{}).Read(bytes.NewReader(unknownVersion)))
+	invalidIndex := append([]byte{}, data...)
+	invalidIndex[len(data)-1] = 3
+	assert.Error(t, (&BinaryMeshReader{}).Read(bytes.NewReader(invalidIndex)))
+}
+
+func TestNewGeometryReader_KnownFormats_ReturnsReader(t *testing.T) {
+	for _, format := range []string{"", GeometryFormatOBJ, GeometryFormatBinaryMesh,
+		GeometryFormatGLTF, GeometryFormatSTL, GeometryFormatPLY} {
+		reader, err := NewGeometryReader(format)
+		assert.NoError(t, err)
+		assert.NotNil(t, reader)
+	}
+	_, err := NewGeometryReader("mesh/2")
+	assert.Error(t, err)
+}
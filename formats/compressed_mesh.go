@@ -0,0 +1,274 @@
+package formats
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+const (
+	compressedMeshMagic   = "RDBZ"
+	compressedMeshVersion = 1
+)
+
+// DefaultCompressedPositionBits is the number of bits used for each
+// position component by CompressedMeshWriter unless set in
+// CompressedMeshOptions.
+const DefaultCompressedPositionBits = 16
+
+// CompressedMeshOptions represents options used by CompressedMeshWriter.
+type CompressedMeshOptions struct {
+	// PositionBits is the number of bits used for each quantized position
+	// component, relative to the bounds of each mesh. Must be between 1
+	// and 31. Defaults to DefaultCompressedPositionBits when zero.
+	PositionBits int
+}
+
+// CompressedMeshWriter writes several meshes in a compressed encoding
+// intended for transfer over slow networks. Positions are quantized
+// relative to the bounds of each mesh and delta encoded, normals are
+// octahedral encoded and vertex indices are delta encoded. The result is
+// compressed using DEFLATE.
+//
+// The encoding is a header ("RDBZ", version (uint8), position bits (uint8),
+// 0 (uint8), 0 (uint8)) followed by a DEFLATE stream holding the number of
+// meshes and for each mesh:
+// - Name, JSON extras and material library (count + bytes)
+// - Flags (uint8) and bounds (6 float64)
+// - Vertex count and positions (3 zigzag varints per vertex)
+// - Normals, texture coordinates and vertex colours (see BinaryMeshReader)
+// - Material names (count, then count + bytes for each)
+// - Faces (count, then corner count, material index and indices for each)
+// Positions are stored as the difference from the quantized position of the
+// previous vertex, and indices as the difference from the previous index.
+// All values are little endian and counts are unsigned varints.
+type CompressedMeshWriter struct {
+	options CompressedMeshOptions
+	meshes  []compressedMesh
+}
+
+type compressedMesh struct {
+	name   string
+	buffer *objBuffer
+	bounds vec3.Box
+	extras interface{}
+}
+
+// SetOptions sets the options that alters the behavior of
+// Write. Defaults to the default CompressedMeshOptions{} struct.
+func (w *CompressedMeshWriter) SetOptions(options CompressedMeshOptions) {
+	w.options = options
+}
+
+// AddMesh adds a mesh holding the geometry read by reader. Positions are
+// quantized relative to bounds, which is extended if it doesn't cover the
+// geometry. extras must be possible to marshal as JSON.
+func (w *CompressedMeshWriter) AddMesh(name string, reader GeometryReader, bounds vec3.Box, extras interface{}) {
+	w.meshes = append(w.meshes, compressedMesh{name, reader.buffer(), bounds, extras})
+}
+
+func (w *CompressedMeshWriter) Write(out io.Writer) error {
+	bits := w.options.PositionBits
+	if bits == 0 {
+		bits = DefaultCompressedPositionBits
+	}
+	if bits < 1 || bits > 31 {
+		return fmt.Errorf("Position bits must be between 1 and 31, but was %d", bits)
+	}
+
+	e := binaryMeshEncoder{}
+	e.writeUvarint(len(w.meshes))
+	for _, mesh := range w.meshes {
+		if err := mesh.encode(&e, bits); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(out, compressedMeshMagic); err != nil {
+		return err
+	}
+	if _, err := out.Write([]byte{compressedMeshVersion, uint8(bits), 0, 0}); err != nil {
+		return err
+	}
+	compressor, err := flate.NewWriter(out, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err = compressor.Write(e.buffer.Bytes()); err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+func (mesh *compressedMesh) encode(e *binaryMeshEncoder, bits int) error {
+	extras, err := json.Marshal(mesh.extras)
+	if err != nil {
+		return fmt.Errorf("Could not encode extras of mesh '%s' (reason: %v)", mesh.name, err)
+	}
+	b := mesh.buffer
+	m := buildIndexedMesh(b)
+	e.writeString(mesh.name)
+	e.writeString(string(extras))
+	e.writeString(b.mtllib)
+	e.buffer.WriteByte(m.flags())
+
+	// Positions
+	box := mesh.bounds
+	if len(m.corners) > 0 {
+		geometryBounds := m.bounds(b)
+		box.Join(&geometryBounds)
+	}
+	e.write([]float64{box.Min[0], box.Min[1], box.Min[2], box.Max[0], box.Max[1], box.Max[2]})
+	e.writeUvarint(len(m.corners))
+	var previous [3]int64
+	for _, c := range m.corners {
+		for i := 0; i < 3; i++ {
+			q := int64(quantize(b.v[c.vertexIndex][i], box.Min[i], box.Max[i], bits))
+			e.writeVarint(q - previous[i])
+			previous[i] = q
+		}
+	}
+	m.writeAttributes(e, b)
+
+	// Faces
+	e.writeUvarint(len(m.materials))
+	for _, material := range m.materials {
+		e.writeString(material)
+	}
+	e.writeUvarint(len(m.faces))
+	previousIndex := 0
+	for i, f := range m.faces {
+		e.writeUvarint(len(f))
+		e.writeUvarint(m.faceMaterials[i])
+		for _, idx := range f {
+			e.writeVarint(int64(idx - previousIndex))
+			previousIndex = idx
+		}
+	}
+	return nil
+}
+
+// CompressedMeshReader reads meshes written by CompressedMeshWriter.
+type CompressedMeshReader struct {
+	meshes []objBuffer
+}
+
+func (l *CompressedMeshReader) Read(reader io.Reader) error {
+	var header [8]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return fmt.Errorf("Could not read compressed mesh header (reason: %v)", err)
+	}
+	if string(header[:4]) != compressedMeshMagic {
+		return fmt.Errorf("Data is not a compressed mesh")
+	}
+	if header[4] != compressedMeshVersion {
+		return fmt.Errorf("Compressed mesh version %d is not supported", header[4])
+	}
+	bits := int(header[5])
+	if bits < 1 || bits > 31 {
+		return fmt.Errorf("Invalid number of position bits %d", bits)
+	}
+
+	data, err := ioutil.ReadAll(flate.NewReader(reader))
+	if err != nil {
+		return fmt.Errorf("Could not decompress meshes (reason: %v)", err)
+	}
+	d := binaryMeshDecoder{r: bytes.NewReader(data)}
+	l.meshes = make([]objBuffer, d.readCount(1))
+	for i := range l.meshes {
+		d.decodeCompressed(&l.meshes[i], bits)
+	}
+	if d.err == nil && d.r.Len() > 0 {
+		d.err = fmt.Errorf("Unexpected %d bytes after the meshes", d.r.Len())
+	}
+	if d.err != nil {
+		return fmt.Errorf("Could not read compressed mesh (reason: %v)", d.err)
+	}
+	return nil
+}
+
+// Groups returns a buffered channel with one element for each mesh. The
+// metadata of each group is the extras of the mesh if it's a JSON object.
+func (l *CompressedMeshReader) Groups() <-chan GeometryGroup {
+	ch := make(chan GeometryGroup, 10)
+	go func() {
+		defer close(ch)
+		for i := range l.meshes {
+			adapter := createGeometryGroupAdapter(&l.meshes[i], l.meshes[i].g[0])
+			ch <- adapter
+		}
+	}()
+	return ch
+}
+
+func (d *binaryMeshDecoder) readVarint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	d.err = err
+	return v
+}
+
+func (d *binaryMeshDecoder) decodeCompressed(b *objBuffer, bits int) {
+	g := group{name: d.readString()}
+	extras := d.readString()
+	b.mtllib = d.readString()
+	var flags uint8
+	d.read(&flags)
+	if d.err == nil && extras != "" {
+		var metadata interface{}
+		if d.err = json.Unmarshal([]byte(extras), &metadata); d.err == nil {
+			g.metadata, _ = metadata.(map[string]interface{})
+		}
+	}
+
+	// Positions
+	var bounds [6]float64
+	d.read(&bounds)
+	box := vec3.Box{Min: vec3.T{bounds[0], bounds[1], bounds[2]}, Max: vec3.T{bounds[3], bounds[4], bounds[5]}}
+	vertexCount := d.readCount(3)
+	b.v = make([]vec3.T, vertexCount)
+	var q [3]int64
+	for i := range b.v {
+		for c := 0; c < 3; c++ {
+			q[c] += d.readVarint()
+			if d.err == nil && (q[c] < 0 || q[c] > 1<<uint(bits)-1) {
+				d.err = fmt.Errorf("Quantized position %d is out of range", q[c])
+			}
+			b.v[i][c] = dequantize(uint32(q[c]), box.Min[c], box.Max[c], bits)
+		}
+	}
+	d.readAttributes(b, flags, vertexCount)
+
+	// Faces
+	materials := d.readMaterials()
+	b.f = make([]face, d.readCount(3))
+	idx := int64(0)
+	for i := range b.f {
+		corners := make([]faceCorner, d.readCount(1))
+		material := ""
+		if m := d.readIndex(len(materials)); d.err == nil {
+			material = materials[m]
+		}
+		for j := range corners {
+			idx += d.readVarint()
+			if d.err == nil && (idx < 0 || idx >= int64(vertexCount)) {
+				d.err = fmt.Errorf("Index %d is out of range, expected less than %d", idx, vertexCount)
+			}
+			corners[j] = indexedCorner(b, int(idx))
+		}
+		b.f[i] = face{corners, material}
+		if d.err != nil {
+			return
+		}
+	}
+	g.faceCount = len(b.f)
+	b.g = []group{g}
+}
@@ -0,0 +1,100 @@
+package formats
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func TestCompressedMeshReader_Read_WrittenMeshes_ReturnsQuantizedGeometry(t *testing.T) {
+	// Arrange
+	first := WavefrontObjReader{}
+	assert.NoError(t, first.Read(strings.NewReader("v 1000 0 0\nv 1010 0 0\nv 1010 10 0\nv 1000 10 0\nvn 0 0 1\n"+
+		"g quad\nusemtl red\nf 1//1 2//1 3//1 4//1\n")))
+	second := WavefrontObjReader{}
+	assert.NoError(t, second.Read(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\ng triangle\nf 1 2 3\n")))
+	writer := CompressedMeshWriter{}
+	writer.SetOptions(CompressedMeshOptions{PositionBits: 10})
+	writer.AddMesh("1", &first, vec3.Box{Min: vec3.T{1000, 0, 0}, Max: vec3.T{1010, 10, 0}}, map[string]interface{}{"id": 1})
+	writer.AddMesh("2", &second, vec3.Box{Min: vec3.T{0, 0, 0}, Max: vec3.T{0.5, 0.5, 0}}, nil)
+	buffer := bytes.Buffer{}
+	assert.NoError(t, writer.Write(&buffer))
+	reader := CompressedMeshReader{}
+
+	// Act
+	err := reader.Read(&buffer)
+
+	// Assert
+	assert.NoError(t, err)
+	groups := []GeometryGroup{}
+	for g := range reader.Groups() {
+		groups = append(groups, g)
+	}
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, "1", groups[0].Name())
+		assert.Equal(t, map[string]interface{}{"id": 1.0}, groups[0].Metadata())
+		assert.Equal(t, vec3.Box{Min: vec3.T{1000, 0, 0}, Max: vec3.T{1010, 10, 0}}, groups[0].BoundingBox())
+		assert.Equal(t, 2, groups[0].TriangleCount())
+		assert.Equal(t, "2", groups[1].Name())
+		assert.Nil(t, groups[1].Metadata())
+		// Bounds are extended to cover the geometry
+		assert.Equal(t, vec3.Box{Min: vec3.T{0, 0, 0}, Max: vec3.T{1, 1, 0}}, groups[1].BoundingBox())
+	}
+	quad := reader.meshes[0]
+	assert.Equal(t, []face{face{[]faceCorner{{0, -1, 0}, {1, -1, 1}, {2, -1, 2}, {3, -1, 3}}, "red"}}, quad.f)
+	assert.InDelta(t, 0, vec3.Distance(&vec3.T{0, 0, 1}, &quad.vn[0]), 1e-4)
+}
+
+func TestCompressedMeshWriter_Write_LargeMesh_IsSmallerThanBinaryMesh(t *testing.T) {
+	// Arrange: a 50x50 grid of quads
+	obj := bytes.Buffer{}
+	for y := 0; y <= 50; y++ {
+		for x := 0; x <= 50; x++ {
+			fmt.Fprintf(&obj, "v %f %f %f\n", float64(x)*0.1, float64(y)*0.1, math.Sin(float64(x+y)))
+		}
+	}
+	obj.WriteString("g grid\n")
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 50; x++ {
+			i := y*51 + x + 1
+			fmt.Fprintf(&obj, "f %d %d %d %d\n", i, i+1, i+52, i+51)
+		}
+	}
+	reader := WavefrontObjReader{}
+	assert.NoError(t, reader.Read(&obj))
+	binaryMesh := bytes.Buffer{}
+	assert.NoError(t, (<-reader.Groups()).WriteBinaryMesh(&binaryMesh, BinaryMeshOptions{PositionBits: 16}))
+	writer := CompressedMeshWriter{}
+	writer.AddMesh("grid", &reader, reader.BoundingBox(), nil)
+	buffer := bytes.Buffer{}
+
+	// Act
+	err := writer.Write(&buffer)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, buffer.Len() < binaryMesh.Len()/2, "%d bytes compressed, %d bytes binary", buffer.Len(), binaryMesh.Len())
+}
+
+func TestCompressedMeshReader_Read_InvalidData_ReturnsError(t *testing.T) {
+	reader := WavefrontObjReader{}
+	assert.NoError(t, reader.Read(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\ng triangle\nf 1 2 3\n")))
+	writer := CompressedMeshWriter{}
+	writer.AddMesh("triangle", &reader, reader.BoundingBox(), nil)
+	buffer := bytes.Buffer{}
+	assert.NoError(t, writer.Write(&buffer))
+	data := buffer.Bytes()
+
+	assert.Error(t, (&CompressedMeshReader{}).Read(strings.NewReader("RDBM")))
+	assert.Error(t, (&CompressedMeshReader{}).Read(bytes.NewReader(data[:len(data)-2])))
+	unknownVersion := append([]byte{}, data...)
+	unknownVersion[4] = 2
+	assert.Error(t, (&CompressedMeshReader{}).Read(bytes.NewReader(unknownVersion)))
+	writer.SetOptions(CompressedMeshOptions{PositionBits: 32})
+	assert.Error(t, writer.Write(&bytes.Buffer{}))
+}
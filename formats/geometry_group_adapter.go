@@ -25,6 +25,10 @@ func (a *geometryGroupAdapter) Name() string {
 	return a.g.name
 }
 
+func (a *geometryGroupAdapter) Metadata() map[string]interface{} {
+	return a.g.metadata
+}
+
 func (a *geometryGroupAdapter) BoundingBox() vec3.Box {
 	return a.buffer.BoundingBox()
 }
@@ -33,6 +37,25 @@ func (a *geometryGroupAdapter) Write(w io.Writer) error {
 	return a.buffer.Write(w)
 }
 
+func (a *geometryGroupAdapter) WriteBinaryMesh(w io.Writer, options BinaryMeshOptions) error {
+	return a.buffer.writeBinaryMesh(w, options)
+}
+
+func (a *geometryGroupAdapter) TriangleCount() int {
+	return a.buffer.TriangleCount()
+}
+
+func (a *geometryGroupAdapter) Simplify(cellSize float64) GeometryGroup {
+	return &geometryGroupAdapter{
+		g:      a.g,
+		buffer: a.buffer.simplify(cellSize),
+	}
+}
+
 func (a *geometryGroupAdapter) RayIntersects(start, direction *vec3.T) bool {
 	return a.buffer.RayIntersects(start, direction)
 }
+
+func (a *geometryGroupAdapter) RayIntersection(start, direction *vec3.T) (float64, bool) {
+	return a.buffer.RayIntersection(start, direction)
+}
@@ -0,0 +1,266 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// GLBWriter writes geometry as binary glTF 2.0 (GLB). Each node added
+// becomes a node in the default scene with one mesh. Polygons are
+// triangulated as triangle fans and the faces of each material becomes a
+// separate primitive. Points are not written. Positions are stored
+// relative to the center of the bounding box of the node, which is stored
+// as the translation of the node, to avoid losing precision when
+// converting to 32-bit floats.
+type GLBWriter struct {
+	nodes []glbNode
+}
+
+type glbNode struct {
+	name   string
+	buffer *objBuffer
+	extras interface{}
+}
+
+// AddNode adds a node holding the geometry read by reader. extras is
+// stored as the 'extras'-property of the node and must be possible to
+// marshal as JSON.
+func (w *GLBWriter) AddNode(name string, reader GeometryReader, extras interface{}) {
+	w.nodes = append(w.nodes, glbNode{name, reader.buffer(), extras})
+}
+
+// glbMesh holds the vertex attributes and indices of a mesh.
+type glbMesh struct {
+	positions []float32
+	normals   []float32
+	texCoords []float32
+	// materials and indices holds the material name and triangle
+	// indices of each primitive
+	materials []string
+	indices   [][]uint32
+}
+
+// buildGLBMesh creates vertex buffers for the faces in the buffer. Corners that
+// refer to the same vertex, texture coordinate and normal share vertex.
+// Normals and texture coordinates are only included if all corners have one.
+func buildGLBMesh(b *objBuffer, origin vec3.T) *glbMesh {
+	hasNormals, hasTexCoords := len(b.f) > 0, len(b.f) > 0
+	for _, f := range b.f {
+		if len(f.corners) < 3 {
+			continue
+		}
+		for _, c := range f.corners {
+			hasNormals = hasNormals && c.normalIndex != -1
+			hasTexCoords = hasTexCoords && c.texCoordIndex != -1
+		}
+	}
+
+	mesh := &glbMesh{}
+	vertexMapping := make(map[faceCorner]uint32)
+	primitiveMapping := make(map[string]int)
+	for _, f := range b.f {
+		if len(f.corners) < 3 {
+			continue
+		}
+		p, ok := primitiveMapping[f.material]
+		if !ok {
+			p = len(mesh.materials)
+			primitiveMapping[f.material] = p
+			mesh.materials = append(mesh.materials, f.material)
+			mesh.indices = append(mesh.indices, nil)
+		}
+
+		cornerIndices := make([]uint32, len(f.corners))
+		for i, c := range f.corners {
+			if !hasNormals {
+				c.normalIndex = -1
+			}
+			if !hasTexCoords {
+				c.texCoordIndex = -1
+			}
+			idx, ok := vertexMapping[c]
+			if !ok {
+				idx = uint32(len(mesh.positions) / 3)
+				vertexMapping[c] = idx
+				v := vec3.Sub(&b.v[c.vertexIndex], &origin)
+				mesh.positions = append(mesh.positions, float32(v[0]), float32(v[1]), float32(v[2]))
+				if hasNormals {
+					n := b.vn[c.normalIndex]
+					mesh.normals = append(mesh.normals, float32(n[0]), float32(n[1]), float32(n[2]))
+				}
+				if hasTexCoords {
+					// OBJ has origin of texture space in the lower left, glTF in upper left
+					t := b.vt[c.texCoordIndex]
+					mesh.texCoords = append(mesh.texCoords, float32(t[0]), float32(1-t[1]))
+				}
+			}
+			cornerIndices[i] = idx
+		}
+		for i := 2; i < len(cornerIndices); i++ {
+			mesh.indices[p] = append(mesh.indices[p], cornerIndices[0], cornerIndices[i-1], cornerIndices[i])
+		}
+	}
+	return mesh
+}
+
+// glbBuilder builds the glTF document and binary buffer of a GLB file.
+type glbBuilder struct {
+	doc       gltfDocument
+	bin       bytes.Buffer
+	materials map[string]int
+}
+
+// addBufferView appends data to the binary buffer, aligned to 4 bytes, and
+// returns the index of the new buffer view.
+func (b *glbBuilder) addBufferView(data interface{}, target int) int {
+	for b.bin.Len()%4 != 0 {
+		b.bin.WriteByte(0)
+	}
+	offset := b.bin.Len()
+	binary.Write(&b.bin, binary.LittleEndian, data)
+	b.doc.BufferViews = append(b.doc.BufferViews, gltfBufferView{
+		Buffer:     0,
+		ByteOffset: offset,
+		ByteLength: b.bin.Len() - offset,
+		Target:     intPtr(target),
+	})
+	return len(b.doc.BufferViews) - 1
+}
+
+// addAccessor adds an accessor for data and returns the index of it.
+func (b *glbBuilder) addAccessor(data interface{}, target, componentType, count int, accessorType string) int {
+	view := b.addBufferView(data, target)
+	b.doc.Accessors = append(b.doc.Accessors, gltfAccessor{
+		BufferView:    intPtr(view),
+		ComponentType: componentType,
+		Count:         count,
+		Type:          accessorType,
+	})
+	return len(b.doc.Accessors) - 1
+}
+
+func (b *glbBuilder) addPositions(positions []float32) int {
+	min := []float64{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32}
+	max := []float64{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32}
+	for i, p := range positions {
+		min[i%3] = math.Min(min[i%3], float64(p))
+		max[i%3] = math.Max(max[i%3], float64(p))
+	}
+	idx := b.addAccessor(positions, gltfTargetArrayBuffer, gltfComponentTypeFloat, len(positions)/3, "VEC3")
+	b.doc.Accessors[idx].Min = min
+	b.doc.Accessors[idx].Max = max
+	return idx
+}
+
+func (b *glbBuilder) addIndices(indices []uint32, vertexCount int) int {
+	// The maximum value of the component type is not allowed as index
+	if vertexCount < math.MaxUint16 {
+		shortIndices := make([]uint16, len(indices))
+		for i, idx := range indices {
+			shortIndices[i] = uint16(idx)
+		}
+		return b.addAccessor(shortIndices, gltfTargetElementArrayBuffer, gltfComponentTypeUnsignedShort, len(indices), "SCALAR")
+	}
+	return b.addAccessor(indices, gltfTargetElementArrayBuffer, gltfComponentTypeUnsignedInt, len(indices), "SCALAR")
+}
+
+func (b *glbBuilder) material(name string) *int {
+	if name == "" {
+		return nil
+	}
+	idx, ok := b.materials[name]
+	if !ok {
+		idx = len(b.doc.Materials)
+		b.materials[name] = idx
+		b.doc.Materials = append(b.doc.Materials, gltfMaterial{Name: name})
+	}
+	return intPtr(idx)
+}
+
+func (b *glbBuilder) addNode(n glbNode) {
+	bounds := n.buffer.BoundingBox()
+	origin := vec3.T{}
+	if len(n.buffer.v) > 0 {
+		origin = bounds.Center()
+	}
+
+	node := gltfNode{
+		Name:        n.name,
+		Translation: []float64{origin[0], origin[1], origin[2]},
+		Extras:      n.extras,
+	}
+	mesh := buildGLBMesh(n.buffer, origin)
+	if len(mesh.positions) > 0 {
+		attributes := map[string]int{"POSITION": b.addPositions(mesh.positions)}
+		if mesh.normals != nil {
+			attributes["NORMAL"] = b.addAccessor(mesh.normals, gltfTargetArrayBuffer, gltfComponentTypeFloat, len(mesh.normals)/3, "VEC3")
+		}
+		if mesh.texCoords != nil {
+			attributes["TEXCOORD_0"] = b.addAccessor(mesh.texCoords, gltfTargetArrayBuffer, gltfComponentTypeFloat, len(mesh.texCoords)/2, "VEC2")
+		}
+
+		m := gltfMesh{Name: n.name}
+		for i, indices := range mesh.indices {
+			m.Primitives = append(m.Primitives, gltfPrimitive{
+				Attributes: attributes,
+				Indices:    intPtr(b.addIndices(indices, len(mesh.positions)/3)),
+				Material:   b.material(mesh.materials[i]),
+				Mode:       intPtr(gltfModeTriangles),
+			})
+		}
+		b.doc.Meshes = append(b.doc.Meshes, m)
+		node.Mesh = intPtr(len(b.doc.Meshes) - 1)
+	}
+	b.doc.Nodes = append(b.doc.Nodes, node)
+	b.doc.Scenes[0].Nodes = append(b.doc.Scenes[0].Nodes, len(b.doc.Nodes)-1)
+}
+
+// Write outputs the GLB file to the writer given. Returns an error if the
+// operation fails.
+func (w *GLBWriter) Write(out io.Writer) error {
+	b := glbBuilder{materials: make(map[string]int)}
+	b.doc.Asset = gltfAsset{Version: "2.0", Generator: "RenderDB"}
+	b.doc.Scene = intPtr(0)
+	b.doc.Scenes = []gltfScene{gltfScene{Nodes: []int{}}}
+	for _, n := range w.nodes {
+		b.addNode(n)
+	}
+	for b.bin.Len()%4 != 0 {
+		b.bin.WriteByte(0)
+	}
+	if b.bin.Len() > 0 {
+		b.doc.Buffers = []gltfBuffer{gltfBuffer{ByteLength: b.bin.Len()}}
+	}
+
+	jsonBuf, err := json.Marshal(b.doc)
+	if err != nil {
+		return err
+	}
+	for len(jsonBuf)%4 != 0 {
+		jsonBuf = append(jsonBuf, ' ')
+	}
+
+	length := glbHeaderLength + glbChunkHeaderLen + len(jsonBuf)
+	if b.bin.Len() > 0 {
+		length += glbChunkHeaderLen + b.bin.Len()
+	}
+	header := []uint32{glbMagic, glbVersion, uint32(length), uint32(len(jsonBuf)), glbChunkTypeJSON}
+	if err = binary.Write(out, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	if _, err = out.Write(jsonBuf); err != nil {
+		return err
+	}
+	if b.bin.Len() > 0 {
+		if err = binary.Write(out, binary.LittleEndian, []uint32{uint32(b.bin.Len()), glbChunkTypeBIN}); err != nil {
+			return err
+		}
+		_, err = out.Write(b.bin.Bytes())
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readGLB splits a GLB file into the JSON document and the binary buffer.
+func readGLB(t *testing.T, data []byte) (gltfDocument, []byte) {
+	var header [5]uint32
+	assert.NoError(t, binary.Read(bytes.NewReader(data), binary.LittleEndian, &header))
+	assert.Equal(t, glbMagic, header[0])
+	assert.Equal(t, glbVersion, header[1])
+	assert.Equal(t, uint32(len(data)), header[2])
+	assert.Equal(t, glbChunkTypeJSON, header[4])
+
+	doc := gltfDocument{}
+	jsonEnd := 20 + int(header[3])
+	assert.NoError(t, json.Unmarshal(data[20:jsonEnd], &doc))
+	if jsonEnd == len(data) {
+		return doc, nil
+	}
+	binLength := binary.LittleEndian.Uint32(data[jsonEnd:])
+	assert.Equal(t, glbChunkTypeBIN, binary.LittleEndian.Uint32(data[jsonEnd+4:]))
+	return doc, data[jsonEnd+8 : jsonEnd+8+int(binLength)]
+}
+
+func TestGLBWriter_Write_NoNodes_WritesEmptyScene(t *testing.T) {
+	// Arrange
+	writer := GLBWriter{}
+	buffer := bytes.Buffer{}
+
+	// Act
+	err := writer.Write(&buffer)
+
+	// Assert
+	assert.NoError(t, err)
+	doc, bin := readGLB(t, buffer.Bytes())
+	assert.Equal(t, "2.0", doc.Asset.Version)
+	assert.Equal(t, []gltfScene{gltfScene{Nodes: []int{}}}, doc.Scenes)
+	assert.Nil(t, bin)
+}
+
+func TestGLBWriter_Write_QuadWithTwoMaterials_WritesTriangulatedPrimitives(t *testing.T) {
+	// Arrange
+	obj := "v 10 10 0\nv 12 10 0\nv 12 12 0\nv 10 12 0\nvn 0 0 1\n" +
+		"g quad\n" +
+		"usemtl red\n" +
+		"f 1//1 2//1 3//1 4//1\n" +
+		"usemtl blue\n" +
+		"f 1//1 3//1 4//1\n"
+	reader := WavefrontObjReader{}
+	assert.NoError(t, reader.Read(strings.NewReader(obj)))
+	writer := GLBWriter{}
+	writer.AddNode("42", &reader, map[string]interface{}{"id": 42})
+	buffer := bytes.Buffer{}
+
+	// Act
+	err := writer.Write(&buffer)
+
+	// Assert
+	assert.NoError(t, err)
+	doc, bin := readGLB(t, buffer.Bytes())
+	assert.Equal(t, len(bin), doc.Buffers[0].ByteLength)
+	assert.Equal(t, 0, len(bin)%4)
+	if assert.Len(t, doc.Nodes, 1) {
+		node := doc.Nodes[0]
+		assert.Equal(t, "42", node.Name)
+		assert.Equal(t, []float64{11, 11, 0}, node.Translation)
+		assert.Equal(t, map[string]interface{}{"id": 42.0}, node.Extras)
+	}
+	assert.Equal(t, []gltfMaterial{gltfMaterial{Name: "red"}, gltfMaterial{Name: "blue"}}, doc.Materials)
+	if assert.Len(t, doc.Meshes, 1) && assert.Len(t, doc.Meshes[0].Primitives, 2) {
+		red := doc.Meshes[0].Primitives[0]
+		blue := doc.Meshes[0].Primitives[1]
+		assert.Equal(t, 4, doc.Accessors[red.Attributes["POSITION"]].Count)
+		assert.Equal(t, []float64{-1, -1, 0}, doc.Accessors[red.Attributes["POSITION"]].Min)
+		assert.Equal(t, []float64{1, 1, 0}, doc.Accessors[red.Attributes["POSITION"]].Max)
+		assert.Equal(t, 4, doc.Accessors[red.Attributes["NORMAL"]].Count)
+		assert.Equal(t, 6, doc.Accessors[*red.Indices].Count)
+		assert.Equal(t, 3, doc.Accessors[*blue.Indices].Count)
+
+		// Check index data of the blue triangle
+		view := doc.BufferViews[*doc.Accessors[*blue.Indices].BufferView]
+		indices := make([]uint16, 3)
+		binary.Read(bytes.NewReader(bin[view.ByteOffset:view.ByteOffset+view.ByteLength]), binary.LittleEndian, indices)
+		assert.Equal(t, []uint16{0, 2, 3}, indices)
+	}
+}
+
+func TestGLBWriter_Write_TexCoords_FlipsV(t *testing.T) {
+	// Arrange
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0.25\nvt 0 1\nf 1/1 2/2 3/3\n"
+	reader := WavefrontObjReader{}
+	assert.NoError(t, reader.Read(strings.NewReader(obj)))
+	writer := GLBWriter{}
+	writer.AddNode("textured", &reader, nil)
+	buffer := bytes.Buffer{}
+
+	// Act
+	err := writer.Write(&buffer)
+
+	// Assert
+	assert.NoError(t, err)
+	doc, bin := readGLB(t, buffer.Bytes())
+	primitive := doc.Meshes[0].Primitives[0]
+	_, hasNormals := primitive.Attributes["NORMAL"]
+	assert.False(t, hasNormals)
+	view := doc.BufferViews[*doc.Accessors[primitive.Attributes["TEXCOORD_0"]].BufferView]
+	texCoords := make([]float32, 6)
+	binary.Read(bytes.NewReader(bin[view.ByteOffset:view.ByteOffset+view.ByteLength]), binary.LittleEndian, texCoords)
+	assert.Equal(t, []float32{0, 1, 1, 0.75, 0, 0}, texCoords)
+}
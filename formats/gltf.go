@@ -0,0 +1,106 @@
+package formats
+
+// The types below map directly to the parts of the glTF 2.0 JSON schema
+// used by RenderDB. See https://github.com/KhronosGroup/glTF/tree/master/specification/2.0.
+
+const (
+	glbMagic          uint32 = 0x46546C67 // "glTF"
+	glbVersion        uint32 = 2
+	glbChunkTypeJSON  uint32 = 0x4E4F534A // "JSON"
+	glbChunkTypeBIN   uint32 = 0x004E4942 // "BIN\0"
+	glbHeaderLength          = 12
+	glbChunkHeaderLen        = 8
+
+	gltfComponentTypeByte          = 5120
+	gltfComponentTypeUnsignedByte  = 5121
+	gltfComponentTypeShort         = 5122
+	gltfComponentTypeUnsignedShort = 5123
+	gltfComponentTypeUnsignedInt   = 5125
+	gltfComponentTypeFloat         = 5126
+
+	gltfTargetArrayBuffer        = 34962
+	gltfTargetElementArrayBuffer = 34963
+
+	gltfModeTriangles     = 4
+	gltfModeTriangleStrip = 5
+	gltfModeTriangleFan   = 6
+)
+
+type gltfDocument struct {
+	Asset       gltfAsset        `json:"asset"`
+	Scene       *int             `json:"scene,omitempty"`
+	Scenes      []gltfScene      `json:"scenes,omitempty"`
+	Nodes       []gltfNode       `json:"nodes,omitempty"`
+	Meshes      []gltfMesh       `json:"meshes,omitempty"`
+	Materials   []gltfMaterial   `json:"materials,omitempty"`
+	Accessors   []gltfAccessor   `json:"accessors,omitempty"`
+	BufferViews []gltfBufferView `json:"bufferViews,omitempty"`
+	Buffers     []gltfBuffer     `json:"buffers,omitempty"`
+}
+
+type gltfAsset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator,omitempty"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfNode struct {
+	Name        string      `json:"name,omitempty"`
+	Mesh        *int        `json:"mesh,omitempty"`
+	Children    []int       `json:"children,omitempty"`
+	Matrix      []float64   `json:"matrix,omitempty"`
+	Translation []float64   `json:"translation,omitempty"`
+	Rotation    []float64   `json:"rotation,omitempty"`
+	Scale       []float64   `json:"scale,omitempty"`
+	Extras      interface{} `json:"extras,omitempty"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name,omitempty"`
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices,omitempty"`
+	Material   *int           `json:"material,omitempty"`
+	Mode       *int           `json:"mode,omitempty"`
+}
+
+type gltfMaterial struct {
+	Name string `json:"name,omitempty"`
+}
+
+type gltfAccessor struct {
+	BufferView    *int      `json:"bufferView,omitempty"`
+	ByteOffset    int       `json:"byteOffset,omitempty"`
+	ComponentType int       `json:"componentType"`
+	Normalized    bool      `json:"normalized,omitempty"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float64 `json:"min,omitempty"`
+	Max           []float64 `json:"max,omitempty"`
+	// Sparse is only used to detect sparse accessors, which are not supported
+	Sparse interface{} `json:"sparse,omitempty"`
+}
+
+type gltfBufferView struct {
+	Buffer     int  `json:"buffer"`
+	ByteOffset int  `json:"byteOffset,omitempty"`
+	ByteLength int  `json:"byteLength"`
+	ByteStride int  `json:"byteStride,omitempty"`
+	Target     *int `json:"target,omitempty"`
+}
+
+type gltfBuffer struct {
+	ByteLength int    `json:"byteLength"`
+	URI        string `json:"uri,omitempty"`
+}
+
+// intPtr returns a pointer to a copy of v. Used for optional glTF properties.
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,531 @@
+package formats
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// GLTFReader reads glTF 2.0 files, either binary (GLB) or JSON with the
+// buffers embedded as base64 data URIs. Buffers referring to external files
+// and sparse accessors are not supported.
+//
+// Each node with a mesh in the default scene becomes a group named after the
+// node (or the mesh if the node has no name). The world transform of the node
+// is applied to the vertices, and the extras of the node is used as metadata
+// of the group if it's a JSON object. Only primitives with triangles, triangle
+// strips or triangle fans are read; points and lines are ignored. The
+// POSITION, NORMAL and TEXCOORD_0 attributes are read, and materials are
+// referred to by name.
+type GLTFReader struct {
+	objBuffer
+
+	doc     gltfDocument
+	buffers [][]byte
+}
+
+// gltfMatrix is a column-major 4x4 matrix as used by glTF.
+type gltfMatrix [16]float64
+
+var gltfIdentity = gltfMatrix{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+
+func (l *GLTFReader) Read(reader io.Reader) error {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	var bin []byte
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == glbMagic {
+		if data, bin, err = splitGLB(data); err != nil {
+			return err
+		}
+	}
+	if err = json.Unmarshal(data, &l.doc); err != nil {
+		return fmt.Errorf("Invalid glTF JSON (%v)", err)
+	}
+	if !strings.HasPrefix(l.doc.Asset.Version, "2.") {
+		return fmt.Errorf("Unsupported glTF version '%s'", l.doc.Asset.Version)
+	}
+	if err = l.loadBuffers(bin); err != nil {
+		return err
+	}
+
+	roots, err := l.rootNodes()
+	if err != nil {
+		return err
+	}
+	for _, nodeIdx := range roots {
+		if err = l.processNode(nodeIdx, gltfIdentity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitGLB returns the JSON and the binary chunk of a GLB file. The binary
+// chunk is nil if the file doesn't have one.
+func splitGLB(data []byte) ([]byte, []byte, error) {
+	if len(data) < glbHeaderLength+glbChunkHeaderLen {
+		return nil, nil, fmt.Errorf("GLB file is truncated")
+	}
+	if version := binary.LittleEndian.Uint32(data[4:]); version != glbVersion {
+		return nil, nil, fmt.Errorf("Unsupported GLB version %d", version)
+	}
+	if length := binary.LittleEndian.Uint32(data[8:]); int(length) > len(data) {
+		return nil, nil, fmt.Errorf("GLB file is truncated")
+	}
+
+	var jsonChunk, binChunk []byte
+	for offset := glbHeaderLength; offset+glbChunkHeaderLen <= len(data); {
+		chunkLength := int(binary.LittleEndian.Uint32(data[offset:]))
+		chunkType := binary.LittleEndian.Uint32(data[offset+4:])
+		start := offset + glbChunkHeaderLen
+		if chunkLength < 0 || start+chunkLength > len(data) {
+			return nil, nil, fmt.Errorf("GLB chunk is truncated")
+		}
+		switch {
+		case chunkType == glbChunkTypeJSON && jsonChunk == nil:
+			jsonChunk = data[start : start+chunkLength]
+		case chunkType == glbChunkTypeBIN && binChunk == nil:
+			binChunk = data[start : start+chunkLength]
+		}
+		offset = start + chunkLength
+	}
+	if jsonChunk == nil {
+		return nil, nil, fmt.Errorf("GLB file has no JSON chunk")
+	}
+	return jsonChunk, binChunk, nil
+}
+
+func (l *GLTFReader) loadBuffers(bin []byte) error {
+	l.buffers = make([][]byte, len(l.doc.Buffers))
+	for i, b := range l.doc.Buffers {
+		switch {
+		case b.URI == "" && i == 0 && bin != nil:
+			l.buffers[i] = bin
+		case strings.HasPrefix(b.URI, "data:"):
+			commaPos := strings.IndexRune(b.URI, ',')
+			if commaPos == -1 || !strings.HasSuffix(b.URI[:commaPos], ";base64") {
+				return fmt.Errorf("Buffer %d has an unsupported data URI", i)
+			}
+			data, err := base64.StdEncoding.DecodeString(b.URI[commaPos+1:])
+			if err != nil {
+				return fmt.Errorf("Buffer %d has an invalid data URI (%v)", i, err)
+			}
+			l.buffers[i] = data
+		default:
+			return fmt.Errorf("Buffer %d refers to external data, which is not supported", i)
+		}
+		if len(l.buffers[i]) < b.ByteLength {
+			return fmt.Errorf("Buffer %d is shorter than its byteLength", i)
+		}
+	}
+	return nil
+}
+
+// rootNodes returns the nodes of the default scene. If there are no scenes,
+// all nodes that are not children of other nodes are returned. Returns an
+// error if the nodes don't form strict trees, i.e. if a node has more than
+// one parent or a root node is the child of another node.
+func (l *GLTFReader) rootNodes() ([]int, error) {
+	isChild := make([]bool, len(l.doc.Nodes))
+	for i, n := range l.doc.Nodes {
+		for _, c := range n.Children {
+			if c < 0 || c >= len(isChild) {
+				return nil, fmt.Errorf("Node %d: Invalid node index %d", i, c)
+			}
+			if isChild[c] {
+				return nil, fmt.Errorf("Node %d has more than one parent", c)
+			}
+			isChild[c] = true
+		}
+	}
+
+	if len(l.doc.Scenes) > 0 {
+		scene := 0
+		if l.doc.Scene != nil && *l.doc.Scene >= 0 && *l.doc.Scene < len(l.doc.Scenes) {
+			scene = *l.doc.Scene
+		}
+		isRoot := make([]bool, len(l.doc.Nodes))
+		for _, n := range l.doc.Scenes[scene].Nodes {
+			if n < 0 || n >= len(isRoot) {
+				return nil, fmt.Errorf("Invalid node index %d", n)
+			}
+			if isChild[n] || isRoot[n] {
+				return nil, fmt.Errorf("Node %d has more than one parent", n)
+			}
+			isRoot[n] = true
+		}
+		return l.doc.Scenes[scene].Nodes, nil
+	}
+
+	roots := []int{}
+	for i := range l.doc.Nodes {
+		if !isChild[i] {
+			roots = append(roots, i)
+		}
+	}
+	return roots, nil
+}
+
+// processNode adds the meshes of the node and its descendants. The node
+// indices must have been validated by rootNodes, which also guarantees that
+// each node is visited at most once.
+func (l *GLTFReader) processNode(nodeIdx int, parent gltfMatrix) error {
+	node := l.doc.Nodes[nodeIdx]
+	local, err := nodeTransform(node)
+	if err != nil {
+		return fmt.Errorf("Node %d: %v", nodeIdx, err)
+	}
+	world := parent.mul(&local)
+
+	if node.Mesh != nil {
+		if err = l.processMesh(nodeIdx, *node.Mesh, &world); err != nil {
+			return fmt.Errorf("Node %d: %v", nodeIdx, err)
+		}
+	}
+	for _, child := range node.Children {
+		if err = l.processNode(child, world); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *GLTFReader) processMesh(nodeIdx, meshIdx int, transform *gltfMatrix) error {
+	if meshIdx < 0 || meshIdx >= len(l.doc.Meshes) {
+		return fmt.Errorf("Invalid mesh index %d", meshIdx)
+	}
+	node := l.doc.Nodes[nodeIdx]
+	mesh := l.doc.Meshes[meshIdx]
+
+	g := group{name: node.Name, firstFaceIndex: len(l.f)}
+	if g.name == "" {
+		g.name = mesh.Name
+	}
+	if g.name == "" {
+		g.name = fmt.Sprintf("node%d", nodeIdx)
+	}
+	if metadata, ok := node.Extras.(map[string]interface{}); ok {
+		g.metadata = metadata
+	}
+
+	for i, p := range mesh.Primitives {
+		if err := l.processPrimitive(p, transform); err != nil {
+			return fmt.Errorf("Mesh %d, primitive %d: %v", meshIdx, i, err)
+		}
+	}
+	g.faceCount = len(l.f) - g.firstFaceIndex
+	if g.faceCount > 0 {
+		l.g = append(l.g, g)
+	}
+	return nil
+}
+
+func (l *GLTFReader) processPrimitive(p gltfPrimitive, transform *gltfMatrix) error {
+	mode := gltfModeTriangles
+	if p.Mode != nil {
+		mode = *p.Mode
+	}
+	if mode != gltfModeTriangles && mode != gltfModeTriangleStrip && mode != gltfModeTriangleFan {
+		return nil
+	}
+
+	positionIdx, ok := p.Attributes["POSITION"]
+	if !ok {
+		return fmt.Errorf("Primitive has no POSITION attribute")
+	}
+	positions, err := l.readAccessor(positionIdx, "VEC3")
+	if err != nil {
+		return fmt.Errorf("POSITION: %v", err)
+	}
+	var normals, texCoords []float64
+	if idx, ok := p.Attributes["NORMAL"]; ok {
+		if normals, err = l.readAccessor(idx, "VEC3"); err != nil {
+			return fmt.Errorf("NORMAL: %v", err)
+		}
+	}
+	if idx, ok := p.Attributes["TEXCOORD_0"]; ok {
+		if texCoords, err = l.readAccessor(idx, "VEC2"); err != nil {
+			return fmt.Errorf("TEXCOORD_0: %v", err)
+		}
+	}
+	vertexCount := len(positions) / 3
+	if len(normals) != 0 && len(normals) != len(positions) ||
+		len(texCoords) != 0 && len(texCoords)/2 != vertexCount {
+		return fmt.Errorf("Attributes have different counts")
+	}
+
+	var indices []int
+	if p.Indices != nil {
+		values, err := l.readAccessor(*p.Indices, "SCALAR")
+		if err != nil {
+			return fmt.Errorf("Indices: %v", err)
+		}
+		indices = make([]int, len(values))
+		for i, v := range values {
+			if indices[i] = int(v); indices[i] < 0 || indices[i] >= vertexCount {
+				return fmt.Errorf("Index %d is out of range", indices[i])
+			}
+		}
+	} else {
+		indices = make([]int, vertexCount)
+		for i := range indices {
+			indices[i] = i
+		}
+	}
+
+	material := ""
+	if p.Material != nil {
+		if *p.Material < 0 || *p.Material >= len(l.doc.Materials) {
+			return fmt.Errorf("Invalid material index %d", *p.Material)
+		}
+		if material = l.doc.Materials[*p.Material].Name; material == "" {
+			material = fmt.Sprintf("material%d", *p.Material)
+		}
+	}
+
+	// Add vertex attributes
+	firstVertex, firstNormal, firstTexCoord := len(l.v), len(l.vn), len(l.vt)
+	for i := 0; i < vertexCount; i++ {
+		l.v = append(l.v, transform.transformPoint(vec3.T{positions[3*i], positions[3*i+1], positions[3*i+2]}))
+		if normals != nil {
+			l.vn = append(l.vn, transform.transformNormal(vec3.T{normals[3*i], normals[3*i+1], normals[3*i+2]}))
+		}
+		if texCoords != nil {
+			// glTF has origin of texture space in the upper left, OBJ in lower left
+			l.vt = append(l.vt, vec3.T{texCoords[2*i], 1 - texCoords[2*i+1], 0})
+		}
+	}
+
+	// Add faces
+	flip := transform.determinant() < 0
+	corner := func(i int) faceCorner {
+		c := faceCorner{firstVertex + i, -1, -1}
+		if texCoords != nil {
+			c.texCoordIndex = firstTexCoord + i
+		}
+		if normals != nil {
+			c.normalIndex = firstNormal + i
+		}
+		return c
+	}
+	addTriangle := func(a, b, c int) {
+		if a == b || b == c || a == c {
+			return
+		}
+		if flip {
+			// Mirroring transforms reverse the winding order
+			a, b = b, a
+		}
+		l.f = append(l.f, face{[]faceCorner{corner(a), corner(b), corner(c)}, material})
+	}
+	switch mode {
+	case gltfModeTriangles:
+		for i := 0; i+2 < len(indices); i += 3 {
+			addTriangle(indices[i], indices[i+1], indices[i+2])
+		}
+	case gltfModeTriangleStrip:
+		for i := 0; i+2 < len(indices); i++ {
+			if i%2 == 0 {
+				addTriangle(indices[i], indices[i+1], indices[i+2])
+			} else {
+				addTriangle(indices[i+1], indices[i], indices[i+2])
+			}
+		}
+	case gltfModeTriangleFan:
+		for i := 1; i+1 < len(indices); i++ {
+			addTriangle(indices[0], indices[i], indices[i+1])
+		}
+	}
+	return nil
+}
+
+// maxGLTFZeroAccessorCount is the maximum number of elements in accessors
+// without a buffer view, which are all zeros and not bounded by the size of
+// the file.
+const maxGLTFZeroAccessorCount = 1 << 20
+
+// readAccessor returns the elements of the accessor as a flat slice of
+// floats. Normalized integer components are converted to [0, 1] or [-1, 1].
+func (l *GLTFReader) readAccessor(accessorIdx int, accessorType string) ([]float64, error) {
+	if accessorIdx < 0 || accessorIdx >= len(l.doc.Accessors) {
+		return nil, fmt.Errorf("Invalid accessor index %d", accessorIdx)
+	}
+	a := l.doc.Accessors[accessorIdx]
+	if a.Type != accessorType {
+		return nil, fmt.Errorf("Expected accessor of type %s, but got %s", accessorType, a.Type)
+	}
+	if a.Sparse != nil {
+		return nil, fmt.Errorf("Sparse accessors are not supported")
+	}
+	components := map[string]int{"SCALAR": 1, "VEC2": 2, "VEC3": 3}[a.Type]
+	componentSize := map[int]int{
+		gltfComponentTypeByte:          1,
+		gltfComponentTypeUnsignedByte:  1,
+		gltfComponentTypeShort:         2,
+		gltfComponentTypeUnsignedShort: 2,
+		gltfComponentTypeUnsignedInt:   4,
+		gltfComponentTypeFloat:         4,
+	}[a.ComponentType]
+	if componentSize == 0 {
+		return nil, fmt.Errorf("Unsupported component type %d", a.ComponentType)
+	}
+
+	elementSize := components * componentSize
+	if a.Count < 0 || a.ByteOffset < 0 {
+		return nil, fmt.Errorf("Accessor %d has a negative count or byteOffset", accessorIdx)
+	}
+	if a.BufferView == nil {
+		// All zeros
+		if a.Count > maxGLTFZeroAccessorCount {
+			return nil, fmt.Errorf("Accessor %d without buffer view has too many elements", accessorIdx)
+		}
+		return make([]float64, a.Count*components), nil
+	}
+	if *a.BufferView < 0 || *a.BufferView >= len(l.doc.BufferViews) {
+		return nil, fmt.Errorf("Invalid buffer view index %d", *a.BufferView)
+	}
+	view := l.doc.BufferViews[*a.BufferView]
+	if view.Buffer < 0 || view.Buffer >= len(l.buffers) || view.ByteOffset < 0 || view.ByteLength < 0 ||
+		view.ByteLength > len(l.buffers[view.Buffer])-view.ByteOffset {
+		return nil, fmt.Errorf("Buffer view %d is out of range", *a.BufferView)
+	}
+	data := l.buffers[view.Buffer][view.ByteOffset : view.ByteOffset+view.ByteLength]
+	stride := view.ByteStride
+	if stride == 0 {
+		stride = elementSize
+	} else if stride < elementSize {
+		return nil, fmt.Errorf("Buffer view %d has a byteStride smaller than the elements of accessor %d", *a.BufferView, accessorIdx)
+	}
+	// Written to avoid overflow for huge counts and offsets
+	if a.Count > 0 && (a.ByteOffset > len(data)-elementSize ||
+		a.Count-1 > (len(data)-elementSize-a.ByteOffset)/stride) {
+		return nil, fmt.Errorf("Accessor %d is out of range of its buffer view", accessorIdx)
+	}
+
+	values := make([]float64, a.Count*components)
+	for i := 0; i < a.Count; i++ {
+		for c := 0; c < components; c++ {
+			offset := a.ByteOffset + i*stride + c*componentSize
+			values[i*components+c] = readComponent(data[offset:], a.ComponentType, a.Normalized)
+		}
+	}
+	return values, nil
+}
+
+func readComponent(data []byte, componentType int, normalized bool) float64 {
+	var value, max float64
+	switch componentType {
+	case gltfComponentTypeByte:
+		value, max = float64(int8(data[0])), math.MaxInt8
+	case gltfComponentTypeUnsignedByte:
+		value, max = float64(data[0]), math.MaxUint8
+	case gltfComponentTypeShort:
+		value, max = float64(int16(binary.LittleEndian.Uint16(data))), math.MaxInt16
+	case gltfComponentTypeUnsignedShort:
+		value, max = float64(binary.LittleEndian.Uint16(data)), math.MaxUint16
+	case gltfComponentTypeUnsignedInt:
+		value, max = float64(binary.LittleEndian.Uint32(data)), math.MaxUint32
+	case gltfComponentTypeFloat:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data)))
+	}
+	if normalized {
+		return math.Max(value/max, -1)
+	}
+	return value
+}
+
+// nodeTransform returns the local transform of the node given either by
+// the matrix or by the translation, rotation and scale of the node.
+func nodeTransform(n gltfNode) (gltfMatrix, error) {
+	if n.Matrix != nil {
+		m := gltfMatrix{}
+		if len(n.Matrix) != len(m) {
+			return m, fmt.Errorf("Expected matrix with 16 elements, but got %d", len(n.Matrix))
+		}
+		copy(m[:], n.Matrix)
+		return m, nil
+	}
+
+	t, r, s := []float64{0, 0, 0}, []float64{0, 0, 0, 1}, []float64{1, 1, 1}
+	if n.Translation != nil {
+		t = n.Translation
+	}
+	if n.Rotation != nil {
+		r = n.Rotation
+	}
+	if n.Scale != nil {
+		s = n.Scale
+	}
+	if len(t) != 3 || len(r) != 4 || len(s) != 3 {
+		return gltfMatrix{}, fmt.Errorf("Invalid translation, rotation or scale")
+	}
+
+	x, y, z, w := r[0], r[1], r[2], r[3]
+	return gltfMatrix{
+		(1 - 2*(y*y+z*z)) * s[0], 2 * (x*y + z*w) * s[0], 2 * (x*z - y*w) * s[0], 0,
+		2 * (x*y - z*w) * s[1], (1 - 2*(x*x+z*z)) * s[1], 2 * (y*z + x*w) * s[1], 0,
+		2 * (x*z + y*w) * s[2], 2 * (y*z - x*w) * s[2], (1 - 2*(x*x+y*y)) * s[2], 0,
+		t[0], t[1], t[2], 1,
+	}, nil
+}
+
+// mul returns the product m*other.
+func (m *gltfMatrix) mul(other *gltfMatrix) gltfMatrix {
+	result := gltfMatrix{}
+	for col := 0; col < 4; col++ {
+		for row := 0; row < 4; row++ {
+			for k := 0; k < 4; k++ {
+				result[col*4+row] += m[k*4+row] * other[col*4+k]
+			}
+		}
+	}
+	return result
+}
+
+func (m *gltfMatrix) transformPoint(p vec3.T) vec3.T {
+	return vec3.T{
+		m[0]*p[0] + m[4]*p[1] + m[8]*p[2] + m[12],
+		m[1]*p[0] + m[5]*p[1] + m[9]*p[2] + m[13],
+		m[2]*p[0] + m[6]*p[1] + m[10]*p[2] + m[14],
+	}
+}
+
+// column returns column i of the upper 3x3 part of the matrix.
+func (m *gltfMatrix) column(i int) vec3.T {
+	return vec3.T{m[i*4], m[i*4+1], m[i*4+2]}
+}
+
+func (m *gltfMatrix) determinant() float64 {
+	c0, c1, c2 := m.column(0), m.column(1), m.column(2)
+	cross := vec3.Cross(&c1, &c2)
+	return vec3.Dot(&c0, &cross)
+}
+
+// transformNormal transforms the normal by the inverse transpose of the
+// upper 3x3 part of the matrix, which has the columns c1 x c2, c2 x c0 and
+// c0 x c1 divided by the determinant.
+func (m *gltfMatrix) transformNormal(n vec3.T) vec3.T {
+	c0, c1, c2 := m.column(0), m.column(1), m.column(2)
+	a, b, c := vec3.Cross(&c1, &c2), vec3.Cross(&c2, &c0), vec3.Cross(&c0, &c1)
+	a.Scale(n[0])
+	b.Scale(n[1])
+	c.Scale(n[2])
+	result := vec3.Add(&a, &b)
+	result.Add(&c)
+	if m.determinant() < 0 {
+		result.Scale(-1)
+	}
+	if result.Length() == 0 {
+		return result
+	}
+	return *result.Normalize()
+}
@@ -0,0 +1,151 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// createEmbeddedGLTF creates a glTF JSON document with a single triangle
+// mesh embedded as a data URI. nodes is the JSON of the nodes-array.
+func createEmbeddedGLTF(nodes string) string {
+	bin := bytes.Buffer{}
+	binary.Write(&bin, binary.LittleEndian, []float32{0, 0, 0, 1, 0, 0, 0, 1, 0})
+	binary.Write(&bin, binary.LittleEndian, []uint16{0, 1, 2, 0})
+	return fmt.Sprintf(`{
+		"asset": {"version": "2.0"},
+		"scene": 0,
+		"scenes": [{"nodes": [0]}],
+		"nodes": %s,
+		"meshes": [{"name": "triangle", "primitives": [{"attributes": {"POSITION": 0}, "indices": 1}]}],
+		"accessors": [
+			{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+			{"bufferView": 1, "componentType": 5123, "count": 3, "type": "SCALAR"}
+		],
+		"bufferViews": [
+			{"buffer": 0, "byteOffset": 0, "byteLength": 36},
+			{"buffer": 0, "byteOffset": 36, "byteLength": 6}
+		],
+		"buffers": [{"byteLength": 44, "uri": "data:application/octet-stream;base64,%s"}]
+	}`, nodes, base64.StdEncoding.EncodeToString(bin.Bytes()))
+}
+
+func TestGLTFReader_Read_GLBFromWriter_ReturnsSameGeometry(t *testing.T) {
+	// Arrange
+	obj := "v 10 10 0\nv 12 10 0\nv 12 12 0\nvt 0 0\nvt 1 0\nvt 1 1\nvn 0 0 1\n" +
+		"g first\nusemtl red\nf 1/1/1 2/2/1 3/3/1\n"
+	objReader := WavefrontObjReader{}
+	assert.NoError(t, objReader.Read(strings.NewReader(obj)))
+	writer := GLBWriter{}
+	writer.AddNode("first", &objReader, map[string]interface{}{"system": "HVAC"})
+	glb := bytes.Buffer{}
+	assert.NoError(t, writer.Write(&glb))
+	reader := GLTFReader{}
+
+	// Act
+	err := reader.Read(&glb)
+
+	// Assert
+	assert.NoError(t, err)
+	groups := readGroups(&reader)
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, "first", groups[0].Name())
+		assert.Equal(t, vec3.Box{Min: vec3.T{10, 10, 0}, Max: vec3.T{12, 12, 0}}, groups[0].BoundingBox())
+		assert.Equal(t, map[string]interface{}{"system": "HVAC"}, groups[0].Metadata())
+		assert.Equal(t, 1, groups[0].TriangleCount())
+		assert.True(t, groups[0].RayIntersects(&vec3.T{11.5, 10.5, 1}, &vec3.T{0, 0, -1}))
+
+		buffer := bytes.Buffer{}
+		assert.NoError(t, groups[0].Write(&buffer))
+		assert.Contains(t, buffer.String(), "vt 1 1\n")
+		assert.Contains(t, buffer.String(), "vn 0 0 1\n")
+		assert.Contains(t, buffer.String(), "f 1/1/1 2/2/2 3/3/3\n") // glTF has one normal per vertex
+	}
+	assert.Equal(t, []face{face{[]faceCorner{{0, 0, 0}, {1, 1, 1}, {2, 2, 2}}, "red"}}, reader.f)
+}
+
+func TestGLTFReader_Read_NodeHierarchy_AppliesWorldTransform(t *testing.T) {
+	// Arrange: parent translates by (10, 0, 0), child rotates 90 degrees around z
+	nodes := `[
+		{"name": "parent", "translation": [10, 0, 0], "children": [1]},
+		{"name": "child", "mesh": 0, "rotation": [0, 0, 0.7071067811865476, 0.7071067811865476]}
+	]`
+	reader := GLTFReader{}
+
+	// Act
+	err := reader.Read(strings.NewReader(createEmbeddedGLTF(nodes)))
+
+	// Assert
+	assert.NoError(t, err)
+	groups := readGroups(&reader)
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, "child", groups[0].Name())
+	}
+	expected := []vec3.T{{10, 0, 0}, {10, 1, 0}, {9, 0, 0}}
+	for i := range expected {
+		assert.InDelta(t, 0, vec3.Distance(&expected[i], &reader.v[i]), 1e-9)
+	}
+}
+
+func TestGLTFReader_Read_MirroredNode_FlipsWindingOrder(t *testing.T) {
+	// Arrange
+	reader := GLTFReader{}
+
+	// Act
+	err := reader.Read(strings.NewReader(createEmbeddedGLTF(`[{"mesh": 0, "scale": [-1, 1, 1]}]`)))
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.Len(t, readGroups(&reader), 1) {
+		assert.Equal(t, "triangle", reader.g[0].name)
+	}
+	assert.Equal(t, []faceCorner{{1, -1, -1}, {0, -1, -1}, {2, -1, -1}}, reader.f[0].corners)
+}
+
+func TestGLTFReader_Read_InvalidFiles_ReturnsError(t *testing.T) {
+	assert.Error(t, (&GLTFReader{}).Read(strings.NewReader("not json")))
+	assert.Error(t, (&GLTFReader{}).Read(strings.NewReader(`{"asset": {"version": "1.0"}}`)))
+	assert.Error(t, (&GLTFReader{}).Read(strings.NewReader(`{"asset": {"version": "2.0"}, "buffers": [{"byteLength": 4, "uri": "mesh.bin"}]}`)))
+	assert.Error(t, (&GLTFReader{}).Read(strings.NewReader("glTF\x02\x00\x00\x00")))
+	assert.Error(t, (&GLTFReader{}).Read(strings.NewReader(createEmbeddedGLTF(`[{"mesh": 1}]`))))
+	assert.Error(t, (&GLTFReader{}).Read(strings.NewReader(createEmbeddedGLTF(`[{"mesh": 0, "children": [0]}]`))))
+}
+
+func TestGLTFReader_Read_InvalidAccessors_ReturnsError(t *testing.T) {
+	replacements := [][2]string{
+		{`"count": 3, "type": "VEC3"`, `"count": -1, "type": "VEC3"`},
+		{`"bufferView": 0, "componentType": 5126, "count": 3`, `"componentType": 5126, "count": 1000000000000`},
+		{`"bufferView": 0, "componentType": 5126, "count": 3`, `"bufferView": 0, "byteOffset": -12, "componentType": 5126, "count": 3`},
+		{`"bufferView": 0, "componentType": 5126, "count": 3`, `"bufferView": 0, "componentType": 5126, "count": 4611686018427387904`},
+		{`"byteOffset": 0, "byteLength": 36`, `"byteOffset": -36, "byteLength": 36`},
+		{`"byteOffset": 0, "byteLength": 36`, `"byteOffset": 0, "byteLength": 36, "byteStride": 4`},
+	}
+	for _, r := range replacements {
+		gltf := strings.Replace(createEmbeddedGLTF(`[{"mesh": 0}]`), r[0], r[1], 1)
+		assert.Error(t, (&GLTFReader{}).Read(strings.NewReader(gltf)), r[1])
+	}
+}
+
+func TestGLTFReader_Read_NodeWithMultipleParents_ReturnsError(t *testing.T) {
+	// Arrange: each node lists the next node twice, which would otherwise
+	// visit the last node 2^n times
+	nodes := `[
+		{"children": [1, 1]},
+		{"children": [2, 2]},
+		{"mesh": 0}
+	]`
+
+	// Act
+	err := (&GLTFReader{}).Read(strings.NewReader(createEmbeddedGLTF(nodes)))
+
+	// Assert
+	assert.Error(t, err)
+	assert.Error(t, (&GLTFReader{}).Read(strings.NewReader(
+		strings.Replace(createEmbeddedGLTF(`[{"mesh": 0}]`), `"nodes": [0]`, `"nodes": [0, 0]`, 1))))
+}
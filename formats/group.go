@@ -1,12 +1,12 @@
 package formats
 
-import "github.com/larsmoa/renderdb/utils"
-
 // group represents a named set of facesets.
 type group struct {
 	name           string
 	firstFaceIndex int
 	faceCount      int
+	// metadata is nil unless set by a metadata directive
+	metadata map[string]interface{}
 }
 
 func (g *group) buildBuffers(parentBuffer *objBuffer) *objBuffer {
@@ -19,11 +19,12 @@ func (g *group) buildBuffers(parentBuffer *objBuffer) *objBuffer {
 		},
 	}
 
-	// Map from original vertex buffers to new
-	vertexMapping := make([]int, len(parentBuffer.v))
-	utils.FillIntSlice(vertexMapping, -1)
-	normalMapping := make([]int, len(parentBuffer.vn))
-	utils.FillIntSlice(normalMapping, -1)
+	// Map from original vertex buffers to new. Maps are used rather than
+	// slices as long as the parent buffers, so that the cost of building a
+	// group depends on the size of the group only.
+	vertexMapping := make(map[int]int)
+	texCoordMapping := make(map[int]int)
+	normalMapping := make(map[int]int)
 
 	for i := g.firstFaceIndex; i < g.firstFaceIndex+g.faceCount; i++ {
 
@@ -36,25 +37,40 @@ func (g *group) buildBuffers(parentBuffer *objBuffer) *objBuffer {
 		for j, origCorner := range originalFace.corners {
 			// Create new 'corners' and map indices
 			origVertIdx := origCorner.vertexIndex
+			origTexIdx := origCorner.texCoordIndex
 			origNormIdx := origCorner.normalIndex
 
 			// Lookup or add new vertex
-			var newVertIdx int
-			if newVertIdx = vertexMapping[origVertIdx]; newVertIdx == -1 {
+			newVertIdx, ok := vertexMapping[origVertIdx]
+			if !ok {
 				newVertIdx = len(buffer.v)
 				buffer.v = append(buffer.v, parentBuffer.v[origVertIdx])
+				if len(parentBuffer.vc) > 0 {
+					buffer.vc = append(buffer.vc, parentBuffer.vc[origVertIdx])
+				}
 				vertexMapping[origVertIdx] = newVertIdx
 			}
-			// Lookup or add new normal
-			var newNormIdx int
-			if newNormIdx = normalMapping[origNormIdx]; newNormIdx == -1 {
-				newNormIdx = len(buffer.vn)
-				buffer.vn = append(buffer.vn, parentBuffer.vn[origNormIdx])
-				normalMapping[origNormIdx] = newNormIdx
+			// Lookup or add new texture coordinate (if any)
+			newTexIdx := -1
+			if origTexIdx != -1 {
+				if newTexIdx, ok = texCoordMapping[origTexIdx]; !ok {
+					newTexIdx = len(buffer.vt)
+					buffer.vt = append(buffer.vt, parentBuffer.vt[origTexIdx])
+					texCoordMapping[origTexIdx] = newTexIdx
+				}
+			}
+			// Lookup or add new normal (if any)
+			newNormIdx := -1
+			if origNormIdx != -1 {
+				if newNormIdx, ok = normalMapping[origNormIdx]; !ok {
+					newNormIdx = len(buffer.vn)
+					buffer.vn = append(buffer.vn, parentBuffer.vn[origNormIdx])
+					normalMapping[origNormIdx] = newNormIdx
+				}
 			}
 
 			// Add face corner
-			f.corners[j].vertexIndex, f.corners[j].normalIndex = newVertIdx, newNormIdx
+			f.corners[j] = faceCorner{newVertIdx, newTexIdx, newNormIdx}
 		}
 
 		buffer.f = append(buffer.f, f)
@@ -12,6 +12,7 @@ func createFace(material string, cornerIdx ...int) face {
 	f.corners = make([]faceCorner, len(cornerIdx))
 	for i := 0; i < len(cornerIdx); i++ {
 		f.corners[i].vertexIndex = cornerIdx[i]
+		f.corners[i].texCoordIndex = -1
 		f.corners[i].normalIndex = cornerIdx[i]
 	}
 	f.material = material
@@ -181,5 +182,28 @@ func TestGroup_BuildFormats_GroupWithTwoFacesets_ReturnsCorrectSubset(t *testing
 		createFace("Material 3", 0, 1, 2), // Remapped indices
 		createFace("Material 3", 1, 0, 3), // Remapped indices
 	}, buffer.f)
-	assert.EqualValues(t, []group{group{"Group 2", 0, 2}}, buffer.g)
+	assert.EqualValues(t, []group{group{name: "Group 2", firstFaceIndex: 0, faceCount: 2}}, buffer.g)
+}
+
+func TestGroup_BuildFormats_FaceWithoutNormals_ReturnsNoNormals(t *testing.T) {
+	// Arrange
+	g := group{firstFaceIndex: 0, faceCount: 1}
+	origBuffer := objBuffer{}
+	origBuffer.g = []group{g}
+	origBuffer.f = []face{
+		face{corners: []faceCorner{{0, -1, -1}, {1, -1, -1}, {2, -1, -1}}},
+	}
+	origBuffer.v = []vec3.T{
+		vec3.T{0, 0, 0},
+		vec3.T{1, 1, 1},
+		vec3.T{2, 2, 2},
+	}
+
+	// Act
+	buffer := g.buildBuffers(&origBuffer)
+
+	// Assert
+	assert.Equal(t, 3, len(buffer.v))
+	assert.Equal(t, 0, len(buffer.vn))
+	assert.Equal(t, -1, buffer.f[0].corners[0].normalIndex)
 }
@@ -1,6 +1,7 @@
 package formats
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/ungerik/go3d/float64/vec3"
@@ -9,6 +10,66 @@ import (
 type GeometryGroup interface {
 	Name() string
 	BoundingBox() vec3.Box
+	// Metadata returns the metadata attached to the group, or nil
+	// if there is no metadata.
+	Metadata() map[string]interface{}
+	// Write writes the geometry as Wavefront OBJ (GeometryFormatOBJ).
 	Write(w io.Writer) error
+	// WriteBinaryMesh writes the geometry in the binary mesh encoding
+	// (GeometryFormatBinaryMesh), see BinaryMeshReader.
+	WriteBinaryMesh(w io.Writer, options BinaryMeshOptions) error
+	// TriangleCount returns the number of triangles in the geometry. Polygons
+	// with n corners count as n-2 triangles.
+	TriangleCount() int
+	// Simplify returns a simplified version of the geometry where details
+	// smaller than cellSize are removed. Normals are discarded.
+	Simplify(cellSize float64) GeometryGroup
 	RayIntersects(start *vec3.T, direction *vec3.T) bool
+	// RayIntersection returns the distance to the nearest intersection between
+	// the ray and the geometry, measured in units of the length of direction.
+	// The second return value is false if the ray doesn't intersect the geometry.
+	RayIntersection(start *vec3.T, direction *vec3.T) (float64, bool)
+}
+
+// GeometryReader is implemented by the readers in this package, and gives
+// access to all the geometry read regardless of the format read.
+type GeometryReader interface {
+	Read(r io.Reader) error
+	// Groups returns a buffered channel with one element for each group read.
+	Groups() <-chan GeometryGroup
+	// Write writes all geometry read as Wavefront OBJ.
+	Write(w io.Writer) error
+	// RayIntersection returns the distance to the nearest intersection between
+	// the ray and the geometry, measured in units of the length of direction.
+	// The second return value is false if the ray doesn't intersect the geometry.
+	RayIntersection(start *vec3.T, direction *vec3.T) (float64, bool)
+
+	buffer() *objBuffer
+}
+
+// The names of geometry formats that can be read, but are not used to
+// store the geometry of objects.
+const (
+	GeometryFormatGLTF = "gltf"
+	GeometryFormatSTL  = "stl"
+	GeometryFormatPLY  = "ply"
+)
+
+// NewGeometryReader returns a reader for geometry stored in the given
+// format, e.g. GeometryFormatOBJ or GeometryFormatBinaryMesh. An empty format
+// is read as OBJ, which was used before the format was recorded.
+func NewGeometryReader(format string) (GeometryReader, error) {
+	switch format {
+	case "", GeometryFormatOBJ:
+		return &WavefrontObjReader{}, nil
+	case GeometryFormatBinaryMesh:
+		return &BinaryMeshReader{}, nil
+	case GeometryFormatGLTF:
+		return &GLTFReader{}, nil
+	case GeometryFormatSTL:
+		return &STLReader{}, nil
+	case GeometryFormatPLY:
+		return &PLYReader{}, nil
+	}
+	return nil, fmt.Errorf("Unknown geometry format '%s'", format)
 }
@@ -0,0 +1,474 @@
+package formats
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// DefaultMaxPointsPerGroup is the maximum number of points in each group
+// produced by PLYReader when PLYReadOptions.MaxPointsPerGroup is not set.
+const DefaultMaxPointsPerGroup = 100000
+
+// PLYReadOptions represents options used by PLYReader.Read.
+type PLYReadOptions struct {
+	// MaxPointsPerGroup is the maximum number of points in each group when
+	// reading point clouds. Larger point clouds are split spatially. Defaults
+	// to DefaultMaxPointsPerGroup when zero.
+	MaxPointsPerGroup int
+}
+
+// PLYReader reads Polygon File Format (PLY) files, both ASCII and binary
+// little endian. The reader supports the following properties of the
+// 'vertex'-element:
+// - x, y, z
+// - nx, ny, nz
+// - red, green, blue
+// and the 'vertex_indices' (or 'vertex_index') list property of the
+// 'face'-element. Other elements and properties are ignored.
+//
+// Files with faces produce a single group named 'mesh'. Files without faces
+// are read as point clouds. The points are split spatially into groups of at
+// most MaxPointsPerGroup points, named 'points', or 'points_0', 'points_1',
+// etc. when split, so each group covers a compact part of the point cloud.
+type PLYReader struct {
+	objBuffer
+
+	options PLYReadOptions
+}
+
+// plyProperty is a property of an element declared in the PLY header.
+// countType is empty unless the property is a list.
+type plyProperty struct {
+	name      string
+	valueType string
+	countType string
+}
+
+// plyElement is an element declared in the PLY header.
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+// plyValueReader reads single values from the body of a PLY file.
+type plyValueReader interface {
+	readValue(valueType string) (float64, error)
+}
+
+// SetOptions sets the read options that alters the behavior of
+// Read. Defaults to the default PLYReadOptions{} struct.
+func (l *PLYReader) SetOptions(options PLYReadOptions) {
+	l.options = options
+}
+
+func (l *PLYReader) Read(reader io.Reader) error {
+	br := bufio.NewReader(reader)
+	format, elements, err := readPLYHeader(br)
+	if err != nil {
+		return err
+	}
+
+	var values plyValueReader
+	switch format {
+	case "ascii":
+		scanner := bufio.NewScanner(br)
+		scanner.Split(bufio.ScanWords)
+		values = &plyASCIIReader{scanner}
+	case "binary_little_endian":
+		values = &plyBinaryReader{reader: br}
+	default:
+		return fmt.Errorf("PLY format '%s' is not supported", format)
+	}
+
+	hasFaces := false
+	for _, e := range elements {
+		switch e.name {
+		case "vertex":
+			err = l.readVertices(values, e)
+		case "face":
+			hasFaces = e.count > 0
+			err = l.readFaces(values, e)
+		default:
+			err = skipPLYElement(values, e)
+		}
+		if err != nil {
+			return fmt.Errorf("Could not read element '%s' (reason: %v)", e.name, err)
+		}
+	}
+
+	if hasFaces {
+		l.g = append(l.g, group{name: "mesh", faceCount: len(l.f)})
+	} else {
+		l.addPointGroups()
+	}
+	return nil
+}
+
+func readPLYHeader(reader *bufio.Reader) (string, []plyElement, error) {
+	format := ""
+	var elements []plyElement
+	for i := 1; ; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", nil, fmt.Errorf("Could not read PLY header (reason: %v)", err)
+		}
+		line = strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		if i == 1 {
+			if line != "ply" {
+				return "", nil, fmt.Errorf("File is not a PLY file")
+			}
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "format":
+			if len(fields) != 3 || fields[2] != "1.0" {
+				err = fmt.Errorf("Expected 'format <format> 1.0'")
+			} else {
+				format = fields[1]
+			}
+		case "element":
+			var count int
+			if len(fields) != 3 {
+				err = fmt.Errorf("Expected 'element <name> <count>'")
+			} else if count, err = strconv.Atoi(fields[2]); err == nil && count < 0 {
+				err = fmt.Errorf("Element count must be positive")
+			}
+			if err == nil {
+				elements = append(elements, plyElement{name: fields[1], count: count})
+			}
+		case "property":
+			var p plyProperty
+			switch {
+			case len(elements) == 0:
+				err = fmt.Errorf("Property declared before any element")
+			case len(fields) == 3:
+				p = plyProperty{name: fields[2], valueType: fields[1]}
+			case len(fields) == 5 && fields[1] == "list":
+				p = plyProperty{name: fields[4], valueType: fields[3], countType: fields[2]}
+			default:
+				err = fmt.Errorf("Expected 'property <type> <name>' or 'property list <type> <type> <name>'")
+			}
+			if err == nil {
+				if err = verifyPLYType(p.valueType); err == nil && p.countType != "" {
+					err = verifyPLYType(p.countType)
+				}
+			}
+			if err == nil {
+				e := &elements[len(elements)-1]
+				e.properties = append(e.properties, p)
+			}
+		case "end_header":
+			if format == "" {
+				return "", nil, fmt.Errorf("PLY header has no format")
+			}
+			return format, elements, nil
+		case "comment", "obj_info":
+			break
+		default:
+			err = fmt.Errorf("Unknown keyword '%s'", fields[0])
+		}
+		if err != nil {
+			return "", nil, lineError{i, line, err}
+		}
+	}
+}
+
+// plyTypeSizes maps from PLY type names to the size of the type in bytes.
+var plyTypeSizes = map[string]int{
+	"char": 1, "int8": 1, "uchar": 1, "uint8": 1,
+	"short": 2, "int16": 2, "ushort": 2, "uint16": 2,
+	"int": 4, "int32": 4, "uint": 4, "uint32": 4,
+	"float": 4, "float32": 4, "double": 8, "float64": 8,
+}
+
+func verifyPLYType(valueType string) error {
+	if _, ok := plyTypeSizes[valueType]; !ok {
+		return fmt.Errorf("Unknown type '%s'", valueType)
+	}
+	return nil
+}
+
+// maxPLYListLength is the maximum number of values in a list property.
+const maxPLYListLength = 1 << 16
+
+// readPLYList reads a list property and returns the values of it.
+func readPLYList(values plyValueReader, p plyProperty) ([]float64, error) {
+	count, err := values.readValue(p.countType)
+	if err != nil {
+		return nil, err
+	}
+	if count != math.Floor(count) || count < 0 || count > maxPLYListLength {
+		return nil, fmt.Errorf("Invalid list length %v", count)
+	}
+	var list []float64
+	for i := 0; i < int(count); i++ {
+		v, err := values.readValue(p.valueType)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// readPLYElement reads one instance of an element. Scalar properties are
+// returned in scalars and list properties in lists, both keyed by name.
+func readPLYElement(values plyValueReader, e plyElement,
+	scalars map[string]float64, lists map[string][]float64) error {
+
+	for _, p := range e.properties {
+		var err error
+		if p.countType != "" {
+			lists[p.name], err = readPLYList(values, p)
+		} else {
+			scalars[p.name], err = values.readValue(p.valueType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func skipPLYElement(values plyValueReader, e plyElement) error {
+	scalars := make(map[string]float64)
+	lists := make(map[string][]float64)
+	for i := 0; i < e.count; i++ {
+		if err := readPLYElement(values, e, scalars, lists); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plyColorScale returns the value that colours of the given type must be
+// divided by to be in [0, 1].
+func plyColorScale(valueType string) float64 {
+	switch valueType {
+	case "uchar", "uint8":
+		return math.MaxUint8
+	case "ushort", "uint16":
+		return math.MaxUint16
+	case "uint", "uint32":
+		return math.MaxUint32
+	}
+	return 1
+}
+
+func (l *PLYReader) readVertices(values plyValueReader, e plyElement) error {
+	types := make(map[string]string)
+	for _, p := range e.properties {
+		if p.countType == "" {
+			types[p.name] = p.valueType
+		}
+	}
+	hasProperties := func(names ...string) bool {
+		for _, name := range names {
+			if _, ok := types[name]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+	if !hasProperties("x", "y", "z") {
+		return fmt.Errorf("Vertices must have x, y and z properties")
+	}
+	hasNormals := hasProperties("nx", "ny", "nz")
+	hasColors := hasProperties("red", "green", "blue")
+
+	scalars := make(map[string]float64)
+	lists := make(map[string][]float64)
+	for i := 0; i < e.count; i++ {
+		if err := readPLYElement(values, e, scalars, lists); err != nil {
+			return fmt.Errorf("Vertex #%d: %v", i+1, err)
+		}
+		l.v = append(l.v, vec3.T{scalars["x"], scalars["y"], scalars["z"]})
+		if hasNormals {
+			l.vn = append(l.vn, vec3.T{scalars["nx"], scalars["ny"], scalars["nz"]})
+		}
+		if hasColors {
+			l.vc = append(l.vc, vec3.T{
+				scalars["red"] / plyColorScale(types["red"]),
+				scalars["green"] / plyColorScale(types["green"]),
+				scalars["blue"] / plyColorScale(types["blue"]),
+			})
+		}
+	}
+	return nil
+}
+
+// vertexCorner returns the corner of vertex i, which has the normal of the
+// vertex if the vertices have normals.
+func (l *PLYReader) vertexCorner(i int) faceCorner {
+	if len(l.vn) > 0 {
+		return faceCorner{i, -1, i}
+	}
+	return faceCorner{i, -1, -1}
+}
+
+func (l *PLYReader) readFaces(values plyValueReader, e plyElement) error {
+	indicesName := ""
+	for _, p := range e.properties {
+		if p.countType != "" && (p.name == "vertex_indices" || p.name == "vertex_index") {
+			indicesName = p.name
+		}
+	}
+	if indicesName == "" {
+		return fmt.Errorf("Faces must have a 'vertex_indices' list property")
+	}
+
+	scalars := make(map[string]float64)
+	lists := make(map[string][]float64)
+	for i := 0; i < e.count; i++ {
+		if err := readPLYElement(values, e, scalars, lists); err != nil {
+			return fmt.Errorf("Face #%d: %v", i+1, err)
+		}
+		indices := lists[indicesName]
+		if len(indices) < 3 {
+			return fmt.Errorf("Face #%d: Expected at least 3 vertices, but got %d", i+1, len(indices))
+		}
+		f := face{corners: make([]faceCorner, len(indices))}
+		for j, idx := range indices {
+			if idx != math.Floor(idx) || idx < 0 || idx >= float64(len(l.v)) {
+				return fmt.Errorf("Face #%d refers to vertex %v, but there are only %d vertices", i+1, idx, len(l.v))
+			}
+			f.corners[j] = l.vertexCorner(int(idx))
+		}
+		l.f = append(l.f, f)
+	}
+	return nil
+}
+
+// addPointGroups adds a point for each vertex and groups the points
+// spatially so that no group holds more than MaxPointsPerGroup points.
+func (l *PLYReader) addPointGroups() {
+	if len(l.v) == 0 {
+		return
+	}
+	maxPoints := l.options.MaxPointsPerGroup
+	if maxPoints <= 0 {
+		maxPoints = DefaultMaxPointsPerGroup
+	}
+
+	indices := make([]int, len(l.v))
+	for i := range indices {
+		indices[i] = i
+	}
+	cells := splitPoints(l.v, indices, maxPoints)
+	for i, cell := range cells {
+		name := "points"
+		if len(cells) > 1 {
+			name = fmt.Sprintf("points_%d", i)
+		}
+		l.g = append(l.g, group{name: name, firstFaceIndex: len(l.f), faceCount: len(cell)})
+		for _, idx := range cell {
+			l.f = append(l.f, face{corners: []faceCorner{l.vertexCorner(idx)}})
+		}
+	}
+}
+
+// splitPoints recursively splits the points referred to by indices in half
+// along the longest axis of their bounding box until each part has at most
+// maxPoints points.
+func splitPoints(points []vec3.T, indices []int, maxPoints int) [][]int {
+	if len(indices) <= maxPoints {
+		return [][]int{indices}
+	}
+
+	box := vec3.Box{vec3.MaxVal, vec3.MinVal}
+	for _, idx := range indices {
+		box.Join(&vec3.Box{points[idx], points[idx]})
+	}
+	diagonal := box.Diagonal()
+	axis := 0
+	for i := 1; i < 3; i++ {
+		if diagonal[i] > diagonal[axis] {
+			axis = i
+		}
+	}
+
+	sort.Sort(pointsByAxis{points, indices, axis})
+	middle := len(indices) / 2
+	return append(splitPoints(points, indices[:middle], maxPoints),
+		splitPoints(points, indices[middle:], maxPoints)...)
+}
+
+// pointsByAxis sorts indices to points by the coordinate along an axis.
+type pointsByAxis struct {
+	points  []vec3.T
+	indices []int
+	axis    int
+}
+
+func (s pointsByAxis) Len() int {
+	return len(s.indices)
+}
+
+func (s pointsByAxis) Less(i, j int) bool {
+	return s.points[s.indices[i]][s.axis] < s.points[s.indices[j]][s.axis]
+}
+
+func (s pointsByAxis) Swap(i, j int) {
+	s.indices[i], s.indices[j] = s.indices[j], s.indices[i]
+}
+
+// plyASCIIReader reads values from the body of an ASCII PLY file.
+type plyASCIIReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *plyASCIIReader) readValue(valueType string) (float64, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return 0, err
+		}
+		return 0, io.ErrUnexpectedEOF
+	}
+	return strconv.ParseFloat(r.scanner.Text(), 64)
+}
+
+// plyBinaryReader reads values from the body of a binary little
+// endian PLY file.
+type plyBinaryReader struct {
+	reader io.Reader
+	buffer [8]byte
+}
+
+func (r *plyBinaryReader) readValue(valueType string) (float64, error) {
+	data := r.buffer[:plyTypeSizes[valueType]]
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return 0, err
+	}
+	switch valueType {
+	case "char", "int8":
+		return float64(int8(data[0])), nil
+	case "uchar", "uint8":
+		return float64(data[0]), nil
+	case "short", "int16":
+		return float64(int16(binary.LittleEndian.Uint16(data))), nil
+	case "ushort", "uint16":
+		return float64(binary.LittleEndian.Uint16(data)), nil
+	case "int", "int32":
+		return float64(int32(binary.LittleEndian.Uint32(data))), nil
+	case "uint", "uint32":
+		return float64(binary.LittleEndian.Uint32(data)), nil
+	case "float", "float32":
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data))), nil
+	default:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	}
+}
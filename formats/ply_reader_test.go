@@ -0,0 +1,146 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func TestPLYReader_Read_ASCIIMesh_ReturnsMeshGroup(t *testing.T) {
+	// Arrange
+	ply := "ply\n" +
+		"format ascii 1.0\n" +
+		"comment Made by a scanner\n" +
+		"element vertex 4\n" +
+		"property float x\nproperty float y\nproperty float z\n" +
+		"property float nx\nproperty float ny\nproperty float nz\n" +
+		"property uchar red\nproperty uchar green\nproperty uchar blue\n" +
+		"element face 1\n" +
+		"property list uchar int vertex_indices\n" +
+		"element edge 1\n" +
+		"property int vertex1\nproperty int vertex2\n" +
+		"end_header\n" +
+		"0 0 0 0 0 1 255 0 0\n" +
+		"1 0 0 0 0 1 0 255 0\n" +
+		"1 1 0 0 0 1 0 0 255\n" +
+		"0 1 0 0 0 1 255 255 255\n" +
+		"4 0 1 2 3\n" +
+		"0 1\n"
+	reader := PLYReader{}
+
+	// Act
+	err := reader.Read(strings.NewReader(ply))
+
+	// Assert
+	assert.NoError(t, err)
+	groups := readGroups(&reader)
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, "mesh", groups[0].Name())
+		assert.Equal(t, 2, groups[0].TriangleCount())
+		buffer := bytes.Buffer{}
+		assert.NoError(t, groups[0].Write(&buffer))
+		assert.Contains(t, buffer.String(), "v 1 0 0 0 1 0\n")
+		assert.Contains(t, buffer.String(), "f 1//1 2//2 3//3 4//4\n")
+	}
+	assert.Equal(t, vec3.T{1, 0, 0}, reader.vc[0])
+}
+
+func TestPLYReader_Read_BinaryPointCloud_SplitsPointsSpatially(t *testing.T) {
+	// Arrange: two clusters of points along x
+	header := "ply\n" +
+		"format binary_little_endian 1.0\n" +
+		"element vertex 8\n" +
+		"property double x\nproperty double y\nproperty double z\n" +
+		"property ushort intensity\n" +
+		"end_header\n"
+	ply := bytes.NewBufferString(header)
+	xs := []float64{100, 0, 101, 1, 102, 2, 103, 3}
+	for i, x := range xs {
+		binary.Write(ply, binary.LittleEndian, []float64{x, float64(i % 2), 0})
+		binary.Write(ply, binary.LittleEndian, uint16(i))
+	}
+	reader := PLYReader{}
+	reader.SetOptions(PLYReadOptions{MaxPointsPerGroup: 4})
+
+	// Act
+	err := reader.Read(ply)
+
+	// Assert
+	assert.NoError(t, err)
+	groups := readGroups(&reader)
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, "points_0", groups[0].Name())
+		assert.Equal(t, vec3.Box{Min: vec3.T{0, 1, 0}, Max: vec3.T{3, 1, 0}}, groups[0].BoundingBox())
+		assert.Equal(t, "points_1", groups[1].Name())
+		assert.Equal(t, vec3.Box{Min: vec3.T{100, 0, 0}, Max: vec3.T{103, 0, 0}}, groups[1].BoundingBox())
+		assert.Equal(t, 0, groups[1].TriangleCount())
+
+		buffer := bytes.Buffer{}
+		assert.NoError(t, groups[1].Write(&buffer))
+		assert.Contains(t, buffer.String(), "p 1\n")
+	}
+}
+
+func TestPLYReader_Read_SmallPointCloud_ReturnsSingleGroup(t *testing.T) {
+	// Arrange
+	ply := "ply\nformat ascii 1.0\nelement vertex 2\n" +
+		"property float x\nproperty float y\nproperty float z\nend_header\n" +
+		"0 0 0\n1 2 3\n"
+	reader := PLYReader{}
+
+	// Act
+	err := reader.Read(strings.NewReader(ply))
+
+	// Assert
+	assert.NoError(t, err)
+	groups := readGroups(&reader)
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, "points", groups[0].Name())
+		assert.Equal(t, vec3.Box{Min: vec3.T{0, 0, 0}, Max: vec3.T{1, 2, 3}}, groups[0].BoundingBox())
+	}
+}
+
+func TestPLYReader_Read_InvalidFiles_ReturnsError(t *testing.T) {
+	vertexHeader := "ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nproperty float y\nproperty float z\n"
+	assert.Error(t, (&PLYReader{}).Read(strings.NewReader("not ply\n")))
+	assert.Error(t, (&PLYReader{}).Read(strings.NewReader("ply\nformat binary_big_endian 1.0\nend_header\n")))
+	assert.Error(t, (&PLYReader{}).Read(strings.NewReader("ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nend_header\n0\n")))
+	assert.Error(t, (&PLYReader{}).Read(strings.NewReader(vertexHeader+"property half w\nend_header\n0 0 0 0\n")))
+	assert.Error(t, (&PLYReader{}).Read(strings.NewReader(vertexHeader+"end_header\n0 0\n")))
+	assert.Error(t, (&PLYReader{}).Read(strings.NewReader(vertexHeader+
+		"element face 1\nproperty list uchar int vertex_indices\nend_header\n0 0 0\n3 0 1 2\n")))
+}
+
+func TestPLYReader_Read_InvalidFaceIndices_ReturnsError(t *testing.T) {
+	header := "ply\nformat ascii 1.0\nelement vertex 3\nproperty float x\nproperty float y\nproperty float z\n" +
+		"element face 1\nproperty list uchar float vertex_indices\nend_header\n0 0 0\n1 0 0\n0 1 0\n"
+	for _, face := range []string{"3 0 1 nan\n", "3 0 1 inf\n", "3 0 1 -inf\n", "3 0 1 1.5\n", "3 0 1 3\n"} {
+		assert.Error(t, (&PLYReader{}).Read(strings.NewReader(header+face)), face)
+	}
+}
+
+func TestPLYReader_Read_InvalidListLength_ReturnsError(t *testing.T) {
+	header := "ply\nformat ascii 1.0\nelement vertex 3\nproperty float x\nproperty float y\nproperty float z\n" +
+		"element face 1\nproperty list float int vertex_indices\nend_header\n0 0 0\n1 0 0\n0 1 0\n"
+	for _, face := range []string{"inf 0 1 2\n", "nan 0 1 2\n", "-1 0 1 2\n", "1e9 0 1 2\n"} {
+		assert.Error(t, (&PLYReader{}).Read(strings.NewReader(header+face)), face)
+	}
+}
+
+func TestPLYReader_Read_BinaryHugeListLength_ReturnsErrorWithoutAllocating(t *testing.T) {
+	// Arrange
+	body := bytes.Buffer{}
+	body.WriteString("ply\nformat binary_little_endian 1.0\nelement face 1\n" +
+		"property list uint int vertex_indices\nend_header\n")
+	binary.Write(&body, binary.LittleEndian, uint32(0xFFFFFFFF))
+
+	// Act
+	err := (&PLYReader{}).Read(&body)
+
+	// Assert
+	assert.Error(t, err)
+}
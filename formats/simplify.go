@@ -0,0 +1,116 @@
+package formats
+
+import (
+	"math"
+
+	"github.com/larsmoa/renderdb/utils"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// gridCell identifies a cell in the grid used by simplify.
+type gridCell [3]int64
+
+// simplify returns a simplified copy of the buffer created by vertex
+// clustering: the bounding box is divided into a grid of cubic cells with
+// the given size, and all vertices inside the same cell are merged into one
+// vertex at their average position. Faces that visit the same merged vertex
+// more than once are split into loops at that vertex, and faces and loops
+// with fewer than three distinct vertices are removed, and so are points.
+// Normals, texture coordinates and vertex colours are discarded as they are
+// no longer valid for the simplified surface. The result has a single group
+// holding all faces.
+func (b *objBuffer) simplify(cellSize float64) *objBuffer {
+	buffer := new(objBuffer)
+	buffer.mtllib = b.mtllib
+	name := ""
+	if len(b.g) > 0 {
+		name = b.g[0].name
+	}
+
+	// Map vertices to cells
+	origin := b.BoundingBox().Min
+	cells := make(map[gridCell]int)
+	clusterMapping := make([]int, len(b.v))
+	var sums []vec3.T
+	var counts []int
+	for i, v := range b.v {
+		var c gridCell
+		for axis := 0; axis < 3; axis++ {
+			c[axis] = int64(math.Floor((v[axis] - origin[axis]) / cellSize))
+		}
+		cluster, found := cells[c]
+		if !found {
+			cluster = len(sums)
+			cells[c] = cluster
+			sums = append(sums, vec3.T{})
+			counts = append(counts, 0)
+		}
+		sums[cluster].Add(&b.v[i])
+		counts[cluster]++
+		clusterMapping[i] = cluster
+	}
+
+	// Rebuild faces, only adding vertices that are in use
+	vertexMapping := make([]int, len(sums))
+	utils.FillIntSlice(vertexMapping, -1)
+	for _, originalFace := range b.f {
+		clusters := make([]int, len(originalFace.corners))
+		for j, origCorner := range originalFace.corners {
+			clusters[j] = clusterMapping[origCorner.vertexIndex]
+		}
+
+		for _, loop := range splitLoops(clusters) {
+			f := face{material: originalFace.material, corners: make([]faceCorner, len(loop))}
+			for j, cluster := range loop {
+				newVertIdx := vertexMapping[cluster]
+				if newVertIdx == -1 {
+					newVertIdx = len(buffer.v)
+					buffer.v = append(buffer.v, sums[cluster].Scaled(1/float64(counts[cluster])))
+					vertexMapping[cluster] = newVertIdx
+				}
+				f.corners[j] = faceCorner{newVertIdx, -1, -1}
+			}
+			buffer.f = append(buffer.f, f)
+		}
+	}
+
+	buffer.g = []group{
+		group{
+			name:      name,
+			faceCount: len(buffer.f),
+		},
+	}
+	return buffer
+}
+
+// splitLoops splits a face given by the clusters of its corners into
+// loops that visit each cluster once. A face that visits a cluster twice
+// is pinched at the cluster, e.g. [A, B, C, A, D] is split into [A, B, C]
+// and [A, D]. Only loops with at least three clusters are returned, so
+// faces like [A, B, A, B] and [A, B, A, C] are removed.
+func splitLoops(clusters []int) [][]int {
+	var loops [][]int
+	var path []int
+	position := make(map[int]int)
+	for _, cluster := range clusters {
+		p, visited := position[cluster]
+		if !visited {
+			position[cluster] = len(path)
+			path = append(path, cluster)
+			continue
+		}
+
+		// Close the loop starting at the previous visit of the cluster
+		if len(path)-p >= 3 {
+			loops = append(loops, append([]int(nil), path[p:]...))
+		}
+		for _, c := range path[p+1:] {
+			delete(position, c)
+		}
+		path = path[:p+1]
+	}
+	if len(path) >= 3 {
+		loops = append(loops, path)
+	}
+	return loops
+}
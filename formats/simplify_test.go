@@ -0,0 +1,90 @@
+package formats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func TestObjBuffer_Simplify_LargeCells_MergesVerticesAndRemovesDegeneratedFaces(t *testing.T) {
+	// Arrange
+	buffer := objBuffer{}
+	buffer.g = []group{group{name: "g", faceCount: 2}}
+	buffer.v = []vec3.T{
+		vec3.T{0, 0, 0}, vec3.T{0.1, 0, 0}, vec3.T{0, 0.1, 0}, // Tiny triangle
+		vec3.T{2, 0, 0}, vec3.T{0, 2, 0},
+	}
+	buffer.f = []face{
+		createFace("a", 0, 1, 2),
+		createFace("b", 0, 3, 4),
+	}
+
+	// Act
+	simplified := buffer.simplify(1)
+
+	// Assert
+	assert.Equal(t, []face{face{corners: []faceCorner{{0, -1, -1}, {1, -1, -1}, {2, -1, -1}}, material: "b"}}, simplified.f)
+	assert.Equal(t, []vec3.T{vec3.T{0.1 / 3, 0.1 / 3, 0}, vec3.T{2, 0, 0}, vec3.T{0, 2, 0}}, simplified.v)
+	assert.Empty(t, simplified.vn)
+	assert.Equal(t, []group{group{name: "g", faceCount: 1}}, simplified.g)
+}
+
+func TestObjBuffer_Simplify_SmallCells_KeepsAllFaces(t *testing.T) {
+	// Arrange
+	buffer := objBuffer{}
+	buffer.g = []group{group{name: "g", faceCount: 1}}
+	buffer.v = []vec3.T{vec3.T{0, 0, 0}, vec3.T{1, 0, 0}, vec3.T{1, 1, 0}, vec3.T{0, 1, 0}}
+	buffer.f = []face{createFace("", 0, 1, 2, 3)}
+
+	// Act
+	simplified := buffer.simplify(0.1)
+
+	// Assert
+	assert.Equal(t, 2, simplified.TriangleCount())
+	assert.Equal(t, buffer.v, simplified.v)
+}
+
+func TestObjBuffer_Simplify_QuadCollapsesToTriangle_KeepsTriangle(t *testing.T) {
+	// Arrange
+	buffer := objBuffer{}
+	buffer.v = []vec3.T{vec3.T{0, 0, 0}, vec3.T{0.1, 0, 0}, vec3.T{2, 0, 0}, vec3.T{0, 2, 0}}
+	buffer.f = []face{createFace("", 0, 1, 2, 3)}
+
+	// Act
+	simplified := buffer.simplify(1)
+
+	// Assert
+	assert.Equal(t, 1, len(simplified.f))
+	assert.Equal(t, 3, len(simplified.f[0].corners))
+}
+
+func TestObjBuffer_Simplify_FacesVisitingClusterTwice_RemovesDegeneratedLoops(t *testing.T) {
+	// Arrange
+	buffer := objBuffer{}
+	buffer.v = []vec3.T{
+		vec3.T{0, 0, 0}, vec3.T{0.1, 0, 0}, // A
+		vec3.T{2, 0, 0}, vec3.T{2.1, 0, 0}, // B
+		vec3.T{0, 2, 0}, // C
+	}
+	buffer.f = []face{
+		createFace("", 0, 2, 1, 3),    // [A, B, A, B]
+		createFace("", 0, 2, 1, 4),    // [A, B, A, C]
+		createFace("", 0, 2, 4, 1, 3), // [A, B, C, A, B]
+	}
+
+	// Act
+	simplified := buffer.simplify(1)
+
+	// Assert
+	if assert.Equal(t, 1, len(simplified.f)) {
+		assert.Equal(t, []faceCorner{{0, -1, -1}, {1, -1, -1}, {2, -1, -1}}, simplified.f[0].corners)
+	}
+	assert.Equal(t, 3, len(simplified.v))
+}
+
+func TestSplitLoops_PinchedFace_ReturnsLoops(t *testing.T) {
+	assert.Equal(t, [][]int{{0, 1, 2}, {0, 3, 4}}, splitLoops([]int{0, 1, 2, 0, 3, 4}))
+	assert.Equal(t, [][]int{{0, 1, 2}}, splitLoops([]int{0, 0, 1, 2, 0}))
+	assert.Empty(t, splitLoops([]int{0, 1, 0, 2}))
+}
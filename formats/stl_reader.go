@@ -0,0 +1,222 @@
+package formats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/larsmoa/renderdb/utils"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+const (
+	stlHeaderLength   = 80
+	stlTriangleLength = 50
+)
+
+// STLReader reads STL files, both ASCII and binary. The format is detected
+// from the content: files where the size matches the triangle count of a
+// binary STL are read as binary, other files must be ASCII and start with
+// 'solid'.
+//
+// ASCII files produce one group per solid, named after the solid. Binary files
+// produce a single group named after the text in the header (or 'stl' if the
+// header holds no text). Identical vertices are merged, and facet normals that
+// are zero are ignored.
+type STLReader struct {
+	objBuffer
+
+	// Maps from position/normal to index in objBuffer, reset per group
+	vertexMapping map[vec3.T]int
+	normalMapping map[vec3.T]int
+}
+
+func (l *STLReader) Read(reader io.Reader) error {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if isBinarySTL(data) {
+		return l.readBinary(data)
+	}
+	if !bytes.HasPrefix(bytes.TrimLeftFunc(data, unicode.IsSpace), []byte("solid")) {
+		return fmt.Errorf("STL file is neither binary nor ASCII")
+	}
+	return l.readASCII(bytes.NewReader(data))
+}
+
+func isBinarySTL(data []byte) bool {
+	if len(data) < stlHeaderLength+4 {
+		return false
+	}
+	count := binary.LittleEndian.Uint32(data[stlHeaderLength:])
+	return uint64(len(data)) == stlHeaderLength+4+uint64(count)*stlTriangleLength
+}
+
+func (l *STLReader) readBinary(data []byte) error {
+	name := strings.TrimSpace(string(bytes.TrimRight(data[:stlHeaderLength], "\x00")))
+	if name == "" || strings.IndexFunc(name, func(r rune) bool { return !unicode.IsPrint(r) }) != -1 {
+		name = "stl"
+	}
+	l.startGroup(name)
+
+	count := int(binary.LittleEndian.Uint32(data[stlHeaderLength:]))
+	for i := 0; i < count; i++ {
+		var values [12]float32
+		offset := stlHeaderLength + 4 + i*stlTriangleLength
+		binary.Read(bytes.NewReader(data[offset:offset+48]), binary.LittleEndian, &values)
+
+		var normal vec3.T
+		var vertices [3]vec3.T
+		for c := 0; c < 3; c++ {
+			normal[c] = float64(values[c])
+			for v := 0; v < 3; v++ {
+				vertices[v][c] = float64(values[3+3*v+c])
+			}
+		}
+		if err := l.addFacet(normal, vertices); err != nil {
+			return fmt.Errorf("Triangle #%d: %v", i+1, err)
+		}
+	}
+	l.endGroup()
+	return nil
+}
+
+func (l *STLReader) readASCII(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	i := 0
+	inSolid := false
+	var normal vec3.T
+	var vertices []vec3.T
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i++
+		if len(line) == 0 {
+			continue
+		}
+
+		var err error
+		fields := strings.Fields(line)
+		keyword := strings.ToLower(fields[0])
+		switch {
+		case keyword == "solid" && !inSolid:
+			inSolid = true
+			name := strings.TrimSpace(line[len(fields[0]):])
+			if name == "" {
+				name = fmt.Sprintf("solid%d", len(l.g)+1)
+			}
+			l.startGroup(name)
+		case keyword == "endsolid" && inSolid:
+			inSolid = false
+			l.endGroup()
+		case !inSolid:
+			err = fmt.Errorf("Expected 'solid', but got '%s'", fields[0])
+		case keyword == "facet":
+			if len(fields) != 5 || strings.ToLower(fields[1]) != "normal" {
+				err = fmt.Errorf("Expected 'facet normal x y z'")
+			} else {
+				normal, err = parseSTLVector(fields[2:])
+			}
+			vertices = vertices[:0]
+		case keyword == "vertex":
+			var v vec3.T
+			if v, err = parseSTLVector(fields[1:]); err == nil {
+				vertices = append(vertices, v)
+			}
+		case keyword == "endfacet":
+			if len(vertices) != 3 {
+				err = fmt.Errorf("Expected 3 vertices in facet, but got %d", len(vertices))
+			} else {
+				err = l.addFacet(normal, [3]vec3.T{vertices[0], vertices[1], vertices[2]})
+			}
+		case keyword == "outer" || keyword == "endloop":
+			break
+		default:
+			err = fmt.Errorf("Unknown keyword '%s'", fields[0])
+		}
+
+		if err != nil {
+			return lineError{i, line, err}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if inSolid {
+		return fmt.Errorf("Expected 'endsolid' before end of file")
+	}
+	return nil
+}
+
+func parseSTLVector(fields []string) (vec3.T, error) {
+	if len(fields) != 3 {
+		return vec3.T{}, fmt.Errorf("Expected 3 fields, but got %d", len(fields))
+	}
+	x, errX := strconv.ParseFloat(fields[0], 64)
+	y, errY := strconv.ParseFloat(fields[1], 64)
+	z, errZ := strconv.ParseFloat(fields[2], 64)
+	return vec3.T{x, y, z}, utils.FirstError(errX, errY, errZ)
+}
+
+func (l *STLReader) startGroup(name string) {
+	l.g = append(l.g, group{name: name, firstFaceIndex: len(l.f)})
+	l.vertexMapping = make(map[vec3.T]int)
+	l.normalMapping = make(map[vec3.T]int)
+}
+
+// endGroup updates the face count of the last group, or discards
+// it if it has no faces.
+func (l *STLReader) endGroup() {
+	idx := len(l.g) - 1
+	if l.g[idx].faceCount = len(l.f) - l.g[idx].firstFaceIndex; l.g[idx].faceCount == 0 {
+		l.g = l.g[:idx]
+	}
+}
+
+func (l *STLReader) addFacet(normal vec3.T, vertices [3]vec3.T) error {
+	normalIdx := -1
+	if normal.LengthSqr() > 0 {
+		for _, c := range normal {
+			if math.IsNaN(c) || math.IsInf(c, 0) {
+				return fmt.Errorf("Invalid normal %v", normal)
+			}
+		}
+		var ok bool
+		if normalIdx, ok = l.normalMapping[normal]; !ok {
+			normalIdx = len(l.vn)
+			l.normalMapping[normal] = normalIdx
+			l.vn = append(l.vn, normal)
+		}
+	}
+
+	f := face{corners: make([]faceCorner, 3)}
+	for i, v := range vertices {
+		for _, c := range v {
+			if math.IsNaN(c) || math.IsInf(c, 0) {
+				return fmt.Errorf("Invalid vertex %v", v)
+			}
+		}
+		vertexIdx, ok := l.vertexMapping[v]
+		if !ok {
+			vertexIdx = len(l.v)
+			l.vertexMapping[v] = vertexIdx
+			l.v = append(l.v, v)
+		}
+		f.corners[i] = faceCorner{vertexIdx, -1, normalIdx}
+	}
+	if f.corners[0].vertexIndex == f.corners[1].vertexIndex ||
+		f.corners[1].vertexIndex == f.corners[2].vertexIndex ||
+		f.corners[0].vertexIndex == f.corners[2].vertexIndex {
+		// Degenerated facet
+		return nil
+	}
+	l.f = append(l.f, f)
+	return nil
+}
@@ -0,0 +1,113 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+const twoSolidsSTL = `solid bracket
+  facet normal 0 0 1
+    outer loop
+      vertex 0 0 0
+      vertex 1 0 0
+      vertex 0 1 0
+    endloop
+  endfacet
+  facet normal 0 0 1
+    outer loop
+      vertex 1 0 0
+      vertex 1 1 0
+      vertex 0 1 0
+    endloop
+  endfacet
+endsolid bracket
+solid
+  facet normal 0 0 0
+    outer loop
+      vertex 0 0 5
+      vertex 1 0 5
+      vertex 0 1 5
+    endloop
+  endfacet
+endsolid
+`
+
+func createBinarySTL(header string, triangles ...[12]float32) []byte {
+	buffer := bytes.Buffer{}
+	h := make([]byte, stlHeaderLength)
+	copy(h, header)
+	buffer.Write(h)
+	binary.Write(&buffer, binary.LittleEndian, uint32(len(triangles)))
+	for _, t := range triangles {
+		binary.Write(&buffer, binary.LittleEndian, t)
+		binary.Write(&buffer, binary.LittleEndian, uint16(0))
+	}
+	return buffer.Bytes()
+}
+
+func TestSTLReader_Read_ASCIIWithTwoSolids_ReturnsOneGroupPerSolid(t *testing.T) {
+	// Arrange
+	reader := STLReader{}
+
+	// Act
+	err := reader.Read(strings.NewReader(twoSolidsSTL))
+
+	// Assert
+	assert.NoError(t, err)
+	groups := readGroups(&reader)
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, "bracket", groups[0].Name())
+		assert.Equal(t, 2, groups[0].TriangleCount())
+		assert.Equal(t, vec3.Box{Min: vec3.T{0, 0, 0}, Max: vec3.T{1, 1, 0}}, groups[0].BoundingBox())
+		assert.Equal(t, "solid2", groups[1].Name())
+		assert.True(t, groups[1].RayIntersects(&vec3.T{0.2, 0.2, 10}, &vec3.T{0, 0, -1}))
+
+		buffer := bytes.Buffer{}
+		assert.NoError(t, groups[0].Write(&buffer))
+		assert.Contains(t, buffer.String(), "# 4 vertices, 0 texture coordinates, 1 normals, 2 faces\n")
+	}
+	// Zero normal is ignored
+	assert.Equal(t, -1, reader.f[2].corners[0].normalIndex)
+}
+
+func TestSTLReader_Read_Binary_ReturnsSingleGroup(t *testing.T) {
+	// Arrange
+	data := createBinarySTL("pipe support",
+		[12]float32{0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0},
+		[12]float32{0, 0, 1, 1, 0, 0, 1, 1, 0, 0, 1, 0},
+		[12]float32{0, 0, 1, 1, 0, 0, 1, 0, 0, 0, 1, 0}) // Degenerated
+	reader := STLReader{}
+
+	// Act
+	err := reader.Read(bytes.NewReader(data))
+
+	// Assert
+	assert.NoError(t, err)
+	groups := readGroups(&reader)
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, "pipe support", groups[0].Name())
+		assert.Equal(t, 2, groups[0].TriangleCount())
+	}
+	assert.Len(t, reader.v, 4)
+	assert.Equal(t, []vec3.T{{0, 0, 1}}, reader.vn)
+}
+
+func TestSTLReader_Read_BinaryWithSolidHeader_ReadsAsBinary(t *testing.T) {
+	reader := STLReader{}
+	err := reader.Read(bytes.NewReader(createBinarySTL("solid exported", [12]float32{0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0})))
+	assert.NoError(t, err)
+	assert.Len(t, readGroups(&reader), 1)
+}
+
+func TestSTLReader_Read_InvalidFiles_ReturnsError(t *testing.T) {
+	assert.Error(t, (&STLReader{}).Read(strings.NewReader("not an stl file")))
+	assert.Error(t, (&STLReader{}).Read(strings.NewReader("solid a\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nendloop\nendfacet\nendsolid\n")))
+	assert.Error(t, (&STLReader{}).Read(strings.NewReader("solid a\nfacet normal 0 0 1\nouter loop\nvertex 0 0 x\n")))
+	assert.Error(t, (&STLReader{}).Read(strings.NewReader("solid a\n")))
+	assert.Error(t, (&STLReader{}).Read(strings.NewReader("solid a\nendsolid\nvertex 0 0 0\n")))
+}
@@ -1,7 +1,6 @@
 package formats
 
 import (
-	"errors"
 	"fmt"
 
 	"github.com/larsmoa/renderdb/threed"
@@ -19,13 +18,16 @@ func (e lineError) Error() string {
 	return fmt.Sprintf("Line #%d: %v ('%s')", e.lineNumber, e.line, e.err)
 }
 
-// faceCorner represents a 'corner' (or vertex) in a face
+// faceCorner represents a 'corner' (or vertex) in a face. texCoordIndex
+// and normalIndex are -1 when the corner has no texture coordinate or normal.
 type faceCorner struct {
-	vertexIndex int
-	normalIndex int
+	vertexIndex   int
+	texCoordIndex int
+	normalIndex   int
 }
 
-// face represents a surface represented by a set of corner
+// face represents a surface represented by a set of corner. Faces
+// with a single corner represent points (the 'p'-keyword).
 type face struct {
 	corners  []faceCorner
 	material string
@@ -37,9 +39,31 @@ type objBuffer struct {
 	// All the below maps directly to OBJ-keywords
 	mtllib string
 	v      []vec3.T
-	vn     []vec3.T
-	f      []face
-	g      []group
+	// vc holds the RGB colour (in [0, 1]) of each vertex, given by the
+	// 'v x y z r g b' extension. It's either empty or as long as v.
+	vc []vec3.T
+	vt []vec3.T
+	vn []vec3.T
+	f  []face
+	g  []group
+}
+
+func (b *objBuffer) buffer() *objBuffer {
+	return b
+}
+
+// Groups returns a buffered channel with one element for each
+// group in the buffer.
+func (b *objBuffer) Groups() <-chan GeometryGroup {
+	ch := make(chan GeometryGroup, 10)
+	go func() {
+		defer close(ch)
+		for _, g := range b.g {
+			adapter := createGeometryGroupAdapter(b, g)
+			ch <- adapter
+		}
+	}()
+	return ch
 }
 
 func (b *objBuffer) BoundingBox() vec3.Box {
@@ -50,20 +74,39 @@ func (b *objBuffer) BoundingBox() vec3.Box {
 	return box
 }
 
-func (b *objBuffer) RayIntersects(origin, direction *vec3.T) bool {
+// TriangleCount returns the number of triangles in the buffer when
+// polygons are triangulated.
+func (b *objBuffer) TriangleCount() int {
+	count := 0
 	for _, f := range b.f {
-		if len(f.corners) != 3 {
-			panic(errors.New("Intersects only works on triangles"))
+		if len(f.corners) > 2 {
+			count += len(f.corners) - 2
 		}
+	}
+	return count
+}
+
+func (b *objBuffer) RayIntersects(origin, direction *vec3.T) bool {
+	_, intersects := b.RayIntersection(origin, direction)
+	return intersects
+}
 
-		v1 := &b.v[f.corners[0].vertexIndex]
-		v2 := &b.v[f.corners[1].vertexIndex]
-		v3 := &b.v[f.corners[2].vertexIndex]
-		if threed.RayTriangleIntersects(v1, v2, v3, origin, direction) {
-			return true
+// RayIntersection returns the distance to the nearest intersection between the
+// ray and the faces in the buffer, measured in units of the length of direction.
+// Polygons are treated as triangle fans.
+func (b *objBuffer) RayIntersection(origin, direction *vec3.T) (float64, bool) {
+	nearest, found := 0.0, false
+	for _, f := range b.f {
+		v0 := &b.v[f.corners[0].vertexIndex]
+		for i := 2; i < len(f.corners); i++ {
+			v1 := &b.v[f.corners[i-1].vertexIndex]
+			v2 := &b.v[f.corners[i].vertexIndex]
+			if t, ok := threed.RayTriangleIntersection(v0, v1, v2, origin, direction); ok && (!found || t < nearest) {
+				nearest, found = t, true
+			}
 		}
 	}
-	return false
+	return nearest, found
 }
 
 // ReadOptions represents options used by WavefrontObjReader.Read.
@@ -7,6 +7,15 @@ import (
 	"github.com/ungerik/go3d/float64/vec3"
 )
 
+// readGroups returns all groups read by the reader.
+func readGroups(reader GeometryReader) []GeometryGroup {
+	groups := []GeometryGroup{}
+	for g := range reader.Groups() {
+		groups = append(groups, g)
+	}
+	return groups
+}
+
 func TestObjBuffer_BoundingBox_NoVertices_ReturnsEmptyBox(t *testing.T) {
 	// Arrange
 	buffer := objBuffer{}
@@ -46,3 +55,39 @@ func TestObjBuffer_BoundingBox_ZeroNotIncludedInBounds_ReturnsCorrectBoundingBox
 	// Assert
 	assert.Equal(t, vec3.Box{Min: vec3.T{1, 1, 1}, Max: vec3.T{2, 4, 5}}, box)
 }
+
+func TestObjBuffer_RayIntersection_QuadAndTriangle_ReturnsNearest(t *testing.T) {
+	// Arrange
+	buffer := objBuffer{}
+	buffer.v = []vec3.T{
+		vec3.T{0, 0, 0}, vec3.T{1, 0, 0}, vec3.T{1, 1, 0}, vec3.T{0, 1, 0},
+		vec3.T{0, 0, 1}, vec3.T{1, 0, 1}, vec3.T{0, 1, 1},
+	}
+	buffer.f = []face{
+		face{corners: []faceCorner{{4, -1, -1}, {5, -1, -1}, {6, -1, -1}}},
+		face{corners: []faceCorner{{0, -1, -1}, {1, -1, -1}, {2, -1, -1}, {3, -1, -1}}},
+	}
+	origin, direction := vec3.T{0.8, 0.8, -1}, vec3.T{0, 0, 1}
+
+	// Act
+	distance, intersects := buffer.RayIntersection(&origin, &direction)
+
+	// Assert
+	assert.True(t, intersects) // Only the quad is hit (upper right half)
+	assert.InDelta(t, 1.0, distance, 1e-9)
+}
+
+func TestObjBuffer_TriangleCount_QuadAndTriangle_ReturnsThree(t *testing.T) {
+	// Arrange
+	buffer := objBuffer{}
+	buffer.f = []face{
+		face{corners: []faceCorner{{0, -1, -1}, {1, -1, -1}, {2, -1, -1}}},
+		face{corners: []faceCorner{{0, -1, -1}, {1, -1, -1}, {2, -1, -1}, {3, -1, -1}}},
+	}
+
+	// Act
+	count := buffer.TriangleCount()
+
+	// Assert
+	assert.Equal(t, 3, count)
+}
@@ -0,0 +1,135 @@
+package formats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/larsmoa/renderdb/utils"
+)
+
+// Material represents a material defined in a Wavefront MTL file.
+type Material struct {
+	Name string `json:"name"`
+	// Ambient, Diffuse, Specular and Emissive are RGB colours given
+	// by the Ka, Kd, Ks and Ke keywords.
+	Ambient  [3]float64 `json:"ambient"`
+	Diffuse  [3]float64 `json:"diffuse"`
+	Specular [3]float64 `json:"specular"`
+	Emissive [3]float64 `json:"emissive"`
+	// SpecularExponent is given by the Ns keyword.
+	SpecularExponent float64 `json:"specularExponent"`
+	// Opacity is given by the d keyword, or as 1-Tr. Defaults to 1.
+	Opacity float64 `json:"opacity"`
+	// IlluminationModel is given by the illum keyword.
+	IlluminationModel int `json:"illuminationModel"`
+	// DiffuseMap is the texture given by the map_Kd keyword, if any.
+	DiffuseMap string `json:"diffuseMap,omitempty"`
+}
+
+// WavefrontMtlReader reads Wavefront MTL material libraries. The reader
+// supports the following keywords:
+// - newmtl
+// - Ka, Kd, Ks, Ke (RGB only)
+// - Ns
+// - d
+// - Tr
+// - illum
+// - map_Kd
+// Other keywords, e.g. other texture maps, are ignored.
+type WavefrontMtlReader struct {
+	materials []Material
+}
+
+// Materials returns the materials read, in the order they are defined.
+func (l *WavefrontMtlReader) Materials() []Material {
+	return l.materials
+}
+
+func (l *WavefrontMtlReader) Read(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	i := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i++
+		// Ignore comments
+		if hashPos := strings.IndexRune(line, '#'); hashPos != -1 {
+			line = line[0:hashPos]
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		keyword := strings.ToLower(fields[0])
+		if keyword == "newmtl" {
+			if len(fields) < 2 {
+				return lineError{i, line, fmt.Errorf("Material name missing")}
+			}
+			name := strings.TrimSpace(line[len(fields[0]):])
+			l.materials = append(l.materials, Material{Name: name, Opacity: 1})
+			continue
+		}
+		if len(l.materials) == 0 {
+			return lineError{i, line, fmt.Errorf("Keyword '%s' must follow a 'newmtl'-keyword", fields[0])}
+		}
+
+		var err error
+		m := &l.materials[len(l.materials)-1]
+		switch keyword {
+		case "ka":
+			err = parseColour(fields[1:], &m.Ambient)
+		case "kd":
+			err = parseColour(fields[1:], &m.Diffuse)
+		case "ks":
+			err = parseColour(fields[1:], &m.Specular)
+		case "ke":
+			err = parseColour(fields[1:], &m.Emissive)
+		case "ns":
+			m.SpecularExponent, err = parseScalar(fields[1:])
+		case "d":
+			m.Opacity, err = parseScalar(fields[1:])
+		case "tr":
+			var transparency float64
+			transparency, err = parseScalar(fields[1:])
+			m.Opacity = 1 - transparency
+		case "illum":
+			if len(fields) != 2 {
+				err = fmt.Errorf("Expected 1 field, but got %d", len(fields)-1)
+			} else {
+				m.IlluminationModel, err = strconv.Atoi(fields[1])
+			}
+		case "map_kd":
+			// Options (e.g. '-s 1 1 1') precede the file name
+			m.DiffuseMap = fields[len(fields)-1]
+		}
+
+		if err != nil {
+			return lineError{i, line, err}
+		}
+	}
+	return scanner.Err()
+}
+
+func parseColour(fields []string, colour *[3]float64) error {
+	if len(fields) != 3 {
+		return fmt.Errorf("Expected 3 fields (only RGB colours are supported), but got %d", len(fields))
+	}
+	r, errR := strconv.ParseFloat(fields[0], 64)
+	g, errG := strconv.ParseFloat(fields[1], 64)
+	b, errB := strconv.ParseFloat(fields[2], 64)
+	if err := utils.FirstError(errR, errG, errB); err != nil {
+		return err
+	}
+	*colour = [3]float64{r, g, b}
+	return nil
+}
+
+func parseScalar(fields []string) (float64, error) {
+	if len(fields) != 1 {
+		return 0, fmt.Errorf("Expected 1 field, but got %d", len(fields))
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
@@ -0,0 +1,63 @@
+package formats
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWavefrontMtlReader_Read_TwoMaterials_ReturnsMaterials(t *testing.T) {
+	// Arrange
+	mtl := "# Exported materials\n" +
+		"newmtl Steel pipe\n" +
+		"Ka 0.1 0.1 0.1\n" +
+		"Kd 0.5 0.5 0.6\n" +
+		"Ks 1 1 1\n" +
+		"Ns 96.5\n" +
+		"illum 2\n" +
+		"map_Bump bump.png\n" +
+		"\n" +
+		"newmtl glass\n" +
+		"Kd 0 0 1\n" +
+		"Tr 0.75\n" +
+		"map_Kd -s 1 1 1 glass.png\n"
+	reader := WavefrontMtlReader{}
+
+	// Act
+	err := reader.Read(strings.NewReader(mtl))
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []Material{
+		Material{
+			Name:              "Steel pipe",
+			Ambient:           [3]float64{0.1, 0.1, 0.1},
+			Diffuse:           [3]float64{0.5, 0.5, 0.6},
+			Specular:          [3]float64{1, 1, 1},
+			SpecularExponent:  96.5,
+			Opacity:           1,
+			IlluminationModel: 2,
+		},
+		Material{
+			Name:       "glass",
+			Diffuse:    [3]float64{0, 0, 1},
+			Opacity:    0.25,
+			DiffuseMap: "glass.png",
+		},
+	}, reader.Materials())
+}
+
+func TestWavefrontMtlReader_Read_KeywordBeforeNewmtl_ReturnsError(t *testing.T) {
+	reader := WavefrontMtlReader{}
+	err := reader.Read(strings.NewReader("Kd 1 1 1\nnewmtl red\n"))
+	assert.Error(t, err)
+}
+
+func TestWavefrontMtlReader_Read_InvalidFields_ReturnsError(t *testing.T) {
+	assert.Error(t, (&WavefrontMtlReader{}).Read(strings.NewReader("newmtl\n")))
+	assert.Error(t, (&WavefrontMtlReader{}).Read(strings.NewReader("newmtl a\nKd 1 1\n")))
+	assert.Error(t, (&WavefrontMtlReader{}).Read(strings.NewReader("newmtl a\nKd spectral file.rfl\n")))
+	assert.Error(t, (&WavefrontMtlReader{}).Read(strings.NewReader("newmtl a\nNs high\n")))
+	assert.Error(t, (&WavefrontMtlReader{}).Read(strings.NewReader("newmtl a\nillum 1.5\n")))
+}
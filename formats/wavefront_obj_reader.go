@@ -2,6 +2,7 @@ package formats
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"regexp"
@@ -13,39 +14,58 @@ import (
 )
 
 var faceVertexOnlyRegex *regexp.Regexp
+var faceVertexAndTexCoordRegex *regexp.Regexp
+var faceVertexTexCoordAndNormalRegex *regexp.Regexp
 var faceVertexAndNormalRegex *regexp.Regexp
 var groupRegex *regexp.Regexp
 var usemtlRegex *regexp.Regexp
 var mtllibRegex *regexp.Regexp
+var metadataRegex *regexp.Regexp
 
 func init() {
-	faceVertexOnlyRegex = regexp.MustCompile(`^(\d+)$`)
-	faceVertexAndNormalRegex = regexp.MustCompile(`^(\d+)//(\d+)$`)
+	faceVertexOnlyRegex = regexp.MustCompile(`^(-?\d+)$`)
+	faceVertexAndTexCoordRegex = regexp.MustCompile(`^(-?\d+)/(-?\d+)$`)
+	faceVertexTexCoordAndNormalRegex = regexp.MustCompile(`^(-?\d+)/(-?\d+)/(-?\d+)$`)
+	faceVertexAndNormalRegex = regexp.MustCompile(`^(-?\d+)//(-?\d+)$`)
 	groupRegex = regexp.MustCompile(`^g\s*(.*)$`)
 	usemtlRegex = regexp.MustCompile(`^usemtl\s+(.*)$`)
 	mtllibRegex = regexp.MustCompile(`^mtllib\s+(.*)$`)
+	metadataRegex = regexp.MustCompile(`^#metadata\s+(\{.*)$`)
 }
 
 // WavefrontObjReader reads Wavefront OBJ files. The reader supports the
 // following keywords:
-// - v
+// - v (optionally followed by an RGB vertex colour, i.e. 'v x y z r g b')
+// - vt
 // - vn
-// - f
+// - f (on the forms v, v/t, v//n and v/t/n)
+// - p
 // - g
 // - mtllib
 // - usemtl
 // The following keywords are ignored:
 // - o
 // - s
-// - vt
 // - vp
 // - Comments (#)
+// Face indices are either absolute (1-based) or relative to the end
+// of the vertices read so far when negative, e.g. -1 refers to the
+// last vertex.
 // The reader supports splitting the OBJ file into 'groups' defined by the
-// 'g'-keyword.
+// 'g'-keyword. Metadata can be attached to a group by adding one or more
+// comments on the form '#metadata {"key": "value", ...}' after the
+// 'g'-keyword. The comment must hold a JSON object, and the keys of
+// several objects in the same group are merged.
 type WavefrontObjReader struct {
 	objBuffer
 
 	options ReadOptions
+	// vertexOffset, texCoordOffset and normalOffset are the number of
+	// vertices, texture coordinates and normals read before the first
+	// element of v, vt and vn. They are only non-zero when elements have
+	// been moved out of the buffer by WavefrontObjStreamReader, and face
+	// indices always count all elements read.
+	vertexOffset, texCoordOffset, normalOffset int
 }
 
 // SetOptions sets the read options that alters the behavior of
@@ -60,74 +80,116 @@ func (l *WavefrontObjReader) Read(reader io.Reader) error {
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		i++
-		// Ignore comments
-		if hashPos := strings.IndexRune(line, '#'); hashPos != -1 {
-			line = line[0:hashPos]
-		}
-		if len(line) == 0 {
-			continue
-		}
-
-		var err error
-		fields := strings.Fields(line)
-		switch strings.ToLower(fields[0]) {
-		case "v":
-			err = l.processVertex(fields[1:])
-		case "vn":
-			err = l.processVertexNormal(fields[1:])
-		case "f":
-			err = l.processFace(fields[1:])
-		case "g":
-			err = l.processGroup(line)
-		case "mtllib":
-			err = l.processMaterialLibrary(line)
-		case "usemtl":
-			err = l.processUseMaterial(line)
-
-			// Ignored keywords
-		case "o":
-		case "s":
-		case "vt":
-		case "vp":
-			break
-
-		default:
-			err = fmt.Errorf("Unknown keyword '%s'", fields[0])
-		}
-
-		if err != nil {
+		if err := l.processLine(line); err != nil {
 			return lineError{i, line, err}
 		}
 	}
 	l.endGroup()
-	return scanner.Err()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return l.verifyFaceIndices(l.f, 0)
 }
 
-// Groups returns a buffered channel with one element for each
-// group in the loaded OBJ file.
-func (l *WavefrontObjReader) Groups() <-chan GeometryGroup {
-	ch := make(chan GeometryGroup, 10)
-	go func() {
-		defer close(ch)
-		for _, g := range l.g {
-			adapter := createGeometryGroupAdapter(&l.objBuffer, g)
-			ch <- adapter
+// processLine processes a single trimmed line of an OBJ file.
+func (l *WavefrontObjReader) processLine(line string) error {
+	// Metadata directive
+	if match := metadataRegex.FindStringSubmatch(line); match != nil {
+		return l.processMetadata(match[1])
+	}
+	// Ignore comments
+	if hashPos := strings.IndexRune(line, '#'); hashPos != -1 {
+		line = line[0:hashPos]
+	}
+	if len(line) == 0 {
+		return nil
+	}
+
+	var err error
+	fields := strings.Fields(line)
+	switch strings.ToLower(fields[0]) {
+	case "v":
+		err = l.processVertex(fields[1:])
+	case "vt":
+		err = l.processTextureCoordinate(fields[1:])
+	case "vn":
+		err = l.processVertexNormal(fields[1:])
+	case "f":
+		err = l.processFace(fields[1:])
+	case "p":
+		err = l.processPoints(fields[1:])
+	case "g":
+		err = l.processGroup(line)
+	case "mtllib":
+		err = l.processMaterialLibrary(line)
+	case "usemtl":
+		err = l.processUseMaterial(line)
+
+		// Ignored keywords
+	case "o":
+	case "s":
+	case "vp":
+		break
+
+	default:
+		err = fmt.Errorf("Unknown keyword '%s'", fields[0])
+	}
+	return err
+}
+
+// verifyFaceIndices returns an error if any of the faces refers to
+// a vertex or normal that doesn't exist. faceOffset is the number of
+// faces read before the faces given, and is used in error messages.
+func (l *WavefrontObjReader) verifyFaceIndices(faces []face, faceOffset int) error {
+	vertexCount, texCoordCount, normalCount := l.counts()
+	for i, f := range faces {
+		n := faceOffset + i + 1
+		for _, c := range f.corners {
+			if c.vertexIndex < 0 || c.vertexIndex >= vertexCount {
+				return fmt.Errorf("Face #%d refers to vertex %d, but there are only %d vertices", n, c.vertexIndex+1, vertexCount)
+			}
+			if c.texCoordIndex < -1 || c.texCoordIndex >= texCoordCount {
+				return fmt.Errorf("Face #%d refers to texture coordinate %d, but there are only %d texture coordinates",
+					n, c.texCoordIndex+1, texCoordCount)
+			}
+			if c.normalIndex < -1 || c.normalIndex >= normalCount {
+				return fmt.Errorf("Face #%d refers to normal %d, but there are only %d normals", n, c.normalIndex+1, normalCount)
+			}
 		}
-	}()
-	return ch
+	}
+	return nil
+}
+
+// counts returns the number of vertices, texture coordinates and normals
+// read so far.
+func (l *WavefrontObjReader) counts() (int, int, int) {
+	return l.vertexOffset + len(l.v), l.texCoordOffset + len(l.vt), l.normalOffset + len(l.vn)
 }
 
 func (l *WavefrontObjReader) processVertex(fields []string) error {
-	if len(fields) != 3 && len(fields) != 4 {
-		return fmt.Errorf("Expected 3 or 4 fields, but got %d", len(fields))
+	if len(fields) != 3 && len(fields) != 4 && len(fields) != 6 {
+		return fmt.Errorf("Expected 3, 4 or 6 fields, but got %d", len(fields))
 	}
-	x, errX := strconv.ParseFloat(fields[0], 64)
-	y, errY := strconv.ParseFloat(fields[1], 64)
-	z, errZ := strconv.ParseFloat(fields[2], 64)
-	if err := utils.FirstError(errX, errY, errZ); err != nil {
-		return err
+	var values [6]float64
+	for i, field := range fields {
+		var err error
+		if values[i], err = strconv.ParseFloat(field, 64); err != nil {
+			return err
+		}
+	}
+	l.v = append(l.v, vec3.T{values[0], values[1], values[2]})
+
+	// Vertices without colour are white when other vertices have colour
+	white := vec3.T{1, 1, 1}
+	switch {
+	case len(fields) == 6:
+		for len(l.vc) < len(l.v)-1 {
+			l.vc = append(l.vc, white)
+		}
+		l.vc = append(l.vc, vec3.T{values[3], values[4], values[5]})
+	case len(l.vc) > 0:
+		l.vc = append(l.vc, white)
 	}
-	l.v = append(l.v, vec3.T{x, y, z})
 	return nil
 }
 
@@ -145,22 +207,61 @@ func (l *WavefrontObjReader) processVertexNormal(fields []string) error {
 	return nil
 }
 
-func parseFaceField(field string) (faceCorner, error) {
+func (l *WavefrontObjReader) processTextureCoordinate(fields []string) error {
+	if len(fields) < 1 || len(fields) > 3 {
+		return fmt.Errorf("Expected 1 to 3 fields, but got %d", len(fields))
+	}
+	var vt vec3.T
+	for i, field := range fields {
+		var err error
+		if vt[i], err = strconv.ParseFloat(field, 64); err != nil {
+			return err
+		}
+	}
+	l.vt = append(l.vt, vt)
+	return nil
+}
+
+// resolveIndex converts a 1-based OBJ index to a 0-based index. Negative
+// indices are relative to the count elements read so far.
+func resolveIndex(field string, count int) (int, error) {
+	idx, err := strconv.Atoi(field)
+	switch {
+	case err != nil:
+		return -1, err
+	case idx > 0:
+		return idx - 1, nil
+	case idx < 0 && count+idx >= 0:
+		return count + idx, nil
+	default:
+		return -1, fmt.Errorf("Invalid index %d", idx)
+	}
+}
+
+func (l *WavefrontObjReader) parseFaceField(field string) (faceCorner, error) {
+	var errV, errT, errN error
+	corner := faceCorner{-1, -1, -1}
+	vertexCount, texCoordCount, normalCount := l.counts()
 	if match := faceVertexOnlyRegex.FindStringSubmatch(field); match != nil {
 		// f v1 v2 ... - only vertex
-		v, err := strconv.Atoi(match[1])
-		return faceCorner{v - 1, -1}, err
+		corner.vertexIndex, errV = resolveIndex(match[1], vertexCount)
+	} else if match := faceVertexAndTexCoordRegex.FindStringSubmatch(field); match != nil {
+		// f v1/t1 v2/t2 ... - vertex and texture coordinate
+		corner.vertexIndex, errV = resolveIndex(match[1], vertexCount)
+		corner.texCoordIndex, errT = resolveIndex(match[2], texCoordCount)
+	} else if match := faceVertexTexCoordAndNormalRegex.FindStringSubmatch(field); match != nil {
+		// f v1/t1/n1 v2/t2/n2 ... - vertex, texture coordinate and normal
+		corner.vertexIndex, errV = resolveIndex(match[1], vertexCount)
+		corner.texCoordIndex, errT = resolveIndex(match[2], texCoordCount)
+		corner.normalIndex, errN = resolveIndex(match[3], normalCount)
 	} else if match := faceVertexAndNormalRegex.FindStringSubmatch(field); match != nil {
 		// f v1//n1 v2//n2 ... - vertex and normal
-		v, errV := strconv.Atoi(match[1])
-		n, errN := strconv.Atoi(match[2])
-		return faceCorner{v - 1, n - 1}, utils.FirstError(errV, errN)
+		corner.vertexIndex, errV = resolveIndex(match[1], vertexCount)
+		corner.normalIndex, errN = resolveIndex(match[2], normalCount)
 	} else {
-		// Note! f v1/t1 v2/t2 ... - vertex + texture and
-		// f v1/t1/n1 v2/t2/n2 ... - vertex, texture and normal
-		// are not currently supported.
-		return faceCorner{-1, -1}, fmt.Errorf("Face field '%s' is not on a supported format", field)
+		return corner, fmt.Errorf("Face field '%s' is not on a supported format", field)
 	}
+	return corner, utils.FirstError(errV, errT, errN)
 }
 
 func (l *WavefrontObjReader) isFaceAccepted(f *face) bool {
@@ -185,7 +286,7 @@ func (l *WavefrontObjReader) processFace(fields []string) error {
 
 	f := face{make([]faceCorner, len(fields)), l.activeMaterial}
 	for i, field := range fields {
-		corner, err := parseFaceField(field)
+		corner, err := l.parseFaceField(field)
 		if err != nil {
 			return err
 		}
@@ -197,6 +298,23 @@ func (l *WavefrontObjReader) processFace(fields []string) error {
 	return nil
 }
 
+// processPoints adds one single-corner face for each vertex reference
+// in fields.
+func (l *WavefrontObjReader) processPoints(fields []string) error {
+	if len(fields) < 1 {
+		return fmt.Errorf("Expected at least 1 field, but got 0")
+	}
+	vertexCount, _, _ := l.counts()
+	for _, field := range fields {
+		idx, err := resolveIndex(field, vertexCount)
+		if err != nil {
+			return err
+		}
+		l.f = append(l.f, face{[]faceCorner{{idx, -1, -1}}, l.activeMaterial})
+	}
+	return nil
+}
+
 func (l *WavefrontObjReader) processGroup(line string) error {
 	if match := groupRegex.FindStringSubmatch(line); match != nil {
 		l.endGroup()
@@ -225,6 +343,25 @@ func (l *WavefrontObjReader) processUseMaterial(line string) error {
 	return fmt.Errorf("Could not parse 'usemtl'-line")
 }
 
+func (l *WavefrontObjReader) processMetadata(text string) error {
+	if len(l.g) == 0 {
+		return fmt.Errorf("Metadata must follow a 'g'-keyword")
+	}
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &metadata); err != nil {
+		return fmt.Errorf("Invalid metadata (%v)", err)
+	}
+
+	g := &l.g[len(l.g)-1]
+	if g.metadata == nil {
+		g.metadata = make(map[string]interface{}, len(metadata))
+	}
+	for key, value := range metadata {
+		g.metadata[key] = value
+	}
+	return nil
+}
+
 func (l *WavefrontObjReader) startGroup(name string) {
 	g := group{
 		name:           name,
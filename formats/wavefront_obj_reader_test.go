@@ -1,8 +1,11 @@
 package formats
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
+	"github.com/larsmoa/renderdb/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/ungerik/go3d/float64/vec3"
 )
@@ -65,8 +68,82 @@ func TestWavefrontObjReader_ProcessFace_InvalidFields_ReturnsError(t *testing.T)
 	assert.Error(t, loader.processFace([]string{}))
 	assert.Error(t, loader.processFace([]string{"a", "b", "c"}))
 	assert.Error(t, loader.processFace([]string{"1/", "2/", "3/"}))
-	assert.Error(t, loader.processFace([]string{"1/1", "2/2", "3/2"})) // Valid but not supported
-	assert.Error(t, loader.processFace([]string{"1", "2"}))            // Too few coordinates
+	assert.Error(t, loader.processFace([]string{"1//", "2//", "3//"}))
+	assert.Error(t, loader.processFace([]string{"0", "1", "2"}))    // Indices are 1-based
+	assert.Error(t, loader.processFace([]string{"-1", "-2", "-3"})) // Relative, but no vertices
+	assert.Error(t, loader.processFace([]string{"1", "2"}))         // Too few coordinates
+}
+
+func TestWavefrontObjReader_ProcessFace_AllFormats_AddsFaces(t *testing.T) {
+	// Arrange
+	loader := WavefrontObjReader{}
+
+	// Act
+	errV := loader.processFace([]string{"1", "2", "3"})
+	errVT := loader.processFace([]string{"1/4", "2/5", "3/6"})
+	errVTN := loader.processFace([]string{"1/4/7", "2/5/8", "3/6/9"})
+	errVN := loader.processFace([]string{"1//7", "2//8", "3//9"})
+
+	// Assert
+	assert.NoError(t, utils.FirstError(errV, errVT, errVTN, errVN))
+	if assert.Equal(t, 4, len(loader.f)) {
+		assert.Equal(t, faceCorner{0, -1, -1}, loader.f[0].corners[0])
+		assert.Equal(t, faceCorner{1, 4, -1}, loader.f[1].corners[1])
+		assert.Equal(t, faceCorner{2, 5, 8}, loader.f[2].corners[2])
+		assert.Equal(t, faceCorner{0, -1, 6}, loader.f[3].corners[0])
+	}
+}
+
+func TestWavefrontObjReader_Read_NegativeIndices_ResolvesRelativeToLastElements(t *testing.T) {
+	// Arrange
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 0 1\nvn 0 0 1\n" +
+		"f -3/-3/-1 -2/-2/-1 -1/-1/-1\n" +
+		"v 1 1 0\n" +
+		"f -3 -2 -1\n"
+	loader := WavefrontObjReader{}
+
+	// Act
+	err := loader.Read(strings.NewReader(obj))
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(loader.f)) {
+		assert.Equal(t, []faceCorner{{0, 0, 0}, {1, 1, 0}, {2, 2, 0}}, loader.f[0].corners)
+		assert.Equal(t, []faceCorner{{1, -1, -1}, {2, -1, -1}, {3, -1, -1}}, loader.f[1].corners)
+	}
+}
+
+func TestWavefrontObjReader_Read_FaceWithInvalidTexCoord_ReturnsError(t *testing.T) {
+	loader := WavefrontObjReader{}
+	err := loader.Read(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nf 1/1 2/1 3/2\n"))
+	assert.Error(t, err)
+}
+
+func TestWavefrontObjReader_Read_TexturedObj_WritesTexCoords(t *testing.T) {
+	// Arrange
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nv 5 5 5\nvt 9 9\nvt 0 0\nvt 1 0 0.5\nvt 0 1\nvn 0 0 1\n" +
+		"g textured\n" +
+		"f 1/2/1 2/3/1 3/4/1\n" +
+		"f 1/2 2/3 3/4\n"
+	loader := WavefrontObjReader{}
+	err := loader.Read(strings.NewReader(obj))
+	assert.NoError(t, err)
+	g := <-loader.Groups()
+	buffer := &bytes.Buffer{}
+
+	// Act
+	err = g.Write(buffer)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "# Exported using RenderDB\n"+
+		"# 3 vertices, 3 texture coordinates, 1 normals, 2 faces\n"+
+		"v 0 0 0\nv 1 0 0\nv 0 1 0\n"+
+		"vt 0 0\nvt 1 0 0.5\nvt 0 1\n"+
+		"vn 0 0 1\n"+
+		"g textured\n"+
+		"f 1/1/1 2/2/1 3/3/1\n"+
+		"f 1/1 2/2 3/3\n", buffer.String())
 }
 
 func TestWavefrontObjReader_ProcessFace_VertexOnlyFormat_AddsFace(t *testing.T) {
@@ -119,7 +196,42 @@ func TestWavefrontObjReader_ProcessVertex_InvalidFields_ReturnsError(t *testing.
 	loader := WavefrontObjReader{}
 	assert.Error(t, loader.processVertex([]string{"0", "0"}))                // XY only
 	assert.Error(t, loader.processVertex([]string{"0", "0", "A"}))           // Non-number
-	assert.Error(t, loader.processVertex([]string{"0", "0", "0", "1", "2"})) // More than 4 coordinates
+	assert.Error(t, loader.processVertex([]string{"0", "0", "0", "1", "2"})) // Neither XYZW nor XYZRGB
+}
+
+func TestWavefrontObjReader_ProcessVertex_MixedColors_PadsWithWhite(t *testing.T) {
+	// Arrange
+	loader := WavefrontObjReader{}
+
+	// Act
+	errA := loader.processVertex([]string{"0", "0", "0"})
+	errB := loader.processVertex([]string{"1", "2", "3", "1", "0", "0"})
+	errC := loader.processVertex([]string{"4", "5", "6"})
+
+	// Assert
+	assert.NoError(t, utils.FirstError(errA, errB, errC))
+	assert.Equal(t, []vec3.T{{0, 0, 0}, {1, 2, 3}, {4, 5, 6}}, loader.v)
+	assert.Equal(t, []vec3.T{{1, 1, 1}, {1, 0, 0}, {1, 1, 1}}, loader.vc)
+}
+
+func TestWavefrontObjReader_Read_PointsAndColors_WritesSameGeometry(t *testing.T) {
+	// Arrange
+	obj := "v 0 0 0 1 0 0\nv 1 2 3 0 1 0\ng points\np 1 -1\n"
+	loader := WavefrontObjReader{}
+
+	// Act
+	err := loader.Read(strings.NewReader(obj))
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []face{face{[]faceCorner{{0, -1, -1}}, ""}, face{[]faceCorner{{1, -1, -1}}, ""}}, loader.f)
+	buffer := bytes.Buffer{}
+	for g := range loader.Groups() {
+		assert.Equal(t, 0, g.TriangleCount())
+		assert.NoError(t, g.Write(&buffer))
+	}
+	assert.Contains(t, buffer.String(), "v 1 2 3 0 1 0\n")
+	assert.Contains(t, buffer.String(), "p 1\np 2\n")
 }
 
 func TestWavefrontObjReader_ProcessVertexNormal_XYZ_AddsNormal(t *testing.T) {
@@ -177,7 +289,7 @@ func TestWavefrontObjReader_EndGroup_GroupStarted_UpdatesFaceCount(t *testing.T)
 	loader.endGroup()
 
 	// Assert
-	assert.Equal(t, []group{group{"Test", 0, 1}}, loader.g)
+	assert.Equal(t, []group{group{name: "Test", firstFaceIndex: 0, faceCount: 1}}, loader.g)
 }
 
 func TestWavefrontObjReader_ProcessFace_UsesActiveMaterial(t *testing.T) {
@@ -207,3 +319,54 @@ func TestWavefrontObjReader_EndGroup_EmptyGroup_DiscardsLast(t *testing.T) {
 	// Assert
 	assert.EqualValues(t, origGroups, loader.g)
 }
+
+func TestWavefrontObjReader_Read_FaceWithInvalidVertex_ReturnsError(t *testing.T) {
+	// Arrange
+	loader := WavefrontObjReader{}
+	obj := "v 0 0 0\nv 1 0 0\ng g\nf 1 2 3\n"
+
+	// Act
+	err := loader.Read(strings.NewReader(obj))
+
+	// Assert
+	assert.Error(t, err)
+}
+
+func TestWavefrontObjReader_Read_MetadataDirectives_MergesMetadataOfGroup(t *testing.T) {
+	// Arrange
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\n" +
+		"g pipe\n" +
+		"#metadata {\"system\": \"HVAC\", \"diameter\": 50}\n" +
+		"# metadata in ordinary comments is ignored\n" +
+		"#metadata {\"diameter\": 80}\n" +
+		"f 1 2 3\n" +
+		"g wall\n" +
+		"f 1 2 3\n"
+	loader := WavefrontObjReader{}
+
+	// Act
+	err := loader.Read(strings.NewReader(obj))
+
+	// Assert
+	assert.NoError(t, err)
+	groups := []GeometryGroup{}
+	for g := range loader.Groups() {
+		groups = append(groups, g)
+	}
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, map[string]interface{}{"system": "HVAC", "diameter": 80.0}, groups[0].Metadata())
+		assert.Nil(t, groups[1].Metadata())
+	}
+}
+
+func TestWavefrontObjReader_Read_InvalidMetadata_ReturnsError(t *testing.T) {
+	loader := WavefrontObjReader{}
+	err := loader.Read(strings.NewReader("g pipe\n#metadata {\"system\": \n"))
+	assert.Error(t, err)
+}
+
+func TestWavefrontObjReader_Read_MetadataBeforeGroup_ReturnsError(t *testing.T) {
+	loader := WavefrontObjReader{}
+	err := loader.Read(strings.NewReader("#metadata {\"system\": \"HVAC\"}\ng pipe\n"))
+	assert.Error(t, err)
+}
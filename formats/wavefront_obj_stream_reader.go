@@ -0,0 +1,345 @@
+package formats
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// WavefrontObjStreamReader reads Wavefront OBJ files group by group, and
+// supports the same keywords and metadata directives as
+// WavefrontObjReader. Each group is returned as soon as the next group
+// starts or the file ends. Faces that are not part of a group are
+// discarded.
+//
+// Vertices, texture coordinates and normals are written to temporary
+// files as they are read, and each group only loads the elements its
+// faces refer to. Memory use is therefore bounded by the largest group
+// rather than by the size of the file. Close must be called to remove the
+// temporary files.
+//
+// Vertices read before the first vertex with a colour are white when a
+// later vertex has a colour, like for WavefrontObjReader, but groups
+// returned before the first vertex with a colour is read have no colours.
+type WavefrontObjStreamReader struct {
+	reader  WavefrontObjReader
+	scanner *bufio.Scanner
+	// lineNumber is the number of lines read so far
+	lineNumber int
+	// faceOffset is the number of faces discarded so far
+	faceOffset int
+	done       bool
+
+	// vertices holds the position and colour of each vertex read so far,
+	// and texCoords and normals the texture coordinates and normals
+	vertices  attributeFile
+	texCoords attributeFile
+	normals   attributeFile
+	hasColors bool
+}
+
+// NewWavefrontObjStreamReader creates a reader that reads groups from r
+// when NextGroup is called.
+func NewWavefrontObjStreamReader(r io.Reader) *WavefrontObjStreamReader {
+	return &WavefrontObjStreamReader{
+		scanner:   bufio.NewScanner(r),
+		vertices:  attributeFile{width: 2},
+		texCoords: attributeFile{width: 1},
+		normals:   attributeFile{width: 1},
+	}
+}
+
+// SetOptions sets the read options that alters the behavior of
+// NextGroup. Defaults to the default ReadOptions{} struct.
+func (l *WavefrontObjStreamReader) SetOptions(options ReadOptions) {
+	l.reader.SetOptions(options)
+}
+
+// Close removes the temporary files holding the vertices, texture
+// coordinates and normals read. Groups returned by NextGroup can still be
+// used after the reader is closed.
+func (l *WavefrontObjStreamReader) Close() error {
+	errV := l.vertices.close()
+	errT := l.texCoords.close()
+	errN := l.normals.close()
+	for _, err := range []error{errV, errT, errN} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NextGroup reads until the end of the next non-empty group and returns
+// it. Returns io.EOF when there are no more groups.
+func (l *WavefrontObjStreamReader) NextGroup() (GeometryGroup, error) {
+	if l.done {
+		return nil, io.EOF
+	}
+	r := &l.reader
+	for l.scanner.Scan() {
+		line := strings.TrimSpace(l.scanner.Text())
+		l.lineNumber++
+		if err := r.processLine(line); err != nil {
+			return nil, lineError{l.lineNumber, line, err}
+		}
+		if err := l.storeAttributes(); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case len(r.g) == 0:
+			l.discardFaces()
+		case len(r.g) > 1:
+			// A 'g'-keyword ended the previous group (empty groups are
+			// discarded by endGroup)
+			return l.takeGroup()
+		}
+	}
+	if err := l.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	l.done = true
+	r.endGroup()
+	if len(r.g) == 0 {
+		return nil, io.EOF
+	}
+	return l.takeGroup()
+}
+
+// storeAttributes moves the vertices, texture coordinates and normals held
+// by the reader to the attribute files.
+func (l *WavefrontObjStreamReader) storeAttributes() error {
+	r := &l.reader
+	for i, v := range r.v {
+		color := vec3.T{1, 1, 1}
+		if len(r.vc) > 0 {
+			color = r.vc[i]
+			l.hasColors = true
+		}
+		if err := l.vertices.add(v, color); err != nil {
+			return err
+		}
+	}
+	for _, vt := range r.vt {
+		if err := l.texCoords.add(vt); err != nil {
+			return err
+		}
+	}
+	for _, vn := range r.vn {
+		if err := l.normals.add(vn); err != nil {
+			return err
+		}
+	}
+	r.vertexOffset += len(r.v)
+	r.texCoordOffset += len(r.vt)
+	r.normalOffset += len(r.vn)
+	r.v, r.vc, r.vt, r.vn = r.v[:0], r.vc[:0], r.vt[:0], r.vn[:0]
+	return nil
+}
+
+// takeGroup verifies and returns the first group held by the reader, and
+// discards its faces.
+func (l *WavefrontObjStreamReader) takeGroup() (GeometryGroup, error) {
+	r := &l.reader
+	g := r.g[0]
+	faces := r.f[g.firstFaceIndex : g.firstFaceIndex+g.faceCount]
+	if err := r.verifyFaceIndices(faces, l.faceOffset+g.firstFaceIndex); err != nil {
+		return nil, err
+	}
+	buffer, err := l.loadGroup(g, faces)
+	if err != nil {
+		return nil, err
+	}
+	adapter := &geometryGroupAdapter{g: g, buffer: buffer}
+
+	// Keep the group that was started, which has no faces yet
+	r.g = r.g[1:]
+	l.discardFaces()
+	return adapter, nil
+}
+
+// loadGroup creates a buffer with the faces of the group, and with the
+// vertices, texture coordinates and normals they refer to read from the
+// attribute files. Like group.buildBuffers, the elements are stored in
+// the order they are first referred to.
+func (l *WavefrontObjStreamReader) loadGroup(g group, faces []face) (*objBuffer, error) {
+	buffer := &objBuffer{
+		mtllib: l.reader.mtllib,
+		g:      []group{{name: g.name, faceCount: g.faceCount}},
+		f:      make([]face, len(faces)),
+	}
+	var vertices, texCoords, normals attributeMapping
+	for i, f := range faces {
+		corners := make([]faceCorner, len(f.corners))
+		for j, c := range f.corners {
+			corners[j] = faceCorner{vertices.add(c.vertexIndex), texCoords.add(c.texCoordIndex), normals.add(c.normalIndex)}
+		}
+		buffer.f[i] = face{corners, f.material}
+	}
+
+	v, err := vertices.load(&l.vertices)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(v); i += 2 {
+		buffer.v = append(buffer.v, v[i])
+		if l.hasColors {
+			buffer.vc = append(buffer.vc, v[i+1])
+		}
+	}
+	if buffer.vt, err = texCoords.load(&l.texCoords); err != nil {
+		return nil, err
+	}
+	if buffer.vn, err = normals.load(&l.normals); err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
+
+// discardFaces removes all faces held by the reader. The current group,
+// if any, must not have any faces.
+func (l *WavefrontObjStreamReader) discardFaces() {
+	r := &l.reader
+	l.faceOffset += len(r.f)
+	r.f = r.f[:0]
+	for i := range r.g {
+		r.g[i].firstFaceIndex = 0
+	}
+}
+
+// attributeMapping maps from indices of elements in an attributeFile to
+// indices of the elements in a group, in the order they are first used.
+type attributeMapping struct {
+	local map[int]int
+	order []int
+}
+
+// add returns the index in the group of element idx, or -1 if idx is -1.
+func (m *attributeMapping) add(idx int) int {
+	if idx == -1 {
+		return -1
+	}
+	if m.local == nil {
+		m.local = make(map[int]int)
+	}
+	local, ok := m.local[idx]
+	if !ok {
+		local = len(m.order)
+		m.local[idx] = local
+		m.order = append(m.order, idx)
+	}
+	return local
+}
+
+// load reads the elements added from the file, in the order they were
+// first added. Returns nil if no elements were added.
+func (m *attributeMapping) load(file *attributeFile) ([]vec3.T, error) {
+	if len(m.order) == 0 {
+		return nil, nil
+	}
+	sorted := append([]int(nil), m.order...)
+	sort.Ints(sorted)
+	values, err := file.read(sorted)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]vec3.T, len(values))
+	for i, idx := range sorted {
+		copy(result[m.local[idx]*file.width:], values[i*file.width:(i+1)*file.width])
+	}
+	return result, nil
+}
+
+// attributeFile stores elements of width vectors each in a temporary
+// file, so that they can be read by index without being held in memory.
+// The file is created when the first element is added.
+type attributeFile struct {
+	width  int
+	file   *os.File
+	writer *bufio.Writer
+	buffer []byte
+}
+
+// elementSize returns the size of each element in the file in bytes.
+func (a *attributeFile) elementSize() int {
+	return a.width * 3 * 8
+}
+
+// add appends an element of width vectors to the file.
+func (a *attributeFile) add(element ...vec3.T) error {
+	if a.file == nil {
+		var err error
+		if a.file, err = ioutil.TempFile("", "renderdb-obj-"); err != nil {
+			return fmt.Errorf("Could not create temporary file (reason: %v)", err)
+		}
+		a.writer = bufio.NewWriter(a.file)
+	}
+	var data [8]byte
+	for _, v := range element {
+		for _, c := range v {
+			binary.LittleEndian.PutUint64(data[:], math.Float64bits(c))
+			if _, err := a.writer.Write(data[:]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// read returns the vectors of the elements with the given sorted indices.
+// Consecutive indices are read with a single read.
+func (a *attributeFile) read(indices []int) ([]vec3.T, error) {
+	if a.file == nil {
+		return nil, fmt.Errorf("No elements have been added")
+	}
+	if err := a.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	size := a.elementSize()
+	result := make([]vec3.T, 0, len(indices)*a.width)
+	for start := 0; start < len(indices); {
+		end := start + 1
+		for end < len(indices) && indices[end] == indices[end-1]+1 {
+			end++
+		}
+		if cap(a.buffer) < (end-start)*size {
+			a.buffer = make([]byte, (end-start)*size)
+		}
+		data := a.buffer[:(end-start)*size]
+		if _, err := a.file.ReadAt(data, int64(indices[start])*int64(size)); err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(data); i += 24 {
+			result = append(result, vec3.T{
+				math.Float64frombits(binary.LittleEndian.Uint64(data[i:])),
+				math.Float64frombits(binary.LittleEndian.Uint64(data[i+8:])),
+				math.Float64frombits(binary.LittleEndian.Uint64(data[i+16:])),
+			})
+		}
+		start = end
+	}
+	return result, nil
+}
+
+// close closes and removes the file, if it was created.
+func (a *attributeFile) close() error {
+	if a.file == nil {
+		return nil
+	}
+	a.file.Close()
+	err := os.Remove(a.file.Name())
+	a.file, a.writer = nil, nil
+	return err
+}
@@ -0,0 +1,126 @@
+package formats
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWavefrontObjStreamReader_NextGroup_SeveralGroups_ReturnsGroupsAsTheyEnd(t *testing.T) {
+	// Arrange
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nv 1 1 0\n" +
+		"f 1 2 3\n" +
+		"g first\n#metadata {\"id\": 1}\nf 1 2 3\nf 2 4 3\n" +
+		"g empty\n" +
+		"v 2 2 2\ng second\nf 2 5 4\n"
+	reader := NewWavefrontObjStreamReader(strings.NewReader(obj))
+	defer reader.Close()
+
+	// Act
+	first, errFirst := reader.NextGroup()
+	facesAfterFirst := len(reader.reader.f)
+	second, errSecond := reader.NextGroup()
+	_, errEnd := reader.NextGroup()
+
+	// Assert
+	assert.NoError(t, errFirst)
+	assert.NoError(t, errSecond)
+	assert.Equal(t, io.EOF, errEnd)
+	assert.Equal(t, 0, facesAfterFirst)
+	if assert.NotNil(t, first) && assert.NotNil(t, second) {
+		assert.Equal(t, "first", first.Name())
+		assert.Equal(t, map[string]interface{}{"id": 1.0}, first.Metadata())
+		assert.Equal(t, 2, first.TriangleCount())
+		assert.Equal(t, "second", second.Name())
+		buffer := bytes.Buffer{}
+		assert.NoError(t, second.Write(&buffer))
+		assert.Contains(t, buffer.String(), "v 1 0 0\nv 2 2 2\nv 1 1 0\ng second\nf 1 2 3\n")
+	}
+}
+
+func TestWavefrontObjStreamReader_NextGroup_SameAsWavefrontObjReader(t *testing.T) {
+	// Arrange
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nvn 0 0 1\ng a\nusemtl red\nf 1//1 2//1 3//1\ng b\nf 1 1 2\nf -1 -2 -3\n"
+	streamReader := NewWavefrontObjStreamReader(strings.NewReader(obj))
+	streamReader.SetOptions(ReadOptions{DiscardDegeneratedFaces: true})
+	defer streamReader.Close()
+	reader := WavefrontObjReader{}
+	reader.SetOptions(ReadOptions{DiscardDegeneratedFaces: true})
+	assert.NoError(t, reader.Read(strings.NewReader(obj)))
+
+	for expected := range reader.Groups() {
+		// Act
+		actual, err := streamReader.NextGroup()
+
+		// Assert
+		assert.NoError(t, err)
+		expectedBuffer, actualBuffer := bytes.Buffer{}, bytes.Buffer{}
+		assert.NoError(t, expected.Write(&expectedBuffer))
+		assert.NoError(t, actual.Write(&actualBuffer))
+		assert.Equal(t, expectedBuffer.String(), actualBuffer.String())
+	}
+	_, err := streamReader.NextGroup()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestWavefrontObjStreamReader_NextGroup_InvalidFile_ReturnsError(t *testing.T) {
+	reader := NewWavefrontObjStreamReader(strings.NewReader("v 0 0 0\ng a\nf 1 1 1\ng b\nf 1 2 1\n"))
+	defer reader.Close()
+	_, err := reader.NextGroup()
+	assert.NoError(t, err)
+	_, err = reader.NextGroup()
+	assert.EqualError(t, err, "Face #2 refers to vertex 2, but there are only 1 vertices")
+
+	_, err = NewWavefrontObjStreamReader(strings.NewReader("g a\nunknown 1\n")).NextGroup()
+	assert.Error(t, err)
+}
+
+func TestWavefrontObjStreamReader_NextGroup_KeepsOnlyVerticesOfGroupInMemory(t *testing.T) {
+	// Arrange
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 0 1\n" +
+		"g first\nf 1/1 2/2 3/3\n" +
+		"v 5 5 5 1 0 0\nv 6 5 5\nvn 0 0 1\n" +
+		"g second\nf -1//1 -2//1 2//1\n"
+	reader := NewWavefrontObjStreamReader(strings.NewReader(obj))
+	defer reader.Close()
+
+	// Act
+	first, errFirst := reader.NextGroup()
+	vertices, texCoords := len(reader.reader.v), len(reader.reader.vt)
+	second, errSecond := reader.NextGroup()
+
+	// Assert
+	assert.NoError(t, errFirst)
+	assert.NoError(t, errSecond)
+	assert.Equal(t, 0, vertices)
+	assert.Equal(t, 0, texCoords)
+	if assert.NotNil(t, first) && assert.NotNil(t, second) {
+		firstBuffer, secondBuffer := bytes.Buffer{}, bytes.Buffer{}
+		assert.NoError(t, first.Write(&firstBuffer))
+		assert.NoError(t, second.Write(&secondBuffer))
+		assert.Contains(t, firstBuffer.String(), "v 0 0 0 1 1 1\nv 1 0 0 1 1 1\nv 0 1 0 1 1 1\nvt 0 0\nvt 1 0\nvt 0 1\ng first\nf 1/1 2/2 3/3\n")
+		assert.Contains(t, secondBuffer.String(), "v 6 5 5 1 1 1\nv 5 5 5 1 0 0\nv 1 0 0 1 1 1\n")
+		assert.Contains(t, secondBuffer.String(), "f 1//1 2//1 3//1\n")
+	}
+}
+
+func TestWavefrontObjStreamReader_Close_RemovesTemporaryFiles(t *testing.T) {
+	// Arrange
+	reader := NewWavefrontObjStreamReader(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\ng a\nf 1 2 3\n"))
+	g, err := reader.NextGroup()
+	assert.NoError(t, err)
+	name := reader.vertices.file.Name()
+
+	// Act
+	err = reader.Close()
+
+	// Assert
+	assert.NoError(t, err)
+	_, err = os.Stat(name)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, 1, g.TriangleCount())
+}
@@ -13,8 +13,8 @@ func (b *objBuffer) Write(w io.Writer) error {
 	var err error
 	_, err = io.WriteString(w,
 		fmt.Sprintf("# Exported using RenderDB\n"+
-			"# %d vertices, %d normals, %d faces\n",
-			len(b.v), len(b.vn), len(b.f)))
+			"# %d vertices, %d texture coordinates, %d normals, %d faces\n",
+			len(b.v), len(b.vt), len(b.vn), len(b.f)))
 	if err != nil {
 		return err
 	}
@@ -27,6 +27,9 @@ func (b *objBuffer) Write(w io.Writer) error {
 	if err = b.writeVertices(w); err != nil {
 		return err
 	}
+	if err = b.writeTexCoords(w); err != nil {
+		return err
+	}
 	if err = b.writeNormals(w); err != nil {
 		return err
 	}
@@ -40,7 +43,32 @@ func (b *objBuffer) Write(w io.Writer) error {
 }
 
 func (b *objBuffer) writeVertices(w io.Writer) error {
-	return writeVectors(w, "v %g %g %g\n", b.v)
+	if len(b.vc) == 0 {
+		return writeVectors(w, "v %g %g %g\n", b.v)
+	}
+	for i, v := range b.v {
+		c := b.vc[i]
+		_, err := io.WriteString(w, fmt.Sprintf("v %g %g %g %g %g %g\n", v[0], v[1], v[2], c[0], c[1], c[2]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *objBuffer) writeTexCoords(w io.Writer) error {
+	for _, vt := range b.vt {
+		var err error
+		if vt[2] != 0 {
+			_, err = io.WriteString(w, fmt.Sprintf("vt %g %g %g\n", vt[0], vt[1], vt[2]))
+		} else {
+			_, err = io.WriteString(w, fmt.Sprintf("vt %g %g\n", vt[0], vt[1]))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (b *objBuffer) writeNormals(w io.Writer) error {
@@ -50,16 +78,27 @@ func (b *objBuffer) writeNormals(w io.Writer) error {
 func writeFace(w io.Writer, f face) error {
 	var err error
 
-	_, err = io.WriteString(w, "f")
+	keyword := "f"
+	if len(f.corners) == 1 {
+		keyword = "p"
+	}
+	_, err = io.WriteString(w, keyword)
 	if err != nil {
 		return err
 	}
 
 	for _, c := range f.corners {
-		if c.normalIndex != -1 {
+		switch {
+		case c.texCoordIndex != -1 && c.normalIndex != -1:
+			_, err = io.WriteString(w,
+				fmt.Sprintf(" %d/%d/%d", c.vertexIndex+1, c.texCoordIndex+1, c.normalIndex+1))
+		case c.texCoordIndex != -1:
+			_, err = io.WriteString(w,
+				fmt.Sprintf(" %d/%d", c.vertexIndex+1, c.texCoordIndex+1))
+		case c.normalIndex != -1:
 			_, err = io.WriteString(w,
 				fmt.Sprintf(" %d//%d", c.vertexIndex+1, c.normalIndex+1))
-		} else {
+		default:
 			_, err = io.WriteString(w, fmt.Sprintf(" %d", c.vertexIndex+1))
 		}
 		if err != nil {
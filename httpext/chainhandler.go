@@ -79,3 +79,11 @@ func (p *responseWriterProxy) Write(data []byte) (int, error) {
 	p.hasWritten = true
 	return p.w.Write(data)
 }
+
+// Flush implements http.Flusher, and flushes the underlying writer if it
+// supports flushing.
+func (p *responseWriterProxy) Flush() {
+	if flusher, ok := p.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -2,8 +2,11 @@ package httpext
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"runtime/debug"
 
+	"github.com/gorilla/context"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -13,8 +16,34 @@ type Handler interface {
 	Handle(tx *sqlx.Tx, renderer ResponseRenderer, w http.ResponseWriter, r *http.Request) error
 }
 
-func NewHttpHandler(db *sqlx.DB, renderer ResponseRenderer, h Handler) http.Handler {
+type commitHooksKeyType int
+
+const commitHooksKey commitHooksKeyType = 0
+
+// OnCommit registers f to be called after the transaction of the request
+// has been committed by the handler created by NewHttpHandler, e.g. to
+// update state shared between requests. f is not called if the transaction
+// is rolled back. Functions are called in the order they are registered.
+func OnCommit(r *http.Request, f func()) {
+	hooks, _ := context.Get(r, commitHooksKey).([]func())
+	context.Set(r, commitHooksKey, append(hooks, f))
+}
+
+// NewHttpHandler creates a HTTP handler that runs h in a transaction. The
+// renderer passed to h is negotiated from the Accept-header of the request,
+// see Renderers.Negotiate. Requests that accept none of the renderers fail
+// with status code http.StatusNotAcceptable. Functions registered with
+// OnCommit are called after the transaction is committed. If h panics, the
+// transaction is rolled back, the panic is logged and the request fails with
+// status code http.StatusInternalServerError.
+func NewHttpHandler(db *sqlx.DB, renderers *Renderers, h Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renderer, err := renderers.Negotiate(r)
+		if err != nil {
+			renderer.WriteError(w, err)
+			return
+		}
+
 		// Initialize transaction
 		tx, err := db.Beginx()
 		if err != nil {
@@ -23,19 +52,33 @@ func NewHttpHandler(db *sqlx.DB, renderer ResponseRenderer, h Handler) http.Hand
 			return
 		}
 
-		// Commit or rollback transation after handler is done
+		// Commit or rollback transation after handler is done. The error is
+		// only written if the handler hasn't written a response, e.g. a
+		// stream ending with an error record.
+		writerProxy := &responseWriterProxy{w: w}
 		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("Panic while handling %s %s: %v\n%s", r.Method, r.URL.Path, p, debug.Stack())
+				err = NewHttpError(fmt.Errorf("Internal server error"), http.StatusInternalServerError)
+			}
 			if err == nil {
 				if err = tx.Commit(); err != nil {
 					renderer.WriteError(w, err)
+					return
+				}
+				hooks, _ := context.Get(r, commitHooksKey).([]func())
+				for _, hook := range hooks {
+					hook()
 				}
 				return
 			}
-			renderer.WriteError(w, err)
+			if !writerProxy.hasWritten {
+				renderer.WriteError(w, err)
+			}
 			tx.Rollback()
 		}()
 
 		// Run handler
-		err = h.Handle(tx, renderer, w, r)
+		err = h.Handle(tx, renderer, writerProxy, r)
 	})
 }
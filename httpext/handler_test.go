@@ -10,15 +10,16 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 type newHTTPHandlerFixture struct {
 	mockDB sqlmock.Sqlmock
 	db     *sqlx.DB
 
-	renderer ResponseRenderer
-	writer   *httptest.ResponseRecorder
-	request  *http.Request
+	renderers *Renderers
+	writer    *httptest.ResponseRecorder
+	request   *http.Request
 }
 
 func (f *newHTTPHandlerFixture) Setup(t *testing.T) {
@@ -30,8 +31,10 @@ func (f *newHTTPHandlerFixture) Setup(t *testing.T) {
 	f.db = sqlx.NewDb(db, "")
 	assert.NoError(t, err)
 
-	f.renderer = NewJSONResponseRenderer()
+	f.renderers = DefaultRenderers()
 	f.writer = httptest.NewRecorder()
+	f.request, err = http.NewRequest("GET", "/", nil)
+	assert.NoError(t, err)
 }
 
 func (f *newHTTPHandlerFixture) Teardown(t *testing.T) {
@@ -52,7 +55,7 @@ func TestNewHttpHandler_InnerHandlerFails_RollsbackTransactionAndWritesError(t *
 	f.mockDB.ExpectRollback()
 
 	// Act
-	handler := NewHttpHandler(f.db, f.renderer, &h)
+	handler := NewHttpHandler(f.db, f.renderers, &h)
 	handler.ServeHTTP(f.writer, f.request)
 
 	// Assert
@@ -61,6 +64,33 @@ func TestNewHttpHandler_InnerHandlerFails_RollsbackTransactionAndWritesError(t *
 	assert.NotZero(t, f.writer.Body.Len())
 }
 
+func TestNewHttpHandler_InnerHandlerFailsAfterWriting_DoesNotWriteError(t *testing.T) {
+	// Arrange
+	f := newHTTPHandlerFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	h := mockHandler{}
+	h.On("Handle", any, any, any, any).
+		Run(func(args mock.Arguments) {
+			w := args.Get(2).(http.ResponseWriter)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("partial"))
+		}).
+		Return(errors.New(""))
+
+	f.mockDB.ExpectBegin()
+	f.mockDB.ExpectRollback()
+
+	// Act
+	handler := NewHttpHandler(f.db, f.renderers, &h)
+	handler.ServeHTTP(f.writer, f.request)
+
+	// Assert
+	assert.NoError(t, f.mockDB.ExpectationsWereMet())
+	assert.Equal(t, http.StatusOK, f.writer.Code)
+	assert.Equal(t, "partial", f.writer.Body.String())
+}
+
 func TestNewHttpHandler_InnerHandlerSucceeds_CommitsTransaction(t *testing.T) {
 	// Arrange
 	f := newHTTPHandlerFixture{}
@@ -73,11 +103,117 @@ func TestNewHttpHandler_InnerHandlerSucceeds_CommitsTransaction(t *testing.T) {
 	f.mockDB.ExpectCommit()
 
 	// Act
-	handler := NewHttpHandler(f.db, f.renderer, &h)
+	handler := NewHttpHandler(f.db, f.renderers, &h)
+	handler.ServeHTTP(f.writer, f.request)
+
+	// Assert
+	assert.NoError(t, f.mockDB.ExpectationsWereMet())
+}
+
+func TestNewHttpHandler_InnerHandlerSucceeds_CallsCommitHooksAfterCommit(t *testing.T) {
+	// Arrange
+	f := newHTTPHandlerFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	calls := []string{}
+	h := mockHandler{}
+	h.On("Handle", any, any, any, any).
+		Run(func(args mock.Arguments) {
+			r := args.Get(3).(*http.Request)
+			OnCommit(r, func() {
+				assert.NoError(t, f.mockDB.ExpectationsWereMet())
+				calls = append(calls, "first")
+			})
+			OnCommit(r, func() { calls = append(calls, "second") })
+		}).
+		Return(nil)
+
+	f.mockDB.ExpectBegin()
+	f.mockDB.ExpectCommit()
+
+	// Act
+	handler := NewHttpHandler(f.db, f.renderers, &h)
+	handler.ServeHTTP(f.writer, f.request)
+
+	// Assert
+	assert.Equal(t, []string{"first", "second"}, calls)
+}
+
+func TestNewHttpHandler_InnerHandlerFails_DoesNotCallCommitHooks(t *testing.T) {
+	// Arrange
+	f := newHTTPHandlerFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	called := false
+	h := mockHandler{}
+	h.On("Handle", any, any, any, any).
+		Run(func(args mock.Arguments) {
+			OnCommit(args.Get(3).(*http.Request), func() { called = true })
+		}).
+		Return(errors.New(""))
+
+	f.mockDB.ExpectBegin()
+	f.mockDB.ExpectRollback()
+
+	// Act
+	handler := NewHttpHandler(f.db, f.renderers, &h)
+	handler.ServeHTTP(f.writer, f.request)
+
+	// Assert
+	assert.NoError(t, f.mockDB.ExpectationsWereMet())
+	assert.False(t, called)
+}
+
+func TestNewHttpHandler_InnerHandlerPanics_RollsbackWithoutCallingCommitHooks(t *testing.T) {
+	// Arrange
+	f := newHTTPHandlerFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	called := false
+	h := mockHandler{}
+	h.On("Handle", any, any, any, any).
+		Run(func(args mock.Arguments) {
+			OnCommit(args.Get(3).(*http.Request), func() { called = true })
+			panic("broken upload")
+		}).
+		Return(nil)
+
+	f.mockDB.ExpectBegin()
+	f.mockDB.ExpectRollback()
+
+	// Act
+	handler := NewHttpHandler(f.db, f.renderers, &h)
+	handler.ServeHTTP(f.writer, f.request)
+
+	// Assert
+	assert.NoError(t, f.mockDB.ExpectationsWereMet())
+	assert.False(t, called)
+	assert.Equal(t, http.StatusInternalServerError, f.writer.Code)
+}
+
+func TestNewHttpHandler_CommitFails_DoesNotCallCommitHooks(t *testing.T) {
+	// Arrange
+	f := newHTTPHandlerFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	called := false
+	h := mockHandler{}
+	h.On("Handle", any, any, any, any).
+		Run(func(args mock.Arguments) {
+			OnCommit(args.Get(3).(*http.Request), func() { called = true })
+		}).
+		Return(nil)
+
+	f.mockDB.ExpectBegin()
+	f.mockDB.ExpectCommit().WillReturnError(errors.New(""))
+
+	// Act
+	handler := NewHttpHandler(f.db, f.renderers, &h)
 	handler.ServeHTTP(f.writer, f.request)
 
 	// Assert
 	assert.NoError(t, f.mockDB.ExpectationsWereMet())
+	assert.False(t, called)
 }
 
 func TestNewHttpHandler_OpenTransactionFails_WritesErrorAndAborts(t *testing.T) {
@@ -91,9 +227,49 @@ func TestNewHttpHandler_OpenTransactionFails_WritesErrorAndAborts(t *testing.T)
 	f.mockDB.ExpectBegin().WillReturnError(errors.New(""))
 
 	// Act
-	handler := NewHttpHandler(f.db, f.renderer, &h)
+	handler := NewHttpHandler(f.db, f.renderers, &h)
+	handler.ServeHTTP(f.writer, f.request)
+
+	// Assert
+	assert.NoError(t, f.mockDB.ExpectationsWereMet())
+}
+
+func TestNewHttpHandler_AcceptsProtobuf_UsesProtobufRenderer(t *testing.T) {
+	// Arrange
+	f := newHTTPHandlerFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	f.request.Header.Set("Accept", "application/json;q=0.5, "+ProtobufMediaType)
+	h := mockHandler{}
+	h.On("Handle", any, f.renderers.renderers[ProtobufMediaType], any, any).Return(errors.New("failed"))
+
+	f.mockDB.ExpectBegin()
+	f.mockDB.ExpectRollback()
+
+	// Act
+	handler := NewHttpHandler(f.db, f.renderers, &h)
+	handler.ServeHTTP(f.writer, f.request)
+
+	// Assert
+	h.AssertExpectations(t)
+	assert.Equal(t, http.StatusInternalServerError, f.writer.Code)
+	assert.Equal(t, ProtobufMediaType, f.writer.Header().Get("Content-Type"))
+}
+
+func TestNewHttpHandler_NoAcceptableRenderer_WritesNotAcceptable(t *testing.T) {
+	// Arrange
+	f := newHTTPHandlerFixture{}
+	f.Setup(t)
+	defer f.Teardown(t)
+	f.request.Header.Set("Accept", "text/html")
+	h := mockHandler{}
+
+	// Act
+	handler := NewHttpHandler(f.db, f.renderers, &h)
 	handler.ServeHTTP(f.writer, f.request)
 
 	// Assert
 	assert.NoError(t, f.mockDB.ExpectationsWereMet())
+	h.AssertNotCalled(t, "Handle", any, any, any, any)
+	assert.Equal(t, http.StatusNotAcceptable, f.writer.Code)
 }
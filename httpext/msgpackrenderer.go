@@ -0,0 +1,149 @@
+package httpext
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+)
+
+// MessagePackMediaType is the media type of responses written by the
+// MessagePack renderer.
+const MessagePackMediaType = "application/msgpack"
+
+type messagePackResponseRenderer struct {
+}
+
+// NewMessagePackResponseRenderer creates a renderer that outputs
+// MessagePack. Values are converted with the same field names and values
+// as the JSON renderer, i.e. byte slices are written as base64 strings.
+// Integral numbers are written as integers and map keys are sorted.
+func NewMessagePackResponseRenderer() ResponseRenderer {
+	return &messagePackResponseRenderer{}
+}
+
+func (r *messagePackResponseRenderer) WriteEmpty(w http.ResponseWriter, statusCode int) {
+	w.WriteHeader(statusCode)
+}
+
+func (r *messagePackResponseRenderer) WriteObject(w http.ResponseWriter, statusCode int, val interface{}) {
+	buffer, err := marshalMessagePack(val)
+	if err != nil {
+		r.WriteError(w, fmt.Errorf("Could not marshal value '%+v' of type '%T'", val, val))
+		return
+	}
+	w.Header().Set("Content-Type", MessagePackMediaType)
+	w.WriteHeader(statusCode)
+	w.Write(buffer)
+}
+
+func (r *messagePackResponseRenderer) WriteError(w http.ResponseWriter, err error) {
+	var httpError HttpError
+	var ok bool
+	if httpError, ok = err.(HttpError); !ok {
+		httpError = NewHttpError(err, http.StatusInternalServerError)
+	}
+	r.WriteObject(w, httpError.StatusCode(), httpError)
+}
+
+// marshalMessagePack encodes val as JSON and then converts the JSON value
+// to MessagePack.
+func marshalMessagePack(val interface{}) ([]byte, error) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err = decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	buffer := bytes.Buffer{}
+	writeMessagePackValue(&buffer, value)
+	return buffer.Bytes(), nil
+}
+
+// writeMessagePackValue writes a value decoded from JSON.
+func writeMessagePackValue(b *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		b.WriteByte(0xc0)
+	case bool:
+		if v {
+			b.WriteByte(0xc3)
+		} else {
+			b.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			writeMessagePackInt(b, i)
+		} else {
+			f, _ := v.Float64()
+			b.WriteByte(0xcb)
+			binary.Write(b, binary.BigEndian, math.Float64bits(f))
+		}
+	case string:
+		writeMessagePackHeader(b, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		b.WriteString(v)
+	case []interface{}:
+		writeMessagePackHeader(b, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			writeMessagePackValue(b, item)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		writeMessagePackHeader(b, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, key := range keys {
+			writeMessagePackValue(b, key)
+			writeMessagePackValue(b, v[key])
+		}
+	}
+}
+
+func writeMessagePackInt(b *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i < 128:
+		b.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		b.WriteByte(byte(0xe0 | (i + 32)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		b.WriteByte(0xd0)
+		b.WriteByte(byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		b.WriteByte(0xd1)
+		binary.Write(b, binary.BigEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		b.WriteByte(0xd2)
+		binary.Write(b, binary.BigEndian, int32(i))
+	default:
+		b.WriteByte(0xd3)
+		binary.Write(b, binary.BigEndian, i)
+	}
+}
+
+// writeMessagePackHeader writes the type and length of a string, array or
+// map. The fix format is used for lengths less than fixLimit, and the 8-bit
+// format is skipped if zero.
+func writeMessagePackHeader(b *bytes.Buffer, length int, fix byte, fixLimit int, format8, format16, format32 byte) {
+	switch {
+	case length < fixLimit:
+		b.WriteByte(fix | byte(length))
+	case format8 != 0 && length <= math.MaxUint8:
+		b.WriteByte(format8)
+		b.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		b.WriteByte(format16)
+		binary.Write(b, binary.BigEndian, uint16(length))
+	default:
+		b.WriteByte(format32)
+		binary.Write(b, binary.BigEndian, uint32(length))
+	}
+}
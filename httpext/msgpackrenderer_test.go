@@ -0,0 +1,62 @@
+package httpext
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessagePackResponseRenderer_WriteObject_Struct_WritesMessagePack(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+	renderer := NewMessagePackResponseRenderer()
+	val := struct {
+		ID     int64     `json:"id"`
+		Name   string    `json:"name"`
+		Values []float64 `json:"values"`
+		Meta   *string   `json:"meta"`
+	}{-1, "a", []float64{300, 0.5}, nil}
+
+	// Act
+	renderer.WriteObject(w, http.StatusOK, val)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, MessagePackMediaType, w.Header().Get("Content-Type"))
+	expected := []byte{0x84,
+		0xa2, 'i', 'd', 0xff,
+		0xa4, 'm', 'e', 't', 'a', 0xc0,
+		0xa4, 'n', 'a', 'm', 'e', 0xa1, 'a',
+		0xa6, 'v', 'a', 'l', 'u', 'e', 's', 0x92, 0xd1, 0x01, 0x2c, 0xcb, 0x3f, 0xe0, 0, 0, 0, 0, 0, 0}
+	assert.Equal(t, expected, w.Body.Bytes())
+}
+
+func TestMessagePackResponseRenderer_WriteObject_LongString_UsesLongerFormat(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+	renderer := NewMessagePackResponseRenderer()
+
+	// Act
+	renderer.WriteObject(w, http.StatusOK, strings.Repeat("a", 300))
+
+	// Assert
+	assert.Equal(t, []byte{0xda, 0x01, 0x2c}, w.Body.Bytes()[:3])
+	assert.Len(t, w.Body.Bytes(), 303)
+}
+
+func TestMessagePackResponseRenderer_WriteError_StandardError_WritesInternalError(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+	renderer := NewMessagePackResponseRenderer()
+
+	// Act
+	renderer.WriteError(w, errors.New("message"))
+
+	// Assert
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "message")
+}
@@ -0,0 +1,174 @@
+package httpext
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/context"
+)
+
+// JSONMediaType is the media type of responses written by the JSON
+// renderer.
+const JSONMediaType = "application/json"
+
+type negotiatedMediaTypeKeyType int
+
+const negotiatedMediaTypeKey negotiatedMediaTypeKeyType = 0
+
+// Renderers holds the renderers available for a set of routes, keyed by
+// media type, and selects the renderer to use for each request from its
+// Accept-header.
+type Renderers struct {
+	mediaTypes []string
+	renderers  map[string]ResponseRenderer
+}
+
+// NewRenderers creates an empty set of renderers, see Register.
+func NewRenderers() *Renderers {
+	return &Renderers{renderers: make(map[string]ResponseRenderer)}
+}
+
+// DefaultRenderers creates renderers for JSON (the default), protocol
+// buffers and MessagePack.
+func DefaultRenderers() *Renderers {
+	renderers := NewRenderers()
+	renderers.Register(JSONMediaType, NewJSONResponseRenderer())
+	renderers.Register(ProtobufMediaType, NewProtobufResponseRenderer())
+	messagePackRenderer := NewMessagePackResponseRenderer()
+	renderers.Register(MessagePackMediaType, messagePackRenderer)
+	renderers.Register("application/x-msgpack", messagePackRenderer)
+	return renderers
+}
+
+// Register registers the renderer used for requests that prefer
+// mediaType. Registering a media type again replaces its renderer. The
+// first renderer registered is the default, which is used for requests
+// without an Accept-header and when several media types are equally
+// preferred by the client. Handlers that write some media types
+// themselves, e.g. binary formats, may register them with the renderer
+// used for errors and check NegotiatedMediaType.
+func (rs *Renderers) Register(mediaType string, renderer ResponseRenderer) {
+	if _, ok := rs.renderers[mediaType]; !ok {
+		rs.mediaTypes = append(rs.mediaTypes, mediaType)
+	}
+	rs.renderers[mediaType] = renderer
+}
+
+// Default returns the first renderer registered.
+func (rs *Renderers) Default() ResponseRenderer {
+	if len(rs.mediaTypes) == 0 {
+		panic("No renderers registered")
+	}
+	return rs.renderers[rs.mediaTypes[0]]
+}
+
+// Negotiate selects the renderer for the request based on the quality
+// values of its Accept-header. Media types listed explicitly are preferred
+// over matching wildcards with the same quality, and the order of the
+// Accept-header is used as a tie-breaker. The selected media type is stored
+// in the request context, see NegotiatedMediaType. If none of the
+// registered media types are accepted the default renderer is returned
+// with a HttpError with status code http.StatusNotAcceptable.
+func (rs *Renderers) Negotiate(r *http.Request) (ResponseRenderer, error) {
+	defaultRenderer := rs.Default()
+	header := r.Header.Get("Accept")
+	ranges := parseAccept(header)
+	if len(ranges) == 0 {
+		context.Set(r, negotiatedMediaTypeKey, rs.mediaTypes[0])
+		return defaultRenderer, nil
+	}
+
+	selected := ""
+	var best acceptMatch
+	for _, mediaType := range rs.mediaTypes {
+		m := matchAccept(ranges, mediaType)
+		if m.q > 0 && (selected == "" || m.preferredTo(best)) {
+			selected, best = mediaType, m
+		}
+	}
+	if selected == "" {
+		err := fmt.Errorf("None of the media types accepted ('%s') are supported, expected one of %s",
+			header, strings.Join(rs.mediaTypes, ", "))
+		return defaultRenderer, NewHttpError(err, http.StatusNotAcceptable)
+	}
+	context.Set(r, negotiatedMediaTypeKey, selected)
+	return rs.renderers[selected], nil
+}
+
+// NegotiatedMediaType returns the media type selected for the request by
+// Renderers.Negotiate, or an empty string if negotiation hasn't been done.
+func NegotiatedMediaType(r *http.Request) string {
+	mediaType, _ := context.Get(r, negotiatedMediaTypeKey).(string)
+	return mediaType
+}
+
+// acceptRange is a media range of an Accept-header, e.g. 'text/*;q=0.5'.
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept returns the media ranges of an Accept-header in the order
+// listed. Invalid ranges are ignored.
+func parseAccept(header string) []acceptRange {
+	ranges := []acceptRange{}
+	for _, accept := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType, q})
+	}
+	return ranges
+}
+
+// acceptMatch describes how a media type matches an Accept-header.
+type acceptMatch struct {
+	q float64
+	// specificity is 3 for an explicitly listed type, 2 for 'type/*' and
+	// 1 for '*/*'
+	specificity int
+	// index is the position of the matching range in the header
+	index int
+}
+
+func (m acceptMatch) preferredTo(other acceptMatch) bool {
+	if m.q != other.q {
+		return m.q > other.q
+	}
+	if m.specificity != other.specificity {
+		return m.specificity > other.specificity
+	}
+	return m.index < other.index
+}
+
+// matchAccept returns the quality of mediaType given by the most specific
+// matching range. The quality is zero if no range matches.
+func matchAccept(ranges []acceptRange, mediaType string) acceptMatch {
+	best := acceptMatch{}
+	for i, accept := range ranges {
+		specificity := 0
+		switch {
+		case accept.mediaType == mediaType:
+			specificity = 3
+		case strings.HasSuffix(accept.mediaType, "/*") &&
+			strings.HasPrefix(mediaType, strings.TrimSuffix(accept.mediaType, "*")):
+			specificity = 2
+		case accept.mediaType == "*/*":
+			specificity = 1
+		}
+		if specificity > best.specificity {
+			best = acceptMatch{accept.q, specificity, i}
+		}
+	}
+	return best
+}
@@ -0,0 +1,68 @@
+package httpext
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func negotiate(t *testing.T, accept string) (string, error) {
+	renderers := DefaultRenderers()
+	renderers.Register("model/gltf-binary", renderers.Default())
+	r, err := http.NewRequest("GET", "/", nil)
+	assert.NoError(t, err)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	_, err = renderers.Negotiate(r)
+	return NegotiatedMediaType(r), err
+}
+
+func TestRenderers_Negotiate_NoAcceptHeader_SelectsDefault(t *testing.T) {
+	mediaType, err := negotiate(t, "")
+	assert.NoError(t, err)
+	assert.Equal(t, JSONMediaType, mediaType)
+}
+
+func TestRenderers_Negotiate_QualityValues_SelectsHighestQuality(t *testing.T) {
+	mediaType, err := negotiate(t, "application/json;q=0.5, application/msgpack;q=0.8, application/x-protobuf;q=0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, MessagePackMediaType, mediaType)
+}
+
+func TestRenderers_Negotiate_EqualQuality_PrefersSpecificTypesThenHeaderOrder(t *testing.T) {
+	mediaType, _ := negotiate(t, "*/*, model/gltf-binary")
+	assert.Equal(t, "model/gltf-binary", mediaType)
+
+	mediaType, _ = negotiate(t, "application/*")
+	assert.Equal(t, JSONMediaType, mediaType)
+
+	mediaType, _ = negotiate(t, "application/x-protobuf, application/json")
+	assert.Equal(t, ProtobufMediaType, mediaType)
+
+	mediaType, _ = negotiate(t, "application/*;q=0.5, application/json;q=0")
+	assert.Equal(t, ProtobufMediaType, mediaType)
+}
+
+func TestRenderers_Negotiate_UnsupportedType_ReturnsNotAcceptable(t *testing.T) {
+	mediaType, err := negotiate(t, "text/html, application/json;q=0")
+	assert.Equal(t, "", mediaType)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusNotAcceptable, err.(HttpError).StatusCode())
+	}
+}
+
+func TestRenderers_Register_SameTypeTwice_ReplacesRenderer(t *testing.T) {
+	// Arrange
+	renderers := NewRenderers()
+	renderers.Register(JSONMediaType, NewProtobufResponseRenderer())
+	jsonRenderer := NewJSONResponseRenderer()
+
+	// Act
+	renderers.Register(JSONMediaType, jsonRenderer)
+
+	// Assert
+	assert.Equal(t, []string{JSONMediaType}, renderers.mediaTypes)
+	assert.Equal(t, jsonRenderer, renderers.Default())
+}
@@ -0,0 +1,90 @@
+package httpext
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/larsmoa/renderdb/protobuf"
+)
+
+// ProtobufMediaType is the media type of responses written by the protobuf
+// renderer.
+const ProtobufMediaType = "application/x-protobuf"
+
+type protobufResponseRenderer struct {
+}
+
+// NewProtobufResponseRenderer creates a renderer that outputs protocol
+// buffers messages as described by protobuf/renderdb.proto. Values must
+// implement protobuf.Marshaler, or be slices of such values, which are
+// written as a list message with the values as repeated field 1. Other
+// values are rejected with status 406 Not Acceptable. Errors are written
+// as the message 'Error'.
+func NewProtobufResponseRenderer() ResponseRenderer {
+	return &protobufResponseRenderer{}
+}
+
+func (r *protobufResponseRenderer) WriteEmpty(w http.ResponseWriter, statusCode int) {
+	w.WriteHeader(statusCode)
+}
+
+func (r *protobufResponseRenderer) WriteObject(w http.ResponseWriter, statusCode int, val interface{}) {
+	m, ok := protoMessage(val)
+	if !ok {
+		err := fmt.Errorf("Values of type '%T' cannot be written as %s", val, ProtobufMediaType)
+		r.WriteError(w, NewHttpError(err, http.StatusNotAcceptable))
+		return
+	}
+	r.write(w, statusCode, protobuf.Marshal(m))
+}
+
+func (r *protobufResponseRenderer) WriteError(w http.ResponseWriter, err error) {
+	var httpError HttpError
+	var ok bool
+	if httpError, ok = err.(HttpError); !ok {
+		httpError = NewHttpError(err, http.StatusInternalServerError)
+	}
+	r.write(w, httpError.StatusCode(), protobuf.Marshal(protoError{httpError}))
+}
+
+func (r *protobufResponseRenderer) write(w http.ResponseWriter, statusCode int, data []byte) {
+	w.Header().Set("Content-Type", ProtobufMediaType)
+	w.WriteHeader(statusCode)
+	w.Write(data)
+}
+
+// protoMessage returns the message to write for val, if any.
+func protoMessage(val interface{}) (protobuf.Marshaler, bool) {
+	if m, ok := val.(protobuf.Marshaler); ok {
+		return m, true
+	}
+	list := reflect.ValueOf(val)
+	marshalerType := reflect.TypeOf((*protobuf.Marshaler)(nil)).Elem()
+	if list.Kind() != reflect.Slice || !list.Type().Elem().Implements(marshalerType) {
+		return nil, false
+	}
+	return protoList{list}, true
+}
+
+// protoList is a list message, e.g. 'WorldList' in renderdb.proto.
+type protoList struct {
+	items reflect.Value
+}
+
+func (l protoList) MarshalProto(e *protobuf.Encoder) {
+	for i := 0; i < l.items.Len(); i++ {
+		item := l.items.Index(i).Interface().(protobuf.Marshaler)
+		e.WriteMessage(1, item)
+	}
+}
+
+// protoError is the message 'Error' in renderdb.proto.
+type protoError struct {
+	err HttpError
+}
+
+func (p protoError) MarshalProto(e *protobuf.Encoder) {
+	e.WriteInt64(1, int64(p.err.StatusCode()))
+	e.WriteString(2, p.err.Error())
+}
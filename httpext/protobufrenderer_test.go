@@ -0,0 +1,75 @@
+package httpext
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/larsmoa/renderdb/protobuf"
+	"github.com/stretchr/testify/assert"
+)
+
+type protoTestValue struct {
+	ID int64
+}
+
+func (v *protoTestValue) MarshalProto(e *protobuf.Encoder) {
+	e.WriteInt64(1, v.ID)
+}
+
+func TestProtobufResponseRenderer_WriteObject_Marshaler_WritesMessage(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+	renderer := NewProtobufResponseRenderer()
+
+	// Act
+	renderer.WriteObject(w, http.StatusCreated, &protoTestValue{5})
+
+	// Assert
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, ProtobufMediaType, w.Header().Get("Content-Type"))
+	assert.Equal(t, []byte{0x08, 5}, w.Body.Bytes())
+}
+
+func TestProtobufResponseRenderer_WriteObject_Slice_WritesListMessage(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+	renderer := NewProtobufResponseRenderer()
+
+	// Act
+	renderer.WriteObject(w, http.StatusOK, []*protoTestValue{{1}, {0}})
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	fields, err := protobuf.ReadFields(w.Body.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, []protobuf.Field{{Number: 1, Data: []byte{0x08, 1}}, {Number: 1, Data: []byte{}}}, fields)
+}
+
+func TestProtobufResponseRenderer_WriteObject_UnsupportedValue_WritesNotAcceptable(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+	renderer := NewProtobufResponseRenderer()
+
+	// Act
+	renderer.WriteObject(w, http.StatusOK, map[string]interface{}{"a": 1})
+
+	// Assert
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+}
+
+func TestProtobufResponseRenderer_WriteError_StandardError_WritesErrorMessage(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+	renderer := NewProtobufResponseRenderer()
+
+	// Act
+	renderer.WriteError(w, errors.New("message"))
+
+	// Assert
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	fields, err := protobuf.ReadFields(w.Body.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, []protobuf.Field{{Number: 1, Value: 500}, {Number: 2, Data: []byte("message")}}, fields)
+}
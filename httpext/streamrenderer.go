@@ -0,0 +1,109 @@
+package httpext
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// NDJSONMediaType is the media type of newline delimited JSON, i.e. one
+// JSON value per line.
+const NDJSONMediaType = "application/x-ndjson"
+
+// DefaultFlushInterval is the interval used by NewNDJSONStreamRenderer
+// when no interval is given.
+const DefaultFlushInterval = 100 * time.Millisecond
+
+// StreamRenderer writes values to the response as they are produced rather
+// than writing the whole response at once.
+type StreamRenderer interface {
+	// WriteStream writes the status code and then each value received on
+	// valCh until it's closed. If an error is received on errCh an error
+	// record is written and the stream ends. Returns the error received
+	// on errCh or the error that stopped the stream, if any.
+	WriteStream(w http.ResponseWriter, statusCode int, valCh <-chan interface{}, errCh <-chan error) error
+}
+
+// streamErrorRecord is the last record of a stream that ends because
+// of an error.
+type streamErrorRecord struct {
+	Error HttpError `json:"error"`
+}
+
+type ndjsonStreamRenderer struct {
+	flushInterval time.Duration
+}
+
+// NewNDJSONStreamRenderer creates a renderer that outputs each value as a
+// line of JSON (NDJSON). The response is flushed to the client at least
+// every flushInterval while values are written, so clients may process the
+// first values before the stream ends. A stream that ends because of an
+// error ends with the record {"error": {...}}, where the error is encoded
+// like the errors written by the JSON renderer. A flushInterval of zero
+// means DefaultFlushInterval.
+func NewNDJSONStreamRenderer(flushInterval time.Duration) StreamRenderer {
+	if flushInterval == 0 {
+		flushInterval = DefaultFlushInterval
+	}
+	return &ndjsonStreamRenderer{flushInterval}
+}
+
+func (r *ndjsonStreamRenderer) WriteStream(w http.ResponseWriter, statusCode int,
+	valCh <-chan interface{}, errCh <-chan error) error {
+
+	w.Header().Set("Content-Type", NDJSONMediaType)
+	w.WriteHeader(statusCode)
+
+	// Flush when values have been written since the last tick, and when
+	// the stream ends
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		flusher = noFlusher{}
+	}
+	defer flusher.Flush()
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+	pending := false
+
+	for {
+		select {
+		case val, more := <-valCh:
+			if !more {
+				return nil
+			}
+			buffer, err := json.Marshal(val)
+			if err != nil {
+				err = fmt.Errorf("Could not marshal value '%+v' of type '%T'", val, val)
+				r.writeError(w, err)
+				return err
+			}
+			if _, err = w.Write(append(buffer, '\n')); err != nil {
+				return err
+			}
+			pending = true
+		case err := <-errCh:
+			r.writeError(w, err)
+			return err
+		case <-ticker.C:
+			if pending {
+				flusher.Flush()
+				pending = false
+			}
+		}
+	}
+}
+
+// noFlusher is used when the response writer doesn't support flushing.
+type noFlusher struct{}
+
+func (noFlusher) Flush() {}
+
+// writeError writes the error record ending a stream.
+func (r *ndjsonStreamRenderer) writeError(w http.ResponseWriter, err error) {
+	httpError, ok := err.(HttpError)
+	if !ok {
+		httpError = NewHttpError(err, http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(streamErrorRecord{httpError})
+}
@@ -0,0 +1,83 @@
+package httpext
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createStream emulates a producer that sends the values given, and an
+// error if the last value is an error.
+func createStream(values ...interface{}) (<-chan interface{}, <-chan error) {
+	valCh := make(chan interface{})
+	errCh := make(chan error)
+	go func() {
+		defer close(valCh)
+		for _, v := range values {
+			if err, ok := v.(error); ok {
+				errCh <- err
+				return
+			}
+			valCh <- v
+		}
+	}()
+	return valCh, errCh
+}
+
+func TestNDJSONStreamRenderer_WriteStream_Values_WritesOneLinePerValue(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+	renderer := NewNDJSONStreamRenderer(time.Millisecond)
+	valCh, errCh := createStream(map[string]int{"id": 1}, map[string]int{"id": 2})
+
+	// Act
+	err := renderer.WriteStream(w, http.StatusOK, valCh, errCh)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, NDJSONMediaType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"id\":1}\n{\"id\":2}\n", w.Body.String())
+	assert.True(t, w.Flushed)
+}
+
+func TestNDJSONStreamRenderer_WriteStream_ErrorMidStream_WritesErrorRecord(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+	renderer := NewNDJSONStreamRenderer(0)
+	valCh, errCh := createStream(1, NewHttpError(errors.New("failed"), http.StatusConflict), 2)
+
+	// Act
+	err := renderer.WriteStream(w, http.StatusOK, valCh, errCh)
+
+	// Assert
+	assert.Error(t, err)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "1", lines[0])
+		record := map[string]map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+		assert.Equal(t, 409.0, record["error"]["statusCode"])
+		assert.Equal(t, "failed", record["error"]["errorMessage"])
+	}
+}
+
+func TestNDJSONStreamRenderer_WriteStream_CannotMarshal_WritesErrorRecord(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+	renderer := NewNDJSONStreamRenderer(0)
+	valCh, errCh := createStream(1, func() {})
+
+	// Act
+	err := renderer.WriteStream(w, http.StatusOK, valCh, errCh)
+
+	// Assert
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "1\n{\"error\":{\"statusCode\":500"))
+}
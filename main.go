@@ -3,11 +3,18 @@ package main
 //go:generate go run _gogenerate/generate_mocks.go
 
 import (
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"golang.org/x/net/http2" // FIXME 20160214: Remove when Go 1.6 is released
 
@@ -30,15 +37,24 @@ type applicationArgs struct {
 	useHTTP2           bool
 	tlsCertFile        string
 	tlsKeyFile         string
+	snapshotDir        string
+	snapshotInterval   time.Duration
 }
 
+// shutdownTimeout is how long to wait for requests in progress when
+// shutting down.
+const shutdownTimeout = 30 * time.Second
+
 type application struct {
-	args applicationArgs
-	db   *sqlx.DB
-	repo repository.Repository
+	args  applicationArgs
+	db    *sqlx.DB
+	repos repository.Repositories
 
-	webHandler *negroni.Negroni
-	router     *mux.Router
+	webHandler  *negroni.Negroni
+	router      *mux.Router
+	server      *http.Server
+	listener    net.Listener
+	connections *connectionTracker
 }
 
 func (a *application) parseArguments() error {
@@ -53,6 +69,10 @@ func (a *application) parseArguments() error {
 		"TLS private key to use to secure the HTTP link.")
 	flag.BoolVar(&a.args.useHTTP2, "http2", false,
 		"Enable HTTP2 support. Requires TLS certification and private key.")
+	flag.StringVar(&a.args.snapshotDir, "snapshots", "",
+		"Directory for snapshots of the spatial indices, which avoids loading all geometry from the database on startup.")
+	flag.DurationVar(&a.args.snapshotInterval, "snapshotInterval", 5*time.Minute,
+		"How often to save snapshots of spatial indices modified since the last snapshot.")
 	flag.Parse()
 	return nil
 }
@@ -76,12 +96,41 @@ func (a *application) initializeDatabase() error {
 }
 
 func (a *application) initializeRepository() error {
-	// var err error
-	// a.repo, err = repository.NewRepository(a.db)
-	// return err
+	// Spatial indices are loaded on first access of each world
+	if a.args.snapshotDir == "" {
+		a.repos = repository.NewRepositories()
+		return nil
+	}
+	if err := os.MkdirAll(a.args.snapshotDir, 0755); err != nil {
+		return err
+	}
+	a.repos = repository.NewRepositoriesWithSnapshots(a.args.snapshotDir)
 	return nil
 }
 
+// saveSnapshots saves snapshots of the spatial indices modified since they
+// were loaded or saved, see repository.Repositories.SaveSnapshots.
+func (a *application) saveSnapshots() {
+	if err := a.repos.SaveSnapshots(); err != nil {
+		log.Printf("Could not save snapshots (reason: %v)\n", err)
+	}
+}
+
+// saveSnapshotsPeriodically saves snapshots every snapshotInterval until
+// stop is closed.
+func (a *application) saveSnapshotsPeriodically(stop <-chan struct{}) {
+	ticker := time.NewTicker(a.args.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.saveSnapshots()
+		case <-stop:
+			return
+		}
+	}
+}
+
 func (a *application) initializeRoutes() error {
 	a.webHandler = negroni.New(negroni.NewRecovery(), negroni.NewLogger())
 
@@ -89,24 +138,27 @@ func (a *application) initializeRoutes() error {
 	a.webHandler.UseHandler(a.router)
 
 	routes.NewStaticController(a.router)
-	routes.RegisterWorldsRoutes(a.router, a.db)
-	routes.RegisterLayersRoutes(a.router, a.db)
-	routes.RegisterScenesRoutes(a.router, a.db)
+	routes.RegisterWorldsRoutes(a.router, a.db, a.repos)
+	routes.RegisterLayersRoutes(a.router, a.db, a.repos)
+	routes.RegisterScenesRoutes(a.router, a.db, a.repos)
+	routes.RegisterGeometryRoutes(a.router, a.db, a.repos)
 
 	return nil
 }
 
 func (a *application) initializeServer() error {
-	srv := &http.Server{
-		Addr:    a.args.serverAddress,
-		Handler: a.router,
+	a.connections = newConnectionTracker()
+	a.server = &http.Server{
+		Addr:      a.args.serverAddress,
+		Handler:   a.router,
+		ConnState: a.connections.setState,
 	}
 
 	// Use HTTP 2?
 	protocolVersion := "1.1"
 	if a.args.useHTTP2 {
 		protocolVersion = "2"
-		http2.ConfigureServer(srv,
+		http2.ConfigureServer(a.server,
 			&http2.Server{
 				MaxHandlers:          10,
 				MaxConcurrentStreams: 50,
@@ -114,16 +166,136 @@ func (a *application) initializeServer() error {
 	}
 
 	// TLS certificate/key
-	if a.args.tlsCertFile != "" && a.args.tlsKeyFile != "" {
-		fmt.Printf("Serving at %s using HTTPS/%s...", a.args.serverAddress, protocolVersion)
-		return srv.ListenAndServeTLS(a.args.tlsCertFile, a.args.tlsKeyFile)
-	} else if a.args.tlsCertFile != "" || a.args.tlsKeyFile != "" {
+	useTLS := a.args.tlsCertFile != "" && a.args.tlsKeyFile != ""
+	if !useTLS && (a.args.tlsCertFile != "" || a.args.tlsKeyFile != "") {
 		return errors.New("Must provide both TLS certificate and private key.")
-	} else if a.args.useHTTP2 {
+	} else if !useTLS && a.args.useHTTP2 {
 		return errors.New("Must provide TLS certificate and private key when using HTTP/2.")
 	}
-	fmt.Printf("Serving at %s using HTTP/%s...", a.args.serverAddress, protocolVersion)
-	return srv.ListenAndServe()
+
+	listener, err := net.Listen("tcp", a.args.serverAddress)
+	if err != nil {
+		return err
+	}
+	if useTLS {
+		config := a.server.TLSConfig
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.NextProtos == nil {
+			config.NextProtos = []string{"http/1.1"}
+		}
+		certificate, err := tls.LoadX509KeyPair(a.args.tlsCertFile, a.args.tlsKeyFile)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+		listener = tls.NewListener(listener, config)
+		fmt.Printf("Serving at %s using HTTPS/%s...", a.args.serverAddress, protocolVersion)
+	} else {
+		fmt.Printf("Serving at %s using HTTP/%s...", a.args.serverAddress, protocolVersion)
+	}
+	a.listener = listener
+	return nil
+}
+
+// serve serves requests until the server fails or the process is asked to
+// terminate. On termination the server stops accepting connections and
+// waits (up to shutdownTimeout) for requests in progress before saving
+// snapshots of the spatial indices.
+func (a *application) serve() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if a.args.snapshotDir != "" {
+		stop := make(chan struct{})
+		defer a.saveSnapshots()
+		defer close(stop)
+		go a.saveSnapshotsPeriodically(stop)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- a.server.Serve(a.listener)
+	}()
+	select {
+	case err := <-serveErr:
+		return err
+	case <-signals:
+	}
+
+	log.Println("Shutting down...")
+	a.listener.Close()
+	<-serveErr
+	a.server.SetKeepAlivesEnabled(false)
+	if !a.connections.closeAndWait(shutdownTimeout) {
+		log.Println("Timed out waiting for requests in progress")
+	}
+	return nil
+}
+
+// connectionTracker keeps track of the connections of a server, so that
+// the server can wait for requests in progress when shutting down.
+type connectionTracker struct {
+	lock sync.Mutex
+	// idle holds whether each open connection is idle
+	idle    map[net.Conn]bool
+	closing bool
+	closed  chan struct{}
+}
+
+func newConnectionTracker() *connectionTracker {
+	return &connectionTracker{idle: make(map[net.Conn]bool)}
+}
+
+// setState is used as http.Server.ConnState.
+func (t *connectionTracker) setState(c net.Conn, state http.ConnState) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	switch state {
+	case http.StateNew, http.StateActive:
+		t.idle[c] = false
+	case http.StateIdle:
+		if t.closing {
+			c.Close()
+		}
+		t.idle[c] = true
+	case http.StateHijacked, http.StateClosed:
+		delete(t.idle, c)
+		if t.closed != nil && len(t.idle) == 0 {
+			close(t.closed)
+			t.closed = nil
+		}
+	}
+}
+
+// closeAndWait closes idle connections, and connections that become idle,
+// and waits until all connections are closed. Returns false if the
+// connections were not closed within timeout.
+func (t *connectionTracker) closeAndWait(timeout time.Duration) bool {
+	t.lock.Lock()
+	t.closing = true
+	if len(t.idle) == 0 {
+		t.lock.Unlock()
+		return true
+	}
+	closed := make(chan struct{})
+	t.closed = closed
+	for c, idle := range t.idle {
+		if idle {
+			c.Close()
+		}
+	}
+	t.lock.Unlock()
+
+	select {
+	case <-closed:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
 
 func (a *application) run() (int, error) {
@@ -136,6 +308,7 @@ func (a *application) run() (int, error) {
 	if err != nil {
 		return 2, err
 	}
+	defer a.db.Close()
 
 	err = a.initializeRepository()
 	if err != nil {
@@ -152,6 +325,10 @@ func (a *application) run() (int, error) {
 		return 5, err
 	}
 
+	err = a.serve()
+	if err != nil {
+		return 6, err
+	}
 	return 0, nil
 }
 
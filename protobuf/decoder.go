@@ -0,0 +1,55 @@
+package protobuf
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Field is a field of an encoded message.
+type Field struct {
+	Number int
+	// Value holds the value of varint and 64-bit fields. 64-bit fields
+	// hold the bits of the value, e.g. math.Float64bits(v) for doubles.
+	Value uint64
+	// Data holds the value of length delimited fields, i.e. strings,
+	// bytes, embedded messages and packed repeated fields.
+	Data []byte
+}
+
+// ReadFields reads the fields of an encoded message. Embedded messages
+// may be read by calling ReadFields with the data of the field.
+func ReadFields(data []byte) ([]Field, error) {
+	fields := []Field{}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("Invalid field key")
+		}
+		data = data[n:]
+		f := Field{Number: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			if f.Value, n = binary.Uvarint(data); n <= 0 {
+				return nil, fmt.Errorf("Invalid varint in field %d", f.Number)
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, fmt.Errorf("Unexpected end of data in field %d", f.Number)
+			}
+			f.Value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireLengthDelimited:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, fmt.Errorf("Invalid length of field %d", f.Number)
+			}
+			f.Data = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return nil, fmt.Errorf("Unsupported wire type %d in field %d", key&7, f.Number)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
@@ -0,0 +1,127 @@
+// Package protobuf implements the subset of the protocol buffers wire
+// format needed to encode the messages in renderdb.proto. Messages are
+// encoded by types implementing Marshaler, which write their fields to an
+// Encoder in field number order.
+package protobuf
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Wire types, see https://developers.google.com/protocol-buffers/docs/encoding
+const (
+	wireVarint          = 0
+	wireFixed64         = 1
+	wireLengthDelimited = 2
+)
+
+// Marshaler is implemented by types that can be encoded as a protocol
+// buffers message.
+type Marshaler interface {
+	// MarshalProto writes the fields of the message to e.
+	MarshalProto(e *Encoder)
+}
+
+// Marshal returns the encoding of the message given.
+func Marshal(m Marshaler) []byte {
+	e := Encoder{}
+	m.MarshalProto(&e)
+	return e.Bytes()
+}
+
+// Encoder writes fields of a protocol buffers message. Scalar fields
+// holding the default (zero) value are omitted as in proto3.
+type Encoder struct {
+	buffer []byte
+}
+
+// Bytes returns the encoded message.
+func (e *Encoder) Bytes() []byte {
+	return e.buffer
+}
+
+func (e *Encoder) writeUvarint(v uint64) {
+	var buffer [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buffer[:], v)
+	e.buffer = append(e.buffer, buffer[:n]...)
+}
+
+func (e *Encoder) writeKey(field int, wireType int) {
+	e.writeUvarint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (e *Encoder) writeLengthDelimited(field int, data []byte) {
+	e.writeKey(field, wireLengthDelimited)
+	e.writeUvarint(uint64(len(data)))
+	e.buffer = append(e.buffer, data...)
+}
+
+// WriteInt64 writes an int64 (or int32) field.
+func (e *Encoder) WriteInt64(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	e.writeKey(field, wireVarint)
+	e.writeUvarint(uint64(v))
+}
+
+// WriteDouble writes a double field.
+func (e *Encoder) WriteDouble(field int, v float64) {
+	if v == 0 {
+		return
+	}
+	e.writeKey(field, wireFixed64)
+	var buffer [8]byte
+	binary.LittleEndian.PutUint64(buffer[:], math.Float64bits(v))
+	e.buffer = append(e.buffer, buffer[:]...)
+}
+
+// WriteString writes a string field.
+func (e *Encoder) WriteString(field int, s string) {
+	if s == "" {
+		return
+	}
+	e.writeLengthDelimited(field, []byte(s))
+}
+
+// WriteBytes writes a bytes field. The data is written as is.
+func (e *Encoder) WriteBytes(field int, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	e.writeLengthDelimited(field, data)
+}
+
+// WriteMessage writes an embedded message field. Nil messages are
+// omitted.
+func (e *Encoder) WriteMessage(field int, m Marshaler) {
+	if m == nil {
+		return
+	}
+	e.writeLengthDelimited(field, Marshal(m))
+}
+
+// WritePackedInt64 writes a packed repeated int64 field.
+func (e *Encoder) WritePackedInt64(field int, values []int64) {
+	if len(values) == 0 {
+		return
+	}
+	packed := Encoder{}
+	for _, v := range values {
+		packed.writeUvarint(uint64(v))
+	}
+	e.writeLengthDelimited(field, packed.buffer)
+}
+
+// WritePackedDouble writes a packed repeated double field.
+func (e *Encoder) WritePackedDouble(field int, values []float64) {
+	if len(values) == 0 {
+		return
+	}
+	packed := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(packed[8*i:], math.Float64bits(v))
+	}
+	e.writeLengthDelimited(field, packed)
+}
@@ -0,0 +1,71 @@
+package protobuf
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMessage struct {
+	id     int64
+	name   string
+	values []float64
+	child  *testMessage
+}
+
+func (m *testMessage) MarshalProto(e *Encoder) {
+	e.WriteInt64(1, m.id)
+	e.WriteString(2, m.name)
+	e.WritePackedDouble(3, m.values)
+	if m.child != nil {
+		e.WriteMessage(4, m.child)
+	}
+}
+
+func TestMarshal_Message_WritesWireFormat(t *testing.T) {
+	// Arrange
+	m := &testMessage{id: 150, name: "testing"}
+
+	// Act
+	data := Marshal(m)
+
+	// Assert: example from the protocol buffers encoding documentation
+	assert.Equal(t, []byte{0x08, 0x96, 0x01, 0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}, data)
+}
+
+func TestMarshal_ZeroValues_OmitsFields(t *testing.T) {
+	assert.Empty(t, Marshal(&testMessage{}))
+}
+
+func TestReadFields_MarshaledMessage_ReturnsFields(t *testing.T) {
+	// Arrange
+	m := &testMessage{id: -1, values: []float64{1.5, -2}, child: &testMessage{name: "child"}}
+
+	// Act
+	fields, err := ReadFields(Marshal(m))
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.Len(t, fields, 3) {
+		assert.Equal(t, 1, fields[0].Number)
+		assert.Equal(t, int64(-1), int64(fields[0].Value))
+		assert.Equal(t, 3, fields[1].Number)
+		assert.Len(t, fields[1].Data, 16)
+		assert.Equal(t, 4, fields[2].Number)
+		child, err := ReadFields(fields[2].Data)
+		assert.NoError(t, err)
+		assert.Equal(t, []Field{{Number: 2, Data: []byte("child")}}, child)
+	}
+}
+
+func TestReadFields_InvalidData_ReturnsError(t *testing.T) {
+	data := Marshal(&testMessage{name: "name"})
+	_, err := ReadFields(data[:len(data)-1])
+	assert.Error(t, err)
+
+	e := Encoder{}
+	e.WriteDouble(1, math.Pi)
+	_, err = ReadFields(e.Bytes()[:5])
+	assert.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package repository
+
+import "github.com/larsmoa/renderdb/db"
+
+// lodObject replaces the geometry of an object with a simplified
+// version (level of detail).
+type lodObject struct {
+	db.Object
+	lod db.LOD
+}
+
+func (o *lodObject) GeometryData() []byte {
+	return o.lod.GeometryData
+}
+
+func (o *lodObject) GeometryFormat() string {
+	return o.lod.GeometryFormat
+}
+
+func (o *lodObject) TriangleCount() int {
+	return o.lod.TriangleCount
+}
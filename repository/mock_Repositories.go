@@ -0,0 +1,51 @@
+package repository
+
+import "github.com/stretchr/testify/mock"
+
+import "github.com/larsmoa/renderdb/db"
+
+type MockRepositories struct {
+	mock.Mock
+}
+
+// Get provides a mock function with given fields: worldID, objects
+func (_m *MockRepositories) Get(worldID int64, objects db.Objects) (Repository, error) {
+	ret := _m.Called(worldID, objects)
+
+	var r0 Repository
+	if rf, ok := ret.Get(0).(func(int64, db.Objects) Repository); ok {
+		r0 = rf(worldID, objects)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(Repository)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int64, db.Objects) error); ok {
+		r1 = rf(worldID, objects)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Evict provides a mock function with given fields: worldID
+func (_m *MockRepositories) Evict(worldID int64) {
+	_m.Called(worldID)
+}
+
+// SaveSnapshots provides a mock function with given fields:
+func (_m *MockRepositories) SaveSnapshots() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -0,0 +1,204 @@
+package repository
+
+import "github.com/stretchr/testify/mock"
+
+import "github.com/larsmoa/renderdb/db"
+import "github.com/ungerik/go3d/float64/vec3"
+
+type MockRepository struct {
+	mock.Mock
+}
+
+// Add provides a mock function with given fields: o
+func (_m *MockRepository) Add(o db.Object) (int64, error) {
+	ret := _m.Called(o)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(db.Object) int64); ok {
+		r0 = rf(o)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(db.Object) error); ok {
+		r1 = rf(o)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Replace provides a mock function with given fields: selectors, objects
+func (_m *MockRepository) Replace(selectors []db.ObjectSelector, objects []db.Object) ([]int64, error) {
+	ret := _m.Called(selectors, objects)
+
+	var r0 []int64
+	if rf, ok := ret.Get(0).(func([]db.ObjectSelector, []db.Object) []int64); ok {
+		r0 = rf(selectors, objects)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]int64)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]db.ObjectSelector, []db.Object) error); ok {
+		r1 = rf(selectors, objects)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReplaceInBatches provides a mock function with given fields: selectors, nextBatch
+func (_m *MockRepository) ReplaceInBatches(selectors []db.ObjectSelector, nextBatch func() ([]db.Object, error)) ([]int64, error) {
+	ret := _m.Called(selectors, nextBatch)
+
+	var r0 []int64
+	if rf, ok := ret.Get(0).(func([]db.ObjectSelector, func() ([]db.Object, error)) []int64); ok {
+		r0 = rf(selectors, nextBatch)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]int64)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]db.ObjectSelector, func() ([]db.Object, error)) error); ok {
+		r1 = rf(selectors, nextBatch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Remove provides a mock function with given fields: selectors
+func (_m *MockRepository) Remove(selectors ...db.ObjectSelector) error {
+	_va := make([]interface{}, len(selectors))
+	for _i := range selectors {
+		_va[_i] = selectors[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(...db.ObjectSelector) error); ok {
+		r0 = rf(selectors...)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Commit provides a mock function with given fields:
+func (_m *MockRepository) Commit() {
+	_m.Called()
+}
+
+// GetInsideVolume provides a mock function with given fields: done, bounds, options
+func (_m *MockRepository) GetInsideVolume(done <-chan struct{}, bounds vec3.Box, options ...interface{}) (<-chan db.Object, <-chan error) {
+	var _ca []interface{}
+	_ca = append(_ca, done, bounds)
+	_ca = append(_ca, options...)
+	ret := _m.Called(_ca...)
+
+	var r0 <-chan db.Object
+	if rf, ok := ret.Get(0).(func(<-chan struct{}, vec3.Box, ...interface{}) <-chan db.Object); ok {
+		r0 = rf(done, bounds, options...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(<-chan db.Object)
+		}
+	}
+
+	var r1 <-chan error
+	if rf, ok := ret.Get(1).(func(<-chan struct{}, vec3.Box, ...interface{}) <-chan error); ok {
+		r1 = rf(done, bounds, options...)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(<-chan error)
+		}
+	}
+
+	return r0, r1
+}
+
+// GetInsideVolumeIDs provides a mock function with given fields: bounds, options
+func (_m *MockRepository) GetInsideVolumeIDs(bounds vec3.Box, options ...interface{}) ([]int64, error) {
+	var _ca []interface{}
+	_ca = append(_ca, bounds)
+	_ca = append(_ca, options...)
+	ret := _m.Called(_ca...)
+
+	var r0 []int64
+	if rf, ok := ret.Get(0).(func(vec3.Box, ...interface{}) []int64); ok {
+		r0 = rf(bounds, options...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]int64)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(vec3.Box, ...interface{}) error); ok {
+		r1 = rf(bounds, options...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetWithIDs provides a mock function with given fields: ids
+func (_m *MockRepository) GetWithIDs(ids []int64) (<-chan db.Object, <-chan error) {
+	ret := _m.Called(ids)
+
+	var r0 <-chan db.Object
+	if rf, ok := ret.Get(0).(func([]int64) <-chan db.Object); ok {
+		r0 = rf(ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(<-chan db.Object)
+		}
+	}
+
+	var r1 <-chan error
+	if rf, ok := ret.Get(1).(func([]int64) <-chan error); ok {
+		r1 = rf(ids)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(<-chan error)
+		}
+	}
+
+	return r0, r1
+}
+
+// GetWithID provides a mock function with given fields: id
+func (_m *MockRepository) GetWithID(id int64) (db.Object, error) {
+	ret := _m.Called(id)
+
+	var r0 db.Object
+	if rf, ok := ret.Get(0).(func(int64) db.Object); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(db.Object)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int64) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
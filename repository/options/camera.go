@@ -0,0 +1,109 @@
+package options
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// Camera describes a perspective camera used by camera-based options
+// such as FrustumCull.
+type Camera struct {
+	// Position is the location of the camera ('the eye').
+	Position vec3.T
+	// Direction is the viewing direction of the camera.
+	Direction vec3.T
+	// Up is the up-vector of the camera. Must not be parallel to Direction.
+	Up vec3.T
+	// FieldOfView is the vertical field of view in degrees.
+	FieldOfView float64
+	// AspectRatio is the ratio between the width and the height of the viewport.
+	AspectRatio float64
+	// Near is the distance to the near clipping plane.
+	Near float64
+	// Far is the distance to the far clipping plane.
+	Far float64
+}
+
+// Verify returns an error if the camera parameters does not describe a
+// valid perspective camera.
+func (c *Camera) Verify() error {
+	if c.Direction.IsZero() {
+		return fmt.Errorf("Camera direction cannot be zero")
+	}
+	right := vec3.Cross(&c.Direction, &c.Up)
+	if right.LengthSqr() < 1e-12 {
+		return fmt.Errorf("Camera up-vector must be non-zero and not parallel to direction")
+	}
+	if c.FieldOfView <= 0 || c.FieldOfView >= 180 {
+		return fmt.Errorf("Field of view must be between 0 and 180 degrees, but was %g", c.FieldOfView)
+	}
+	if c.AspectRatio <= 0 {
+		return fmt.Errorf("Aspect ratio must be positive, but was %g", c.AspectRatio)
+	}
+	if c.Near <= 0 || c.Far <= c.Near {
+		return fmt.Errorf("Near and far planes must satisfy 0 < near < far, but was %g and %g", c.Near, c.Far)
+	}
+	return nil
+}
+
+// basis returns the normalized forward, right and up vectors of the camera.
+func (c *Camera) basis() (forward, right, up vec3.T) {
+	forward = c.Direction.Normalized()
+	right = vec3.Cross(&forward, &c.Up)
+	right.Normalize()
+	up = vec3.Cross(&right, &forward)
+	return
+}
+
+// plane represents the plane n·p + d = 0. Points where n·p + d >= 0
+// are considered to be inside the plane.
+type plane struct {
+	normal vec3.T
+	d      float64
+}
+
+func newPlane(normal vec3.T, point *vec3.T) plane {
+	normal.Normalize()
+	return plane{normal, -vec3.Dot(&normal, point)}
+}
+
+// isBoxOutside returns true if the box is fully outside the plane.
+func (p *plane) isBoxOutside(box *vec3.Box) bool {
+	// Test the corner of the box that is furthest along the normal
+	corner := box.Min
+	for i := 0; i < 3; i++ {
+		if p.normal[i] >= 0 {
+			corner[i] = box.Max[i]
+		}
+	}
+	return vec3.Dot(&p.normal, &corner)+p.d < 0
+}
+
+// frustumPlanes returns the six planes of the view frustum of the camera
+// with normals pointing into the frustum.
+func (c *Camera) frustumPlanes() [6]plane {
+	forward, right, up := c.basis()
+	tanY := math.Tan(c.FieldOfView * math.Pi / 360.0)
+	tanX := tanY * c.AspectRatio
+
+	nearPoint := forward.Scaled(c.Near)
+	nearPoint.Add(&c.Position)
+	farPoint := forward.Scaled(c.Far)
+	farPoint.Add(&c.Position)
+
+	sideNormal := func(side *vec3.T, tan float64, sign float64) vec3.T {
+		n := forward.Scaled(tan)
+		s := side.Scaled(sign)
+		return *n.Add(&s)
+	}
+	return [6]plane{
+		newPlane(forward, &nearPoint),
+		newPlane(forward.Inverted(), &farPoint),
+		newPlane(sideNormal(&right, tanX, 1), &c.Position),  // Left
+		newPlane(sideNormal(&right, tanX, -1), &c.Position), // Right
+		newPlane(sideNormal(&up, tanY, 1), &c.Position),     // Bottom
+		newPlane(sideNormal(&up, tanY, -1), &c.Position),    // Top
+	}
+}
@@ -0,0 +1,33 @@
+package options
+
+import "github.com/ungerik/go3d/float64/vec3"
+
+// FrustumCull removes objects that are fully outside the view frustum
+// of a camera, i.e. objects that cannot be visible from the camera. The
+// test is conservative, so some objects outside the frustum might be
+// kept. The camera must be valid (see Camera.Verify).
+type FrustumCull struct {
+	Camera Camera
+}
+
+// Apply returns the indices of the bounds that intersect the view frustum.
+// The order of the bounds is preserved.
+func (o FrustumCull) Apply(bounds []*vec3.Box) []int {
+	planes := o.Camera.frustumPlanes()
+	indices := make([]int, 0, len(bounds))
+	for i, b := range bounds {
+		if isInsideFrustum(&planes, b) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+func isInsideFrustum(planes *[6]plane, box *vec3.Box) bool {
+	for i := range planes {
+		if planes[i].isBoxOutside(box) {
+			return false
+		}
+	}
+	return true
+}
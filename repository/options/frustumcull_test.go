@@ -0,0 +1,107 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// createCamera creates a camera at origo looking along the positive X-axis
+// with a 90 degree field of view.
+func createCamera() Camera {
+	return Camera{
+		Position:    vec3.T{0, 0, 0},
+		Direction:   vec3.T{1, 0, 0},
+		Up:          vec3.T{0, 0, 1},
+		FieldOfView: 90,
+		AspectRatio: 1,
+		Near:        0.1,
+		Far:         100,
+	}
+}
+
+func TestCamera_Verify_ValidCamera_ReturnsNoError(t *testing.T) {
+	camera := createCamera()
+	assert.NoError(t, camera.Verify())
+}
+
+func TestCamera_Verify_InvalidCamera_ReturnsError(t *testing.T) {
+	invalid := []func(c *Camera){
+		func(c *Camera) { c.Direction = vec3.T{} },
+		func(c *Camera) { c.Up = vec3.T{2, 0, 0} },
+		func(c *Camera) { c.FieldOfView = 180 },
+		func(c *Camera) { c.AspectRatio = 0 },
+		func(c *Camera) { c.Near = 0 },
+		func(c *Camera) { c.Far = c.Near },
+	}
+	for i, modify := range invalid {
+		camera := createCamera()
+		modify(&camera)
+		assert.Error(t, camera.Verify(), "Case %d", i)
+	}
+}
+
+func TestFrustumCull_BoxInFront_IsKept(t *testing.T) {
+	// Arrange
+	opt := FrustumCull{createCamera()}
+	bounds := []*vec3.Box{createBox(vec3.T{10, 0, 0}, 1)}
+
+	// Act
+	indices := opt.Apply(bounds)
+
+	// Assert
+	assert.Equal(t, []int{0}, indices)
+}
+
+func TestFrustumCull_BoxesOutsideEachPlane_AreRemoved(t *testing.T) {
+	// Arrange
+	opt := FrustumCull{createCamera()}
+	bounds := []*vec3.Box{
+		createBox(vec3.T{-10, 0, 0}, 1),  // Behind
+		createBox(vec3.T{200, 0, 0}, 1),  // Beyond far plane
+		createBox(vec3.T{10, 20, 0}, 1),  // Left
+		createBox(vec3.T{10, -20, 0}, 1), // Right
+		createBox(vec3.T{10, 0, 20}, 1),  // Above
+		createBox(vec3.T{10, 0, -20}, 1), // Below
+	}
+
+	// Act
+	indices := opt.Apply(bounds)
+
+	// Assert
+	assert.Empty(t, indices)
+}
+
+func TestFrustumCull_BoxIntersectingPlane_IsKept(t *testing.T) {
+	// Arrange
+	opt := FrustumCull{createCamera()}
+	bounds := []*vec3.Box{
+		createBox(vec3.T{10, 0, 0}, 1),
+		createBox(vec3.T{10, 10, 0}, 1), // Intersects left plane
+		createBox(vec3.T{10, 20, 0}, 1),
+	}
+
+	// Act
+	indices := opt.Apply(bounds)
+
+	// Assert
+	assert.Equal(t, []int{0, 1}, indices)
+}
+
+func TestFrustumCull_AspectRatio_WidensHorizontalView(t *testing.T) {
+	// Arrange
+	camera := createCamera()
+	camera.AspectRatio = 2
+	opt := FrustumCull{camera}
+	bounds := []*vec3.Box{
+		createBox(vec3.T{10, 15, 0}, 1), // Inside horizontally
+		createBox(vec3.T{10, 0, 15}, 1), // Outside vertically
+	}
+
+	// Act
+	indices := opt.Apply(bounds)
+
+	// Assert
+	assert.Equal(t, []int{0}, indices)
+}
@@ -0,0 +1,29 @@
+package options
+
+import "github.com/ungerik/go3d/float64/vec3"
+
+// LevelOfDetail selects simplified geometry for objects far away from Eye.
+// Distances holds the distances (in ascending order) where the level of
+// detail increases, i.e. objects closer than Distances[0] use the full
+// resolution geometry, objects between Distances[0] and Distances[1] use
+// level 1 and so on. The distance is measured to the closest point of the
+// bounds of each object.
+type LevelOfDetail struct {
+	Eye       vec3.T
+	Distances []float64
+}
+
+// SelectLevels returns the level of detail for each of the bounds.
+func (o LevelOfDetail) SelectLevels(bounds []*vec3.Box) []int {
+	levels := make([]int, len(bounds))
+	for i, b := range bounds {
+		sqDist := sqDistToClosestPointOnBox(&o.Eye, b)
+		for _, d := range o.Distances {
+			if sqDist < d*d {
+				break
+			}
+			levels[i]++
+		}
+	}
+	return levels
+}
@@ -0,0 +1,31 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func TestLevelOfDetail_SelectLevels_DifferentDistances_ReturnsCorrectLevels(t *testing.T) {
+	// Arrange
+	opt := LevelOfDetail{Eye: vec3.T{0, 0, 0}, Distances: []float64{10, 100}}
+	bounds := []*vec3.Box{
+		createBox(vec3.T{0, 0, 0}, 1),
+		createBox(vec3.T{0, 0, 50}, 1),
+		createBox(vec3.T{0, 0, 500}, 1),
+		createBox(vec3.T{0, 0, 500}, 1000), // Large box close to eye
+	}
+
+	// Act
+	levels := opt.SelectLevels(bounds)
+
+	// Assert
+	assert.Equal(t, []int{0, 1, 2, 0}, levels)
+}
+
+func TestLevelOfDetail_SelectLevels_NoDistances_ReturnsFullResolution(t *testing.T) {
+	opt := LevelOfDetail{Eye: vec3.T{0, 0, 0}}
+	levels := opt.SelectLevels([]*vec3.Box{createBox(vec3.T{0, 0, 500}, 1)})
+	assert.Equal(t, []int{0}, levels)
+}
@@ -0,0 +1,104 @@
+package options
+
+import (
+	"sort"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// occlusionSampleShrink is the fraction each corner sample point is moved
+// towards the center of the box, to avoid rays grazing the edges of
+// neighbouring geometry.
+const occlusionSampleShrink = 0.1
+
+// OcclusionCull removes objects that are hidden behind large objects closer
+// to the eye. Rays are cast from the eye towards the center and the corners
+// of the bounds of each object, and the object is removed if all rays are
+// blocked by one of the occluders. The occluders are the MaxOccluders objects
+// nearest to the eye with a bounding box diagonal of at least MinOccluderSize.
+// The test is a heuristic; objects that are only visible between the
+// sample points might be removed. The order of the objects is preserved.
+type OcclusionCull struct {
+	Eye             vec3.T
+	MinOccluderSize float64
+	MaxOccluders    int
+}
+
+// SelectOccluders returns the indices of the bounds of the large objects
+// nearest to the eye.
+func (o OcclusionCull) SelectOccluders(bounds []*vec3.Box) []int {
+	minSqSize := o.MinOccluderSize * o.MinOccluderSize
+	candidates := byDistance{o.Eye, bounds, make([]int, 0)}
+	for i, b := range bounds {
+		diagonal := b.Diagonal()
+		if diagonal.LengthSqr() >= minSqSize {
+			candidates.indices = append(candidates.indices, i)
+		}
+	}
+	sort.Stable(candidates)
+
+	if len(candidates.indices) > o.MaxOccluders {
+		candidates.indices = candidates.indices[:o.MaxOccluders]
+	}
+	return candidates.indices
+}
+
+// Apply returns the indices of the bounds that are not hidden behind the
+// occluders. Occluders are never removed.
+func (o OcclusionCull) Apply(bounds []*vec3.Box, occluders map[int]Occluder) []int {
+	indices := make([]int, 0, len(bounds))
+	for i, b := range bounds {
+		if _, isOccluder := occluders[i]; isOccluder || !o.isOccluded(b, bounds, occluders) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// isOccluded returns true if the rays towards all sample points of the box
+// are blocked by an occluder.
+func (o OcclusionCull) isOccluded(box *vec3.Box, bounds []*vec3.Box, occluders map[int]Occluder) bool {
+	if box.Contains(&o.Eye) {
+		return false
+	}
+	for _, p := range samplePoints(box) {
+		if !o.isRayBlocked(&p, bounds, occluders) {
+			return false
+		}
+	}
+	return true
+}
+
+// isRayBlocked returns true if any of the occluders intersect the line
+// segment between the eye and target.
+func (o OcclusionCull) isRayBlocked(target *vec3.T, bounds []*vec3.Box, occluders map[int]Occluder) bool {
+	direction := vec3.Sub(target, &o.Eye)
+	sqLength := direction.LengthSqr()
+	for i, occluder := range occluders {
+		// Occluders further away than the target cannot block the ray
+		if sqDistToClosestPointOnBox(&o.Eye, bounds[i]) > sqLength {
+			continue
+		}
+		if t, hit := occluder.RayIntersection(&o.Eye, &direction); hit && t < 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// samplePoints returns the center of the box and its corners moved slightly
+// towards the center.
+func samplePoints(box *vec3.Box) []vec3.T {
+	center := box.Center()
+	points := []vec3.T{center}
+	for i := 0; i < 8; i++ {
+		corner := box.Min
+		for axis := uint(0); axis < 3; axis++ {
+			if i&(1<<axis) != 0 {
+				corner[axis] = box.Max[axis]
+			}
+		}
+		points = append(points, vec3.Interpolate(&corner, &center, occlusionSampleShrink))
+	}
+	return points
+}
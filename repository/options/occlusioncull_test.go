@@ -0,0 +1,92 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// planeOccluder blocks all rays crossing the plane z = Z inside the square
+// [-Size, Size] x [-Size, Size].
+type planeOccluder struct {
+	Z    float64
+	Size float64
+}
+
+func (o planeOccluder) RayIntersection(origin, direction *vec3.T) (float64, bool) {
+	if direction[2] == 0 {
+		return 0, false
+	}
+	t := (o.Z - origin[2]) / direction[2]
+	x, y := origin[0]+t*direction[0], origin[1]+t*direction[1]
+	if t < 0 || x < -o.Size || x > o.Size || y < -o.Size || y > o.Size {
+		return 0, false
+	}
+	return t, true
+}
+
+func TestOcclusionCull_SelectOccluders_ReturnsNearestLargeObjects(t *testing.T) {
+	// Arrange
+	opt := OcclusionCull{Eye: vec3.T{0, 0, 0}, MinOccluderSize: 1.5, MaxOccluders: 2}
+	bounds := []*vec3.Box{
+		createBox(vec3.T{0, 0, 5}, 2),
+		createBox(vec3.T{0, 0, 2}, 0.5), // Too small
+		createBox(vec3.T{0, 0, 3}, 1),
+		createBox(vec3.T{0, 0, 10}, 3), // Too far away
+	}
+
+	// Act
+	indices := opt.SelectOccluders(bounds)
+
+	// Assert
+	assert.Equal(t, []int{2, 0}, indices)
+}
+
+func TestOcclusionCull_Apply_ObjectFullyBehindOccluder_IsRemoved(t *testing.T) {
+	// Arrange
+	opt := OcclusionCull{Eye: vec3.T{0, 0, 0}}
+	bounds := []*vec3.Box{
+		createBox(vec3.T{0, 0, 1}, 0.1),
+		createBox(vec3.T{0, 0, 5}, 1),
+	}
+	occluders := map[int]Occluder{0: planeOccluder{Z: 1, Size: 10}}
+
+	// Act
+	indices := opt.Apply(bounds, occluders)
+
+	// Assert
+	assert.Equal(t, []int{0}, indices)
+}
+
+func TestOcclusionCull_Apply_ObjectPartiallyBehindOccluder_IsKept(t *testing.T) {
+	// Arrange
+	opt := OcclusionCull{Eye: vec3.T{0, 0, 0}}
+	bounds := []*vec3.Box{
+		createBox(vec3.T{0, 0, 1}, 0.1),
+		createBox(vec3.T{2.5, 0, 5}, 2),
+	}
+	occluders := map[int]Occluder{0: planeOccluder{Z: 1, Size: 0.5}}
+
+	// Act
+	indices := opt.Apply(bounds, occluders)
+
+	// Assert
+	assert.Equal(t, []int{0, 1}, indices)
+}
+
+func TestOcclusionCull_Apply_ObjectInFrontOfOccluder_IsKept(t *testing.T) {
+	// Arrange
+	opt := OcclusionCull{Eye: vec3.T{0, 0, 0}}
+	bounds := []*vec3.Box{
+		createBox(vec3.T{0, 0, 5}, 0.1),
+		createBox(vec3.T{0, 0, 2}, 1),
+	}
+	occluders := map[int]Occluder{0: planeOccluder{Z: 5, Size: 10}}
+
+	// Act
+	indices := opt.Apply(bounds, occluders)
+
+	// Assert
+	assert.Equal(t, []int{0, 1}, indices)
+}
@@ -10,7 +10,7 @@ import (
 
 // FilterGeometryOption is an interface to operations that filter/reshuffled
 // elements based on geometry (bounds). This can e.g. be operations that
-// cut of small objects far away or sorting objects by distance.
+// cut off small objects far away (ScreenSpaceSizeCull) or sorting objects by distance.
 type FilterGeometryOption interface {
 	// Apply filters or reshuffles elements by looking at the bounds.
 	// Returns indices relative to the collection of bounds of the filtered/reshuffled
@@ -18,11 +18,64 @@ type FilterGeometryOption interface {
 	Apply(bounds []*vec3.Box) []int
 }
 
+// TriangleCounter is implemented by elements that know the number of
+// triangles in their geometry.
+type TriangleCounter interface {
+	TriangleCount() int
+}
+
+// FilterTrianglesOption is an interface to operations that filter elements
+// based on bounds and the number of triangles in each element, e.g. to
+// restrict the amount of geometry returned.
+type FilterTrianglesOption interface {
+	// Apply filters elements by looking at the bounds and triangle counts.
+	// Returns indices relative to the collection of bounds of the kept
+	// elements.
+	Apply(bounds []*vec3.Box, triangleCounts []int) []int
+}
+
+// LevelOfDetailOption is an interface to operations that choose which level
+// of detail of the geometry to use for each element, e.g. based on distance.
+type LevelOfDetailOption interface {
+	// SelectLevels returns the level of detail for each of the bounds.
+	// Level 0 is the full resolution geometry and higher levels are
+	// increasingly simplified.
+	SelectLevels(bounds []*vec3.Box) []int
+}
+
+// Occluder is geometry that may block the view of other objects.
+type Occluder interface {
+	// RayIntersection returns the distance to the nearest intersection between
+	// the ray and the geometry, measured in units of the length of direction.
+	// The second return value is false if the ray doesn't intersect the geometry.
+	RayIntersection(origin, direction *vec3.T) (float64, bool)
+}
+
+// FilterOccludedOption is an interface to operations that filter elements
+// based on bounds and the exact geometry of a few selected elements, e.g.
+// occlusion culling.
+type FilterOccludedOption interface {
+	// SelectOccluders returns indices relative to the collection of bounds of the
+	// elements whose geometry is needed by Apply.
+	SelectOccluders(bounds []*vec3.Box) []int
+	// Apply filters elements by looking at the bounds and the geometry of the
+	// elements selected by SelectOccluders (keyed by index in bounds). Returns
+	// indices relative to the collection of bounds of the kept elements.
+	Apply(bounds []*vec3.Box, occluders map[int]Occluder) []int
+}
+
+// OccluderLoader loads the geometry of the objects given. The result must
+// have the same order as objects.
+type OccluderLoader func(objects []rtreego.Spatial) ([]Occluder, error)
+
 // VerifyAllAreOptions checks that all provided arguments are valid options.
 func VerifyAllAreOptions(opts ...interface{}) error {
 	for i, o := range opts {
 		_, isOption := o.(FilterGeometryOption)
-		if !isOption {
+		_, isTrianglesOption := o.(FilterTrianglesOption)
+		_, isOccludedOption := o.(FilterOccludedOption)
+		_, isLODOption := o.(LevelOfDetailOption)
+		if !isOption && !isTrianglesOption && !isOccludedOption && !isLODOption {
 			return fmt.Errorf("Argument %d (%T: %+v) is not a valid option", i, o, o)
 		}
 	}
@@ -35,16 +88,68 @@ func ApplyAllFilterGeometryOptions(objects []rtreego.Spatial, opts ...interface{
 	for _, o := range opts {
 		if option, ok := o.(FilterGeometryOption); ok {
 			bounds := conversion.SpatialSliceToBoundsSlice(objects)
-			keptIndices := option.Apply(bounds)
+			objects = pick(objects, option.Apply(bounds))
+		}
+	}
+
+	return objects
+}
 
-			// Apply filter/shuffle
-			keep := make([]rtreego.Spatial, len(keptIndices))
-			for i, j := range keptIndices {
-				keep[i] = objects[j]
+// ApplyAllOptions applies all FilterGeometryOption, FilterTrianglesOption and
+// FilterOccludedOption from the opts provided on the unfiltered objects-list given.
+// The filters are applied in the order they are provided. The geometry needed by
+// FilterOccludedOptions is retrieved using loader. FilterTrianglesOptions require
+// that the objects implement TriangleCounter.
+func ApplyAllOptions(objects []rtreego.Spatial, loader OccluderLoader, opts ...interface{}) ([]rtreego.Spatial, error) {
+	for _, o := range opts {
+		switch option := o.(type) {
+		case FilterGeometryOption:
+			objects = ApplyAllFilterGeometryOptions(objects, option)
+		case FilterTrianglesOption:
+			triangleCounts := make([]int, len(objects))
+			for i, x := range objects {
+				counter, ok := x.(TriangleCounter)
+				if !ok {
+					return nil, fmt.Errorf("Object %d (%T) does not provide a triangle count", i, x)
+				}
+				triangleCounts[i] = counter.TriangleCount()
+			}
+			bounds := conversion.SpatialSliceToBoundsSlice(objects)
+			objects = pick(objects, option.Apply(bounds, triangleCounts))
+		case FilterOccludedOption:
+			bounds := conversion.SpatialSliceToBoundsSlice(objects)
+			occluderIndices := option.SelectOccluders(bounds)
+			loaded, err := loader(pick(objects, occluderIndices))
+			if err != nil {
+				return nil, err
 			}
-			objects = keep
+			occluders := make(map[int]Occluder, len(occluderIndices))
+			for i, j := range occluderIndices {
+				occluders[j] = loaded[i]
+			}
+			objects = pick(objects, option.Apply(bounds, occluders))
 		}
 	}
+	return objects, nil
+}
 
-	return objects
+// SelectLevels returns the level of detail for each of the objects given using
+// the last LevelOfDetailOption in opts. Returns nil if there is no such option.
+func SelectLevels(objects []rtreego.Spatial, opts ...interface{}) []int {
+	var levels []int
+	for _, o := range opts {
+		if option, ok := o.(LevelOfDetailOption); ok {
+			levels = option.SelectLevels(conversion.SpatialSliceToBoundsSlice(objects))
+		}
+	}
+	return levels
+}
+
+// pick returns the objects at the given indices in order.
+func pick(objects []rtreego.Spatial, indices []int) []rtreego.Spatial {
+	picked := make([]rtreego.Spatial, len(indices))
+	for i, j := range indices {
+		picked[i] = objects[j]
+	}
+	return picked
 }
@@ -1,6 +1,7 @@
 package options
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/dhconnelly/rtreego"
@@ -76,3 +77,85 @@ func Test_ApplyAllFilterGeometryOptions_OptionKeepsFirst_ReturnsFirstOnly(t *tes
 	// Assert
 	assert.EqualValues(t, []rtreego.Spatial{objects[0]}, result)
 }
+
+type stubFilterOccludedOption struct {
+	occluderIndices []int
+}
+
+func (s stubFilterOccludedOption) SelectOccluders(bounds []*vec3.Box) []int {
+	return s.occluderIndices
+}
+
+func (s stubFilterOccludedOption) Apply(bounds []*vec3.Box, occluders map[int]Occluder) []int {
+	indices := []int{}
+	for i := range occluders {
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+func Test_ApplyAllOptions_FilterOccludedOption_LoadsOccluders(t *testing.T) {
+	// Arrange
+	objects := []rtreego.Spatial{
+		stubSpatial{vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}},
+		stubSpatial{vec3.Box{vec3.T{0, 0, 0}, vec3.T{2, 2, 2}}},
+	}
+	var loaded []rtreego.Spatial
+	loader := func(occluders []rtreego.Spatial) ([]Occluder, error) {
+		loaded = occluders
+		return make([]Occluder, len(occluders)), nil
+	}
+
+	// Act
+	result, err := ApplyAllOptions(objects, loader, stubFilterOccludedOption{[]int{1}})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []rtreego.Spatial{objects[1]}, loaded)
+	assert.Equal(t, []rtreego.Spatial{objects[1]}, result)
+}
+
+func Test_ApplyAllOptions_LoaderFails_ReturnsError(t *testing.T) {
+	// Arrange
+	objects := []rtreego.Spatial{stubSpatial{vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}}}
+	loader := func(occluders []rtreego.Spatial) ([]Occluder, error) {
+		return nil, errors.New("error")
+	}
+
+	// Act
+	_, err := ApplyAllOptions(objects, loader, stubFilterOccludedOption{[]int{0}})
+
+	// Assert
+	assert.Error(t, err)
+}
+
+type stubTriangleSpatial struct {
+	stubSpatial
+	triangleCount int
+}
+
+func (s stubTriangleSpatial) TriangleCount() int {
+	return s.triangleCount
+}
+
+func Test_ApplyAllOptions_FilterTrianglesOption_UsesTriangleCounts(t *testing.T) {
+	// Arrange
+	box := vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}
+	objects := []rtreego.Spatial{
+		stubTriangleSpatial{stubSpatial{box}, 10},
+		stubTriangleSpatial{stubSpatial{box}, 20},
+	}
+
+	// Act
+	result, err := ApplyAllOptions(objects, nil, TriangleBudget{MaxTriangles: 15})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, objects[:1], result)
+}
+
+func Test_ApplyAllOptions_FilterTrianglesOptionWithoutCounts_ReturnsError(t *testing.T) {
+	objects := []rtreego.Spatial{stubSpatial{vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}}}
+	_, err := ApplyAllOptions(objects, nil, TriangleBudget{MaxTriangles: 15})
+	assert.Error(t, err)
+}
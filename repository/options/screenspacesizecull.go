@@ -0,0 +1,51 @@
+package options
+
+import (
+	"math"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// ScreenSpaceSizeCull removes objects that appear smaller than MinPixelSize
+// pixels on screen when viewed from Eye, e.g. tiny objects far away. The
+// projected size is estimated from the bounding sphere of each box, so
+// the test is independent of the viewing direction. The order of the
+// objects is preserved.
+type ScreenSpaceSizeCull struct {
+	Eye vec3.T
+	// FieldOfView is the vertical field of view in degrees.
+	FieldOfView float64
+	// ViewportHeight is the height of the viewport in pixels.
+	ViewportHeight float64
+	// MinPixelSize is the smallest projected size in pixels of objects
+	// that are kept.
+	MinPixelSize float64
+}
+
+// Apply returns the indices of the bounds with a projected size of at
+// least MinPixelSize.
+func (o ScreenSpaceSizeCull) Apply(bounds []*vec3.Box) []int {
+	// Number of pixels covered by an object of unit size at unit distance
+	pixelsPerUnit := o.ViewportHeight / (2 * math.Tan(o.FieldOfView*math.Pi/360))
+
+	indices := make([]int, 0, len(bounds))
+	for i, b := range bounds {
+		if o.projectedSize(b, pixelsPerUnit) >= o.MinPixelSize {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// projectedSize estimates the size in pixels of the box on screen.
+func (o ScreenSpaceSizeCull) projectedSize(box *vec3.Box, pixelsPerUnit float64) float64 {
+	center := box.Center()
+	diagonal := box.Diagonal()
+	radius := diagonal.Length() / 2
+	distance := vec3.Distance(&o.Eye, &center)
+	if distance <= radius {
+		// Eye is inside the bounding sphere
+		return math.Inf(1)
+	}
+	return 2 * radius / distance * pixelsPerUnit
+}
@@ -0,0 +1,53 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func TestScreenSpaceSizeCull_Apply_SameSizeDifferentDistance_RemovesDistant(t *testing.T) {
+	// Arrange
+	// With 90 degrees field of view and 100 pixels viewport, an object of
+	// unit size at unit distance covers 50 pixels
+	opt := ScreenSpaceSizeCull{vec3.T{0, 0, 0}, 90, 100, 10}
+	bounds := []*vec3.Box{
+		createBox(vec3.T{0, 0, 10}, 1),
+		createBox(vec3.T{0, 0, 1}, 1),
+	}
+
+	// Act
+	indices := opt.Apply(bounds)
+
+	// Assert
+	assert.Equal(t, []int{1}, indices)
+}
+
+func TestScreenSpaceSizeCull_Apply_SameDistanceDifferentSize_RemovesSmall(t *testing.T) {
+	// Arrange
+	opt := ScreenSpaceSizeCull{vec3.T{0, 0, 0}, 90, 100, 10}
+	bounds := []*vec3.Box{
+		createBox(vec3.T{0, 0, 10}, 3),
+		createBox(vec3.T{0, 0, 10}, 0.5),
+		createBox(vec3.T{10, 0, 0}, 2),
+	}
+
+	// Act
+	indices := opt.Apply(bounds)
+
+	// Assert
+	assert.Equal(t, []int{0, 2}, indices)
+}
+
+func TestScreenSpaceSizeCull_Apply_EyeInsideBox_KeepsBox(t *testing.T) {
+	// Arrange
+	opt := ScreenSpaceSizeCull{vec3.T{0, 0, 0}, 90, 100, 1e6}
+	bounds := []*vec3.Box{createBox(vec3.T{0, 0, 0}, 0.1)}
+
+	// Act
+	indices := opt.Apply(bounds)
+
+	// Assert
+	assert.Equal(t, []int{0}, indices)
+}
@@ -0,0 +1,25 @@
+package options
+
+import "github.com/ungerik/go3d/float64/vec3"
+
+// TriangleBudget restricts the total number of triangles returned. Objects
+// are kept in the order given until the next object would exceed the budget,
+// so the option should be applied after sorting (e.g. SortByDistance) to
+// return the most important objects.
+type TriangleBudget struct {
+	MaxTriangles int
+}
+
+// Apply returns the indices of the first bounds that fit within the budget.
+func (o TriangleBudget) Apply(bounds []*vec3.Box, triangleCounts []int) []int {
+	indices := make([]int, 0, len(bounds))
+	remaining := o.MaxTriangles
+	for i, count := range triangleCounts {
+		if count > remaining {
+			break
+		}
+		remaining -= count
+		indices = append(indices, i)
+	}
+	return indices
+}
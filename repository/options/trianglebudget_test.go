@@ -0,0 +1,47 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func TestTriangleBudget_Apply_BudgetExceeded_ReturnsFirstWithinBudget(t *testing.T) {
+	// Arrange
+	opt := TriangleBudget{MaxTriangles: 100}
+	bounds := make([]*vec3.Box, 4)
+	triangleCounts := []int{40, 60, 10, 1}
+
+	// Act
+	indices := opt.Apply(bounds, triangleCounts)
+
+	// Assert
+	assert.Equal(t, []int{0, 1}, indices)
+}
+
+func TestTriangleBudget_Apply_FirstExceedsBudget_ReturnsEmpty(t *testing.T) {
+	// Arrange
+	opt := TriangleBudget{MaxTriangles: 10}
+	bounds := make([]*vec3.Box, 2)
+	triangleCounts := []int{20, 1}
+
+	// Act
+	indices := opt.Apply(bounds, triangleCounts)
+
+	// Assert
+	assert.Empty(t, indices)
+}
+
+func TestTriangleBudget_Apply_WithinBudget_ReturnsAll(t *testing.T) {
+	// Arrange
+	opt := TriangleBudget{MaxTriangles: 10}
+	bounds := make([]*vec3.Box, 3)
+	triangleCounts := []int{2, 0, 8}
+
+	// Act
+	indices := opt.Apply(bounds, triangleCounts)
+
+	// Assert
+	assert.Equal(t, []int{0, 1, 2}, indices)
+}
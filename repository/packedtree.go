@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"math"
+	"sort"
+
+	"github.com/dhconnelly/rtreego"
+)
+
+// packedTree is a static R-tree bulk loaded using Sort-Tile-Recursive
+// (STR) packing. Building the tree is a few sorts of the entries, which is
+// much faster than inserting the entries one by one, and the nodes are
+// fully packed. Entries cannot be added or removed after the tree is built.
+type packedTree struct {
+	// entries in STR order, each leaf holds a range of the entries
+	entries []*rtreeEntry
+	boxes   []packedBox
+	// levels holds the nodes of each level of the tree. levels[0] holds the
+	// leaves, and each node in the other levels holds a range of the nodes
+	// in the level below. The last level holds the root.
+	levels [][]packedNode
+}
+
+type packedNode struct {
+	bounds packedBox
+	first  int
+	count  int
+}
+
+// packedBox holds the min (0-2) and max (3-5) corner of a box.
+type packedBox [6]float64
+
+func newPackedBox(rect *rtreego.Rect) packedBox {
+	b := packedBox{}
+	if rect == nil {
+		return b
+	}
+	for i := 0; i < 3; i++ {
+		b[i] = rect.PointCoord(i)
+		b[i+3] = b[i] + rect.LengthsCoord(i)
+	}
+	return b
+}
+
+func (b *packedBox) join(other *packedBox) {
+	for i := 0; i < 3; i++ {
+		b[i] = math.Min(b[i], other[i])
+		b[i+3] = math.Max(b[i+3], other[i+3])
+	}
+}
+
+// intersects returns true if the boxes overlap. Boxes that only touch
+// don't intersect, as in rtreego.
+func (b *packedBox) intersects(other *packedBox) bool {
+	for i := 0; i < 3; i++ {
+		if other[i+3] <= b[i] || b[i+3] <= other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// newPackedTree builds a tree holding the entries with at most capacity
+// children in each node. The slice given is not modified.
+func newPackedTree(entries []*rtreeEntry, capacity int) *packedTree {
+	boxes := make([]packedBox, len(entries))
+	for i, e := range entries {
+		boxes[i] = newPackedBox(e.bounds)
+	}
+	order := strOrder(boxes, capacity)
+	t := &packedTree{entries: make([]*rtreeEntry, len(entries))}
+	t.boxes = make([]packedBox, len(entries))
+	for i, j := range order {
+		t.entries[i] = entries[j]
+		t.boxes[i] = boxes[j]
+	}
+
+	level := packNodes(t.boxes, capacity)
+	for len(level) > 0 {
+		t.levels = append(t.levels, level)
+		if len(level) == 1 {
+			break
+		}
+
+		// Sort the nodes of this level and pack them into parents
+		boxes = make([]packedBox, len(level))
+		for i := range level {
+			boxes[i] = level[i].bounds
+		}
+		order = strOrder(boxes, capacity)
+		sortedLevel := make([]packedNode, len(level))
+		for i, j := range order {
+			sortedLevel[i] = level[j]
+			boxes[i] = level[j].bounds
+		}
+		t.levels[len(t.levels)-1] = sortedLevel
+		level = packNodes(boxes, capacity)
+	}
+	return t
+}
+
+// packNodes creates one node for each run of capacity boxes.
+func packNodes(boxes []packedBox, capacity int) []packedNode {
+	nodes := make([]packedNode, 0, (len(boxes)+capacity-1)/capacity)
+	for first := 0; first < len(boxes); first += capacity {
+		count := capacity
+		if first+count > len(boxes) {
+			count = len(boxes) - first
+		}
+		bounds := boxes[first]
+		for i := first + 1; i < first+count; i++ {
+			bounds.join(&boxes[i])
+		}
+		nodes = append(nodes, packedNode{bounds, first, count})
+	}
+	return nodes
+}
+
+// strOrder returns the order of the boxes after STR sorting, i.e. such
+// that runs of capacity boxes are spatially close. The boxes are sorted
+// along x into S slabs, each slab is sorted along y into S strips and
+// each strip is sorted along z, where S is the cube root of the number of
+// runs.
+func strOrder(boxes []packedBox, capacity int) []int {
+	order := make([]int, len(boxes))
+	for i := range order {
+		order[i] = i
+	}
+	runs := (len(boxes) + capacity - 1) / capacity
+	slabs := int(math.Ceil(math.Cbrt(float64(runs))))
+	stripSize := slabs * capacity
+	slabSize := slabs * stripSize
+
+	sort.Sort(&byCenter{order, boxes, 0})
+	for slab := 0; slab < len(order); slab += slabSize {
+		slabOrder := order[slab:minInt(slab+slabSize, len(order))]
+		sort.Sort(&byCenter{slabOrder, boxes, 1})
+		for strip := 0; strip < len(slabOrder); strip += stripSize {
+			stripOrder := slabOrder[strip:minInt(strip+stripSize, len(slabOrder))]
+			sort.Sort(&byCenter{stripOrder, boxes, 2})
+		}
+	}
+	return order
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// byCenter sorts indices of boxes by the center of the boxes along an axis.
+type byCenter struct {
+	order []int
+	boxes []packedBox
+	axis  int
+}
+
+func (s *byCenter) Len() int {
+	return len(s.order)
+}
+
+func (s *byCenter) Less(i, j int) bool {
+	a, b := &s.boxes[s.order[i]], &s.boxes[s.order[j]]
+	return a[s.axis]+a[s.axis+3] < b[s.axis]+b[s.axis+3]
+}
+
+func (s *byCenter) Swap(i, j int) {
+	s.order[i], s.order[j] = s.order[j], s.order[i]
+}
+
+// searchIntersect returns the entries that intersect rect.
+func (t *packedTree) searchIntersect(rect *rtreego.Rect) []*rtreeEntry {
+	results := []*rtreeEntry{}
+	if len(t.levels) == 0 {
+		return results
+	}
+	bounds := newPackedBox(rect)
+	root := len(t.levels) - 1
+	return t.search(&bounds, root, t.levels[root], results)
+}
+
+func (t *packedTree) search(bounds *packedBox, level int, nodes []packedNode, results []*rtreeEntry) []*rtreeEntry {
+	for i := range nodes {
+		node := &nodes[i]
+		if !node.bounds.intersects(bounds) {
+			continue
+		}
+		if level > 0 {
+			results = t.search(bounds, level-1, t.levels[level-1][node.first:node.first+node.count], results)
+			continue
+		}
+		for j := node.first; j < node.first+node.count; j++ {
+			if t.boxes[j].intersects(bounds) {
+				results = append(results, t.entries[j])
+			}
+		}
+	}
+	return results
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/larsmoa/renderdb/conversion"
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func createRandomEntries(count int) []*rtreeEntry {
+	random := rand.New(rand.NewSource(1))
+	entries := make([]*rtreeEntry, count)
+	for i := range entries {
+		min := vec3.T{random.Float64() * 100, random.Float64() * 100, random.Float64() * 10}
+		size := vec3.T{0.1 + random.Float64()*5, 0.1 + random.Float64()*5, 0.1 + random.Float64()}
+		max := vec3.Add(&min, &size)
+		entries[i] = &rtreeEntry{id: int64(i + 1), bounds: conversion.BoxToRect(&vec3.Box{Min: min, Max: max})}
+	}
+	return entries
+}
+
+func sortedIDs(entries []*rtreeEntry) []int {
+	ids := make([]int, len(entries))
+	for i, e := range entries {
+		ids[i] = int(e.id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func TestPackedTree_SearchIntersect_ManyEntries_ReturnsSameAsLinearSearch(t *testing.T) {
+	// Arrange
+	entries := createRandomEntries(5000)
+	tree := newPackedTree(entries, 10)
+	query := vec3.Box{Min: vec3.T{20, 30, 2}, Max: vec3.T{40, 45, 4}}
+	queryBox := newPackedBox(conversion.BoxToRect(&query))
+	expected := []*rtreeEntry{}
+	for _, e := range entries {
+		b := newPackedBox(e.bounds)
+		if b.intersects(&queryBox) {
+			expected = append(expected, e)
+		}
+	}
+
+	// Act
+	results := tree.searchIntersect(conversion.BoxToRect(&query))
+
+	// Assert
+	assert.NotEmpty(t, expected)
+	assert.Equal(t, sortedIDs(expected), sortedIDs(results))
+	assert.Len(t, tree.levels, 4)
+	assert.Len(t, tree.levels[3], 1)
+}
+
+func TestPackedTree_SearchIntersect_NoEntries_ReturnsEmpty(t *testing.T) {
+	tree := newPackedTree(nil, 10)
+	assert.Empty(t, tree.searchIntersect(conversion.BoxToRect(&vec3.Box{Max: vec3.T{1, 1, 1}})))
+}
+
+func TestSpatialIndex_SearchIntersect_RemovedAndInsertedEntries_ReturnsCurrentEntries(t *testing.T) {
+	// Arrange
+	entries := createRandomEntries(100)
+	for i, e := range entries {
+		e.sceneID = int64(i % 2)
+	}
+	index := newPackedSpatialIndex(entries)
+	inserted := &rtreeEntry{id: 1000, sceneID: 2, bounds: conversion.BoxToRect(&vec3.Box{Min: vec3.T{1, 1, 1}, Max: vec3.T{2, 2, 2}})}
+	everything := conversion.BoxToRect(&vec3.Box{Min: vec3.T{-1, -1, -1}, Max: vec3.T{200, 200, 200}})
+
+	// Act
+	removed := []int64{}
+	for _, e := range entries {
+		if e.sceneID == 0 {
+			removed = append(removed, e.id)
+		}
+	}
+	index.apply(&indexChange{removed: removed, added: []*rtreeEntry{inserted}})
+	results := index.searchIntersect(everything)
+
+	// Assert
+	assert.Len(t, results, 51)
+	assert.Equal(t, 51, index.size())
+	for _, x := range results {
+		assert.NotEqual(t, int64(0), x.(*rtreeEntry).sceneID)
+	}
+}
+
+func TestSpatialIndex_Apply_ChangesAppliedOutOfOrder_ReturnsCurrentEntries(t *testing.T) {
+	// Arrange
+	index := newPackedSpatialIndex(createRandomEntries(2))
+	added := &rtreeEntry{id: 1000, bounds: conversion.BoxToRect(&vec3.Box{Min: vec3.T{1, 1, 1}, Max: vec3.T{2, 2, 2}})}
+	first := &indexChange{removed: []int64{1}, added: []*rtreeEntry{added}}
+	second := &indexChange{removed: []int64{1000}}
+	everything := conversion.BoxToRect(&vec3.Box{Min: vec3.T{-1, -1, -1}, Max: vec3.T{200, 200, 200}})
+
+	// Act
+	index.apply(second)
+	index.apply(first)
+	results := index.searchIntersect(everything)
+
+	// Assert
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, int64(2), results[0].(*rtreeEntry).id)
+	}
+	assert.Equal(t, 1, index.size())
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	"github.com/larsmoa/renderdb/db"
+)
+
+// Repositories keeps the spatial index of each world in memory between
+// requests. Objects are retrieved using the db.Objects provided to Get, which
+// allows a repository to use the transaction of the current request.
+type Repositories interface {
+	// Get returns a repository for the world with the given ID. The spatial
+	// index of the world is loaded using objects on first access.
+	Get(worldID int64, objects db.Objects) (Repository, error)
+	// Evict discards the spatial index of the world with the given ID. The
+	// index is reloaded from the database on next access.
+	Evict(worldID int64)
+	// SaveSnapshots saves snapshots of the spatial indices that have changed
+	// since they were loaded or saved, if snapshots are enabled. Returns the
+	// first error encountered, but attempts to save all snapshots.
+	SaveSnapshots() error
+}
+
+// NewRepositories creates an empty set of repositories.
+func NewRepositories() Repositories {
+	return &defaultRepositories{worlds: make(map[int64]*worldIndex)}
+}
+
+// NewRepositoriesWithSnapshots creates an empty set of repositories that
+// keeps snapshots of the spatial indices as files in dir, which must exist.
+// On first access of a world the index is read from its snapshot if the
+// version of the snapshot matches the version of the objects in the
+// database (see db.Objects.Version). Otherwise the index is loaded from the
+// database and a new snapshot is written. Snapshots of indices modified
+// later are written by SaveSnapshots.
+func NewRepositoriesWithSnapshots(dir string) Repositories {
+	return &defaultRepositories{
+		worlds:    make(map[int64]*worldIndex),
+		snapshots: &snapshotStore{dir},
+	}
+}
+
+type defaultRepositories struct {
+	// lock guards worlds only, indices are loaded and saved without holding
+	// it so that requests to other worlds aren't blocked
+	lock   sync.Mutex
+	worlds map[int64]*worldIndex
+	// snapshots is nil if snapshots are disabled
+	snapshots *snapshotStore
+	// saveLock serializes writing and removing snapshots in SaveSnapshots
+	// and Evict
+	saveLock sync.Mutex
+}
+
+// worldIndex holds the spatial index of a world, which is loaded by the
+// first request to the world while later requests wait for it.
+type worldIndex struct {
+	// loaded is closed when index or err has been set
+	loaded chan struct{}
+	index  *spatialIndex
+	err    error
+	// saved holds the version of the last snapshot saved of the index, or
+	// nil if no snapshot has been saved. Guarded by saveLock after loading.
+	saved *db.ObjectsVersion
+}
+
+// isLoaded returns true if the index has been loaded successfully.
+func (w *worldIndex) isLoaded() bool {
+	select {
+	case <-w.loaded:
+		return w.err == nil
+	default:
+		return false
+	}
+}
+
+func (r *defaultRepositories) Get(worldID int64, objects db.Objects) (Repository, error) {
+	r.lock.Lock()
+	w, found := r.worlds[worldID]
+	if !found {
+		w = &worldIndex{loaded: make(chan struct{})}
+		r.worlds[worldID] = w
+	}
+	r.lock.Unlock()
+
+	if found {
+		<-w.loaded
+	} else {
+		w.index, w.saved, w.err = r.loadIndex(worldID, objects)
+		close(w.loaded)
+	}
+	if w.err != nil {
+		// Load again on next access
+		r.lock.Lock()
+		if r.worlds[worldID] == w {
+			delete(r.worlds, worldID)
+		}
+		r.lock.Unlock()
+		return nil, w.err
+	}
+	return &defaultRepository{database: objects, index: w.index}, nil
+}
+
+// loadIndex loads the spatial index of the world from its snapshot, if
+// enabled and up to date, or from the database. Returns the version of the
+// snapshot of the index, or nil if there is none.
+func (r *defaultRepositories) loadIndex(worldID int64, objects db.Objects) (*spatialIndex, *db.ObjectsVersion, error) {
+	if r.snapshots == nil {
+		entries, err := loadEntries(objects)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newPackedSpatialIndex(entries), nil, nil
+	}
+
+	version, err := objects.Version()
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := r.snapshots.load(worldID, version)
+	if err == nil {
+		log.Printf("Loaded %d geometry objects from snapshot of world %d\n", len(entries), worldID)
+		index := newPackedSpatialIndex(entries)
+		index.trackVersion(version)
+		return index, &version, nil
+	}
+	if !os.IsNotExist(err) {
+		log.Printf("Rebuilding spatial index of world %d (reason: %v)\n", worldID, err)
+	}
+
+	if entries, err = loadEntries(objects); err != nil {
+		return nil, nil, err
+	}
+	var saved *db.ObjectsVersion
+	if err = r.snapshots.save(worldID, version, entries); err != nil {
+		log.Printf("Could not save snapshot of world %d (reason: %v)\n", worldID, err)
+	} else {
+		saved = &version
+	}
+	index := newPackedSpatialIndex(entries)
+	index.trackVersion(version)
+	return index, saved, nil
+}
+
+func (r *defaultRepositories) Evict(worldID int64) {
+	r.lock.Lock()
+	delete(r.worlds, worldID)
+	r.lock.Unlock()
+
+	if r.snapshots != nil {
+		r.saveLock.Lock()
+		defer r.saveLock.Unlock()
+		if err := r.snapshots.remove(worldID); err != nil {
+			log.Printf("Could not remove snapshot of world %d (reason: %v)\n", worldID, err)
+		}
+	}
+}
+
+func (r *defaultRepositories) SaveSnapshots() error {
+	if r.snapshots == nil {
+		return nil
+	}
+	r.saveLock.Lock()
+	defer r.saveLock.Unlock()
+
+	// Indices that are still loading are skipped, a snapshot is saved when
+	// they have been loaded
+	r.lock.Lock()
+	worlds := make(map[int64]*worldIndex, len(r.worlds))
+	for worldID, w := range r.worlds {
+		if w.isLoaded() {
+			worlds[worldID] = w
+		}
+	}
+	r.lock.Unlock()
+
+	var firstErr error
+	for worldID, w := range worlds {
+		w.index.lock.RLock()
+		var version db.ObjectsVersion
+		var entries []*rtreeEntry
+		if w.index.version != nil && (w.saved == nil || *w.index.version != *w.saved) {
+			version = *w.index.version
+			entries = w.index.allEntries()
+		}
+		w.index.lock.RUnlock()
+		if entries == nil {
+			// Unchanged, or the version is unknown
+			continue
+		}
+
+		if err := r.snapshots.save(worldID, version, entries); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		w.saved = &version
+	}
+	return firstErr
+}
@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/larsmoa/renderdb/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func TestRepositories_Get_FirstAccess_LoadsFromDatabase(t *testing.T) {
+	// Arrange
+	obj := new(db.MockObject)
+	obj.On("ID").Return(int64(1))
+	obj.On("Bounds").Return(&vec3.Box{})
+	obj.On("LayerID").Return(int64(0))
+	obj.On("SceneID").Return(int64(0))
+	obj.On("TriangleCount").Return(0)
+	mockDb := new(db.MockObjects)
+	mockDb.On("GetAll", mock.Anything).Return(createGetManyResult(obj))
+	repos := NewRepositories()
+
+	// Act
+	repo, err := repos.Get(1, mockDb)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NotNil(t, repo)
+	assert.Equal(t, 1, repo.(*defaultRepository).index.size())
+	mockDb.AssertExpectations(t)
+}
+
+func TestRepositories_Get_SecondAccess_ReusesIndex(t *testing.T) {
+	// Arrange
+	mockDb := new(db.MockObjects)
+	mockDb.On("GetAll", mock.Anything).Return(createGetManyResult()).Once()
+	repos := NewRepositories()
+	first, _ := repos.Get(1, mockDb)
+
+	// Act
+	second, err := repos.Get(1, new(db.MockObjects))
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, first.(*defaultRepository).index == second.(*defaultRepository).index)
+	mockDb.AssertExpectations(t)
+}
+
+func TestRepositories_Get_OtherWorldLoading_ReturnsWithoutWaiting(t *testing.T) {
+	// Arrange
+	loadingCh := make(chan db.Object)
+	started := make(chan struct{})
+	loadingDb := new(db.MockObjects)
+	loadingDb.On("GetAll", mock.Anything).
+		Return((<-chan db.Object)(loadingCh), (<-chan error)(make(chan error))).
+		Run(func(mock.Arguments) { close(started) })
+	mockDb := new(db.MockObjects)
+	mockDb.On("GetAll", mock.Anything).Return(createGetManyResult())
+	repos := NewRepositories()
+	loaded := make(chan error)
+	go func() {
+		_, err := repos.Get(1, loadingDb)
+		loaded <- err
+	}()
+	<-started
+
+	// Act
+	repo, err := repos.Get(2, mockDb)
+	close(loadingCh)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NotNil(t, repo)
+	assert.NoError(t, <-loaded)
+}
+
+func TestRepositories_Get_ConcurrentFirstAccess_LoadsOnce(t *testing.T) {
+	// Arrange
+	mockDb := new(db.MockObjects)
+	mockDb.On("GetAll", mock.Anything).Return(createGetManyResult()).Once()
+	repos := NewRepositories()
+	repoCh := make(chan Repository)
+
+	// Act
+	for i := 0; i < 2; i++ {
+		go func() {
+			repo, _ := repos.Get(1, mockDb)
+			repoCh <- repo
+		}()
+	}
+	first, second := <-repoCh, <-repoCh
+
+	// Assert
+	if assert.NotNil(t, first) && assert.NotNil(t, second) {
+		assert.True(t, first.(*defaultRepository).index == second.(*defaultRepository).index)
+	}
+	mockDb.AssertExpectations(t)
+}
+
+func TestRepositories_Get_DatabaseReturnsError_ReturnsError(t *testing.T) {
+	// Arrange
+	mockDb := new(db.MockObjects)
+	mockDb.On("GetAll", mock.Anything).Return(createGetManyResult(errors.New("")))
+	repos := NewRepositories()
+
+	// Act
+	repo, err := repos.Get(1, mockDb)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Nil(t, repo)
+}
+
+func TestRepositories_Evict_ReloadsOnNextAccess(t *testing.T) {
+	// Arrange
+	mockDb := new(db.MockObjects)
+	mockDb.On("GetAll", mock.Anything).Return(createGetManyResult()).Twice()
+	repos := NewRepositories()
+	first, _ := repos.Get(1, mockDb)
+
+	// Act
+	repos.Evict(1)
+	second, err := repos.Get(1, mockDb)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.False(t, first.(*defaultRepository).index == second.(*defaultRepository).index)
+	mockDb.AssertExpectations(t)
+}
+
+// createStoredObject creates an object as returned by db.Objects.GetAll.
+func createStoredObject(id int64) db.Object {
+	obj := new(db.MockObject)
+	obj.On("ID").Return(id)
+	obj.On("Bounds").Return(&vec3.Box{Min: vec3.T{0, 0, 0}, Max: vec3.T{1, 1, 1}})
+	obj.On("LayerID").Return(int64(1))
+	obj.On("SceneID").Return(int64(1))
+	obj.On("TriangleCount").Return(0)
+	return obj
+}
+
+func TestRepositories_Get_SnapshotUpToDate_LoadsFromSnapshot(t *testing.T) {
+	// Arrange
+	dir, err := ioutil.TempDir("", "snapshots")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	version := db.ObjectsVersion{Count: 2, MaxID: 2}
+	firstDb := new(db.MockObjects)
+	firstDb.On("Version").Return(version, nil)
+	firstDb.On("GetAll", mock.Anything).Return(createGetManyResult(createStoredObject(1), createStoredObject(2))).Once()
+	_, err = NewRepositoriesWithSnapshots(dir).Get(1, firstDb)
+	assert.NoError(t, err)
+	mockDb := new(db.MockObjects)
+	mockDb.On("Version").Return(version, nil)
+
+	// Act
+	repo, err := NewRepositoriesWithSnapshots(dir).Get(1, mockDb)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 2, repo.(*defaultRepository).index.size())
+	firstDb.AssertExpectations(t)
+	mockDb.AssertExpectations(t)
+}
+
+func TestRepositories_Get_SnapshotStale_LoadsFromDatabase(t *testing.T) {
+	// Arrange
+	dir, err := ioutil.TempDir("", "snapshots")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := snapshotStore{dir}
+	assert.NoError(t, store.save(1, db.ObjectsVersion{Count: 1, MaxID: 1}, []*rtreeEntry{}))
+	version := db.ObjectsVersion{Count: 1, MaxID: 2}
+	mockDb := new(db.MockObjects)
+	mockDb.On("Version").Return(version, nil)
+	mockDb.On("GetAll", mock.Anything).Return(createGetManyResult(createStoredObject(2)))
+
+	// Act
+	repo, err := NewRepositoriesWithSnapshots(dir).Get(1, mockDb)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, repo.(*defaultRepository).index.size())
+	mockDb.AssertExpectations(t)
+	entries, err := store.load(1, version)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestRepositories_SaveSnapshots_IndexModified_SavesSnapshotWithNewVersion(t *testing.T) {
+	// Arrange
+	dir, err := ioutil.TempDir("", "snapshots")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	obj := createSceneObject(1)
+	mockDb := new(db.MockObjects)
+	mockDb.On("Version").Return(db.ObjectsVersion{}, nil).Once()
+	mockDb.On("Version").Return(db.ObjectsVersion{Count: 1, MaxID: 1}, nil)
+	mockDb.On("GetAll", mock.Anything).Return(createGetManyResult())
+	mockDb.On("Add", obj).Return(int64(1), nil)
+	repos := NewRepositoriesWithSnapshots(dir)
+	repo, err := repos.Get(1, mockDb)
+	assert.NoError(t, err)
+	_, err = repo.Add(obj)
+	assert.NoError(t, err)
+	repo.Commit()
+
+	// Act
+	err = repos.SaveSnapshots()
+
+	// Assert
+	assert.NoError(t, err)
+	entries, err := (&snapshotStore{dir}).load(1, db.ObjectsVersion{Count: 1, MaxID: 1})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestRepositories_Evict_WithSnapshots_RemovesSnapshot(t *testing.T) {
+	// Arrange
+	dir, err := ioutil.TempDir("", "snapshots")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	mockDb := new(db.MockObjects)
+	mockDb.On("Version").Return(db.ObjectsVersion{}, nil)
+	mockDb.On("GetAll", mock.Anything).Return(createGetManyResult())
+	repos := NewRepositoriesWithSnapshots(dir)
+	_, err = repos.Get(1, mockDb)
+	assert.NoError(t, err)
+
+	// Act
+	repos.Evict(1)
+
+	// Assert
+	_, err = (&snapshotStore{dir}).load(1, db.ObjectsVersion{})
+	assert.True(t, os.IsNotExist(err))
+}
@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"bytes"
+	"fmt"
 	"log"
 
 	"github.com/larsmoa/renderdb/conversion"
 	"github.com/larsmoa/renderdb/db"
+	"github.com/larsmoa/renderdb/formats"
 	"github.com/larsmoa/renderdb/repository/options"
 
 	"github.com/dhconnelly/rtreego"
@@ -16,11 +19,35 @@ type Repository interface {
 	// Add puts the object given in the database. Returns the ID of the inserted
 	// object or an error.
 	Add(o db.Object) (int64, error)
+	// Replace deletes all objects matching the selectors and adds the objects
+	// given in one operation, e.g. to replace the geometry of a scene. At least
+	// one selector must be given and only selectors that can be evaluated using
+	// the spatial index (i.e. db.LayersSelector and db.ScenesSelector) are
+	// supported. Lookups either see the objects before or after the
+	// replacement. Returns the IDs of the added objects.
+	Replace(selectors []db.ObjectSelector, objects []db.Object) ([]int64, error)
+	// ReplaceInBatches works like Replace, but the objects to add are returned
+	// by nextBatch, which is called until it returns no objects. Each batch is
+	// written to the database before the next is requested, so the objects
+	// don't need to be held in memory at the same time.
+	ReplaceInBatches(selectors []db.ObjectSelector, nextBatch func() ([]db.Object, error)) ([]int64, error)
+	// Remove deletes all objects matching the selectors. The same
+	// restrictions as for Replace apply to the selectors.
+	Remove(selectors ...db.ObjectSelector) error
+	// Commit applies the changes made by Add, Replace, ReplaceInBatches and
+	// Remove to the spatial index, which is shared by all requests. Until
+	// then the changes are only visible in the database, and lookups using
+	// the spatial index don't see them. Commit must be called after the
+	// transaction of the database has been committed, and must not be
+	// called if the transaction is rolled back.
+	Commit()
 	// GetInsideVolume returns all objects inside the bounding box. Returns two channels,
-	// one for geometry object and one for error. The operation is aborted on the first error.
+	// one for geometry object and one for error. The operation is aborted on the first error,
+	// or when done is closed, e.g. because the receiver stops reading. done may be nil.
 	// Optionally, one or more Options may be provided to alter the behaviour of the
-	// operation.
-	GetInsideVolume(bounds vec3.Box, options ...interface{}) (<-chan db.Object, <-chan error)
+	// operation. db.ObjectSelectors may also be provided to restrict the result to e.g.
+	// certain layers.
+	GetInsideVolume(done <-chan struct{}, bounds vec3.Box, options ...interface{}) (<-chan db.Object, <-chan error)
 	// GetInsideVolumeIDs returns the same result as GetInsideVolume, but only returns
 	// object IDs as a flat array rather than a channel of objects.
 	GetInsideVolumeIDs(bounds vec3.Box, options ...interface{}) ([]int64, error)
@@ -31,42 +58,30 @@ type Repository interface {
 	GetWithID(id int64) (db.Object, error)
 }
 
-/*
-// NewRepository initializes a new repository using the given database.
-func NewRepository(database *sqlx.DB) (Repository, error) {
-	tx, err := database.Beginx()
-	if err != nil {
-		return nil, err
-	}
-
-	repo := new(defaultRepository)
-	repo.database = db.NewObjectsDb(tx)
-	repo.tree = rtreego.NewTree(3, 25, 50)
-	if err := repo.loadFromDatabase(); err != nil {
-		return nil, err
-	}
-	return repo, nil
-}
-*/
-
+// NewRepository initializes a new repository using the given database. The
+// spatial index is loaded from the database. Commit must be called after
+// each modification, see Repository.Commit.
 func NewRepository(database db.Objects) (Repository, error) {
-	repo := new(defaultRepository)
-	//repo.database = db.NewObjectsDb(tx)
-	repo.database = database
-	repo.tree = rtreego.NewTree(3, 25, 50)
-	if err := repo.loadFromDatabase(); err != nil {
+	entries, err := loadEntries(database)
+	if err != nil {
 		return nil, err
 	}
-	return repo, nil
+	return &defaultRepository{database: database, index: newPackedSpatialIndex(entries)}, nil
 }
 
 type defaultRepository struct {
 	database db.Objects
-	tree     *rtreego.Rtree
+	index    *spatialIndex
+	// pending holds the changes to apply to the index on Commit
+	pending []*indexChange
 }
 
-func (r *defaultRepository) loadFromDatabase() error {
-	dataCh, errCh := r.database.GetAll()
+// loadEntries reads the index entries of all objects in the database.
+func loadEntries(database db.Objects) ([]*rtreeEntry, error) {
+	done := make(chan struct{})
+	defer close(done)
+	dataCh, errCh := database.GetAll(done)
+	entries := []*rtreeEntry{}
 	more := true
 	log.Println("Initializing geometry database...")
 	for more {
@@ -75,71 +90,254 @@ func (r *defaultRepository) loadFromDatabase() error {
 		select {
 		case d, more = <-dataCh:
 			if more {
-				treeEntry := new(rtreeEntry)
-				treeEntry.id = d.ID()
-				treeEntry.bounds = conversion.BoxToRect(d.Bounds())
-				r.tree.Insert(treeEntry)
+				entries = append(entries, newRtreeEntry(d.ID(), d))
 			}
 		case err, more = <-errCh:
 			if more {
-				return err
+				return nil, err
 			}
 		}
 	}
-	log.Printf("Loaded %d geometry objects from database\n", r.tree.Size())
-	return nil
+	log.Printf("Loaded %d geometry objects from database\n", len(entries))
+	return entries, nil
+}
+
+// newChange creates a change removing the objects with the given IDs and
+// adding the entries given. The version of the objects after the change is
+// retrieved if the version of the index is tracked. If the version cannot
+// be retrieved it's left unknown, so the index won't be saved as a
+// snapshot.
+func (r *defaultRepository) newChange(removed []int64, added []*rtreeEntry) *indexChange {
+	change := &indexChange{removed: removed, added: added}
+	r.index.lock.RLock()
+	tracked := r.index.version != nil
+	r.index.lock.RUnlock()
+	if tracked {
+		version, err := r.database.Version()
+		if err != nil {
+			log.Printf("Could not retrieve version of geometry objects (reason: %v)\n", err)
+		} else {
+			change.version = &version
+		}
+	}
+	return change
+}
+
+func (r *defaultRepository) Commit() {
+	if len(r.pending) == 0 {
+		return
+	}
+	r.index.lock.Lock()
+	defer r.index.lock.Unlock()
+	for _, change := range r.pending {
+		r.index.apply(change)
+	}
+	r.pending = nil
 }
 
 func (r *defaultRepository) Add(o db.Object) (int64, error) {
 	id, err := r.database.Add(o)
-	if err == nil {
-		r.tree.Insert(&rtreeEntry{id, conversion.BoxToRect(o.Bounds())})
+	if err != nil {
+		return id, err
 	}
-	return id, err
+	r.pending = append(r.pending, r.newChange(nil, []*rtreeEntry{newRtreeEntry(id, o)}))
+	return id, nil
 }
 
-func (r *defaultRepository) GetInsideVolume(bounds vec3.Box, opts ...interface{}) (<-chan db.Object, <-chan error) {
+func (r *defaultRepository) Replace(selectors []db.ObjectSelector, objects []db.Object) ([]int64, error) {
+	// Verify arguments
+	if err := verifyIndexedSelectors(selectors); err != nil {
+		return nil, err
+	}
+
+	// Update database
+	removed, err := r.database.GetIDs(selectors...)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.database.Delete(selectors...); err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(objects))
+	entries := make([]*rtreeEntry, len(objects))
+	for i, o := range objects {
+		id, err := r.database.Add(o)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+		entries[i] = newRtreeEntry(id, o)
+	}
+
+	r.pending = append(r.pending, r.newChange(removed, entries))
+	return ids, nil
+}
+
+func (r *defaultRepository) ReplaceInBatches(selectors []db.ObjectSelector,
+	nextBatch func() ([]db.Object, error)) ([]int64, error) {
+	// Verify arguments
+	if err := verifyIndexedSelectors(selectors); err != nil {
+		return nil, err
+	}
+
+	// Update database
+	removed, err := r.database.GetIDs(selectors...)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.database.Delete(selectors...); err != nil {
+		return nil, err
+	}
+	ids := []int64{}
+	entries := []*rtreeEntry{}
+	for {
+		objects, err := nextBatch()
+		if err != nil {
+			return nil, err
+		}
+		if len(objects) == 0 {
+			break
+		}
+		batchIDs, err := r.database.AddMany(objects)
+		if err != nil {
+			return nil, err
+		}
+		for i, o := range objects {
+			entries = append(entries, newRtreeEntry(batchIDs[i], o))
+		}
+		ids = append(ids, batchIDs...)
+	}
+
+	r.pending = append(r.pending, r.newChange(removed, entries))
+	return ids, nil
+}
+
+func (r *defaultRepository) Remove(selectors ...db.ObjectSelector) error {
+	// Verify arguments
+	if err := verifyIndexedSelectors(selectors); err != nil {
+		return err
+	}
+
+	removed, err := r.database.GetIDs(selectors...)
+	if err != nil {
+		return err
+	}
+	if err = r.database.Delete(selectors...); err != nil {
+		return err
+	}
+	r.pending = append(r.pending, r.newChange(removed, nil))
+	return nil
+}
+
+func (r *defaultRepository) GetInsideVolume(done <-chan struct{}, bounds vec3.Box,
+	opts ...interface{}) (<-chan db.Object, <-chan error) {
 	geometryCh := make(chan db.Object, 200)
 	errCh := make(chan error)
 
 	go func() {
 		defer close(geometryCh)
 
-		// Find IDs
-		ids, err := r.GetInsideVolumeIDs(bounds, opts...)
+		// Find objects
+		results, err := r.searchInsideVolume(bounds, opts)
 		if err != nil {
-			errCh <- err
+			sendError(done, errCh, err)
 			return
 		}
+		ids := entryIDs(results)
+
+		// Lookup simplified geometry for objects that should use
+		// a lower level of detail
+		var lods map[int64]db.LOD
+		if levels := options.SelectLevels(results, opts...); levels != nil {
+			requested := make(map[int64]int)
+			for i, level := range levels {
+				if level > 0 {
+					requested[ids[i]] = level
+				}
+			}
+			if len(requested) > 0 {
+				if lods, err = r.database.GetLODs(requested); err != nil {
+					sendError(done, errCh, err)
+					return
+				}
+			}
+		}
 
 		// Lookup exact geometry and metadata
-		r.retrieveGeometryFromDatabase(ids, geometryCh, errCh)
+		r.retrieveGeometryFromDatabase(done, ids, lods, geometryCh, errCh)
 	}()
 
 	return geometryCh, errCh
 }
 
 func (r *defaultRepository) GetInsideVolumeIDs(bounds vec3.Box, opts ...interface{}) ([]int64, error) {
+	results, err := r.searchInsideVolume(bounds, opts)
+	if err != nil {
+		return nil, err
+	}
+	return entryIDs(results), nil
+}
+
+// searchInsideVolume returns the index entries of the objects inside the
+// bounding box after applying selectors and options.
+func (r *defaultRepository) searchInsideVolume(bounds vec3.Box, opts []interface{}) ([]rtreego.Spatial, error) {
 	// Verify arguments
+	selectors, opts := splitSelectors(opts)
 	err := options.VerifyAllAreOptions(opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	// Spacial lookup
-	results := r.tree.SearchIntersect(conversion.BoxToRect(&bounds))
+	r.index.lock.RLock()
+	results := r.index.searchIntersect(conversion.BoxToRect(&bounds))
+	r.index.lock.RUnlock()
 
-	// Apply geometry filters
-	results = options.ApplyAllFilterGeometryOptions(results, opts...)
+	// Restrict to selected layers/scenes
+	if len(selectors) > 0 {
+		selected := make([]rtreego.Spatial, 0, len(results))
+		for _, x := range results {
+			if x.(*rtreeEntry).isSelected(selectors) {
+				selected = append(selected, x)
+			}
+		}
+		results = selected
+	}
 
-	// Extract IDs
-	ids := make([]int64, len(results))
-	for i, x := range results {
-		entry := x.(*rtreeEntry)
-		ids[i] = entry.id
+	// Restrict to objects matching selectors that can't be evaluated using
+	// the index, e.g. db.MetadataFilter. This must happen before applying
+	// options so that e.g. options.TriangleBudget only counts objects
+	// that are returned.
+	var sqlSelectors []db.ObjectSelector
+	for _, s := range selectors {
+		if !isIndexedSelector(s) {
+			sqlSelectors = append(sqlSelectors, s)
+		}
+	}
+	if len(sqlSelectors) > 0 && len(results) > 0 {
+		candidates := make([]int64, len(results))
+		for i, x := range results {
+			candidates[i] = x.(*rtreeEntry).id
+		}
+		ids, err := r.database.FilterIDs(candidates, sqlSelectors...)
+		if err != nil {
+			return nil, err
+		}
+		matching := make(map[int64]bool, len(ids))
+		for _, id := range ids {
+			matching[id] = true
+		}
+		selected := make([]rtreego.Spatial, 0, len(results))
+		for _, x := range results {
+			if matching[x.(*rtreeEntry).id] {
+				selected = append(selected, x)
+			}
+		}
+		results = selected
 	}
 
-	return ids, nil
+	// Apply geometry filters
+	return options.ApplyAllOptions(results, r.loadOccluders, opts...)
 }
 
 func (r *defaultRepository) GetWithIDs(ids []int64) (<-chan db.Object, <-chan error) {
@@ -148,7 +346,7 @@ func (r *defaultRepository) GetWithIDs(ids []int64) (<-chan db.Object, <-chan er
 	go func() {
 		defer close(geometryCh)
 
-		r.retrieveGeometryFromDatabase(ids, geometryCh, errCh)
+		r.retrieveGeometryFromDatabase(nil, ids, nil, geometryCh, errCh)
 	}()
 	return geometryCh, errCh
 }
@@ -163,12 +361,16 @@ func (r *defaultRepository) GetWithID(id int64) (db.Object, error) {
 	}
 }
 
-func (r *defaultRepository) retrieveGeometryFromDatabase(ids []int64, geometryCh chan db.Object, errCh chan error) {
+// retrieveGeometryFromDatabase looks up the objects with the given IDs and sends them
+// to geometryCh. The geometry of objects with an entry in lods is replaced by the LOD.
+// Returns when done is closed, after the database lookup has ended.
+func (r *defaultRepository) retrieveGeometryFromDatabase(done <-chan struct{}, ids []int64,
+	lods map[int64]db.LOD, geometryCh chan db.Object, errCh chan error) {
 	if len(ids) == 0 {
 		return
 	}
 	// Lookup exact geometry and metadata
-	dbDataCh, dbErrCh := r.database.GetMany(ids)
+	dbDataCh, dbErrCh := r.database.GetMany(done, ids)
 	// Merge spatial data and metadata/exact geometry
 	open := true
 	for open {
@@ -177,14 +379,110 @@ func (r *defaultRepository) retrieveGeometryFromDatabase(ids []int64, geometryCh
 		select {
 		case object, open = <-dbDataCh:
 			if open {
-				geometryCh <- object
+				if len(lods) > 0 {
+					if lod, ok := lods[object.ID()]; ok {
+						object = &lodObject{object, lod}
+					}
+				}
+				select {
+				case geometryCh <- object:
+				case <-done:
+					// Wait for the lookup to end so that the database
+					// isn't used after geometryCh is closed
+					for range dbDataCh {
+					}
+					return
+				}
 			}
 
 		case err, open = <-dbErrCh:
 			if open {
-				errCh <- err
+				sendError(done, errCh, err)
 			}
 			return
 		}
 	}
 }
+
+// sendError sends err on errCh unless done is closed first.
+func sendError(done <-chan struct{}, errCh chan<- error, err error) {
+	select {
+	case errCh <- err:
+	case <-done:
+	}
+}
+
+// loadOccluders reads the geometry of the objects given from the database
+// for use in options that need exact geometry, e.g. options.OcclusionCull.
+func (r *defaultRepository) loadOccluders(objects []rtreego.Spatial) ([]options.Occluder, error) {
+	ids := entryIDs(objects)
+	geometry := make(map[int64]options.Occluder, len(ids))
+	geometryCh, errCh := r.GetWithIDs(ids)
+	for more := true; more; {
+		var o db.Object
+		var err error
+		select {
+		case o, more = <-geometryCh:
+			if more {
+				reader, err := formats.NewGeometryReader(o.GeometryFormat())
+				if err == nil {
+					err = reader.Read(bytes.NewReader(o.GeometryData()))
+				}
+				if err != nil {
+					return nil, fmt.Errorf("Could not read geometry of object %d (reason: %v)", o.ID(), err)
+				}
+				geometry[o.ID()] = reader
+			}
+		case err, more = <-errCh:
+			if more {
+				return nil, err
+			}
+		}
+	}
+
+	occluders := make([]options.Occluder, len(ids))
+	for i, id := range ids {
+		var ok bool
+		if occluders[i], ok = geometry[id]; !ok {
+			return nil, fmt.Errorf("Could not find geometry of object %d", id)
+		}
+	}
+	return occluders, nil
+}
+
+// entryIDs returns the IDs of the index entries given.
+func entryIDs(entries []rtreego.Spatial) []int64 {
+	ids := make([]int64, len(entries))
+	for i, x := range entries {
+		ids[i] = x.(*rtreeEntry).id
+	}
+	return ids
+}
+
+// verifyIndexedSelectors returns an error if no selectors are given, or if
+// any of the selectors cannot be evaluated using the spatial index.
+func verifyIndexedSelectors(selectors []db.ObjectSelector) error {
+	if len(selectors) == 0 {
+		return fmt.Errorf("At least one selector must be provided")
+	}
+	for _, s := range selectors {
+		if !isIndexedSelector(s) {
+			return fmt.Errorf("Selector of type %T is not supported", s)
+		}
+	}
+	return nil
+}
+
+// splitSelectors separates db.ObjectSelectors from other options.
+func splitSelectors(opts []interface{}) ([]db.ObjectSelector, []interface{}) {
+	var selectors []db.ObjectSelector
+	others := make([]interface{}, 0, len(opts))
+	for _, o := range opts {
+		if s, ok := o.(db.ObjectSelector); ok {
+			selectors = append(selectors, s)
+		} else {
+			others = append(others, o)
+		}
+	}
+	return selectors, others
+}
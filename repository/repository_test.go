@@ -9,6 +9,7 @@ import (
 	"github.com/larsmoa/renderdb/db"
 	"github.com/larsmoa/renderdb/repository/options"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/ungerik/go3d/float64/vec3"
 )
 
@@ -60,10 +61,11 @@ func TestRepository_Add_ValidGeometry_AddsToTreeAndDatabase(t *testing.T) {
 	mockDb.On("Add", obj).Return(int64(1), nil)
 
 	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
 
 	// Act
 	id, err := repo.Add(obj)
+	repo.Commit()
 
 	// Assert
 	assert.Equal(t, int64(1), id)
@@ -80,10 +82,11 @@ func TestRepository_Add_DatabaseReturnsError_DoesNotAddToTree(t *testing.T) {
 	mockDb.On("Add", obj).Return(int64(0), errors.New("error"))
 
 	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
 
 	// Act
 	_, err := repo.Add(obj)
+	repo.Commit()
 
 	// Assert
 	assert.Equal(t, 0, rtree.Size())
@@ -99,12 +102,13 @@ func TestRepository_GetInsideVolume_NothingInsideVolume_ReturnsEmpty(t *testing.
 	mockDb.On("Add", obj).Return(int64(1), nil)
 
 	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
 	repo.Add(obj)
+	repo.Commit()
 
 	// Act
 	bounds := vec3.Box{vec3.T{5, 5, 5}, vec3.T{6, 6, 6}}
-	objects, err := flattenChannels(repo.GetInsideVolume(bounds))
+	objects, err := flattenChannels(repo.GetInsideVolume(nil, bounds))
 
 	// Assert
 	mockDb.AssertExpectations(t)
@@ -122,14 +126,15 @@ func TestRepository_GetInsideVolume_OneInsideVolume_ReturnsObject(t *testing.T)
 
 	mockDb := new(db.MockObjects)
 	mockDb.On("Add", obj).Return(int64(1), nil)
-	mockDb.On("GetMany", []int64{1}).Return(createGetManyResult(data))
+	mockDb.On("GetMany", mock.Anything, []int64{1}).Return(createGetManyResult(data))
 	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
 	repo.Add(obj)
+	repo.Commit()
 
 	// Act
 	searchBounds := vec3.Box{vec3.T{0.5, 0.5, 0.5}, vec3.T{1.5, 1.5, 1.5}}
-	objects, err := flattenChannels(repo.GetInsideVolume(searchBounds))
+	objects, err := flattenChannels(repo.GetInsideVolume(nil, searchBounds))
 
 	// Assert
 	mockDb.AssertExpectations(t)
@@ -144,14 +149,15 @@ func TestRepository_GetInsideVolume_DatabaseReturnsError_ReturnsError(t *testing
 
 	mockDb := new(db.MockObjects)
 	mockDb.On("Add", obj).Return(int64(1), nil)
-	mockDb.On("GetMany", []int64{1}).Return(createGetManyResult(errors.New("error")))
+	mockDb.On("GetMany", mock.Anything, []int64{1}).Return(createGetManyResult(errors.New("error")))
 	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
 	repo.Add(obj)
+	repo.Commit()
 
 	// Act
 	searchBounds := vec3.Box{vec3.T{0.5, 0.5, 0.5}, vec3.T{1.5, 1.5, 1.5}}
-	objects, err := flattenChannels(repo.GetInsideVolume(searchBounds))
+	objects, err := flattenChannels(repo.GetInsideVolume(nil, searchBounds))
 
 	// Assert
 	mockDb.AssertExpectations(t)
@@ -171,15 +177,16 @@ func TestRepository_GetInsideVolume_DatabaseReturnsOneThenError_ReturnsError(t *
 	mockDb := new(db.MockObjects)
 	mockDb.On("Add", obj1).Return(int64(1), nil)
 	mockDb.On("Add", obj2).Return(int64(2), nil)
-	mockDb.On("GetMany", []int64{1, 2}).Return(createGetManyResult(data, errors.New("error")))
+	mockDb.On("GetMany", mock.Anything, []int64{1, 2}).Return(createGetManyResult(data, errors.New("error")))
 	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
 	repo.Add(obj1)
 	repo.Add(obj2)
+	repo.Commit()
 
 	// Act
 	searchBounds := vec3.Box{vec3.T{0.5, 0.5, 0.5}, vec3.T{1.5, 1.5, 1.5}}
-	_, err := flattenChannels(repo.GetInsideVolume(searchBounds))
+	_, err := flattenChannels(repo.GetInsideVolume(nil, searchBounds))
 
 	// Assert
 	mockDb.AssertExpectations(t)
@@ -197,18 +204,19 @@ func TestRepository_GetInsideVolume_WithFilterGeometryOptions_ReturnsFiltered(t
 	mockDb := new(db.MockObjects)
 	mockDb.On("Add", obj1).Return(int64(1), nil)
 	mockDb.On("Add", obj2).Return(int64(2), nil)
-	mockDb.On("GetMany", []int64{1}).Return(createGetManyResult(data))
+	mockDb.On("GetMany", mock.Anything, []int64{1}).Return(createGetManyResult(data))
 	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
 	repo.Add(obj1)
 	repo.Add(obj2)
+	repo.Commit()
 
 	mockOptions := new(options.MockFilterGeometryOption)
 	mockOptions.On("Apply", []*vec3.Box{&objBounds, &objBounds}).Return([]int{0})
 
 	// Act
 	searchBounds := vec3.Box{vec3.T{0.5, 0.5, 0.5}, vec3.T{1.5, 1.5, 1.5}}
-	result, err := flattenChannels(repo.GetInsideVolume(searchBounds, mockOptions))
+	result, err := flattenChannels(repo.GetInsideVolume(nil, searchBounds, mockOptions))
 
 	// Assert
 	mockDb.AssertExpectations(t)
@@ -217,33 +225,349 @@ func TestRepository_GetInsideVolume_WithFilterGeometryOptions_ReturnsFiltered(t
 	assert.Equal(t, 1, len(result))
 }
 
-func TestRepository_LoadFromDatabase_LoadsObjectsFromDatabase(t *testing.T) {
+func TestRepository_GetInsideVolumeIDs_WithMetadataFilterAndTriangleBudget_OnlyCountsMatchingObjects(t *testing.T) {
+	// Arrange
+	obj1 := db.NewSceneObject(1, 1, 1, vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}, nil, "", 100, nil, nil)
+	obj2 := db.NewSceneObject(1, 1, 1, vec3.Box{vec3.T{1, 1, 1}, vec3.T{2, 2, 2}}, nil, "", 100, nil, nil)
+	filter, _ := db.ParseMetadataFilter(`metadata.system == "HVAC"`)
+
+	mockDb := new(db.MockObjects)
+	mockDb.On("Add", obj1).Return(int64(1), nil)
+	mockDb.On("Add", obj2).Return(int64(2), nil)
+	mockDb.On("FilterIDs", mock.MatchedBy(func(ids []int64) bool { return len(ids) == 2 }), filter).Return([]int64{2}, nil)
+	rtree := rtreego.NewTree(3, 5, 10)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
+	repo.Add(obj1)
+	repo.Add(obj2)
+	repo.Commit()
+
+	// Act
+	searchBounds := vec3.Box{vec3.T{0, 0, 0}, vec3.T{2, 2, 2}}
+	ids, err := repo.GetInsideVolumeIDs(searchBounds, filter,
+		options.SortByDistance{Pivot: vec3.T{0, 0, 0}},
+		options.TriangleBudget{MaxTriangles: 100})
+
+	// Assert
+	mockDb.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2}, ids)
+}
+
+func TestRepository_GetInsideVolume_WithLayersSelector_ReturnsObjectsInLayer(t *testing.T) {
+	// Arrange
+	objBounds := vec3.Box{vec3.T{0.5, 0.5, 0.5}, vec3.T{1.5, 1.5, 1.5}}
+	obj1 := new(db.MockObject)
+	obj1.On("LayerID").Return(int64(1))
+	obj1.On("SceneID").Return(int64(1))
+	obj1.On("TriangleCount").Return(0)
+	obj1.On("Bounds").Return(&objBounds)
+	obj2 := new(db.MockObject)
+	obj2.On("LayerID").Return(int64(2))
+	obj2.On("SceneID").Return(int64(2))
+	obj2.On("TriangleCount").Return(0)
+	obj2.On("Bounds").Return(&objBounds)
+
+	data := new(db.MockObject)
+	mockDb := new(db.MockObjects)
+	mockDb.On("Add", obj1).Return(int64(1), nil)
+	mockDb.On("Add", obj2).Return(int64(2), nil)
+	mockDb.On("GetMany", mock.Anything, []int64{2}).Return(createGetManyResult(data))
+	rtree := rtreego.NewTree(3, 5, 10)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
+	repo.Add(obj1)
+	repo.Add(obj2)
+	repo.Commit()
+
+	// Act
+	searchBounds := vec3.Box{vec3.T{0, 0, 0}, vec3.T{2, 2, 2}}
+	result, err := flattenChannels(repo.GetInsideVolume(nil, searchBounds, db.LayersSelector{LayerIDs: []int64{2}}))
+
+	// Assert
+	mockDb.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, []db.Object{data}, result)
+}
+
+func TestRepository_GetInsideVolumeIDs_WithLayersAndScenesSelector_ReturnsIntersection(t *testing.T) {
+	// Arrange
+	objBounds := vec3.Box{vec3.T{0.5, 0.5, 0.5}, vec3.T{1.5, 1.5, 1.5}}
+	obj1 := new(db.MockObject)
+	obj1.On("LayerID").Return(int64(1))
+	obj1.On("SceneID").Return(int64(1))
+	obj1.On("TriangleCount").Return(0)
+	obj1.On("Bounds").Return(&objBounds)
+	obj2 := new(db.MockObject)
+	obj2.On("LayerID").Return(int64(1))
+	obj2.On("SceneID").Return(int64(2))
+	obj2.On("TriangleCount").Return(0)
+	obj2.On("Bounds").Return(&objBounds)
+
+	mockDb := new(db.MockObjects)
+	mockDb.On("Add", obj1).Return(int64(1), nil)
+	mockDb.On("Add", obj2).Return(int64(2), nil)
+	rtree := rtreego.NewTree(3, 5, 10)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
+	repo.Add(obj1)
+	repo.Add(obj2)
+	repo.Commit()
+
+	// Act
+	searchBounds := vec3.Box{vec3.T{0, 0, 0}, vec3.T{2, 2, 2}}
+	ids, err := repo.GetInsideVolumeIDs(searchBounds,
+		db.LayersSelector{LayerIDs: []int64{1}},
+		db.ScenesSelector{SceneIDs: []int64{1}})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1}, ids)
+}
+
+// createSceneObject creates an object in the scene given for testing Replace.
+func createSceneObject(sceneID int64) db.Object {
+	return db.NewSceneObject(1, 1, sceneID, vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}, nil, "", 0, nil, nil)
+}
+
+func TestRepository_Replace_ExistingScene_ReplacesObjectsInScene(t *testing.T) {
+	// Arrange
+	oldObj, otherObj, newObj := createSceneObject(1), createSceneObject(2), createSceneObject(1)
+	mockDb := new(db.MockObjects)
+	mockDb.On("Add", oldObj).Return(int64(1), nil).Once()
+	mockDb.On("Add", otherObj).Return(int64(2), nil).Once()
+	mockDb.On("Add", newObj).Return(int64(3), nil).Once()
+	mockDb.On("GetIDs", db.ScenesSelector{SceneIDs: []int64{1}}).Return([]int64{1}, nil)
+	mockDb.On("Delete", db.ScenesSelector{SceneIDs: []int64{1}}).Return(nil)
+	rtree := rtreego.NewTree(3, 5, 10)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
+	repo.Add(oldObj)
+	repo.Add(otherObj)
+	repo.Commit()
+
+	// Act
+	ids, err := repo.Replace([]db.ObjectSelector{db.ScenesSelector{SceneIDs: []int64{1}}}, []db.Object{newObj})
+	repo.Commit()
+
+	// Assert
+	mockDb.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3}, ids)
+	assert.Equal(t, 2, rtree.Size())
+	found, _ := repo.GetInsideVolumeIDs(vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}, db.ScenesSelector{SceneIDs: []int64{1}})
+	assert.Equal(t, []int64{3}, found)
+}
+
+func TestRepository_Replace_DatabaseReturnsError_DoesNotUpdateTree(t *testing.T) {
+	// Arrange
+	oldObj, newObj := createSceneObject(1), createSceneObject(1)
+	mockDb := new(db.MockObjects)
+	mockDb.On("Add", oldObj).Return(int64(1), nil).Once()
+	mockDb.On("Add", newObj).Return(int64(-1), errors.New("error")).Once()
+	mockDb.On("GetIDs", mock.Anything).Return([]int64{1}, nil)
+	mockDb.On("Delete", mock.Anything).Return(nil)
+	rtree := rtreego.NewTree(3, 5, 10)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
+	repo.Add(oldObj)
+	repo.Commit()
+
+	// Act
+	_, err := repo.Replace([]db.ObjectSelector{db.ScenesSelector{SceneIDs: []int64{1}}}, []db.Object{newObj})
+	repo.Commit()
+
+	// Assert
+	assert.Error(t, err)
+	found, _ := repo.GetInsideVolumeIDs(vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}})
+	assert.Equal(t, []int64{1}, found)
+}
+
+func TestRepository_Replace_NotCommitted_DoesNotUpdateTree(t *testing.T) {
+	// Arrange
+	oldObj, newObj := createSceneObject(1), createSceneObject(1)
+	mockDb := new(db.MockObjects)
+	mockDb.On("Add", oldObj).Return(int64(1), nil).Once()
+	mockDb.On("Add", newObj).Return(int64(2), nil).Once()
+	mockDb.On("GetIDs", mock.Anything).Return([]int64{1}, nil)
+	mockDb.On("Delete", mock.Anything).Return(nil)
+	rtree := rtreego.NewTree(3, 5, 10)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
+	repo.Add(oldObj)
+	repo.Commit()
+
+	// Act
+	_, err := repo.Replace([]db.ObjectSelector{db.ScenesSelector{SceneIDs: []int64{1}}}, []db.Object{newObj})
+
+	// Assert
+	assert.NoError(t, err)
+	found, _ := repo.GetInsideVolumeIDs(vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}})
+	assert.Equal(t, []int64{1}, found)
+}
+
+// createBatches returns a function that returns the batches given one
+// at a time, for testing ReplaceInBatches.
+func createBatches(batches ...[]db.Object) func() ([]db.Object, error) {
+	return func() ([]db.Object, error) {
+		if len(batches) == 0 {
+			return nil, nil
+		}
+		batch := batches[0]
+		batches = batches[1:]
+		return batch, nil
+	}
+}
+
+func TestRepository_ReplaceInBatches_ExistingScene_ReplacesObjectsInScene(t *testing.T) {
+	// Arrange
+	oldObj, otherObj := createSceneObject(1), createSceneObject(2)
+	newObj1, newObj2, newObj3 := createSceneObject(1), createSceneObject(1), createSceneObject(1)
+	mockDb := new(db.MockObjects)
+	mockDb.On("Add", oldObj).Return(int64(1), nil).Once()
+	mockDb.On("Add", otherObj).Return(int64(2), nil).Once()
+	mockDb.On("AddMany", []db.Object{newObj1, newObj2}).Return([]int64{3, 4}, nil).Once()
+	mockDb.On("AddMany", []db.Object{newObj3}).Return([]int64{5}, nil).Once()
+	mockDb.On("GetIDs", db.ScenesSelector{SceneIDs: []int64{1}}).Return([]int64{1}, nil)
+	mockDb.On("Delete", db.ScenesSelector{SceneIDs: []int64{1}}).Return(nil)
+	rtree := rtreego.NewTree(3, 5, 10)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
+	repo.Add(oldObj)
+	repo.Add(otherObj)
+	repo.Commit()
+
+	// Act
+	ids, err := repo.ReplaceInBatches([]db.ObjectSelector{db.ScenesSelector{SceneIDs: []int64{1}}},
+		createBatches([]db.Object{newObj1, newObj2}, []db.Object{newObj3}))
+	repo.Commit()
+
+	// Assert
+	mockDb.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 4, 5}, ids)
+	assert.Equal(t, 4, rtree.Size())
+	found, _ := repo.GetInsideVolumeIDs(vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}, db.ScenesSelector{SceneIDs: []int64{1}})
+	assert.Len(t, found, 3)
+	for _, id := range []int64{3, 4, 5} {
+		assert.Contains(t, found, id)
+	}
+}
+
+func TestRepository_ReplaceInBatches_NextBatchReturnsError_DoesNotUpdateTree(t *testing.T) {
+	// Arrange
+	oldObj, newObj := createSceneObject(1), createSceneObject(1)
+	mockDb := new(db.MockObjects)
+	mockDb.On("Add", oldObj).Return(int64(1), nil).Once()
+	mockDb.On("AddMany", []db.Object{newObj}).Return([]int64{2}, nil).Once()
+	mockDb.On("GetIDs", mock.Anything).Return([]int64{1}, nil)
+	mockDb.On("Delete", mock.Anything).Return(nil)
+	rtree := rtreego.NewTree(3, 5, 10)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
+	repo.Add(oldObj)
+	repo.Commit()
+	batches := createBatches([]db.Object{newObj})
+	nextBatch := func() ([]db.Object, error) {
+		if objects, _ := batches(); objects != nil {
+			return objects, nil
+		}
+		return nil, errors.New("error")
+	}
+
+	// Act
+	_, err := repo.ReplaceInBatches([]db.ObjectSelector{db.ScenesSelector{SceneIDs: []int64{1}}}, nextBatch)
+	repo.Commit()
+
+	// Assert
+	assert.Error(t, err)
+	found, _ := repo.GetInsideVolumeIDs(vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}})
+	assert.Equal(t, []int64{1}, found)
+}
+
+func TestRepository_Replace_NoSelectors_ReturnsError(t *testing.T) {
+	// Arrange
+	mockDb := new(db.MockObjects)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtreego.NewTree(3, 5, 10))}
+
+	// Act
+	_, err := repo.Replace(nil, []db.Object{createSceneObject(1)})
+
+	// Assert
+	assert.Error(t, err)
+	mockDb.AssertExpectations(t)
+}
+
+func TestRepository_Remove_LayersSelector_RemovesFromTreeAndDatabase(t *testing.T) {
+	// Arrange
+	obj1 := db.NewSceneObject(1, 1, 1, vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}, nil, "", 0, nil, nil)
+	obj2 := db.NewSceneObject(1, 2, 2, vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}, nil, "", 0, nil, nil)
+	mockDb := new(db.MockObjects)
+	mockDb.On("Add", obj1).Return(int64(1), nil)
+	mockDb.On("Add", obj2).Return(int64(2), nil)
+	mockDb.On("GetIDs", db.LayersSelector{LayerIDs: []int64{1}}).Return([]int64{1}, nil)
+	mockDb.On("Delete", db.LayersSelector{LayerIDs: []int64{1}}).Return(nil)
+	rtree := rtreego.NewTree(3, 5, 10)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
+	repo.Add(obj1)
+	repo.Add(obj2)
+	repo.Commit()
+
+	// Act
+	err := repo.Remove(db.LayersSelector{LayerIDs: []int64{1}})
+	repo.Commit()
+
+	// Assert
+	mockDb.AssertExpectations(t)
+	assert.NoError(t, err)
+	found, _ := repo.GetInsideVolumeIDs(vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}})
+	assert.Equal(t, []int64{2}, found)
+}
+
+func TestRepository_Remove_DatabaseReturnsError_DoesNotUpdateTree(t *testing.T) {
+	// Arrange
+	obj := createSceneObject(1)
+	mockDb := new(db.MockObjects)
+	mockDb.On("Add", obj).Return(int64(1), nil)
+	mockDb.On("GetIDs", mock.Anything).Return([]int64{1}, nil)
+	mockDb.On("Delete", mock.Anything).Return(errors.New("error"))
+	rtree := rtreego.NewTree(3, 5, 10)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
+	repo.Add(obj)
+	repo.Commit()
+
+	// Act
+	err := repo.Remove(db.ScenesSelector{SceneIDs: []int64{1}})
+	repo.Commit()
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, 1, rtree.Size())
+}
+
+func TestLoadEntries_PopulatedDatabase_ReturnsEntriesOfAllObjects(t *testing.T) {
 	// Arrange
 	obj1 := new(db.MockObject)
 	obj1.On("ID").Return(int64(1))
 	obj1.On("Bounds").Return(&vec3.Box{})
+	obj1.On("LayerID").Return(int64(0))
+	obj1.On("SceneID").Return(int64(0))
+	obj1.On("TriangleCount").Return(0)
 	obj2 := new(db.MockObject)
 	obj2.On("ID").Return(int64(2))
 	obj2.On("Bounds").Return(&vec3.Box{})
+	obj2.On("LayerID").Return(int64(0))
+	obj2.On("SceneID").Return(int64(0))
+	obj2.On("TriangleCount").Return(0)
 	mockDb := new(db.MockObjects)
-	mockDb.On("GetAll").Return(createGetManyResult(obj1, obj2))
-	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	mockDb.On("GetAll", mock.Anything).Return(createGetManyResult(obj1, obj2))
 
 	// Act
-	err := repo.loadFromDatabase()
+	entries, err := loadEntries(mockDb)
 
 	// Assert
 	mockDb.AssertExpectations(t)
 	assert.NoError(t, err)
-	assert.Equal(t, 2, rtree.Size())
+	assert.Len(t, entries, 2)
 }
 
 func TestRepository_GetWithIDs_NoIDs_ReturnsEmpty(t *testing.T) {
 	// Arrange
 	mockDb := new(db.MockObjects)
 	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
 
 	// Act
 	results, err := flattenChannels(repo.GetWithIDs([]int64{}))
@@ -256,9 +580,9 @@ func TestRepository_GetWithIDs_NoIDs_ReturnsEmpty(t *testing.T) {
 func TestRepository_GetWithIDs_DatabaseReturnsError_ReturnsError(t *testing.T) {
 	// Arrange
 	mockDb := new(db.MockObjects)
-	mockDb.On("GetMany", []int64{1}).Return(createGetManyResult(errors.New("")))
+	mockDb.On("GetMany", mock.Anything, []int64{1}).Return(createGetManyResult(errors.New("")))
 	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
 
 	// Act
 	results, err := flattenChannels(repo.GetWithIDs([]int64{1}))
@@ -277,10 +601,10 @@ func TestRepository_GetWithIDs_TwoValidIDs_ReturnsTwoObjects(t *testing.T) {
 	obj2.On("ID").Return(int64(2))
 	obj2.On("Bounds").Return(&vec3.Box{})
 	mockDb := new(db.MockObjects)
-	mockDb.On("GetMany", []int64{1, 2}).
+	mockDb.On("GetMany", mock.Anything, []int64{1, 2}).
 		Return(createGetManyResult(obj1, obj2))
 	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
 
 	// Act
 	results, err := flattenChannels(repo.GetWithIDs([]int64{1, 2}))
@@ -293,10 +617,10 @@ func TestRepository_GetWithIDs_TwoValidIDs_ReturnsTwoObjects(t *testing.T) {
 func TestRepository_GetWithID_InvalidID_ReturnsError(t *testing.T) {
 	// Arrange
 	mockDb := new(db.MockObjects)
-	mockDb.On("GetMany", []int64{1}).
+	mockDb.On("GetMany", mock.Anything, []int64{1}).
 		Return(createGetManyResult(errors.New("")))
 	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
 
 	// Act
 	result, err := repo.GetWithID(1)
@@ -310,10 +634,10 @@ func TestRepository_GetWithID_ValidID_ReturnsObject(t *testing.T) {
 	obj1 := new(db.MockObject)
 	obj1.On("ID").Return(int64(1))
 	mockDb := new(db.MockObjects)
-	mockDb.On("GetMany", []int64{1}).
+	mockDb.On("GetMany", mock.Anything, []int64{1}).
 		Return(createGetManyResult(obj1))
 	rtree := rtreego.NewTree(3, 5, 10)
-	repo := defaultRepository{mockDb, rtree}
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
 
 	// Act
 	result, err := repo.GetWithID(1)
@@ -322,3 +646,78 @@ func TestRepository_GetWithID_ValidID_ReturnsObject(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 }
+
+func TestRepository_GetInsideVolumeIDs_WithOcclusionCull_RemovesObjectBehindOccluder(t *testing.T) {
+	// Arrange
+	wallBounds := vec3.Box{vec3.T{-5, -5, 0.9}, vec3.T{5, 5, 1.1}}
+	hiddenBounds := vec3.Box{vec3.T{-0.5, -0.5, 3}, vec3.T{0.5, 0.5, 4}}
+	visibleBounds := vec3.Box{vec3.T{20, 20, 3}, vec3.T{21, 21, 4}}
+	wall := db.NewSimpleObject(wallBounds, nil, nil)
+	hidden := db.NewSimpleObject(hiddenBounds, nil, nil)
+	visible := db.NewSimpleObject(visibleBounds, nil, nil)
+
+	wallData := new(db.MockObject)
+	wallData.On("ID").Return(int64(1))
+	wallData.On("GeometryFormat").Return("obj")
+	wallData.On("GeometryData").Return([]byte("v -5 -5 1\nv 5 -5 1\nv 5 5 1\nv -5 5 1\ng wall\nf 1 2 3 4\n"))
+	mockDb := new(db.MockObjects)
+	mockDb.On("Add", wall).Return(int64(1), nil)
+	mockDb.On("Add", hidden).Return(int64(2), nil)
+	mockDb.On("Add", visible).Return(int64(3), nil)
+	mockDb.On("GetMany", mock.Anything, []int64{1}).Return(createGetManyResult(wallData))
+	rtree := rtreego.NewTree(3, 5, 10)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
+	repo.Add(wall)
+	repo.Add(hidden)
+	repo.Add(visible)
+	repo.Commit()
+
+	// Act
+	searchBounds := vec3.Box{vec3.T{-30, -30, -30}, vec3.T{30, 30, 30}}
+	cull := options.OcclusionCull{Eye: vec3.T{0, 0, 0}, MinOccluderSize: 5, MaxOccluders: 10}
+	ids, err := repo.GetInsideVolumeIDs(searchBounds, cull, options.SortByDistance{})
+
+	// Assert
+	mockDb.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 3}, ids)
+}
+
+func TestRepository_GetInsideVolume_WithLevelOfDetail_ReplacesGeometryOfDistantObjects(t *testing.T) {
+	// Arrange
+	nearBounds := vec3.Box{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}}
+	farBounds := vec3.Box{vec3.T{100, 0, 0}, vec3.T{101, 1, 1}}
+	near := db.NewSimpleObject(nearBounds, nil, nil)
+	far := db.NewSimpleObject(farBounds, nil, nil)
+
+	nearData := new(db.MockObject)
+	nearData.On("ID").Return(int64(1))
+	nearData.On("GeometryData").Return([]byte("near"))
+	farData := new(db.MockObject)
+	farData.On("ID").Return(int64(2))
+	lod := db.LOD{GeometryData: []byte("far-lod"), TriangleCount: 1}
+	mockDb := new(db.MockObjects)
+	mockDb.On("Add", near).Return(int64(1), nil)
+	mockDb.On("Add", far).Return(int64(2), nil)
+	mockDb.On("GetLODs", map[int64]int{2: 1}).Return(map[int64]db.LOD{2: lod}, nil)
+	mockDb.On("GetMany", mock.Anything, []int64{1, 2}).Return(createGetManyResult(nearData, farData))
+	rtree := rtreego.NewTree(3, 5, 10)
+	repo := defaultRepository{database: mockDb, index: newSpatialIndex(rtree)}
+	repo.Add(near)
+	repo.Add(far)
+	repo.Commit()
+
+	// Act
+	searchBounds := vec3.Box{vec3.T{-200, -200, -200}, vec3.T{200, 200, 200}}
+	lodOption := options.LevelOfDetail{Eye: vec3.T{0, 0, 0}, Distances: []float64{50}}
+	result, err := flattenChannels(repo.GetInsideVolume(nil, searchBounds, options.SortByDistance{}, lodOption))
+
+	// Assert
+	mockDb.AssertExpectations(t)
+	assert.NoError(t, err)
+	if assert.Len(t, result, 2) {
+		assert.Equal(t, []byte("near"), result[0].GeometryData())
+		assert.Equal(t, []byte("far-lod"), result[1].GeometryData())
+		assert.Equal(t, 1, result[1].TriangleCount())
+	}
+}
@@ -1,12 +1,72 @@
 package repository
 
-import "github.com/dhconnelly/rtreego"
+import (
+	"github.com/larsmoa/renderdb/conversion"
+	"github.com/larsmoa/renderdb/db"
+
+	"github.com/dhconnelly/rtreego"
+)
 
 type rtreeEntry struct {
-	id     int64
-	bounds *rtreego.Rect
+	id            int64
+	layerID       int64
+	sceneID       int64
+	triangleCount int
+	bounds        *rtreego.Rect
+}
+
+func newRtreeEntry(id int64, o db.Object) *rtreeEntry {
+	return &rtreeEntry{
+		id:            id,
+		layerID:       o.LayerID(),
+		sceneID:       o.SceneID(),
+		triangleCount: o.TriangleCount(),
+		bounds:        conversion.BoxToRect(o.Bounds()),
+	}
 }
 
 func (e *rtreeEntry) Bounds() *rtreego.Rect {
 	return e.bounds
 }
+
+// TriangleCount implements options.TriangleCounter.
+func (e *rtreeEntry) TriangleCount() int {
+	return e.triangleCount
+}
+
+// isSelected returns false if any of the selectors that can be evaluated
+// using the spatial index rejects the entry.
+func (e *rtreeEntry) isSelected(selectors []db.ObjectSelector) bool {
+	for _, s := range selectors {
+		switch sel := s.(type) {
+		case db.LayersSelector:
+			if !containsID(sel.LayerIDs, e.layerID) {
+				return false
+			}
+		case db.ScenesSelector:
+			if !containsID(sel.SceneIDs, e.sceneID) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isIndexedSelector returns true if the selector can be evaluated
+// by rtreeEntry.isSelected.
+func isIndexedSelector(s db.ObjectSelector) bool {
+	switch s.(type) {
+	case db.LayersSelector, db.ScenesSelector:
+		return true
+	}
+	return false
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/larsmoa/renderdb/conversion"
+	"github.com/larsmoa/renderdb/db"
+
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+const (
+	snapshotMagic   = "RDBI"
+	snapshotVersion = 1
+	// snapshotEntrySize is the size of an entry: ID, layer ID, scene ID and
+	// triangle count (int64) followed by the bounds (6 float64)
+	snapshotEntrySize = 10 * 8
+)
+
+// writeSnapshot writes the entries of a spatial index. The encoding is a
+// header ("RDBI", version (uint8), 0 (uint8), 0 (uint8), 0 (uint8)), the
+// version of the objects (count and max ID as int64), the number of
+// entries (uint64) and the entries. All values are little endian.
+func writeSnapshot(w io.Writer, version db.ObjectsVersion, entries []*rtreeEntry) error {
+	out := bufio.NewWriter(w)
+	header := make([]byte, 32)
+	copy(header, snapshotMagic)
+	header[4] = snapshotVersion
+	binary.LittleEndian.PutUint64(header[8:], uint64(version.Count))
+	binary.LittleEndian.PutUint64(header[16:], uint64(version.MaxID))
+	binary.LittleEndian.PutUint64(header[24:], uint64(len(entries)))
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]byte, snapshotEntrySize)
+	for _, e := range entries {
+		b := newPackedBox(e.bounds)
+		values := []uint64{uint64(e.id), uint64(e.layerID), uint64(e.sceneID), uint64(e.triangleCount)}
+		for i := range b {
+			values = append(values, math.Float64bits(b[i]))
+		}
+		for i, v := range values {
+			binary.LittleEndian.PutUint64(record[8*i:], v)
+		}
+		if _, err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// readSnapshotVersion reads the header of a snapshot written by
+// writeSnapshot. Returns the version of the objects and the number of
+// entries.
+func readSnapshotVersion(r io.Reader) (db.ObjectsVersion, int, error) {
+	header := make([]byte, 32)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return db.ObjectsVersion{}, 0, fmt.Errorf("Could not read snapshot header (reason: %v)", err)
+	}
+	if string(header[:4]) != snapshotMagic {
+		return db.ObjectsVersion{}, 0, fmt.Errorf("Data is not a spatial index snapshot")
+	}
+	if header[4] != snapshotVersion {
+		return db.ObjectsVersion{}, 0, fmt.Errorf("Snapshot version %d is not supported", header[4])
+	}
+	version := db.ObjectsVersion{
+		Count: int64(binary.LittleEndian.Uint64(header[8:])),
+		MaxID: int64(binary.LittleEndian.Uint64(header[16:])),
+	}
+	count := binary.LittleEndian.Uint64(header[24:])
+	if count > math.MaxInt32 {
+		return db.ObjectsVersion{}, 0, fmt.Errorf("Invalid number of entries %d", count)
+	}
+	return version, int(count), nil
+}
+
+// readSnapshotEntries reads count entries following the header of a
+// snapshot.
+func readSnapshotEntries(r io.Reader, count int) ([]*rtreeEntry, error) {
+	in := bufio.NewReader(r)
+	entries := make([]*rtreeEntry, count)
+	record := make([]byte, snapshotEntrySize)
+	for i := range entries {
+		if _, err := io.ReadFull(in, record); err != nil {
+			return nil, fmt.Errorf("Could not read entry #%d (reason: %v)", i+1, err)
+		}
+		values := make([]uint64, 10)
+		for j := range values {
+			values[j] = binary.LittleEndian.Uint64(record[8*j:])
+		}
+		box := vec3.Box{}
+		for j := 0; j < 3; j++ {
+			box.Min[j] = math.Float64frombits(values[4+j])
+			box.Max[j] = math.Float64frombits(values[7+j])
+		}
+		entries[i] = &rtreeEntry{
+			id:            int64(values[0]),
+			layerID:       int64(values[1]),
+			sceneID:       int64(values[2]),
+			triangleCount: int(values[3]),
+			bounds:        conversion.BoxToRect(&box),
+		}
+	}
+	if n, _ := in.Read(record[:1]); n > 0 {
+		return nil, fmt.Errorf("Unexpected data after %d entries", count)
+	}
+	return entries, nil
+}
+
+// snapshotStore keeps snapshots of spatial indices as files in a
+// directory, one file per world.
+type snapshotStore struct {
+	dir string
+}
+
+func (s *snapshotStore) path(worldID int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("world-%d.rtree", worldID))
+}
+
+// load reads the snapshot of the world given if its version is expected.
+// Returns an error satisfying os.IsNotExist if there is no snapshot.
+func (s *snapshotStore) load(worldID int64, expected db.ObjectsVersion) ([]*rtreeEntry, error) {
+	f, err := os.Open(s.path(worldID))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	version, count, err := readSnapshotVersion(f)
+	if err != nil {
+		return nil, err
+	}
+	if version != expected {
+		return nil, fmt.Errorf("Snapshot is stale (snapshot: %+v, database: %+v)", version, expected)
+	}
+	// Check the size before allocating the entries in case the header is
+	// corrupt
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != 32+int64(count)*snapshotEntrySize {
+		return nil, fmt.Errorf("Snapshot size %d does not match %d entries", info.Size(), count)
+	}
+	return readSnapshotEntries(f, count)
+}
+
+// save writes the snapshot of the world given. The snapshot is written to
+// a temporary file which replaces the previous snapshot when complete.
+func (s *snapshotStore) save(worldID int64, version db.ObjectsVersion, entries []*rtreeEntry) error {
+	f, err := ioutil.TempFile(s.dir, fmt.Sprintf("world-%d.", worldID))
+	if err != nil {
+		return err
+	}
+	err = writeSnapshot(f, version, entries)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path(worldID))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// remove deletes the snapshot of the world given, if any.
+func (s *snapshotStore) remove(worldID int64) error {
+	if err := os.Remove(s.path(worldID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/larsmoa/renderdb/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSnapshot_ReadWrittenSnapshot_ReturnsSameEntries(t *testing.T) {
+	// Arrange
+	entries := createRandomEntries(10)
+	entries[3].layerID, entries[3].sceneID, entries[3].triangleCount = 5, 6, 7
+	version := db.ObjectsVersion{Count: 10, MaxID: 12}
+	buffer := bytes.Buffer{}
+	assert.NoError(t, writeSnapshot(&buffer, version, entries))
+
+	// Act
+	readVersion, count, errVersion := readSnapshotVersion(&buffer)
+	readEntries, errEntries := readSnapshotEntries(&buffer, count)
+
+	// Assert
+	assert.NoError(t, errVersion)
+	assert.NoError(t, errEntries)
+	assert.Equal(t, version, readVersion)
+	assert.Equal(t, entries, readEntries)
+}
+
+func TestReadSnapshot_InvalidData_ReturnsError(t *testing.T) {
+	buffer := bytes.Buffer{}
+	assert.NoError(t, writeSnapshot(&buffer, db.ObjectsVersion{}, createRandomEntries(2)))
+	data := buffer.Bytes()
+
+	_, _, err := readSnapshotVersion(bytes.NewReader([]byte("RDBI")))
+	assert.Error(t, err)
+	_, _, err = readSnapshotVersion(bytes.NewReader([]byte("RDBM" + string(data[4:]))))
+	assert.Error(t, err)
+	r := bytes.NewReader(data[:len(data)-1])
+	_, count, err := readSnapshotVersion(r)
+	assert.NoError(t, err)
+	_, err = readSnapshotEntries(r, count)
+	assert.Error(t, err)
+}
+
+func TestSnapshotStore_Load_StaleOrMissingSnapshot_ReturnsError(t *testing.T) {
+	// Arrange
+	dir, err := ioutil.TempDir("", "snapshots")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := snapshotStore{dir}
+	assert.NoError(t, store.save(1, db.ObjectsVersion{Count: 2, MaxID: 2}, createRandomEntries(2)))
+
+	// Act
+	_, errMissing := store.load(2, db.ObjectsVersion{Count: 2, MaxID: 2})
+	_, errStale := store.load(1, db.ObjectsVersion{Count: 2, MaxID: 3})
+	entries, err := store.load(1, db.ObjectsVersion{Count: 2, MaxID: 2})
+
+	// Assert
+	assert.True(t, os.IsNotExist(errMissing))
+	assert.Error(t, errStale)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
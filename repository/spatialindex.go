@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/larsmoa/renderdb/db"
+
+	"github.com/dhconnelly/rtreego"
+)
+
+// Parameters of the R-trees of the spatial index.
+const (
+	treeMinChildren = 25
+	treeMaxChildren = 50
+)
+
+// spatialIndex holds the R-tree of a world. The index outlives the
+// repositories created for each request, so all access to the tree must
+// be guarded by the lock.
+type spatialIndex struct {
+	lock sync.RWMutex
+	// packed holds the entries bulk loaded when the index was created, and
+	// tree the entries inserted later
+	packed *packedTree
+	tree   *rtreego.Rtree
+	// entries holds all entries in the index by ID. Required as entries
+	// can only be deleted from the tree by identity, and entries removed
+	// from the packed tree are only removed from entries.
+	entries map[int64]*rtreeEntry
+	// version is the version of the objects in the index if tracked, see
+	// trackVersion.
+	version *db.ObjectsVersion
+	// removed holds the IDs of entries removed before they were inserted,
+	// which happens if changes are applied in another order than they were
+	// committed. The entries are skipped when inserted.
+	removed map[int64]bool
+}
+
+// indexChange is a change of the objects in a world made in a transaction.
+// The change is applied to the index when the transaction is committed.
+type indexChange struct {
+	removed []int64
+	added   []*rtreeEntry
+	// version is the version of the objects after the change, or nil if
+	// the version is unknown or not tracked
+	version *db.ObjectsVersion
+}
+
+func newSpatialIndex(tree *rtreego.Rtree) *spatialIndex {
+	return &spatialIndex{
+		packed:  newPackedTree(nil, treeMaxChildren),
+		tree:    tree,
+		entries: make(map[int64]*rtreeEntry),
+		removed: make(map[int64]bool),
+	}
+}
+
+// newPackedSpatialIndex creates an index holding the entries given, which
+// are bulk loaded.
+func newPackedSpatialIndex(entries []*rtreeEntry) *spatialIndex {
+	i := newSpatialIndex(rtreego.NewTree(3, treeMinChildren, treeMaxChildren))
+	i.packed = newPackedTree(entries, treeMaxChildren)
+	for _, e := range entries {
+		i.entries[e.id] = e
+	}
+	return i
+}
+
+// trackVersion starts tracking the version of the objects in the index,
+// see indexChange.
+func (i *spatialIndex) trackVersion(version db.ObjectsVersion) {
+	i.version = &version
+}
+
+// size returns the number of entries in the index.
+func (i *spatialIndex) size() int {
+	return len(i.entries)
+}
+
+// allEntries returns all entries in the index. The caller must hold the
+// read lock.
+func (i *spatialIndex) allEntries() []*rtreeEntry {
+	entries := make([]*rtreeEntry, 0, len(i.entries))
+	for _, e := range i.entries {
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// insert adds the entry to the index unless it's already in the index or
+// has been removed. The caller must hold the write lock.
+func (i *spatialIndex) insert(entry *rtreeEntry) {
+	if i.removed[entry.id] {
+		delete(i.removed, entry.id)
+		return
+	}
+	if _, ok := i.entries[entry.id]; ok {
+		return
+	}
+	i.tree.Insert(entry)
+	i.entries[entry.id] = entry
+}
+
+// remove removes the entry with the given ID from the index. The caller
+// must hold the write lock.
+func (i *spatialIndex) remove(id int64) {
+	entry, ok := i.entries[id]
+	if !ok {
+		i.removed[id] = true
+		return
+	}
+	// Entries in the packed tree are only removed from entries
+	i.tree.Delete(entry)
+	delete(i.entries, id)
+}
+
+// apply applies the change to the index. The entries end up the same
+// regardless of the order changes are applied in, as object IDs are never
+// reused. The caller must hold the write lock.
+func (i *spatialIndex) apply(change *indexChange) {
+	for _, id := range change.removed {
+		i.remove(id)
+	}
+	for _, e := range change.added {
+		i.insert(e)
+	}
+	if i.version != nil {
+		i.version = change.version
+	}
+}
+
+// searchIntersect returns the entries that intersect rect. The caller must
+// hold the read lock.
+func (i *spatialIndex) searchIntersect(rect *rtreego.Rect) []rtreego.Spatial {
+	results := i.tree.SearchIntersect(rect)
+	for _, e := range i.packed.searchIntersect(rect) {
+		// Skip entries that have been removed
+		if i.entries[e.id] == e {
+			results = append(results, e)
+		}
+	}
+	return results
+}
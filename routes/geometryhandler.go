@@ -0,0 +1,457 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/larsmoa/renderdb/db"
+	"github.com/larsmoa/renderdb/formats"
+	"github.com/larsmoa/renderdb/httpext"
+	"github.com/larsmoa/renderdb/protobuf"
+	"github.com/larsmoa/renderdb/repository"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// -------------------------------------------------------------
+// Middleware for injecting repository.Repository to the context.
+// Requires worldsMiddleware.
+// -------------------------------------------------------------
+type repositoryKeyType int
+
+const repositoryKey repositoryKeyType = 0
+
+type repositoryMiddleware struct {
+	repos repository.Repositories
+}
+
+func (h *repositoryMiddleware) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer,
+	w http.ResponseWriter, r *http.Request) error {
+
+	var err error
+	// Parse URL
+	vars := mux.Vars(r)
+	worldID, err := httpext.ReadInt64ID(vars, "worldID")
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	repo, err := loadRepository(h.repos, tx, r, worldID)
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+	context.Set(r, repositoryKey, repo)
+	return nil
+}
+
+// loadRepository loads (or reuses) the spatial index of the world with the
+// given ID, and returns a repository that uses the transaction given. The
+// worlds of the request must be set, see worldsMiddleware.
+func loadRepository(repos repository.Repositories, tx *sqlx.Tx, r *http.Request,
+	worldID int64) (repository.Repository, error) {
+
+	// Lookup world
+	worldsDB := getWorldsFromContext(r)
+	world, err := worldsDB.Get(worldID)
+	if err != nil {
+		return nil, httpext.NewHttpError(fmt.Errorf("Could not retrieve world with id %d (reason: %s)", worldID, err), http.StatusInternalServerError)
+	}
+	if world == nil {
+		return nil, httpext.NewHttpError(fmt.Errorf("No world with id %d", worldID), http.StatusNotFound)
+	}
+
+	// Load (or reuse) spatial index of world
+	repo, err := repos.Get(worldID, db.NewObjectsDb(tx, world))
+	if err != nil {
+		return nil, httpext.NewHttpError(fmt.Errorf("Could not load geometry of world with id %d (reason: %s)", worldID, err), http.StatusInternalServerError)
+	}
+
+	// Changes to the geometry are applied to the spatial index, which is
+	// shared by all requests, once the changes are committed
+	httpext.OnCommit(r, repo.Commit)
+	return repo, nil
+}
+
+func getRepositoryFromContext(r *http.Request) repository.Repository {
+	repo, ok := context.GetOk(r, repositoryKey)
+	if !ok {
+		panic("Repository not available in context, forgot repositoryMiddleware?")
+	}
+	return repo.(repository.Repository)
+}
+
+// -------------------------------------------------------------
+// GET /worlds/{worldID}/geometry?{filter}&{options}
+// -------------------------------------------------------------
+
+type getWorldGeometryHandler struct{}
+
+func (h *getWorldGeometryHandler) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer,
+	w http.ResponseWriter, r *http.Request) error {
+
+	// Parse query
+	query, err := parseGeometryQuery(r.URL.Query())
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Lookup geometry
+	repo := getRepositoryFromContext(r)
+	done := make(chan struct{})
+	objCh, errCh := repo.GetInsideVolume(done, query.bounds, query.options...)
+	defer stopLookup(done, objCh)
+	if httpext.NegotiatedMediaType(r) == httpext.NDJSONMediaType {
+		return streamGeometry(w, objCh, errCh)
+	}
+	objects, err := readObjects(objCh, errCh)
+	if err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not retrieve geometry (reason: %s)", err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	return writeGeometry(renderer, w, r, objects)
+}
+
+// -------------------------------------------------------------
+// GET /worlds/{worldID}/layers/{layerID}/geometry?{filter}&{options}
+// -------------------------------------------------------------
+
+type getLayerGeometryHandler struct{}
+
+func (h *getLayerGeometryHandler) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer,
+	w http.ResponseWriter, r *http.Request) error {
+
+	var err error
+	// Parse URL
+	vars := mux.Vars(r)
+	layerID, err := httpext.ReadInt64ID(vars, "layerID")
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+	query, err := parseGeometryQuery(r.URL.Query())
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Lookup layer
+	layersDB := getLayersFromContext(r)
+	layer, err := layersDB.Get(layerID)
+	if err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not retrieve layer with id %d (reason: %s)", layerID, err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+	if layer == nil {
+		err = httpext.NewHttpError(fmt.Errorf("No layer with id %d", layerID), http.StatusNotFound)
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Lookup geometry
+	repo := getRepositoryFromContext(r)
+	opts := append(query.options, db.LayersSelector{LayerIDs: []int64{layerID}})
+	done := make(chan struct{})
+	objCh, errCh := repo.GetInsideVolume(done, query.bounds, opts...)
+	defer stopLookup(done, objCh)
+	if httpext.NegotiatedMediaType(r) == httpext.NDJSONMediaType {
+		return streamGeometry(w, objCh, errCh)
+	}
+	objects, err := readObjects(objCh, errCh)
+	if err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not retrieve geometry (reason: %s)", err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	return writeGeometry(renderer, w, r, objects)
+}
+
+// readObjects reads all objects from the channel until it's closed. Returns
+// the first error received on the error channel.
+func readObjects(objCh <-chan db.Object, errCh <-chan error) ([]db.Object, error) {
+	objects := []db.Object{}
+	for {
+		select {
+		case obj, more := <-objCh:
+			if !more {
+				return objects, nil
+			}
+			objects = append(objects, obj)
+		case err := <-errCh:
+			return nil, err
+		}
+	}
+}
+
+// stopLookup stops a lookup started by repository.Repository.GetInsideVolume
+// with the done channel given, e.g. when the client has disconnected while
+// the objects are streamed, and waits until the lookup has ended so that
+// the transaction isn't used after the handler returns.
+func stopLookup(done chan struct{}, objCh <-chan db.Object) {
+	close(done)
+	for range objCh {
+	}
+}
+
+// glbMediaType is the media type of binary glTF 2.0 files.
+const glbMediaType = "model/gltf-binary"
+
+// compressedMeshMediaType is the media type of compressed meshes, see
+// formats.CompressedMeshWriter.
+const compressedMeshMediaType = "application/vnd.renderdb.compressed-mesh"
+
+// geometryRenderers returns the renderers of the geometry routes. In
+// addition to the default renderers, the geometry formats are registered
+// with the JSON renderer, which is used for errors since the handlers write
+// the geometry formats themselves, see writeGeometry and streamGeometry.
+func geometryRenderers() *httpext.Renderers {
+	renderers := httpext.DefaultRenderers()
+	jsonRenderer := renderers.Default()
+	renderers.Register(glbMediaType, jsonRenderer)
+	renderers.Register(compressedMeshMediaType, jsonRenderer)
+	renderers.Register(httpext.NDJSONMediaType, jsonRenderer)
+	return renderers
+}
+
+// geometryStreamRenderer is used for writing geometry to clients that
+// accept httpext.NDJSONMediaType.
+var geometryStreamRenderer = httpext.NewNDJSONStreamRenderer(httpext.DefaultFlushInterval)
+
+// streamGeometry writes one geometryObjectPayload per line (NDJSON) as the
+// objects are received, so clients may process the first objects before
+// all objects are retrieved. If an error is received the stream ends with
+// an error record, see httpext.NewNDJSONStreamRenderer.
+func streamGeometry(w http.ResponseWriter, objCh <-chan db.Object, errCh <-chan error) error {
+	payloadCh := make(chan interface{})
+	payloadErrCh := make(chan error)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(payloadCh)
+		for {
+			var payload geometryObjectPayload
+			var err error
+			select {
+			case o, more := <-objCh:
+				if !more {
+					return
+				}
+				if payload, err = newGeometryObjectPayload(o); err != nil {
+					err = fmt.Errorf("Could not convert geometry (reason: %s)", err)
+				}
+			case err = <-errCh:
+				err = fmt.Errorf("Could not retrieve geometry (reason: %s)", err)
+			}
+
+			if err != nil {
+				select {
+				case payloadErrCh <- httpext.NewHttpError(err, http.StatusInternalServerError):
+				case <-done:
+				}
+				return
+			}
+			select {
+			case payloadCh <- payload:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return geometryStreamRenderer.WriteStream(w, http.StatusOK, payloadCh, payloadErrCh)
+}
+
+// writeGeometry writes the objects in the negotiated media type: as a GLB
+// file for glbMediaType, as compressed meshes for compressedMeshMediaType,
+// otherwise as a list of geometryObjectPayload written by the renderer.
+func writeGeometry(renderer httpext.ResponseRenderer, w http.ResponseWriter, r *http.Request,
+	objects []db.Object) error {
+
+	var write func(*bytes.Buffer, []db.Object) error
+	var description string
+	mediaType := httpext.NegotiatedMediaType(r)
+	switch mediaType {
+	case glbMediaType:
+		write, description = writeGLB, "GLB"
+	case compressedMeshMediaType:
+		write, description = writeCompressedMeshes, "compressed meshes"
+	default:
+		payloads, err := newGeometryObjectPayloads(objects)
+		if err != nil {
+			err = httpext.NewHttpError(fmt.Errorf("Could not convert geometry (reason: %s)", err), http.StatusInternalServerError)
+			renderer.WriteError(w, err)
+			return err
+		}
+		renderer.WriteObject(w, http.StatusOK, payloads)
+		return nil
+	}
+
+	buffer := bytes.Buffer{}
+	if err := write(&buffer, objects); err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not create %s (reason: %s)", description, err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buffer.Bytes())
+	return nil
+}
+
+// writeGLB writes the objects as a GLB file with one node per object. The
+// extras of each node holds the ID, layer ID, scene ID and metadata of the
+// object.
+func writeGLB(buffer *bytes.Buffer, objects []db.Object) error {
+	writer := formats.GLBWriter{}
+	for _, o := range objects {
+		reader, err := readObjectGeometry(o)
+		if err != nil {
+			return err
+		}
+		writer.AddNode(fmt.Sprintf("%d", o.ID()), reader, objectExtras(o))
+	}
+	return writer.Write(buffer)
+}
+
+// writeCompressedMeshes writes the objects as compressed meshes with
+// one mesh per object. Positions are quantized relative to the bounds of
+// each object. The extras of each mesh holds the ID, layer ID, scene ID
+// and metadata of the object.
+func writeCompressedMeshes(buffer *bytes.Buffer, objects []db.Object) error {
+	writer := formats.CompressedMeshWriter{}
+	for _, o := range objects {
+		reader, err := readObjectGeometry(o)
+		if err != nil {
+			return err
+		}
+		writer.AddMesh(fmt.Sprintf("%d", o.ID()), reader, *o.Bounds(), objectExtras(o))
+	}
+	return writer.Write(buffer)
+}
+
+// objectExtras returns the properties of the object that are included
+// with the geometry when written as GLB or compressed meshes.
+func objectExtras(o db.Object) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       o.ID(),
+		"layerId":  o.LayerID(),
+		"sceneId":  o.SceneID(),
+		"metadata": o.Metadata(),
+	}
+}
+
+// readObjectGeometry reads the geometry of the object given.
+func readObjectGeometry(o db.Object) (formats.GeometryReader, error) {
+	reader, err := formats.NewGeometryReader(o.GeometryFormat())
+	if err == nil {
+		err = reader.Read(bytes.NewReader(o.GeometryData()))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read geometry of object %d (reason: %s)", o.ID(), err)
+	}
+	return reader, nil
+}
+
+// objGeometryData returns the geometry of the object as Wavefront OBJ,
+// converting it if it's stored in another format.
+func objGeometryData(o db.Object) ([]byte, error) {
+	switch o.GeometryFormat() {
+	case "", formats.GeometryFormatOBJ:
+		return o.GeometryData(), nil
+	}
+	reader, err := readObjectGeometry(o)
+	if err != nil {
+		return nil, err
+	}
+	buffer := bytes.Buffer{}
+	if err = reader.Write(&buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+type boundsPayload struct {
+	Min vec3.T `json:"min"`
+	Max vec3.T `json:"max"`
+}
+
+// MarshalProto writes the bounds as the message 'Bounds' in renderdb.proto.
+func (p boundsPayload) MarshalProto(e *protobuf.Encoder) {
+	e.WritePackedDouble(1, p.Min[:])
+	e.WritePackedDouble(2, p.Max[:])
+}
+
+type geometryObjectPayload struct {
+	ID           int64         `json:"id"`
+	LayerID      int64         `json:"layerId"`
+	SceneID      int64         `json:"sceneId"`
+	Bounds       boundsPayload `json:"bounds"`
+	GeometryData []byte        `json:"geometryData"`
+	// Metadata holds the metadata of the object as JSON, or nil if the
+	// object has no metadata
+	Metadata *json.RawMessage `json:"metadata"`
+}
+
+// MarshalProto writes the payload as the message 'Object' in
+// renderdb.proto. The geometry is written as raw bytes.
+func (p geometryObjectPayload) MarshalProto(e *protobuf.Encoder) {
+	e.WriteInt64(1, p.ID)
+	e.WriteInt64(2, p.LayerID)
+	e.WriteInt64(3, p.SceneID)
+	e.WriteMessage(4, p.Bounds)
+	e.WriteBytes(5, p.GeometryData)
+	if p.Metadata != nil {
+		e.WriteString(6, string(*p.Metadata))
+	}
+}
+
+// newGeometryObjectPayloads creates payloads for the objects given. The
+// geometry of the payloads is Wavefront OBJ regardless of how the geometry
+// is stored.
+func newGeometryObjectPayloads(objects []db.Object) ([]geometryObjectPayload, error) {
+	payloads := make([]geometryObjectPayload, len(objects))
+	for i, o := range objects {
+		var err error
+		if payloads[i], err = newGeometryObjectPayload(o); err != nil {
+			return nil, err
+		}
+	}
+	return payloads, nil
+}
+
+// newGeometryObjectPayload creates the payload of a single object, see
+// newGeometryObjectPayloads.
+func newGeometryObjectPayload(o db.Object) (geometryObjectPayload, error) {
+	geometryData, err := objGeometryData(o)
+	if err != nil {
+		return geometryObjectPayload{}, err
+	}
+	var metadata *json.RawMessage
+	if m := o.Metadata(); m != nil {
+		buf, err := json.Marshal(m)
+		if err != nil {
+			return geometryObjectPayload{}, fmt.Errorf("Could not marshal metadata of object %d (reason: %v)", o.ID(), err)
+		}
+		raw := json.RawMessage(buf)
+		metadata = &raw
+	}
+	bounds := o.Bounds()
+	return geometryObjectPayload{
+		ID:           o.ID(),
+		LayerID:      o.LayerID(),
+		SceneID:      o.SceneID(),
+		Bounds:       boundsPayload{bounds.Min, bounds.Max},
+		GeometryData: geometryData,
+		Metadata:     metadata,
+	}, nil
+}
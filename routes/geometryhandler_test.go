@@ -0,0 +1,520 @@
+package routes
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/context"
+	"github.com/jmoiron/sqlx"
+	"github.com/larsmoa/renderdb/db"
+	"github.com/larsmoa/renderdb/formats"
+	"github.com/larsmoa/renderdb/httpext"
+	"github.com/larsmoa/renderdb/protobuf"
+	"github.com/larsmoa/renderdb/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+type geometryHandlerFixture struct {
+	mockDB sqlmock.Sqlmock
+	db     *sqlx.DB
+	tx     *sqlx.Tx
+
+	worlds *db.MockWorlds
+	layers *db.MockLayers
+	repos  *repository.MockRepositories
+	repo   *repository.MockRepository
+
+	writer   *httptest.ResponseRecorder
+	renderer *httpext.MockResponseRenderer
+}
+
+func (f *geometryHandlerFixture) Setup(t *testing.T, r *http.Request) {
+	var database *sql.DB
+	var err error
+	database, f.mockDB, err = sqlmock.New()
+	assert.NoError(t, err)
+
+	f.mockDB.ExpectBegin()
+	f.db = sqlx.NewDb(database, "")
+	f.tx, err = f.db.Beginx()
+	assert.NoError(t, err)
+
+	f.writer = httptest.NewRecorder()
+	f.renderer = &httpext.MockResponseRenderer{}
+
+	f.worlds = &db.MockWorlds{}
+	f.layers = &db.MockLayers{}
+	f.repos = &repository.MockRepositories{}
+	f.repo = &repository.MockRepository{}
+	context.Set(r, worldsDBKey, f.worlds)
+	context.Set(r, layersDBKey, f.layers)
+	context.Set(r, repositoryKey, f.repo)
+	_, err = geometryRenderers().Negotiate(r)
+	assert.NoError(t, err)
+}
+
+func (f *geometryHandlerFixture) Teardown(t *testing.T) {
+	assert.NoError(t, f.db.Close())
+}
+
+// createObjectsResult emulates how Repository.GetInsideVolume() returns
+// values/error.
+func createObjectsResult(values ...interface{}) (<-chan db.Object, <-chan error) {
+	objCh := make(chan db.Object)
+	errCh := make(chan error)
+	go func() {
+		defer close(objCh)
+		for _, v := range values {
+			if err, ok := v.(error); ok {
+				errCh <- err
+				return
+			}
+			objCh <- v.(db.Object)
+		}
+	}()
+	return objCh, errCh
+}
+
+func TestRepositoryMiddleware_WorldExists_InjectsRepository(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry", nil)
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+	context.Delete(r, repositoryKey)
+
+	f.worlds.On("Get", int64(13)).Return(&db.World{ID: 13}, nil)
+	f.repos.On("Get", int64(13), mock.Anything).Return(f.repo, nil)
+	middleware := repositoryMiddleware{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&middleware, "GET", "/worlds/{worldID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, f.repo, getRepositoryFromContext(r))
+	f.repos.AssertExpectations(t)
+}
+
+func TestRepositoryMiddleware_NoWorld_WritesError(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry", nil)
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.worlds.On("Get", int64(13)).Return(nil, nil)
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	middleware := repositoryMiddleware{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&middleware, "GET", "/worlds/{worldID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestRepositoryMiddleware_LoadFails_WritesError(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry", nil)
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.worlds.On("Get", int64(13)).Return(&db.World{ID: 13}, nil)
+	f.repos.On("Get", int64(13), mock.Anything).Return(nil, errors.New(""))
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	middleware := repositoryMiddleware{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&middleware, "GET", "/worlds/{worldID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	f.repos.AssertExpectations(t)
+	f.renderer.AssertExpectations(t)
+}
+
+func TestGetWorldGeometryHandler_MissingBounds_WritesError(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry", nil)
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := getWorldGeometryHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	f.renderer.AssertExpectations(t)
+}
+
+func TestGetWorldGeometryHandler_ValidQuery_WritesObjects(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry?bounds=0,0,0,1,1,1&sortByDistance=2,2,2", nil)
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	obj := db.NewSimpleObject(vec3.Box{}, []byte("g"), nil)
+	bounds := vec3.Box{Min: vec3.T{0, 0, 0}, Max: vec3.T{1, 1, 1}}
+	payloads, _ := newGeometryObjectPayloads([]db.Object{obj})
+	f.repo.On("GetInsideVolume", mock.Anything, bounds, mock.Anything).Return(createObjectsResult(obj))
+	f.renderer.On("WriteObject", f.writer, 200, payloads)
+	handler := getWorldGeometryHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	f.repo.AssertExpectations(t)
+	f.renderer.AssertExpectations(t)
+}
+
+func TestGetWorldGeometryHandler_BinaryMeshObject_WritesOBJ(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry?bounds=0,0,0,1,1,1", nil)
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	reader := formats.WavefrontObjReader{}
+	assert.NoError(t, reader.Read(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\ng first\nf 1 2 3\n")))
+	mesh := bytes.Buffer{}
+	for g := range reader.Groups() {
+		assert.NoError(t, g.WriteBinaryMesh(&mesh, formats.BinaryMeshOptions{}))
+	}
+	obj := db.NewSceneObject(13, 1, 1, vec3.Box{}, mesh.Bytes(), formats.GeometryFormatBinaryMesh, 1, nil, nil)
+	f.repo.On("GetInsideVolume", mock.Anything, mock.Anything).Return(createObjectsResult(obj))
+	f.renderer.On("WriteObject", f.writer, 200, mock.Anything)
+	handler := getWorldGeometryHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	payloads := f.renderer.Calls[0].Arguments.Get(2).([]geometryObjectPayload)
+	if assert.Len(t, payloads, 1) {
+		assert.Contains(t, string(payloads[0].GeometryData), "g first\nf 1 2 3\n")
+	}
+}
+
+func TestGetWorldGeometryHandler_RepositoryReturnsError_WritesError(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry?bounds=0,0,0,1,1,1", nil)
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.repo.On("GetInsideVolume", mock.Anything, mock.Anything).Return(createObjectsResult(errors.New("")))
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := getWorldGeometryHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	f.repo.AssertExpectations(t)
+	f.renderer.AssertExpectations(t)
+}
+
+func TestGetLayerGeometryHandler_NoLayer_WritesError(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/layers/7/geometry?bounds=0,0,0,1,1,1", nil)
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(7)).Return(nil, nil)
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := getLayerGeometryHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/layers/{layerID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestGetLayerGeometryHandler_ValidQuery_SelectsLayer(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/layers/7/geometry?bounds=0,0,0,1,1,1", nil)
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	obj := db.NewSimpleObject(vec3.Box{}, []byte("g"), nil)
+	bounds := vec3.Box{Min: vec3.T{0, 0, 0}, Max: vec3.T{1, 1, 1}}
+	f.layers.On("Get", int64(7)).Return(&db.Layer{ID: 7, WorldID: 13}, nil)
+	payloads, _ := newGeometryObjectPayloads([]db.Object{obj})
+	f.repo.On("GetInsideVolume", mock.Anything, bounds, db.LayersSelector{LayerIDs: []int64{7}}).Return(createObjectsResult(obj))
+	f.renderer.On("WriteObject", f.writer, 200, payloads)
+	handler := getLayerGeometryHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/layers/{layerID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	f.repo.AssertExpectations(t)
+	f.renderer.AssertExpectations(t)
+}
+
+func TestGetWorldGeometryHandler_AcceptsGLB_WritesGLB(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry?bounds=0,0,0,1,1,1", nil)
+	r.Header.Set("Accept", "model/gltf-binary, application/json;q=0.5")
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	obj := db.NewSimpleObject(vec3.Box{}, []byte("v 0 0 0\nv 1 0 0\nv 0 1 0\ng first\nf 1 2 3\n"), nil)
+	f.repo.On("GetInsideVolume", mock.Anything, mock.Anything).Return(createObjectsResult(obj))
+	handler := getWorldGeometryHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, f.writer.Code)
+	assert.Equal(t, "model/gltf-binary", f.writer.Header().Get("Content-Type"))
+	assert.Equal(t, "glTF", f.writer.Body.String()[0:4])
+	f.renderer.AssertExpectations(t)
+}
+
+func TestGetWorldGeometryHandler_AcceptsGLBInvalidGeometry_WritesError(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry?bounds=0,0,0,1,1,1", nil)
+	r.Header.Set("Accept", "model/gltf-binary")
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	obj := db.NewSimpleObject(vec3.Box{}, []byte("invalid"), nil)
+	f.repo.On("GetInsideVolume", mock.Anything, mock.Anything).Return(createObjectsResult(obj))
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := getWorldGeometryHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusInternalServerError, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestGetWorldGeometryHandler_AcceptsCompressedMesh_WritesCompressedMeshes(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry?bounds=0,0,0,1,1,1", nil)
+	r.Header.Set("Accept", "application/vnd.renderdb.compressed-mesh, application/json;q=0.5")
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	bounds := vec3.Box{Min: vec3.T{0, 0, 0}, Max: vec3.T{1, 1, 0}}
+	obj := db.NewSimpleObject(bounds, []byte("v 0 0 0\nv 1 0 0\nv 0 1 0\ng first\nf 1 2 3\n"), nil)
+	f.repo.On("GetInsideVolume", mock.Anything, mock.Anything).Return(createObjectsResult(obj))
+	handler := getWorldGeometryHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, f.writer.Code)
+	assert.Equal(t, "application/vnd.renderdb.compressed-mesh", f.writer.Header().Get("Content-Type"))
+	assert.Equal(t, "RDBZ", f.writer.Body.String()[0:4])
+	reader := formats.CompressedMeshReader{}
+	if assert.NoError(t, reader.Read(f.writer.Body)) {
+		g := <-reader.Groups()
+		assert.Equal(t, bounds, g.BoundingBox())
+		assert.Equal(t, 1, g.TriangleCount())
+	}
+	f.renderer.AssertExpectations(t)
+}
+
+func TestGetWorldGeometryHandler_AcceptsNDJSON_StreamsObjects(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry?bounds=0,0,0,1,1,1", nil)
+	r.Header.Set("Accept", "application/x-ndjson")
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	obj1 := db.NewSimpleObject(vec3.Box{}, []byte("g first"), nil)
+	obj2 := db.NewSimpleObject(vec3.Box{}, []byte("g second"), nil)
+	f.repo.On("GetInsideVolume", mock.Anything, mock.Anything).Return(createObjectsResult(obj1, obj2))
+	handler := getWorldGeometryHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, f.writer.Code)
+	assert.Equal(t, "application/x-ndjson", f.writer.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(f.writer.Body.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		payload := geometryObjectPayload{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &payload))
+		assert.Equal(t, "g second", string(payload.GeometryData))
+	}
+	f.renderer.AssertExpectations(t)
+}
+
+func TestGetWorldGeometryHandler_AcceptsNDJSONRepositoryReturnsError_EndsWithErrorRecord(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry?bounds=0,0,0,1,1,1", nil)
+	r.Header.Set("Accept", "application/x-ndjson")
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	obj := db.NewSimpleObject(vec3.Box{}, []byte("g first"), nil)
+	f.repo.On("GetInsideVolume", mock.Anything, mock.Anything).Return(createObjectsResult(obj, errors.New("failed")))
+	handler := getWorldGeometryHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/geometry",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	lines := strings.Split(strings.TrimSpace(f.writer.Body.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, lines[1], "\"errorMessage\":\"Could not retrieve geometry (reason: failed)\"")
+	}
+	f.renderer.AssertExpectations(t)
+}
+
+// disconnectedWriter emulates a client that disconnects after the first
+// write to the response.
+type disconnectedWriter struct {
+	*httptest.ResponseRecorder
+	writes int
+}
+
+func (w *disconnectedWriter) Write(buf []byte) (int, error) {
+	w.writes++
+	if w.writes > 1 {
+		return 0, errors.New("client disconnected")
+	}
+	return w.ResponseRecorder.Write(buf)
+}
+
+func TestGetWorldGeometryHandler_AcceptsNDJSONClientDisconnects_StopsLookup(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/geometry?bounds=0,0,0,1,1,1", nil)
+	r.Header.Set("Accept", "application/x-ndjson")
+	f := geometryHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	// Emulate a lookup of an unbounded number of objects
+	obj := db.NewSimpleObject(vec3.Box{}, []byte("g first"), nil)
+	objCh := make(chan db.Object)
+	f.repo.On("GetInsideVolume", mock.Anything, mock.Anything).
+		Return((<-chan db.Object)(objCh), (<-chan error)(make(chan error))).
+		Run(func(args mock.Arguments) {
+			done := args.Get(0).(<-chan struct{})
+			go func() {
+				defer close(objCh)
+				for {
+					select {
+					case objCh <- obj:
+					case <-done:
+						return
+					}
+				}
+			}()
+		})
+	handler := getWorldGeometryHandler{}
+	writer := &disconnectedWriter{ResponseRecorder: f.writer}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/geometry",
+		writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	_, more := <-objCh
+	assert.False(t, more)
+}
+
+func TestGeometryObjectPayload_MarshalProto_WritesObjectMessage(t *testing.T) {
+	// Arrange
+	metadata := json.RawMessage(`{"id":1}`)
+	payload := geometryObjectPayload{
+		ID:           1,
+		LayerID:      2,
+		SceneID:      3,
+		Bounds:       boundsPayload{vec3.T{0, 0, 0}, vec3.T{1, 1, 1}},
+		GeometryData: []byte("g a\n"),
+		Metadata:     &metadata,
+	}
+
+	// Act
+	fields, err := protobuf.ReadFields(protobuf.Marshal(payload))
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.Len(t, fields, 6) {
+		assert.Equal(t, []int{1, 2, 3, 4, 5, 6}, []int{fields[0].Number, fields[1].Number,
+			fields[2].Number, fields[3].Number, fields[4].Number, fields[5].Number})
+		assert.Equal(t, uint64(3), fields[2].Value)
+		assert.Equal(t, []byte("g a\n"), fields[4].Data)
+		assert.Equal(t, `{"id":1}`, string(fields[5].Data))
+		bounds, err := protobuf.ReadFields(fields[3].Data)
+		assert.NoError(t, err)
+		if assert.Len(t, bounds, 2) {
+			assert.Len(t, bounds[0].Data, 24)
+			assert.Len(t, bounds[1].Data, 24)
+		}
+	}
+}
+
+func TestNewGeometryObjectPayload_UnmarshalableMetadata_ReturnsError(t *testing.T) {
+	// Arrange
+	o := db.NewSimpleObject(vec3.Box{}, []byte("g a\n"), map[string]interface{}{"f": func() {}})
+
+	// Act
+	_, err := newGeometryObjectPayload(o)
+
+	// Assert
+	assert.Error(t, err)
+}
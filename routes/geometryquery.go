@@ -0,0 +1,225 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/larsmoa/renderdb/db"
+	"github.com/larsmoa/renderdb/httpext"
+	"github.com/larsmoa/renderdb/repository/options"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+// geometryQuery holds the filter and options of a geometry query.
+type geometryQuery struct {
+	bounds vec3.Box
+	// camera is nil unless camera parameters are provided
+	camera  *options.Camera
+	options []interface{}
+}
+
+// parseGeometryQuery parses a geometry query from the URL query string.
+// Supported parameters:
+// - bounds=minX,minY,minZ,maxX,maxY,maxZ (required)
+//   Only objects intersecting the bounding box are returned. Min must not be
+//   greater than max.
+// - filter=expression
+//   Only objects with metadata matching the expression are returned,
+//   see db.MetadataFilter.
+// - cameraPosition=x,y,z&cameraDirection=x,y,z&cameraUp=x,y,z&
+//   fov=degrees&aspectRatio=width/height&near=distance&far=distance
+//   Only objects inside the view frustum of the camera are returned.
+//   All camera parameters must be set when cameraPosition is set.
+// - minPixelSize=pixels,viewportHeight
+//   Removes objects that are smaller than the given number of pixels on
+//   screen for a viewport of viewportHeight pixels. Requires camera parameters.
+// - occlusionCull=minOccluderSize,maxOccluders
+//   Removes objects hidden behind large objects near the camera. Up to
+//   maxOccluders objects with a bounding box diagonal of at least
+//   minOccluderSize are used as occluders. Requires camera parameters.
+// - sortByDistance=x,y,z
+//   Sorts the objects by distance to the given point (nearest first).
+// - lodDistances=d1,d2,...
+//   Returns simplified geometry for objects further away from the camera
+//   than d1 (level 1), d2 (level 2) etc. Requires camera parameters.
+// - maxTriangles=count
+//   Restricts the total number of triangles returned. Applied after sorting.
+// Returns a HttpError with status code http.StatusBadRequest if the query is
+// invalid.
+func parseGeometryQuery(values url.Values) (*geometryQuery, error) {
+	query := new(geometryQuery)
+
+	// Filter
+	if values.Get("bounds") == "" {
+		return nil, httpext.NewHttpError(fmt.Errorf("Query parameter 'bounds' must be set"), http.StatusBadRequest)
+	}
+	bounds, err := parseFloats(values, "bounds", 6)
+	if err != nil {
+		return nil, err
+	}
+	query.bounds = vec3.Box{
+		Min: vec3.T{bounds[0], bounds[1], bounds[2]},
+		Max: vec3.T{bounds[3], bounds[4], bounds[5]},
+	}
+	for i := 0; i < 3; i++ {
+		if query.bounds.Min[i] > query.bounds.Max[i] {
+			return nil, httpext.NewHttpError(fmt.Errorf("Query parameter 'bounds' must have min less than or equal to max"), http.StatusBadRequest)
+		}
+	}
+
+	if expression := values.Get("filter"); expression != "" {
+		filter, err := db.ParseMetadataFilter(expression)
+		if err != nil {
+			return nil, httpext.NewHttpError(fmt.Errorf("Query parameter 'filter' is invalid (reason: %v)", err), http.StatusBadRequest)
+		}
+		query.options = append(query.options, filter)
+	}
+
+	// Camera
+	if values.Get("cameraPosition") != "" {
+		if query.camera, err = parseCamera(values); err != nil {
+			return nil, err
+		}
+		query.options = append(query.options, options.FrustumCull{Camera: *query.camera})
+	}
+	if values.Get("minPixelSize") != "" {
+		if query.camera == nil {
+			return nil, httpext.NewHttpError(fmt.Errorf("Query parameter 'minPixelSize' requires 'cameraPosition' to be set"), http.StatusBadRequest)
+		}
+		pixels, err := parseFloats(values, "minPixelSize", 2)
+		if err != nil {
+			return nil, err
+		}
+		if pixels[0] < 0 || pixels[1] <= 0 {
+			return nil, httpext.NewHttpError(fmt.Errorf("Query parameter 'minPixelSize' must have a non-negative size and a positive viewport height"), http.StatusBadRequest)
+		}
+		query.options = append(query.options, options.ScreenSpaceSizeCull{
+			Eye:            query.camera.Position,
+			FieldOfView:    query.camera.FieldOfView,
+			ViewportHeight: pixels[1],
+			MinPixelSize:   pixels[0],
+		})
+	}
+	if values.Get("occlusionCull") != "" {
+		if query.camera == nil {
+			return nil, httpext.NewHttpError(fmt.Errorf("Query parameter 'occlusionCull' requires 'cameraPosition' to be set"), http.StatusBadRequest)
+		}
+		occlusion, err := parseFloats(values, "occlusionCull", 2)
+		if err != nil {
+			return nil, err
+		}
+		if occlusion[0] < 0 || occlusion[1] < 0 || occlusion[1] != math.Floor(occlusion[1]) {
+			return nil, httpext.NewHttpError(fmt.Errorf("Query parameter 'occlusionCull' must have a non-negative size and a non-negative integer count"), http.StatusBadRequest)
+		}
+		query.options = append(query.options, options.OcclusionCull{
+			Eye:             query.camera.Position,
+			MinOccluderSize: occlusion[0],
+			MaxOccluders:    int(occlusion[1]),
+		})
+	}
+
+	// Options
+	if values.Get("sortByDistance") != "" {
+		pivot, err := parseFloats(values, "sortByDistance", 3)
+		if err != nil {
+			return nil, err
+		}
+		query.options = append(query.options, options.SortByDistance{Pivot: vec3.T{pivot[0], pivot[1], pivot[2]}})
+	}
+	if values.Get("lodDistances") != "" {
+		if query.camera == nil {
+			return nil, httpext.NewHttpError(fmt.Errorf("Query parameter 'lodDistances' requires 'cameraPosition' to be set"), http.StatusBadRequest)
+		}
+		distances, err := parseFloatList(values, "lodDistances")
+		if err != nil {
+			return nil, err
+		}
+		for i := 1; i < len(distances); i++ {
+			if distances[i] < distances[i-1] {
+				return nil, httpext.NewHttpError(fmt.Errorf("Query parameter 'lodDistances' must be in ascending order"), http.StatusBadRequest)
+			}
+		}
+		query.options = append(query.options, options.LevelOfDetail{Eye: query.camera.Position, Distances: distances})
+	}
+	if values.Get("maxTriangles") != "" {
+		maxTriangles, err := strconv.Atoi(values.Get("maxTriangles"))
+		if err != nil || maxTriangles < 0 {
+			return nil, httpext.NewHttpError(fmt.Errorf("Query parameter 'maxTriangles' must be a non-negative integer"), http.StatusBadRequest)
+		}
+		query.options = append(query.options, options.TriangleBudget{MaxTriangles: maxTriangles})
+	}
+	return query, nil
+}
+
+// parseCamera parses the camera parameters of a geometry query.
+func parseCamera(values url.Values) (*options.Camera, error) {
+	camera := new(options.Camera)
+	vectors := []struct {
+		name   string
+		target *vec3.T
+	}{
+		{"cameraPosition", &camera.Position},
+		{"cameraDirection", &camera.Direction},
+		{"cameraUp", &camera.Up},
+	}
+	for _, v := range vectors {
+		coords, err := parseFloats(values, v.name, 3)
+		if err != nil {
+			return nil, err
+		}
+		*v.target = vec3.T{coords[0], coords[1], coords[2]}
+	}
+
+	scalars := []struct {
+		name   string
+		target *float64
+	}{
+		{"fov", &camera.FieldOfView},
+		{"aspectRatio", &camera.AspectRatio},
+		{"near", &camera.Near},
+		{"far", &camera.Far},
+	}
+	for _, s := range scalars {
+		if values.Get(s.name) == "" {
+			return nil, httpext.NewHttpError(fmt.Errorf("Query parameter '%s' must be set when 'cameraPosition' is set", s.name), http.StatusBadRequest)
+		}
+		value, err := parseFloats(values, s.name, 1)
+		if err != nil {
+			return nil, err
+		}
+		*s.target = value[0]
+	}
+
+	if err := camera.Verify(); err != nil {
+		return nil, httpext.NewHttpError(fmt.Errorf("Invalid camera (reason: %v)", err), http.StatusBadRequest)
+	}
+	return camera, nil
+}
+
+// parseFloats parses a comma separated list of exactly count floats
+// from the query parameter given.
+func parseFloats(values url.Values, name string, count int) ([]float64, error) {
+	if fields := strings.Split(values.Get(name), ","); len(fields) != count {
+		return nil, httpext.NewHttpError(fmt.Errorf("Query parameter '%s' must have %d comma separated values, but got %d", name, count, len(fields)), http.StatusBadRequest)
+	}
+	return parseFloatList(values, name)
+}
+
+// parseFloatList parses a comma separated list of finite floats from the
+// query parameter given.
+func parseFloatList(values url.Values, name string) ([]float64, error) {
+	fields := strings.Split(values.Get(name), ",")
+	result := make([]float64, len(fields))
+	for i, f := range fields {
+		var err error
+		result[i], err = strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || math.IsNaN(result[i]) || math.IsInf(result[i], 0) {
+			return nil, httpext.NewHttpError(fmt.Errorf("Query parameter '%s' has invalid value '%s'", name, f), http.StatusBadRequest)
+		}
+	}
+	return result, nil
+}
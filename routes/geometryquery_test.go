@@ -0,0 +1,254 @@
+package routes
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/larsmoa/renderdb/db"
+	"github.com/larsmoa/renderdb/repository/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go3d/float64/vec3"
+)
+
+func TestParseGeometryQuery_MissingBounds_ReturnsError(t *testing.T) {
+	_, err := parseGeometryQuery(url.Values{})
+	assert.Error(t, err)
+}
+
+func TestParseGeometryQuery_InvalidBounds_ReturnsError(t *testing.T) {
+	_, err := parseGeometryQuery(url.Values{"bounds": {"0,0,0,1,1"}})
+	assert.Error(t, err)
+	_, err = parseGeometryQuery(url.Values{"bounds": {"0,0,0,1,1,a"}})
+	assert.Error(t, err)
+	_, err = parseGeometryQuery(url.Values{"bounds": {"0,0,0,1,NaN,1"}})
+	assert.Error(t, err)
+	_, err = parseGeometryQuery(url.Values{"bounds": {"-Inf,0,0,1,1,1"}})
+	assert.Error(t, err)
+	_, err = parseGeometryQuery(url.Values{"bounds": {"0,2,0,1,1,1"}})
+	assert.Error(t, err)
+}
+
+func TestParseGeometryQuery_ZeroExtentBounds_ReturnsBounds(t *testing.T) {
+	query, err := parseGeometryQuery(url.Values{"bounds": {"0,0,0,0,0,0"}})
+	assert.NoError(t, err)
+	assert.Equal(t, vec3.Box{}, query.bounds)
+}
+
+func TestParseGeometryQuery_ValidBounds_ReturnsBounds(t *testing.T) {
+	// Act
+	query, err := parseGeometryQuery(url.Values{"bounds": {"-1,-2,-3, 1.5,2,3"}})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, vec3.Box{Min: vec3.T{-1, -2, -3}, Max: vec3.T{1.5, 2, 3}}, query.bounds)
+	assert.Empty(t, query.options)
+}
+
+func TestParseGeometryQuery_SortByDistance_AddsOption(t *testing.T) {
+	// Act
+	query, err := parseGeometryQuery(url.Values{
+		"bounds":         {"0,0,0,1,1,1"},
+		"sortByDistance": {"1,2,3"},
+	})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{options.SortByDistance{Pivot: vec3.T{1, 2, 3}}}, query.options)
+}
+
+func TestParseGeometryQuery_InvalidSortByDistance_ReturnsError(t *testing.T) {
+	_, err := parseGeometryQuery(url.Values{
+		"bounds":         {"0,0,0,1,1,1"},
+		"sortByDistance": {"1,2"},
+	})
+	assert.Error(t, err)
+}
+
+// createCameraValues returns a query with a valid camera looking along
+// the X-axis.
+func createCameraValues() url.Values {
+	return url.Values{
+		"bounds":          {"0,0,0,1,1,1"},
+		"cameraPosition":  {"0,0,0"},
+		"cameraDirection": {"1,0,0"},
+		"cameraUp":        {"0,0,1"},
+		"fov":             {"60"},
+		"aspectRatio":     {"1.5"},
+		"near":            {"0.1"},
+		"far":             {"1000"},
+	}
+}
+
+func TestParseGeometryQuery_Camera_AddsFrustumCull(t *testing.T) {
+	// Act
+	query, err := parseGeometryQuery(createCameraValues())
+
+	// Assert
+	assert.NoError(t, err)
+	expected := options.Camera{
+		Position:    vec3.T{0, 0, 0},
+		Direction:   vec3.T{1, 0, 0},
+		Up:          vec3.T{0, 0, 1},
+		FieldOfView: 60,
+		AspectRatio: 1.5,
+		Near:        0.1,
+		Far:         1000,
+	}
+	assert.Equal(t, &expected, query.camera)
+	assert.Equal(t, []interface{}{options.FrustumCull{Camera: expected}}, query.options)
+}
+
+func TestParseGeometryQuery_IncompleteCamera_ReturnsError(t *testing.T) {
+	for _, name := range []string{"cameraDirection", "cameraUp", "fov", "aspectRatio", "near", "far"} {
+		values := createCameraValues()
+		values.Del(name)
+		_, err := parseGeometryQuery(values)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestParseGeometryQuery_InvalidCamera_ReturnsError(t *testing.T) {
+	// Arrange
+	values := createCameraValues()
+	values.Set("near", "10")
+	values.Set("far", "1")
+
+	// Act
+	_, err := parseGeometryQuery(values)
+
+	// Assert
+	assert.Error(t, err)
+}
+
+func TestParseGeometryQuery_OcclusionCull_AddsOptionAfterFrustumCull(t *testing.T) {
+	// Arrange
+	values := createCameraValues()
+	values.Set("occlusionCull", "2.5,8")
+
+	// Act
+	query, err := parseGeometryQuery(values)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, query.options, 2)
+	assert.Equal(t, options.OcclusionCull{Eye: vec3.T{0, 0, 0}, MinOccluderSize: 2.5, MaxOccluders: 8}, query.options[1])
+}
+
+func TestParseGeometryQuery_OcclusionCullWithoutCamera_ReturnsError(t *testing.T) {
+	values := url.Values{"bounds": {"0,0,0,1,1,1"}, "occlusionCull": {"1,8"}}
+	_, err := parseGeometryQuery(values)
+	assert.Error(t, err)
+}
+
+func TestParseGeometryQuery_InvalidOcclusionCull_ReturnsError(t *testing.T) {
+	for _, value := range []string{"1", "1,2.5", "-1,8", "a,8"} {
+		values := createCameraValues()
+		values.Set("occlusionCull", value)
+		_, err := parseGeometryQuery(values)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseGeometryQuery_MinPixelSize_AddsScreenSpaceSizeCull(t *testing.T) {
+	// Arrange
+	values := createCameraValues()
+	values.Set("minPixelSize", "4,1080")
+
+	// Act
+	query, err := parseGeometryQuery(values)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, query.options, 2)
+	expected := options.ScreenSpaceSizeCull{
+		Eye:            query.camera.Position,
+		FieldOfView:    query.camera.FieldOfView,
+		ViewportHeight: 1080,
+		MinPixelSize:   4,
+	}
+	assert.Equal(t, expected, query.options[1])
+}
+
+func TestParseGeometryQuery_InvalidMinPixelSize_ReturnsError(t *testing.T) {
+	for _, value := range []string{"4", "-1,1080", "4,0", "a,1080"} {
+		values := createCameraValues()
+		values.Set("minPixelSize", value)
+		_, err := parseGeometryQuery(values)
+		assert.Error(t, err, value)
+	}
+
+	values := url.Values{"bounds": {"0,0,0,1,1,1"}, "minPixelSize": {"4,1080"}}
+	_, err := parseGeometryQuery(values)
+	assert.Error(t, err)
+}
+
+func TestParseGeometryQuery_MaxTriangles_AddsTriangleBudgetAfterSort(t *testing.T) {
+	// Arrange
+	values := url.Values{"bounds": {"0,0,0,1,1,1"}, "maxTriangles": {"1000"}, "sortByDistance": {"1,2,3"}}
+
+	// Act
+	query, err := parseGeometryQuery(values)
+
+	// Assert
+	assert.NoError(t, err)
+	expected := []interface{}{
+		options.SortByDistance{Pivot: vec3.T{1, 2, 3}},
+		options.TriangleBudget{MaxTriangles: 1000},
+	}
+	assert.Equal(t, expected, query.options)
+}
+
+func TestParseGeometryQuery_InvalidMaxTriangles_ReturnsError(t *testing.T) {
+	for _, value := range []string{"-1", "1.5", "a"} {
+		values := url.Values{"bounds": {"0,0,0,1,1,1"}, "maxTriangles": {value}}
+		_, err := parseGeometryQuery(values)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseGeometryQuery_LodDistances_AddsLevelOfDetail(t *testing.T) {
+	// Arrange
+	values := createCameraValues()
+	values.Set("lodDistances", "50,200,500")
+
+	// Act
+	query, err := parseGeometryQuery(values)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, query.options, 2)
+	expected := options.LevelOfDetail{Eye: query.camera.Position, Distances: []float64{50, 200, 500}}
+	assert.Equal(t, expected, query.options[1])
+}
+
+func TestParseGeometryQuery_InvalidLodDistances_ReturnsError(t *testing.T) {
+	for _, value := range []string{"200,50", "a", "50,"} {
+		values := createCameraValues()
+		values.Set("lodDistances", value)
+		_, err := parseGeometryQuery(values)
+		assert.Error(t, err, value)
+	}
+
+	values := url.Values{"bounds": {"0,0,0,1,1,1"}, "lodDistances": {"50"}}
+	_, err := parseGeometryQuery(values)
+	assert.Error(t, err)
+}
+
+func TestParseGeometryQuery_Filter_AddsMetadataFilter(t *testing.T) {
+	// Arrange
+	values := url.Values{"bounds": {"0,0,0,1,1,1"}, "filter": {`metadata.system == "HVAC"`}}
+
+	// Act
+	query, err := parseGeometryQuery(values)
+
+	// Assert
+	assert.NoError(t, err)
+	expected, _ := db.ParseMetadataFilter(`metadata.system == "HVAC"`)
+	assert.Equal(t, []interface{}{expected}, query.options)
+}
+
+func TestParseGeometryQuery_InvalidFilter_ReturnsError(t *testing.T) {
+	values := url.Values{"bounds": {"0,0,0,1,1,1"}, "filter": {`metadata.system ==`}}
+	_, err := parseGeometryQuery(values)
+	assert.Error(t, err)
+}
@@ -165,3 +165,44 @@ func parseLayerFromBody(r *http.Request) (*db.Layer, error) {
 	}
 	return &layer, nil
 }
+
+// ----------------------------------------------
+// DELETE /worlds/{worldID}/layers/{layerID}
+// ----------------------------------------------
+
+type deleteLayerHandler struct{}
+
+func (h *deleteLayerHandler) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer,
+	w http.ResponseWriter, r *http.Request) error {
+
+	var err error
+	// Parse URL
+	vars := mux.Vars(r)
+	layerID, err := httpext.ReadInt64ID(vars, "layerID")
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Lookup layer
+	if err = verifyLayerExists(r, layerID); err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Delete geometry, then the layer with its scenes
+	repo := getRepositoryFromContext(r)
+	if err = repo.Remove(db.LayersSelector{LayerIDs: []int64{layerID}}); err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not delete geometry in layer with id %d (reason: %s)", layerID, err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+	if err = getLayersFromContext(r).Delete(layerID); err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not delete layer with id %d (reason: %s)", layerID, err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	renderer.WriteEmpty(w, http.StatusNoContent)
+	return nil
+}
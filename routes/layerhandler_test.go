@@ -13,6 +13,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/larsmoa/renderdb/db"
 	"github.com/larsmoa/renderdb/httpext"
+	"github.com/larsmoa/renderdb/repository"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -23,6 +24,7 @@ type layerHandlerFixture struct {
 	tx     *sqlx.Tx
 
 	layers *db.MockLayers
+	repo   *repository.MockRepository
 
 	writer   *httptest.ResponseRecorder
 	renderer *httpext.MockResponseRenderer
@@ -43,7 +45,9 @@ func (f *layerHandlerFixture) Setup(t *testing.T, r *http.Request) {
 	f.renderer = &httpext.MockResponseRenderer{}
 
 	f.layers = &db.MockLayers{}
+	f.repo = &repository.MockRepository{}
 	context.Set(r, layersDBKey, f.layers)
+	context.Set(r, repositoryKey, f.repo)
 }
 
 func (f *layerHandlerFixture) Teardown(t *testing.T) {
@@ -192,3 +196,49 @@ func TestPostLayerHandler_ValidBody_AddsToDatabaseAndWritesObject(t *testing.T)
 	f.layers.AssertExpectations(t)
 	f.renderer.AssertExpectations(t)
 }
+
+func TestDeleteLayerHandler_ExistingLayer_RemovesGeometryAndLayer(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("DELETE", "/worlds/13/layers/42", nil)
+	f := layerHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(42)).Return(&db.Layer{ID: 42, WorldID: 13}, nil)
+	f.layers.On("Delete", int64(42)).Return(nil)
+	f.repo.On("Remove", db.LayersSelector{LayerIDs: []int64{42}}).Return(nil)
+	f.renderer.On("WriteEmpty", f.writer, http.StatusNoContent)
+	handler := deleteLayerHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "DELETE", "/worlds/{worldID}/layers/{layerID}",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	f.layers.AssertExpectations(t)
+	f.repo.AssertExpectations(t)
+	f.renderer.AssertExpectations(t)
+}
+
+func TestDeleteLayerHandler_NoLayer_WritesError(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("DELETE", "/worlds/13/layers/42", nil)
+	f := layerHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(42)).Return(nil, nil)
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := deleteLayerHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "DELETE", "/worlds/{worldID}/layers/{layerID}",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, err.(httpext.HttpError).StatusCode())
+	f.repo.AssertNotCalled(t, "Remove", mock.Anything)
+	f.renderer.AssertExpectations(t)
+}
@@ -13,6 +13,21 @@
 //   There is no API to add single objects or to query for objects based
 //   on IDs. To add objects a new 'scene' must be added.
 //
+// Responses are JSON by default. The format is negotiated from the
+// 'Accept' header, including quality values, e.g.
+// 'Accept: application/x-protobuf, application/json;q=0.5'. Supported
+// formats are JSON ('application/json'), MessagePack ('application/msgpack')
+// and protocol buffers ('application/x-protobuf'), and the geometry
+// endpoints also support the geometry formats described below. Requests
+// that accept none of the supported formats fail with 406 Not Acceptable.
+// MessagePack responses have the same fields as JSON responses.
+// Protocol buffers messages are described by protobuf/renderdb.proto.
+// Single values are encoded as the message of the value (e.g. World) and
+// lists as the corresponding list message (e.g. WorldList). Object
+// geometry is written as raw bytes rather than base64, and errors are
+// written as the message Error. Responses that have no message in the
+// schema, e.g. materials, are rejected with 406 Not Acceptable.
+//
 // Data management endpoints:
 // --------------------------
 // POST 	/worlds
@@ -21,7 +36,7 @@
 // - Returns metadata for all known worlds
 // GET  	/worlds/{id}
 // - Returns metadata the world with the given ID
-// DELETE 	/worlds/{id} 	(Not implemented yet)
+// DELETE 	/worlds/{id}
 // - Deletes the world with the given ID. Deletes all
 //   layers in the world.
 // POST 	/worlds/{id}/layers
@@ -30,92 +45,220 @@
 // - Returns metadata for all layers in the world
 // GET 		/worlds/{id}/layers/{id}
 // - Returns metadata for the layer with the given ID
-// DELETE   /worlds/{id}/layers/{id} 	(Not implemented yet)
+// DELETE   /worlds/{id}/layers/{id}
 // - Deletes the layer with the given ID. Deletes all
 //   scenes in the layer.
 // POST 	/worlds/{id}/layers/{id}/scenes
 // - Adds a new scene to the given layer. Scenes are specified
 //   using the Wavefront OBJ-format and each group
 //   in the file is considered to be a separate object.
-// PUT 		/worlds/{id}/layers/{id}/scenes/{id}	(Not implemented yet)
+//   The OBJ file is either the body of a text/plain request (the
+//   scene name is given by the 'name' query parameter), or the
+//   'obj'-part of a multipart/form-data request with a 'name'-field.
+//   The OBJ file is streamed, i.e. each group is stored as soon as
+//   it has been read. Vertices, texture coordinates and normals are
+//   kept in temporary files, so memory use is bounded by the
+//   largest group rather than the size of the file.
+//   glTF 2.0 files are accepted in the same way, either as the body
+//   of a model/gltf-binary or model/gltf+json request, or as the
+//   'gltf'-part of a multipart/form-data request. Each mesh node
+//   is considered to be a separate object, and the world transform
+//   of the node is applied to the geometry. Buffers must be
+//   embedded in the GLB file or as data URIs.
+//   ASCII and binary STL files are accepted as the body of a
+//   model/stl (or model/x.stl-ascii, model/x.stl-binary,
+//   application/sla) request, or as the 'stl'-part of a
+//   multipart/form-data request. Each solid is considered to be a
+//   separate object.
+//   ASCII and binary little endian PLY files are accepted as the
+//   body of an application/ply (or model/x-ply) request, or as the
+//   'ply'-part of a multipart/form-data request. Vertex positions,
+//   normals, colours and faces are read. Point clouds (files without
+//   faces) are split spatially into objects of at most 100000 points.
+//   An application/json request, {"name": "..."}, creates an
+//   empty scene.
+//   Metadata is attached to the objects either by '#metadata {...}'
+//   lines following a 'g'-line in the OBJ file, by the extras of
+//   the glTF nodes, or by an optional
+//   'metadata'-part of a multipart/form-data request holding a JSON
+//   object keyed by group name. The 'metadata'-part takes precedence,
+//   and entries for groups not in the OBJ file are ignored.
+//   The materials referenced by the OBJ file are given by an optional
+//   'mtl'-part of a multipart/form-data request holding a Wavefront
+//   MTL file.
+// PUT 		/worlds/{id}/layers/{id}/scenes/{id}
 // - Replaces all geometry in a scene. Supports the same
-//   formats as the POST request.
+//   formats as the POST request, but the request must contain
+//   geometry. The name of the scene is not changed. The
+//   materials are only replaced if the request has an 'mtl'-part.
 // GET 		/worlds/{id}/layers/{id}/scenes
 // - Returns metadata for all scenes in the layer.
 // GET 		/worlds/{id}/layers/{id}/scenes/{id}
 // - Returns metadata for the given scene.
-// DELETE 	/worlds/{id}/layers/{id}/scenes/{id}	(Not implemented yet)
+// GET 		/worlds/{id}/layers/{id}/scenes/{id}/materials
+// - Returns the materials of the given scene as a list of
+//   {"name", "ambient", "diffuse", "specular", "emissive",
+//   "specularExponent", "opacity", "illuminationModel", "diffuseMap"}
+//   objects, where colours are [r, g, b]. Empty if the scene has no
+//   materials.
+// DELETE 	/worlds/{id}/layers/{id}/scenes/{id}
 // - Deletes the scene with the given ID and all the objects
 //   in the scene.
 //
 // Geometry query endpoints:
 // -------------------------
-// GET /world/{id}/geometry?{filter}&{options}	(Not implemented yet)
+// GET /worlds/{id}/geometry?{filter}&{options}
 // - Gets all geometry in the world that matches the filter.
-// GET /world/{id}/layers/{id}/geometry?{filter}&{options}	(Not implemented yet)
+// GET /worlds/{id}/layers/{id}/geometry?{filter}&{options}
 // - Gets all geometry in the layer that matches the filter.
 //
 // Filters is used to filter away unwanted data, e.g. based on location or distance
 // to camera.
 // Options are used to e.g. sort the results by distance to a camera, or
-// restrict the number of returned triangles
+// restrict the number of returned triangles.
+//
+// By default the result is a JSON list of objects with the geometry as
+// base64-encoded Wavefront OBJ. Clients that send 'Accept: model/gltf-binary'
+// instead receive a binary glTF 2.0 (GLB) file with one node per object.
+// The node extras holds the id, layerId, sceneId and metadata of the
+// object, and the node translation holds the center of the object.
+// Clients on slow networks can send
+// 'Accept: application/vnd.renderdb.compressed-mesh' to receive the geometry
+// as compressed meshes with one mesh per object (see
+// formats.CompressedMeshReader). Positions are quantized to 16 bits relative
+// to the bounds of each object and delta encoded, vertex indices are delta
+// encoded and the result is compressed using DEFLATE. The mesh extras holds
+// the same fields as the glTF node extras.
+// Clients that send 'Accept: application/x-ndjson' receive the objects
+// as newline delimited JSON, one object per line, written as the objects
+// are retrieved so the first objects can be processed before the query
+// completes. The status code is written before the objects are retrieved,
+// so if the query fails the stream ends with an error record,
+// '{"error": {...}}', rather than an error status code.
+// Geometry is stored in a compact binary mesh encoding and converted to OBJ
+// or glTF when returned. Positions are stored as 32-bit floats relative to
+// each object (16-bit quantized for simplified geometry), so very small
+// details of large objects may be rounded. Objects stored in older versions
+// of RenderDB are stored as OBJ and returned unchanged.
+//
+// Supported filters:
+// - bounds=minX,minY,minZ,maxX,maxY,maxZ (required)
+//   Only returns objects that intersects the bounding box.
+// - filter=expression
+//   Only returns objects with metadata matching the filter expression, e.g.
+//   metadata.system == "HVAC" && metadata.diameter > 50. Nested fields are
+//   accessed as metadata.floor.level. Supported operators are ==, !=, <, <=,
+//   >, >=, &&, || and !, and parentheses can be used for grouping. Literals
+//   are strings in double quotes, numbers, true, false and null. Remember
+//   to URL-encode the expression.
+// - cameraPosition=x,y,z&cameraDirection=x,y,z&cameraUp=x,y,z&
+//   fov=degrees&aspectRatio=width/height&near=distance&far=distance
+//   Only returns objects inside the view frustum of the camera (view
+//   frustum culling). The field of view is vertical. All camera parameters
+//   must be set when cameraPosition is set.
+// - minPixelSize=pixels,viewportHeight
+//   Removes objects that are smaller than pixels on screen when rendered
+//   by the camera to a viewport that is viewportHeight pixels high. The size
+//   is estimated from the bounding sphere of each object. Useful to reduce
+//   the amount of data sent to clients with small screens. Requires the
+//   camera parameters.
+// - occlusionCull=minOccluderSize,maxOccluders
+//   Removes objects hidden behind large objects near the camera (occlusion
+//   culling). Rays are cast from the camera towards each object, and the
+//   maxOccluders objects nearest to the camera with a bounding box diagonal
+//   of at least minOccluderSize are used as occluders. This is a heuristic,
+//   and some objects that are barely visible might be removed. Requires the
+//   camera parameters.
+// Supported options:
+// - sortByDistance=x,y,z
+//   Sorts the result by distance to the given point (nearest first).
+// - lodDistances=d1,d2,...
+//   Returns simplified geometry for objects further away from the camera
+//   than d1 (level 1), d2 (level 2) and so on. The distances must be in
+//   ascending order. Simplified versions of each object are created when
+//   geometry is uploaded; objects with fewer levels use the most simplified
+//   version available. Requires the camera parameters.
+// - maxTriangles=count
+//   Returns the objects in order until the total number of triangles would
+//   exceed the given count. Applied after sorting, so combined with
+//   sortByDistance the nearest objects are returned. Objects stored before
+//   triangle counts were recorded count as having no triangles. Triangles
+//   are counted at full resolution, also when lodDistances is used.
 package routes
 
 import (
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
 	"github.com/larsmoa/renderdb/httpext"
+	"github.com/larsmoa/renderdb/repository"
 )
 
 // RegisterWorldsRoutes registers handlers for the "/worlds"-route.
-func RegisterWorldsRoutes(router *mux.Router, db *sqlx.DB) {
-	renderer := httpext.NewJSONResponseRenderer()
+func RegisterWorldsRoutes(router *mux.Router, db *sqlx.DB, repos repository.Repositories) {
+	renderers := httpext.DefaultRenderers()
 	middleware := httpext.Chain(&worldsMiddleware{})
-	getWorlds := httpext.NewHttpHandler(db, renderer, middleware.Then(&getWorldsHandler{}))
-	getWorld := httpext.NewHttpHandler(db, renderer, middleware.Then(&getWorldHandler{}))
-	postWorld := httpext.NewHttpHandler(db, renderer, middleware.Then(&postWorldHandler{}))
+	getWorlds := httpext.NewHttpHandler(db, renderers, middleware.Then(&getWorldsHandler{}))
+	getWorld := httpext.NewHttpHandler(db, renderers, middleware.Then(&getWorldHandler{}))
+	postWorld := httpext.NewHttpHandler(db, renderers, middleware.Then(&postWorldHandler{}))
+	deleteWorld := httpext.NewHttpHandler(db, renderers, middleware.Then(&deleteWorldHandler{repos}))
 
 	router.Handle("/worlds", getWorlds).Methods("GET")
 	router.Handle("/worlds/{worldID:[0-9]+}", getWorld).Methods("GET")
 	router.Handle("/worlds", postWorld).Methods("POST")
+	router.Handle("/worlds/{worldID:[0-9]+}", deleteWorld).Methods("DELETE")
 }
 
 // RegisterLayersRoutes registers handlers for the "/worlds/{worldID}/layers"-route.
-func RegisterLayersRoutes(router *mux.Router, db *sqlx.DB) {
-	renderer := httpext.NewJSONResponseRenderer()
+func RegisterLayersRoutes(router *mux.Router, db *sqlx.DB, repos repository.Repositories) {
+	renderers := httpext.DefaultRenderers()
 	middleware := httpext.Chain(&layersMiddleware{})
-	getLayers := httpext.NewHttpHandler(db, renderer, middleware.Then(&getLayersHandler{}))
-	getLayer := httpext.NewHttpHandler(db, renderer, middleware.Then(&getLayerHandler{}))
-	postLayer := httpext.NewHttpHandler(db, renderer, middleware.Then(&postLayerHandler{}))
+	geometryMiddleware := httpext.Chain(&worldsMiddleware{}, &layersMiddleware{}, &repositoryMiddleware{repos})
+	getLayers := httpext.NewHttpHandler(db, renderers, middleware.Then(&getLayersHandler{}))
+	getLayer := httpext.NewHttpHandler(db, renderers, middleware.Then(&getLayerHandler{}))
+	postLayer := httpext.NewHttpHandler(db, renderers, middleware.Then(&postLayerHandler{}))
+	deleteLayer := httpext.NewHttpHandler(db, renderers, geometryMiddleware.Then(&deleteLayerHandler{}))
 
-	router = router.Path("/worlds/{worldID:[0-9]+}").Subrouter()
+	router = router.PathPrefix("/worlds/{worldID:[0-9]+}").Subrouter()
 	router.Handle("/layers", getLayers).Methods("GET")
 	router.Handle("/layers/{layerID:[0-9]+}", getLayer).Methods("GET")
 	router.Handle("/layers", postLayer).Methods("POST")
+	router.Handle("/layers/{layerID:[0-9]+}", deleteLayer).Methods("DELETE")
 }
 
 // RegisterScenesRoutes registers handlers for the "/worlds/{worldID}/layers/{layerID}/scenes"-route.
-func RegisterScenesRoutes(router *mux.Router, db *sqlx.DB) {
-	renderer := httpext.NewJSONResponseRenderer()
-	middleware := httpext.Chain(&layersMiddleware{})
-	getScenes := httpext.NewHttpHandler(db, renderer, middleware.Then(&getScenesHandler{}))
-	getScene := httpext.NewHttpHandler(db, renderer, middleware.Then(&getSceneHandler{}))
-	postScene := httpext.NewHttpHandler(db, renderer, middleware.Then(&postSceneHandler{}))
+func RegisterScenesRoutes(router *mux.Router, db *sqlx.DB, repos repository.Repositories) {
+	renderers := httpext.DefaultRenderers()
+	middleware := httpext.Chain(&scenesMiddleware{})
+	// Scenes without geometry can be created without loading the spatial
+	// index, so postSceneHandler loads it when needed
+	postMiddleware := httpext.Chain(&worldsMiddleware{}, &layersMiddleware{}, &scenesMiddleware{})
+	geometryMiddleware := httpext.Chain(&worldsMiddleware{}, &layersMiddleware{}, &scenesMiddleware{}, &repositoryMiddleware{repos})
+	getScenes := httpext.NewHttpHandler(db, renderers, middleware.Then(&getScenesHandler{}))
+	getScene := httpext.NewHttpHandler(db, renderers, middleware.Then(&getSceneHandler{}))
+	getSceneMaterials := httpext.NewHttpHandler(db, renderers, middleware.Then(&getSceneMaterialsHandler{}))
+	postScene := httpext.NewHttpHandler(db, renderers, postMiddleware.Then(&postSceneHandler{repos}))
+	putScene := httpext.NewHttpHandler(db, renderers, geometryMiddleware.Then(&putSceneHandler{}))
+	deleteScene := httpext.NewHttpHandler(db, renderers, geometryMiddleware.Then(&deleteSceneHandler{}))
 
-	router = router.Path("/worlds/{worldID:[0-9]+}/layers/{layerID:[0-9]+}").Subrouter()
+	router = router.PathPrefix("/worlds/{worldID:[0-9]+}/layers/{layerID:[0-9]+}").Subrouter()
 	router.Handle("/scenes", getScenes).Methods("GET")
 	router.Handle("/scenes/{sceneID:[0-9]+}", getScene).Methods("GET")
+	router.Handle("/scenes/{sceneID:[0-9]+}/materials", getSceneMaterials).Methods("GET")
 	router.Handle("/scenes", postScene).Methods("POST")
+	router.Handle("/scenes/{sceneID:[0-9]+}", putScene).Methods("PUT")
+	router.Handle("/scenes/{sceneID:[0-9]+}", deleteScene).Methods("DELETE")
 }
 
-/*
-// RegisterGeometryRoutes registers handelrs for the "/worlds/{worldID}/layers/{layerID}/scenes/{sceneID}/geometry"-route.
-func RegisterGeometryRoutes(router *mux.Router, db *sqlx.DB) {
-	renderer := httpext.NewJSONResponseRenderer()
+// RegisterGeometryRoutes registers handlers for the "/worlds/{worldID}/geometry"- and
+// "/worlds/{worldID}/layers/{layerID}/geometry"-routes.
+func RegisterGeometryRoutes(router *mux.Router, db *sqlx.DB, repos repository.Repositories) {
+	renderers := geometryRenderers()
+	worldMiddleware := httpext.Chain(&worldsMiddleware{}, &repositoryMiddleware{repos})
+	layerMiddleware := httpext.Chain(&worldsMiddleware{}, &layersMiddleware{}, &repositoryMiddleware{repos})
+	getWorldGeometry := httpext.NewHttpHandler(db, renderers, worldMiddleware.Then(&getWorldGeometryHandler{}))
+	getLayerGeometry := httpext.NewHttpHandler(db, renderers, layerMiddleware.Then(&getLayerGeometryHandler{}))
 
-	middleware := httpext.Chain(&objectsMiddleware{})
-	postSceneGeometry := httpext.NewHttpHandler(db, renderer, middleware.Then(&postSceneGeometryHandler{}))
-	router = router.Path("/worlds/{worldID:[0-9]+}/layers/{layerID:[0-9]+}/scenes/{sceneID:[0-9]+}").Subrouter()
-	router.Handle("/geometry", postSceneGeometry).Methods("POST")
+	router = router.PathPrefix("/worlds/{worldID:[0-9]+}").Subrouter()
+	router.Handle("/geometry", getWorldGeometry).Methods("GET")
+	router.Handle("/layers/{layerID:[0-9]+}/geometry", getLayerGeometry).Methods("GET")
 }
-*/
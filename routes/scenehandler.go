@@ -10,6 +10,8 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/larsmoa/renderdb/db"
 	"github.com/larsmoa/renderdb/httpext"
+	"github.com/larsmoa/renderdb/protobuf"
+	"github.com/larsmoa/renderdb/repository"
 )
 
 // --------------------------------------------------
@@ -105,11 +107,72 @@ func (h *getSceneHandler) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer,
 	return nil
 }
 
+// ------------------------------------------------------------------
+// GET /worlds/{worldID}/layers/{layerID}/scenes/{sceneID}/materials
+// ------------------------------------------------------------------
+
+type getSceneMaterialsHandler struct{}
+
+func (h *getSceneMaterialsHandler) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer,
+	w http.ResponseWriter, r *http.Request) error {
+
+	var err error
+	// Parse URL
+	vars := mux.Vars(r)
+	sceneID, err := httpext.ReadInt64ID(vars, "sceneID")
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Read from database
+	scenesDB := getScenesFromContext(r)
+	scene, err := scenesDB.Get(sceneID)
+	if err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not retrieve scene with id %d (reason: %s)", sceneID, err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+	if scene == nil {
+		err = httpext.NewHttpError(fmt.Errorf("No scene with id %d", sceneID), http.StatusNotFound)
+		renderer.WriteError(w, err)
+		return err
+	}
+	materials, err := scenesDB.GetMaterials(sceneID)
+	if err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not retrieve materials of scene with id %d (reason: %s)", sceneID, err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Respond
+	if materials == nil {
+		materials = []interface{}{}
+	}
+	renderer.WriteObject(w, http.StatusOK, materials)
+	return nil
+}
+
 // -------------------------------------------------
 // POST /worlds/{worldID}/layers/{layerID}/scenes
 // -------------------------------------------------
 
+// postSceneHandler loads the spatial index of the world only if the scene
+// has geometry, so creating empty scenes doesn't require the index.
 type postSceneHandler struct {
+	repos repository.Repositories
+}
+
+type scenePayload struct {
+	*db.Scene
+	ObjectIDs []int64 `json:"objectIds"`
+}
+
+// MarshalProto writes the scene and the IDs of its objects as the message
+// 'Scene' in renderdb.proto.
+func (p scenePayload) MarshalProto(e *protobuf.Encoder) {
+	p.Scene.MarshalProto(e)
+	e.WritePackedInt64(4, p.ObjectIDs)
 }
 
 func (h *postSceneHandler) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer,
@@ -118,6 +181,11 @@ func (h *postSceneHandler) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer
 	var err error
 	// Parse URL
 	vars := mux.Vars(r)
+	worldID, err := httpext.ReadInt64ID(vars, "worldID")
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
 	layerID, err := httpext.ReadInt64ID(vars, "layerID")
 	if err != nil {
 		renderer.WriteError(w, err)
@@ -125,12 +193,27 @@ func (h *postSceneHandler) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer
 	}
 
 	// Parse body
-	scene, err := parseSceneFromBody(r)
+	upload, err := parseSceneUpload(r)
 	if err != nil {
 		renderer.WriteError(w, err)
 		return err
 	}
+	defer upload.close()
+	scene := upload.scene
 	scene.LayerID = layerID
+	if scene.Name == "" {
+		err = httpext.NewHttpError(fmt.Errorf("Scene name must be set"), http.StatusBadRequest)
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Geometry is tagged with the world, so verify that the layer is part of it
+	if upload.hasGeometry() {
+		if err = verifyLayerExists(r, layerID); err != nil {
+			renderer.WriteError(w, err)
+			return err
+		}
+	}
 
 	// Add to database
 	scenesDB := getScenesFromContext(r)
@@ -141,8 +224,184 @@ func (h *postSceneHandler) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer
 	}
 	scene.ID = id
 
+	objectIDs := []int64{}
+	if upload.hasGeometry() {
+		repo, err := loadRepository(h.repos, tx, r, worldID)
+		if err != nil {
+			renderer.WriteError(w, err)
+			return err
+		}
+		objectIDs, err = replaceSceneObjects(repo, worldID, scene, upload)
+		if err != nil {
+			if _, ok := err.(httpext.HttpError); !ok {
+				err = httpext.NewHttpError(err, http.StatusInternalServerError)
+			}
+			renderer.WriteError(w, err)
+			return err
+		}
+	}
+	if upload.materials != nil {
+		if err = scenesDB.SetMaterials(scene.ID, upload.materials); err != nil {
+			err = httpext.NewHttpError(fmt.Errorf("Could not store materials (reason: %v)", err), http.StatusInternalServerError)
+			renderer.WriteError(w, err)
+			return err
+		}
+	}
+
 	// Return to client
-	renderer.WriteObject(w, http.StatusOK, scene)
+	renderer.WriteObject(w, http.StatusOK, scenePayload{scene, objectIDs})
+	return nil
+}
+
+// ----------------------------------------------------------
+// PUT /worlds/{worldID}/layers/{layerID}/scenes/{sceneID}
+// ----------------------------------------------------------
+
+type putSceneHandler struct {
+}
+
+func (h *putSceneHandler) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer,
+	w http.ResponseWriter, r *http.Request) error {
+
+	var err error
+	// Parse URL
+	vars := mux.Vars(r)
+	worldID, err := httpext.ReadInt64ID(vars, "worldID")
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+	layerID, err := httpext.ReadInt64ID(vars, "layerID")
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+	sceneID, err := httpext.ReadInt64ID(vars, "sceneID")
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Parse body
+	upload, err := parseSceneUpload(r)
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+	defer upload.close()
+	if !upload.hasGeometry() {
+		err = httpext.NewHttpError(fmt.Errorf("Request must contain geometry"), http.StatusBadRequest)
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Lookup layer and scene
+	if err = verifyLayerExists(r, layerID); err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+	scene, err := getScenesFromContext(r).Get(sceneID)
+	if err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not retrieve scene with id %d (reason: %s)", sceneID, err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+	if scene == nil {
+		err = httpext.NewHttpError(fmt.Errorf("No scene with id %d", sceneID), http.StatusNotFound)
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Replace geometry
+	objectIDs, err := replaceSceneObjects(getRepositoryFromContext(r), worldID, scene, upload)
+	if err != nil {
+		if _, ok := err.(httpext.HttpError); !ok {
+			err = httpext.NewHttpError(err, http.StatusInternalServerError)
+		}
+		renderer.WriteError(w, err)
+		return err
+	}
+	if upload.materials != nil {
+		if err = getScenesFromContext(r).SetMaterials(scene.ID, upload.materials); err != nil {
+			err = httpext.NewHttpError(fmt.Errorf("Could not store materials (reason: %v)", err), http.StatusInternalServerError)
+			renderer.WriteError(w, err)
+			return err
+		}
+	}
+
+	// Return to client
+	renderer.WriteObject(w, http.StatusOK, scenePayload{scene, objectIDs})
+	return nil
+}
+
+// ----------------------------------------------------------
+// DELETE /worlds/{worldID}/layers/{layerID}/scenes/{sceneID}
+// ----------------------------------------------------------
+
+type deleteSceneHandler struct{}
+
+func (h *deleteSceneHandler) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer,
+	w http.ResponseWriter, r *http.Request) error {
+
+	var err error
+	// Parse URL
+	vars := mux.Vars(r)
+	layerID, err := httpext.ReadInt64ID(vars, "layerID")
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+	sceneID, err := httpext.ReadInt64ID(vars, "sceneID")
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Lookup layer and scene
+	if err = verifyLayerExists(r, layerID); err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+	scenesDB := getScenesFromContext(r)
+	scene, err := scenesDB.Get(sceneID)
+	if err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not retrieve scene with id %d (reason: %s)", sceneID, err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+	if scene == nil {
+		err = httpext.NewHttpError(fmt.Errorf("No scene with id %d", sceneID), http.StatusNotFound)
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Delete geometry, then the scene
+	repo := getRepositoryFromContext(r)
+	if err = repo.Remove(db.ScenesSelector{SceneIDs: []int64{sceneID}}); err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not delete geometry in scene with id %d (reason: %s)", sceneID, err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+	if err = scenesDB.Delete(sceneID); err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not delete scene with id %d (reason: %s)", sceneID, err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	renderer.WriteEmpty(w, http.StatusNoContent)
+	return nil
+}
+
+// verifyLayerExists returns a HttpError if the layer doesn't exist
+// in the world of the request.
+func verifyLayerExists(r *http.Request, layerID int64) error {
+	layer, err := getLayersFromContext(r).Get(layerID)
+	if err != nil {
+		return httpext.NewHttpError(fmt.Errorf("Could not retrieve layer with id %d (reason: %s)", layerID, err), http.StatusInternalServerError)
+	}
+	if layer == nil {
+		return httpext.NewHttpError(fmt.Errorf("No layer with id %d", layerID), http.StatusNotFound)
+	}
 	return nil
 }
 
@@ -4,17 +4,22 @@ import (
 	"bytes"
 	"database/sql"
 	"errors"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
 	"github.com/larsmoa/renderdb/db"
+	"github.com/larsmoa/renderdb/formats"
 	"github.com/larsmoa/renderdb/httpext"
+	"github.com/larsmoa/renderdb/repository"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/ungerik/go3d/float64/vec3"
 )
 
 type sceneHandlerFixture struct {
@@ -22,7 +27,11 @@ type sceneHandlerFixture struct {
 	db     *sqlx.DB
 	tx     *sqlx.Tx
 
+	worlds *db.MockWorlds
 	scenes *db.MockScenes
+	layers *db.MockLayers
+	repos  *repository.MockRepositories
+	repo   *repository.MockRepository
 
 	writer   *httptest.ResponseRecorder
 	renderer *httpext.MockResponseRenderer
@@ -42,8 +51,17 @@ func (f *sceneHandlerFixture) Setup(t *testing.T, r *http.Request) {
 	f.writer = httptest.NewRecorder()
 	f.renderer = &httpext.MockResponseRenderer{}
 
+	f.worlds = &db.MockWorlds{}
 	f.scenes = &db.MockScenes{}
+	f.layers = &db.MockLayers{}
+	f.repos = &repository.MockRepositories{}
+	f.repo = &repository.MockRepository{}
+	f.worlds.On("Get", int64(42)).Return(&db.World{ID: 42}, nil)
+	f.repos.On("Get", int64(42), mock.Anything).Return(f.repo, nil)
+	context.Set(r, worldsDBKey, f.worlds)
 	context.Set(r, scenesDBKey, f.scenes)
+	context.Set(r, layersDBKey, f.layers)
+	context.Set(r, repositoryKey, f.repo)
 }
 
 func (f *sceneHandlerFixture) Teardown(t *testing.T) {
@@ -151,6 +169,49 @@ func TestGetSceneHandler_GetAllReturnsScenes_WritesResponse(t *testing.T) {
 	f.renderer.AssertExpectations(t)
 }
 
+func TestGetSceneMaterialsHandler_NoMaterials_WritesEmptyList(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/layers/42/scenes/88/materials", nil)
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.scenes.On("Get", int64(88)).Return(&db.Scene{ID: 88}, nil)
+	f.scenes.On("GetMaterials", int64(88)).Return(nil, nil)
+	f.renderer.On("WriteObject", f.writer, 200, []interface{}{})
+	handler := getSceneMaterialsHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/layers/{layerID}/scenes/{sceneID}/materials",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	f.scenes.AssertExpectations(t)
+	f.renderer.AssertExpectations(t)
+}
+
+func TestGetSceneMaterialsHandler_NoScene_WritesError(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("GET", "/worlds/13/layers/42/scenes/88/materials", nil)
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.scenes.On("Get", int64(88)).Return(nil, nil)
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := getSceneMaterialsHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "GET", "/worlds/{worldID}/layers/{layerID}/scenes/{sceneID}/materials",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
 func TestPostSceneHandler_InvalidBody_WritesError(t *testing.T) {
 	// Arrange
 	buffer := bytes.NewBuffer([]byte("{}"))
@@ -160,7 +221,7 @@ func TestPostSceneHandler_InvalidBody_WritesError(t *testing.T) {
 	defer f.Teardown(t)
 
 	f.renderer.On("WriteError", f.writer, mock.Anything)
-	handler := postSceneHandler{}
+	handler := postSceneHandler{f.repos}
 
 	// Act
 	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
@@ -181,14 +242,753 @@ func TestPostSceneHandler_ValidBody_AddsToDatabaseAndWritesObject(t *testing.T)
 
 	f.scenes.On("Add", mock.Anything).Return(int64(1), nil)
 	f.renderer.On("WriteObject", f.writer, 200, mock.Anything)
-	handler := postSceneHandler{}
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	f.scenes.AssertExpectations(t)
+	f.renderer.AssertExpectations(t)
+}
+
+func TestPostSceneHandler_ValidBody_DoesNotLoadRepository(t *testing.T) {
+	// Arrange
+	buffer := bytes.NewBuffer([]byte(`{"name":"MyScene"}`))
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes", buffer)
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.scenes.On("Add", mock.Anything).Return(int64(1), nil)
+	f.renderer.On("WriteObject", f.writer, 200, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	f.repos.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+}
+
+const twoGroupsObj = `v 0 0 0
+v 1 0 0
+v 0 1 0
+g first
+f 1 2 3
+g second
+f 3 2 1
+`
+
+// mockReplaceInBatches sets up ReplaceInBatches of repo to read all batches
+// into objects. The call returns ids, or the error returned by the batches.
+func mockReplaceInBatches(repo *repository.MockRepository, selectors interface{}, ids []int64,
+	objects *[]db.Object) *mock.Call {
+
+	var err error
+	return repo.On("ReplaceInBatches", selectors, mock.Anything).Return(
+		func(_ []db.ObjectSelector, nextBatch func() ([]db.Object, error)) []int64 {
+			for {
+				var batch []db.Object
+				if batch, err = nextBatch(); err != nil || len(batch) == 0 {
+					break
+				}
+				*objects = append(*objects, batch...)
+			}
+			if err != nil {
+				return nil
+			}
+			return ids
+		},
+		func([]db.ObjectSelector, func() ([]db.Object, error)) error {
+			return err
+		})
+}
+
+func TestPostSceneHandler_ObjBody_AddsOneObjectPerGroup(t *testing.T) {
+	// Arrange
+	buffer := bytes.NewBuffer([]byte(twoGroupsObj))
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes?name=MyScene", buffer)
+	r.Header.Set("Content-Type", "text/plain")
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Add", mock.Anything).Return(int64(7), nil)
+	objects := []db.Object{}
+	mockReplaceInBatches(f.repo, []db.ObjectSelector{db.ScenesSelector{SceneIDs: []int64{7}}}, []int64{1, 2}, &objects)
+	expectedScene := &db.Scene{ID: 7, LayerID: 13, Name: "MyScene"}
+	f.renderer.On("WriteObject", f.writer, 200, scenePayload{expectedScene, []int64{1, 2}})
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	f.repo.AssertExpectations(t)
+	f.renderer.AssertExpectations(t)
+	assert.Equal(t, 2, len(objects))
+	obj := objects[0]
+	assert.Equal(t, int64(42), obj.WorldID())
+	assert.Equal(t, int64(13), obj.LayerID())
+	assert.Equal(t, int64(7), obj.SceneID())
+}
+
+func TestPostSceneHandler_GLBBody_AddsOneObjectPerMeshNode(t *testing.T) {
+	// Arrange
+	objReader := formats.WavefrontObjReader{}
+	assert.NoError(t, objReader.Read(bytes.NewBufferString(twoGroupsObj)))
+	writer := formats.GLBWriter{}
+	writer.AddNode("first", &objReader, map[string]interface{}{"system": "HVAC"})
+	writer.AddNode("second", &objReader, nil)
+	buffer := &bytes.Buffer{}
+	assert.NoError(t, writer.Write(buffer))
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes?name=MyScene", buffer)
+	r.Header.Set("Content-Type", "model/gltf-binary")
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Add", mock.Anything).Return(int64(7), nil)
+	f.repo.On("Replace", mock.Anything, mock.Anything).Return([]int64{1, 2}, nil)
+	f.renderer.On("WriteObject", f.writer, 200, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	f.repo.AssertExpectations(t)
+	objects := f.repo.Calls[0].Arguments.Get(1).([]db.Object)
+	if assert.Equal(t, 2, len(objects)) {
+		assert.Equal(t, map[string]interface{}{"system": "HVAC"}, objects[0].Metadata())
+		assert.Equal(t, 2, objects[0].TriangleCount())
+		assert.Nil(t, objects[1].Metadata())
+	}
+}
+
+func TestPostSceneHandler_STLBody_AddsOneObjectPerSolid(t *testing.T) {
+	// Arrange
+	stl := "solid first\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 0 0\nvertex 0 1 0\nendloop\nendfacet\nendsolid\n" +
+		"solid second\nfacet normal 0 0 1\nouter loop\nvertex 0 0 1\nvertex 1 0 1\nvertex 0 1 1\nendloop\nendfacet\nendsolid\n"
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes?name=MyScene", bytes.NewBufferString(stl))
+	r.Header.Set("Content-Type", "model/stl")
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Add", mock.Anything).Return(int64(7), nil)
+	f.repo.On("Replace", mock.Anything, mock.Anything).Return([]int64{1, 2}, nil)
+	f.renderer.On("WriteObject", f.writer, 200, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	objects := f.repo.Calls[0].Arguments.Get(1).([]db.Object)
+	if assert.Equal(t, 2, len(objects)) {
+		bounds := objects[1].Bounds()
+		assert.Equal(t, 1.0, bounds.Min[2])
+		assert.Equal(t, 1, objects[1].TriangleCount())
+	}
+}
+
+func TestPostSceneHandler_PLYPointCloud_AddsPointObject(t *testing.T) {
+	// Arrange
+	ply := "ply\nformat ascii 1.0\nelement vertex 2\n" +
+		"property float x\nproperty float y\nproperty float z\nend_header\n0 0 0\n1 2 3\n"
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes?name=Scan", bytes.NewBufferString(ply))
+	r.Header.Set("Content-Type", "application/ply")
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Add", mock.Anything).Return(int64(7), nil)
+	f.repo.On("Replace", mock.Anything, mock.Anything).Return([]int64{1}, nil)
+	f.renderer.On("WriteObject", f.writer, 200, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	objects := f.repo.Calls[0].Arguments.Get(1).([]db.Object)
+	if assert.Equal(t, 1, len(objects)) {
+		assert.Equal(t, 0, objects[0].TriangleCount())
+		obj, err := objGeometryData(objects[0])
+		assert.NoError(t, err)
+		assert.Contains(t, string(obj), "p 2\n")
+	}
+}
+
+func TestPostSceneHandler_InvalidSTLBody_WritesError(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes?name=MyScene", bytes.NewBufferString("not stl"))
+	r.Header.Set("Content-Type", "application/sla")
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestPostSceneHandler_MultipartBodyWithObjAndGLTF_WritesError(t *testing.T) {
+	// Arrange
+	buffer := &bytes.Buffer{}
+	form := multipart.NewWriter(buffer)
+	form.WriteField("name", "MyScene")
+	part, _ := form.CreateFormFile("obj", "scene.obj")
+	part.Write([]byte(twoGroupsObj))
+	part, _ = form.CreateFormFile("gltf", "scene.gltf")
+	part.Write([]byte(`{"asset": {"version": "2.0"}}`))
+	form.Close()
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes", buffer)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestPostSceneHandler_MultipartBody_AddsObjects(t *testing.T) {
+	// Arrange
+	buffer := &bytes.Buffer{}
+	form := multipart.NewWriter(buffer)
+	form.WriteField("name", "MyScene")
+	part, _ := form.CreateFormFile("obj", "scene.obj")
+	part.Write([]byte(twoGroupsObj))
+	form.Close()
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes", buffer)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Add", mock.Anything).Return(int64(7), nil)
+	objects := []db.Object{}
+	mockReplaceInBatches(f.repo, []db.ObjectSelector{db.ScenesSelector{SceneIDs: []int64{7}}}, []int64{1, 2}, &objects)
+	f.renderer.On("WriteObject", f.writer, 200, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	f.repo.AssertExpectations(t)
+	assert.Equal(t, 2, len(objects))
+	f.renderer.AssertExpectations(t)
+}
+
+func TestPostSceneHandler_MultipartBodyWithMetadata_AddsObjectsWithMetadata(t *testing.T) {
+	// Arrange
+	buffer := &bytes.Buffer{}
+	form := multipart.NewWriter(buffer)
+	form.WriteField("name", "MyScene")
+	part, _ := form.CreateFormFile("obj", "scene.obj")
+	part.Write([]byte(twoGroupsObj))
+	part, _ = form.CreateFormFile("metadata", "metadata.json")
+	part.Write([]byte(`{"second": {"system": "HVAC"}, "unknown": {"system": "Electrical"}}`))
+	form.Close()
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes", buffer)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Add", mock.Anything).Return(int64(7), nil)
+	objects := []db.Object{}
+	mockReplaceInBatches(f.repo, mock.Anything, []int64{1, 2}, &objects)
+	f.renderer.On("WriteObject", f.writer, 200, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	f.repo.AssertExpectations(t)
+	if assert.Equal(t, 2, len(objects)) {
+		assert.Nil(t, objects[0].Metadata())
+		assert.Equal(t, map[string]interface{}{"system": "HVAC"}, objects[1].Metadata())
+	}
+}
+
+func TestPostSceneHandler_MultipartBodyWithMtl_StoresMaterials(t *testing.T) {
+	// Arrange
+	buffer := &bytes.Buffer{}
+	form := multipart.NewWriter(buffer)
+	form.WriteField("name", "MyScene")
+	part, _ := form.CreateFormFile("obj", "scene.obj")
+	part.Write([]byte("mtllib scene.mtl\nusemtl red\n" + twoGroupsObj))
+	part, _ = form.CreateFormFile("mtl", "scene.mtl")
+	part.Write([]byte("newmtl red\nKd 1 0 0\n"))
+	form.Close()
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes", buffer)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Add", mock.Anything).Return(int64(7), nil)
+	f.scenes.On("SetMaterials", int64(7), []formats.Material{
+		formats.Material{Name: "red", Diffuse: [3]float64{1, 0, 0}, Opacity: 1},
+	}).Return(nil)
+	mockReplaceInBatches(f.repo, mock.Anything, []int64{1, 2}, &[]db.Object{})
+	f.renderer.On("WriteObject", f.writer, 200, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	f.scenes.AssertExpectations(t)
+	f.repo.AssertExpectations(t)
+	f.renderer.AssertExpectations(t)
+}
+
+func TestPostSceneHandler_MultipartBodyWithInvalidMtl_WritesError(t *testing.T) {
+	// Arrange
+	buffer := &bytes.Buffer{}
+	form := multipart.NewWriter(buffer)
+	form.WriteField("name", "MyScene")
+	part, _ := form.CreateFormFile("obj", "scene.obj")
+	part.Write([]byte(twoGroupsObj))
+	part, _ = form.CreateFormFile("mtl", "scene.mtl")
+	part.Write([]byte("Kd 1 0 0\n"))
+	form.Close()
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes", buffer)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestPostSceneHandler_MultipartBodyWithInvalidMetadata_WritesError(t *testing.T) {
+	// Arrange
+	buffer := &bytes.Buffer{}
+	form := multipart.NewWriter(buffer)
+	form.WriteField("name", "MyScene")
+	part, _ := form.CreateFormFile("obj", "scene.obj")
+	part.Write([]byte(twoGroupsObj))
+	part, _ = form.CreateFormFile("metadata", "metadata.json")
+	part.Write([]byte(`{"second": `))
+	form.Close()
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes", buffer)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestPostSceneHandler_ObjBodyWithMetadataDirective_AddsObjectsWithMetadata(t *testing.T) {
+	// Arrange
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\ng first\n#metadata {\"system\": \"HVAC\"}\nf 1 2 3\n"
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes?name=MyScene", bytes.NewBufferString(obj))
+	r.Header.Set("Content-Type", "text/plain")
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Add", mock.Anything).Return(int64(7), nil)
+	objects := []db.Object{}
+	mockReplaceInBatches(f.repo, mock.Anything, []int64{1}, &objects)
+	f.renderer.On("WriteObject", f.writer, 200, mock.Anything)
+	handler := postSceneHandler{f.repos}
 
 	// Act
 	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
 		f.writer, r, f.tx, f.renderer)
 
+	// Assert
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(objects)) {
+		assert.Equal(t, map[string]interface{}{"system": "HVAC"}, objects[0].Metadata())
+	}
+}
+
+func TestPostSceneHandler_MultipartBodyWithoutObj_WritesError(t *testing.T) {
+	// Arrange
+	buffer := &bytes.Buffer{}
+	form := multipart.NewWriter(buffer)
+	form.WriteField("name", "MyScene")
+	form.Close()
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes", buffer)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestPostSceneHandler_InvalidObjBody_WritesError(t *testing.T) {
+	// Arrange
+	buffer := bytes.NewBuffer([]byte("v 0 0 zero"))
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes?name=MyScene", buffer)
+	r.Header.Set("Content-Type", "text/plain")
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	// The body is read while the objects are added
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Add", mock.Anything).Return(int64(7), nil)
+	mockReplaceInBatches(f.repo, mock.Anything, nil, &[]db.Object{})
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestPostSceneHandler_RepositoryReturnsError_WritesError(t *testing.T) {
+	// Arrange
+	buffer := bytes.NewBuffer([]byte(twoGroupsObj))
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes?name=MyScene", buffer)
+	r.Header.Set("Content-Type", "text/plain")
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Add", mock.Anything).Return(int64(7), nil)
+	f.repo.On("ReplaceInBatches", mock.Anything, mock.Anything).Return(nil, errors.New(""))
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	f.repo.AssertExpectations(t)
+	f.renderer.AssertExpectations(t)
+}
+
+func TestPostSceneHandler_ObjBodyWithoutName_WritesError(t *testing.T) {
+	// Arrange
+	buffer := bytes.NewBuffer([]byte(twoGroupsObj))
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes", buffer)
+	r.Header.Set("Content-Type", "text/plain")
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := postSceneHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "POST", "/worlds/{worldID}/layers/{layerID}/scenes",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestPutSceneHandler_ObjBody_ReplacesSceneGeometry(t *testing.T) {
+	// Arrange
+	buffer := bytes.NewBuffer([]byte(twoGroupsObj))
+	r, _ := http.NewRequest("PUT", "/worlds/42/layers/13/scenes/7", buffer)
+	r.Header.Set("Content-Type", "text/plain")
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	scene := &db.Scene{ID: 7, LayerID: 13, Name: "MyScene"}
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Get", int64(7)).Return(scene, nil)
+	objects := []db.Object{}
+	mockReplaceInBatches(f.repo, []db.ObjectSelector{db.ScenesSelector{SceneIDs: []int64{7}}}, []int64{3, 4}, &objects)
+	f.renderer.On("WriteObject", f.writer, 200, scenePayload{scene, []int64{3, 4}})
+	handler := putSceneHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "PUT", "/worlds/{worldID}/layers/{layerID}/scenes/{sceneID}",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.NoError(t, err)
+	f.repo.AssertExpectations(t)
+	f.renderer.AssertExpectations(t)
+	assert.Equal(t, 2, len(objects))
+}
+
+// createRepositoryWithObject creates a repository of world 42 where the
+// spatial index holds object 1 in scene 7 of layer 13.
+func createRepositoryWithObject(t *testing.T, objects *db.MockObjects) repository.Repository {
+	existing := &db.MockObject{}
+	existing.On("ID").Return(int64(1))
+	existing.On("Bounds").Return(&vec3.Box{Min: vec3.T{0, 0, 0}, Max: vec3.T{1, 1, 1}})
+	existing.On("LayerID").Return(int64(13))
+	existing.On("SceneID").Return(int64(7))
+	existing.On("TriangleCount").Return(1)
+	objects.On("GetAll", mock.Anything).Return(createObjectsResult(existing))
+	repo, err := repository.NewRepositories().Get(42, objects)
+	assert.NoError(t, err)
+	return repo
+}
+
+// serveRolledBackWithRepository serves the request as the registered
+// routes do: handler runs in a transaction after repositoryMiddleware has
+// injected repo. The transaction is expected to be rolled back.
+func serveRolledBackWithRepository(f *sceneHandlerFixture, r *http.Request, repo repository.Repository,
+	path string, handler httpext.Handler) {
+
+	repos := &repository.MockRepositories{}
+	repos.On("Get", int64(42), mock.Anything).Return(repo, nil)
+	worlds := &db.MockWorlds{}
+	worlds.On("Get", int64(42)).Return(&db.World{ID: 42}, nil)
+	context.Set(r, worldsDBKey, worlds)
+	f.mockDB.ExpectBegin()
+	f.mockDB.ExpectRollback()
+	f.mockDB.ExpectClose()
+
+	router := mux.NewRouter()
+	router.Handle(path, httpext.NewHttpHandler(f.db, httpext.DefaultRenderers(),
+		httpext.Chain(&repositoryMiddleware{repos}).Then(handler)))
+	router.ServeHTTP(f.writer, r)
+}
+
+func TestPutSceneHandler_SetMaterialsFailsAfterReplace_DoesNotUpdateSpatialIndex(t *testing.T) {
+	// Arrange
+	buffer := &bytes.Buffer{}
+	form := multipart.NewWriter(buffer)
+	part, _ := form.CreateFormFile("obj", "scene.obj")
+	part.Write([]byte(twoGroupsObj))
+	part, _ = form.CreateFormFile("mtl", "scene.mtl")
+	part.Write([]byte("newmtl red\nKd 1 0 0\n"))
+	form.Close()
+	r, _ := http.NewRequest("PUT", "/worlds/42/layers/13/scenes/7", buffer)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	objects := &db.MockObjects{}
+	repo := createRepositoryWithObject(t, objects)
+	objects.On("GetIDs", db.ScenesSelector{SceneIDs: []int64{7}}).Return([]int64{1}, nil)
+	objects.On("Delete", db.ScenesSelector{SceneIDs: []int64{7}}).Return(nil)
+	objects.On("AddMany", mock.Anything).Return([]int64{2, 3}, nil)
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Get", int64(7)).Return(&db.Scene{ID: 7, LayerID: 13, Name: "MyScene"}, nil)
+	f.scenes.On("SetMaterials", int64(7), mock.Anything).Return(errors.New(""))
+
+	// Act
+	serveRolledBackWithRepository(&f, r, repo, "/worlds/{worldID}/layers/{layerID}/scenes/{sceneID}", &putSceneHandler{})
+
+	// Assert
+	assert.Equal(t, http.StatusInternalServerError, f.writer.Code)
+	objects.AssertExpectations(t)
+	found, err := repo.GetInsideVolumeIDs(vec3.Box{Min: vec3.T{0, 0, 0}, Max: vec3.T{1, 1, 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1}, found)
+}
+
+func TestPutSceneHandler_NoScene_WritesError(t *testing.T) {
+	// Arrange
+	buffer := bytes.NewBuffer([]byte(twoGroupsObj))
+	r, _ := http.NewRequest("PUT", "/worlds/42/layers/13/scenes/7", buffer)
+	r.Header.Set("Content-Type", "text/plain")
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Get", int64(7)).Return(nil, nil)
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := putSceneHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "PUT", "/worlds/{worldID}/layers/{layerID}/scenes/{sceneID}",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestPutSceneHandler_JSONBody_WritesError(t *testing.T) {
+	// Arrange
+	buffer := bytes.NewBuffer([]byte(`{"name":"MyScene"}`))
+	r, _ := http.NewRequest("PUT", "/worlds/42/layers/13/scenes/7", buffer)
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := putSceneHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "PUT", "/worlds/{worldID}/layers/{layerID}/scenes/{sceneID}",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestDeleteSceneHandler_ExistingScene_RemovesGeometryAndScene(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("DELETE", "/worlds/42/layers/13/scenes/7", nil)
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Get", int64(7)).Return(&db.Scene{ID: 7, LayerID: 13}, nil)
+	f.scenes.On("Delete", int64(7)).Return(nil)
+	f.repo.On("Remove", db.ScenesSelector{SceneIDs: []int64{7}}).Return(nil)
+	f.renderer.On("WriteEmpty", f.writer, http.StatusNoContent)
+	handler := deleteSceneHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "DELETE", "/worlds/{worldID}/layers/{layerID}/scenes/{sceneID}",
+		f.writer, r, f.tx, f.renderer)
+
 	// Assert
 	assert.NoError(t, err)
 	f.scenes.AssertExpectations(t)
+	f.repo.AssertExpectations(t)
+	f.renderer.AssertExpectations(t)
+}
+
+func TestDeleteSceneHandler_RemoveReturnsError_WritesError(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("DELETE", "/worlds/42/layers/13/scenes/7", nil)
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Get", int64(7)).Return(&db.Scene{ID: 7, LayerID: 13}, nil)
+	f.repo.On("Remove", mock.Anything).Return(errors.New(""))
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := deleteSceneHandler{}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "DELETE", "/worlds/{worldID}/layers/{layerID}/scenes/{sceneID}",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	f.scenes.AssertNotCalled(t, "Delete", mock.Anything)
 	f.renderer.AssertExpectations(t)
 }
+
+func TestDeleteSceneHandler_DeleteFailsAfterRemove_DoesNotUpdateSpatialIndex(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("DELETE", "/worlds/42/layers/13/scenes/7", nil)
+	f := sceneHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	objects := &db.MockObjects{}
+	repo := createRepositoryWithObject(t, objects)
+	objects.On("GetIDs", db.ScenesSelector{SceneIDs: []int64{7}}).Return([]int64{1}, nil)
+	objects.On("Delete", db.ScenesSelector{SceneIDs: []int64{7}}).Return(nil)
+	f.layers.On("Get", int64(13)).Return(&db.Layer{ID: 13, WorldID: 42}, nil)
+	f.scenes.On("Get", int64(7)).Return(&db.Scene{ID: 7, LayerID: 13}, nil)
+	f.scenes.On("Delete", int64(7)).Return(errors.New(""))
+
+	// Act
+	serveRolledBackWithRepository(&f, r, repo, "/worlds/{worldID}/layers/{layerID}/scenes/{sceneID}", &deleteSceneHandler{})
+
+	// Assert
+	assert.Equal(t, http.StatusInternalServerError, f.writer.Code)
+	objects.AssertExpectations(t)
+	found, err := repo.GetInsideVolumeIDs(vec3.Box{Min: vec3.T{0, 0, 0}, Max: vec3.T{1, 1, 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1}, found)
+}
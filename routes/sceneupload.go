@@ -0,0 +1,383 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/larsmoa/renderdb/db"
+	"github.com/larsmoa/renderdb/formats"
+	"github.com/larsmoa/renderdb/httpext"
+	"github.com/larsmoa/renderdb/repository"
+)
+
+// lodCellSizes holds the grid cell sizes used when creating simplified
+// versions of uploaded geometry, relative to the length of the bounding
+// box diagonal of each object. See formats.GeometryGroup.Simplify.
+var lodCellSizes = []float64{1.0 / 64, 1.0 / 16, 1.0 / 4}
+
+// objectBatchSize is the number of objects written to the database at a
+// time when an uploaded OBJ file is streamed, see sceneUpload.stream.
+var objectBatchSize = 50
+
+// geometryEncoding and lodGeometryEncoding are the options used when
+// storing uploaded geometry and simplified versions of it in the binary
+// mesh encoding (formats.GeometryFormatBinaryMesh). Simplified geometry
+// is coarse already, so it's quantized.
+var (
+	geometryEncoding    = formats.BinaryMeshOptions{}
+	lodGeometryEncoding = formats.BinaryMeshOptions{PositionBits: 16}
+)
+
+// geometryFormFields maps from multipart form field to the format of the
+// geometry in the field.
+var geometryFormFields = map[string]string{
+	"obj":  formats.GeometryFormatOBJ,
+	"gltf": formats.GeometryFormatGLTF,
+	"stl":  formats.GeometryFormatSTL,
+	"ply":  formats.GeometryFormatPLY,
+}
+
+// sceneUpload holds the content of a request for creating a scene.
+type sceneUpload struct {
+	scene *db.Scene
+	// groups holds the geometry of the scene, or nil if the request
+	// did not contain any geometry or the geometry is streamed.
+	groups []formats.GeometryGroup
+	// stream reads the geometry of the scene one group at a time when
+	// the request contained an OBJ file, otherwise nil.
+	stream *formats.WavefrontObjStreamReader
+	// spool holds an OBJ file read from a multipart body until it is
+	// streamed, or nil. It's removed by close.
+	spool *os.File
+	// metadata holds metadata for the groups keyed by group name, or
+	// nil if the request did not contain a metadata document.
+	metadata map[string]interface{}
+	// materials holds the materials of the scene, or nil if the request
+	// did not contain a material library.
+	materials []formats.Material
+}
+
+// parseSceneUpload parses the body of a request for creating a scene based
+// on the Content-Type of the request. Supported content types:
+// - application/json (default)
+//   {"name": "..."}. Creates a scene without geometry.
+// - text/plain
+//   A Wavefront OBJ file. The name of the scene is given by the 'name'
+//   query parameter. The file is streamed rather than read into memory
+//   up front.
+// - model/gltf-binary, model/gltf+json
+//   A glTF 2.0 file. The name of the scene is given by the 'name' query
+//   parameter.
+// - model/stl, model/x.stl-ascii, model/x.stl-binary, application/sla
+//   An ASCII or binary STL file. The name of the scene is given by the
+//   'name' query parameter.
+// - application/ply, model/x-ply
+//   An ASCII or binary little endian PLY file. The name of the scene is
+//   given by the 'name' query parameter.
+// - multipart/form-data
+//   A form with a 'name'-field and either an 'obj'-file holding a Wavefront
+//   OBJ file, a 'gltf'-file holding a glTF 2.0 file, an 'stl'-file holding
+//   an STL file or a 'ply'-file holding a PLY file. Optionally the form has
+//   a 'metadata'-file holding a JSON object with metadata for each group
+//   keyed by group name and an 'mtl'-file holding a Wavefront MTL material
+//   library. An 'obj'-file is copied to a temporary file, so that it can
+//   be streamed after the remaining fields have been read.
+// Each group in the OBJ file, each mesh node in the glTF file and each solid
+// in the STL file is considered to be a separate object. PLY files are a
+// single object, except point clouds which are split spatially into several
+// objects. Metadata can also be given by directives in the OBJ file (see
+// formats.WavefrontObjReader) or by the extras of glTF nodes.
+// Note that the scene name is only required for application/json requests.
+func parseSceneUpload(r *http.Request) (*sceneUpload, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, httpext.NewHttpError(fmt.Errorf("Invalid Content-Type '%s' (reason: %v)", contentType, err), http.StatusBadRequest)
+	}
+
+	switch mediaType {
+	case "application/json":
+		scene, err := parseSceneFromBody(r)
+		if err != nil {
+			return nil, err
+		}
+		return &sceneUpload{scene: scene}, nil
+	case "text/plain":
+		return parseSceneUploadFromObjStream(r), nil
+	case "model/gltf-binary", "model/gltf+json":
+		return parseSceneUploadFromGeometry(r, formats.GeometryFormatGLTF)
+	case "model/stl", "model/x.stl-ascii", "model/x.stl-binary", "application/sla":
+		return parseSceneUploadFromGeometry(r, formats.GeometryFormatSTL)
+	case "application/ply", "model/x-ply":
+		return parseSceneUploadFromGeometry(r, formats.GeometryFormatPLY)
+	case "multipart/form-data":
+		return parseSceneUploadFromMultipart(r)
+	}
+	return nil, httpext.NewHttpError(fmt.Errorf("Unsupported Content-Type '%s'", mediaType), http.StatusUnsupportedMediaType)
+}
+
+// parseSceneUploadFromGeometry parses a request where the body is a geometry
+// file in the given format, see formats.NewGeometryReader.
+func parseSceneUploadFromGeometry(r *http.Request, format string) (*sceneUpload, error) {
+	defer r.Body.Close()
+	groups, err := readGroups(format, r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &sceneUpload{scene: &db.Scene{Name: r.URL.Query().Get("name")}, groups: groups}, nil
+}
+
+// parseSceneUploadFromObjStream parses a request where the body is an OBJ
+// file that is read when the objects of the scene are created.
+func parseSceneUploadFromObjStream(r *http.Request) *sceneUpload {
+	return &sceneUpload{scene: &db.Scene{Name: r.URL.Query().Get("name")}, stream: newObjStream(r.Body)}
+}
+
+// newObjStream creates a reader that streams the OBJ file in r.
+func newObjStream(r io.Reader) *formats.WavefrontObjStreamReader {
+	stream := formats.NewWavefrontObjStreamReader(r)
+	stream.SetOptions(formats.ReadOptions{DiscardDegeneratedFaces: true})
+	return stream
+}
+
+func parseSceneUploadFromMultipart(r *http.Request) (*sceneUpload, error) {
+	defer r.Body.Close()
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, httpext.NewHttpError(fmt.Errorf("Could not read multipart body (reason: %v)", err), http.StatusBadRequest)
+	}
+
+	upload := &sceneUpload{scene: &db.Scene{}}
+	if err = upload.readParts(reader); err != nil {
+		upload.close()
+		return nil, err
+	}
+	return upload, nil
+}
+
+// readParts reads the fields of a multipart body into the upload.
+func (u *sceneUpload) readParts(reader *multipart.Reader) error {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return httpext.NewHttpError(fmt.Errorf("Could not read multipart body (reason: %v)", err), http.StatusBadRequest)
+		}
+
+		if format, ok := geometryFormFields[part.FormName()]; ok {
+			if u.hasGeometry() {
+				return httpext.NewHttpError(fmt.Errorf("Only one of the form fields 'obj', 'gltf', 'stl' and 'ply' can be set"), http.StatusBadRequest)
+			}
+			if format == formats.GeometryFormatOBJ {
+				err = u.spoolObjStream(part)
+			} else {
+				u.groups, err = readGroups(format, part)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch part.FormName() {
+		case "name":
+			buf, err := ioutil.ReadAll(part)
+			if err != nil {
+				return httpext.NewHttpError(fmt.Errorf("Could not read field 'name' (reason: %v)", err), http.StatusBadRequest)
+			}
+			u.scene.Name = strings.TrimSpace(string(buf))
+		case "mtl":
+			if u.materials, err = readMtlMaterials(part); err != nil {
+				return err
+			}
+		case "metadata":
+			if err = json.NewDecoder(part).Decode(&u.metadata); err != nil {
+				return httpext.NewHttpError(fmt.Errorf("Could not read field 'metadata' (reason: %v)", err), http.StatusBadRequest)
+			}
+		default:
+			return httpext.NewHttpError(fmt.Errorf("Unknown form field '%s'", part.FormName()), http.StatusBadRequest)
+		}
+	}
+
+	// Validate
+	if !u.hasGeometry() {
+		return httpext.NewHttpError(fmt.Errorf("One of the form fields 'obj', 'gltf', 'stl' and 'ply' must be set"), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// spoolObjStream copies the OBJ file in r to a temporary file that is
+// streamed when the objects of the scene are created.
+func (u *sceneUpload) spoolObjStream(r io.Reader) error {
+	var err error
+	if u.spool, err = ioutil.TempFile("", "renderdb-upload-"); err != nil {
+		return fmt.Errorf("Could not create temporary file (reason: %v)", err)
+	}
+	if _, err = io.Copy(u.spool, r); err != nil {
+		return httpext.NewHttpError(fmt.Errorf("Could not read field 'obj' (reason: %v)", err), http.StatusBadRequest)
+	}
+	if _, err = u.spool.Seek(0, os.SEEK_SET); err != nil {
+		return err
+	}
+	u.stream = newObjStream(u.spool)
+	return nil
+}
+
+// close removes the temporary files held by the upload.
+func (u *sceneUpload) close() {
+	if u.stream != nil {
+		u.stream.Close()
+	}
+	if u.spool != nil {
+		u.spool.Close()
+		os.Remove(u.spool.Name())
+	}
+}
+
+// hasGeometry returns true if the request contained geometry.
+func (u *sceneUpload) hasGeometry() bool {
+	return u.groups != nil || u.stream != nil
+}
+
+// readGroups reads a geometry file in the given format and returns the
+// groups in the file. Degenerated faces are discarded from OBJ files.
+func readGroups(format string, r io.Reader) ([]formats.GeometryGroup, error) {
+	reader, err := formats.NewGeometryReader(format)
+	if err != nil {
+		return nil, err
+	}
+	if objReader, ok := reader.(*formats.WavefrontObjReader); ok {
+		objReader.SetOptions(formats.ReadOptions{DiscardDegeneratedFaces: true})
+	}
+	if err := reader.Read(r); err != nil {
+		return nil, httpext.NewHttpError(fmt.Errorf("Could not read %s file (reason: %v)", strings.ToUpper(format), err), http.StatusBadRequest)
+	}
+
+	groups := []formats.GeometryGroup{}
+	for g := range reader.Groups() {
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// readMtlMaterials reads a Wavefront MTL file and returns the materials
+// in the file.
+func readMtlMaterials(r io.Reader) ([]formats.Material, error) {
+	reader := formats.WavefrontMtlReader{}
+	if err := reader.Read(r); err != nil {
+		return nil, httpext.NewHttpError(fmt.Errorf("Could not read MTL file (reason: %v)", err), http.StatusBadRequest)
+	}
+	materials := reader.Materials()
+	if materials == nil {
+		materials = []formats.Material{}
+	}
+	return materials, nil
+}
+
+// replaceSceneObjects replaces all objects in the scene with one object
+// per group of the upload. The metadata of each object is taken from the
+// metadata of the upload (keyed by group name) if present, otherwise from the
+// group itself. Streamed groups are written to the database in batches of
+// objectBatchSize objects as they are read. Returns the IDs of the new objects.
+func replaceSceneObjects(repo repository.Repository, worldID int64, scene *db.Scene,
+	upload *sceneUpload) ([]int64, error) {
+
+	selectors := []db.ObjectSelector{db.ScenesSelector{SceneIDs: []int64{scene.ID}}}
+	if upload.stream != nil {
+		nextBatch := func() ([]db.Object, error) {
+			var objects []db.Object
+			for len(objects) < objectBatchSize {
+				g, err := upload.stream.NextGroup()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					return nil, httpext.NewHttpError(fmt.Errorf("Could not read OBJ file (reason: %v)", err), http.StatusBadRequest)
+				}
+				o, err := newSceneObject(worldID, scene, g, upload.metadata)
+				if err != nil {
+					return nil, err
+				}
+				objects = append(objects, o)
+			}
+			return objects, nil
+		}
+		return repo.ReplaceInBatches(selectors, nextBatch)
+	}
+
+	objects := make([]db.Object, len(upload.groups))
+	for i, g := range upload.groups {
+		var err error
+		if objects[i], err = newSceneObject(worldID, scene, g, upload.metadata); err != nil {
+			return nil, err
+		}
+	}
+	return repo.Replace(selectors, objects)
+}
+
+// newSceneObject creates an object in the scene holding the geometry of the
+// group and simplified versions of it.
+func newSceneObject(worldID int64, scene *db.Scene, g formats.GeometryGroup,
+	metadata map[string]interface{}) (db.Object, error) {
+
+	buf := bytes.Buffer{}
+	if err := g.WriteBinaryMesh(&buf, geometryEncoding); err != nil {
+		return nil, fmt.Errorf("Could not write geometry of group '%s' (reason: %v)", g.Name(), err)
+	}
+	lods, err := createLODs(g)
+	if err != nil {
+		return nil, err
+	}
+	var objectMetadata interface{}
+	if m, ok := metadata[g.Name()]; ok {
+		objectMetadata = m
+	} else if m := g.Metadata(); m != nil {
+		objectMetadata = m
+	}
+	return db.NewSceneObject(worldID, scene.LayerID, scene.ID, g.BoundingBox(), buf.Bytes(),
+		formats.GeometryFormatBinaryMesh, g.TriangleCount(), lods, objectMetadata), nil
+}
+
+// createLODs creates simplified versions of the group using the cell sizes
+// in lodCellSizes. Levels that do not reduce the number of triangles are
+// skipped.
+func createLODs(g formats.GeometryGroup) ([]db.LOD, error) {
+	bounds := g.BoundingBox()
+	diagonal := bounds.Diagonal()
+	size := diagonal.Length()
+	if size == 0 {
+		return nil, nil
+	}
+
+	var lods []db.LOD
+	triangleCount := g.TriangleCount()
+	for _, cellSize := range lodCellSizes {
+		simplified := g.Simplify(cellSize * size)
+		if simplified.TriangleCount() >= triangleCount {
+			continue
+		}
+		triangleCount = simplified.TriangleCount()
+
+		buf := bytes.Buffer{}
+		if err := simplified.WriteBinaryMesh(&buf, lodGeometryEncoding); err != nil {
+			return nil, fmt.Errorf("Could not write simplified geometry of group '%s' (reason: %v)", g.Name(), err)
+		}
+		lods = append(lods, db.LOD{
+			GeometryData:   buf.Bytes(),
+			TriangleCount:  triangleCount,
+			GeometryFormat: formats.GeometryFormatBinaryMesh,
+		})
+	}
+	return lods, nil
+}
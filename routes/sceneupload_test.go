@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/larsmoa/renderdb/db"
+	"github.com/larsmoa/renderdb/formats"
+	"github.com/larsmoa/renderdb/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// createGridObj returns an OBJ file with a single group holding a flat
+// grid of n x n quads covering the unit square.
+func createGridObj(n int) string {
+	buf := bytes.Buffer{}
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			fmt.Fprintf(&buf, "v %g %g 0\n", float64(x)/float64(n), float64(y)/float64(n))
+		}
+	}
+	buf.WriteString("g grid\n")
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			i := y*(n+1) + x + 1
+			fmt.Fprintf(&buf, "f %d %d %d %d\n", i, i+1, i+n+2, i+n+1)
+		}
+	}
+	return buf.String()
+}
+
+func TestCreateLODs_DenseGrid_ReturnsLevelsWithDecreasingTriangleCounts(t *testing.T) {
+	// Arrange
+	groups, err := readGroups(formats.GeometryFormatOBJ, bytes.NewBufferString(createGridObj(64)))
+	assert.NoError(t, err)
+
+	// Act
+	lods, err := createLODs(groups[0])
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NotEmpty(t, lods)
+	previous := groups[0].TriangleCount()
+	for _, lod := range lods {
+		assert.True(t, lod.TriangleCount < previous, "%d >= %d", lod.TriangleCount, previous)
+		assert.NotEmpty(t, lod.GeometryData)
+		previous = lod.TriangleCount
+	}
+}
+
+func TestCreateLODs_SingleTriangle_ReturnsNoLevels(t *testing.T) {
+	// Arrange
+	groups, err := readGroups(formats.GeometryFormatOBJ, bytes.NewBufferString("v 0 0 0\nv 1 0 0\nv 0 1 0\ng t\nf 1 2 3\n"))
+	assert.NoError(t, err)
+
+	// Act
+	lods, err := createLODs(groups[0])
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Empty(t, lods)
+}
+
+func TestReplaceSceneObjects_StreamedObj_AddsObjectsInBatches(t *testing.T) {
+	// Arrange
+	obj := bytes.NewBufferString("v 0 0 0\nv 1 0 0\nv 0 1 0\n")
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(obj, "g group%d\nf 1 2 3\n", i)
+	}
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes?name=MyScene", obj)
+	upload := parseSceneUploadFromObjStream(r)
+	defer upload.close()
+	repo := &repository.MockRepository{}
+	batchSizes := []int{}
+	repo.On("ReplaceInBatches", []db.ObjectSelector{db.ScenesSelector{SceneIDs: []int64{7}}}, mock.Anything).
+		Return(func(_ []db.ObjectSelector, nextBatch func() ([]db.Object, error)) []int64 {
+			for batch, err := nextBatch(); len(batch) > 0 && err == nil; batch, err = nextBatch() {
+				batchSizes = append(batchSizes, len(batch))
+			}
+			return []int64{1, 2, 3, 4, 5}
+		}, nil)
+	defer func(size int) { objectBatchSize = size }(objectBatchSize)
+	objectBatchSize = 2
+
+	// Act
+	ids, err := replaceSceneObjects(repo, 42, &db.Scene{ID: 7, LayerID: 13}, upload)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, ids)
+	assert.Equal(t, []int{2, 2, 1}, batchSizes)
+}
+
+func TestParseSceneUpload_MultipartObj_StreamsSpooledFileUntilClosed(t *testing.T) {
+	// Arrange
+	buffer := &bytes.Buffer{}
+	form := multipart.NewWriter(buffer)
+	part, _ := form.CreateFormFile("obj", "scene.obj")
+	part.Write([]byte("v 0 0 0\nv 1 0 0\nv 0 1 0\ng t\nf 1 2 3\n"))
+	form.Close()
+	r, _ := http.NewRequest("POST", "/worlds/42/layers/13/scenes", buffer)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+
+	// Act
+	upload, err := parseSceneUpload(r)
+	var g formats.GeometryGroup
+	if err == nil {
+		g, err = upload.stream.NextGroup()
+		upload.close()
+	}
+
+	// Assert
+	if assert.NoError(t, err) {
+		assert.Nil(t, upload.groups)
+		assert.Equal(t, "t", g.Name())
+		_, err = os.Stat(upload.spool.Name())
+		assert.True(t, os.IsNotExist(err))
+	}
+}
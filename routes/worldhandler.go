@@ -10,6 +10,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/larsmoa/renderdb/db"
 	"github.com/larsmoa/renderdb/httpext"
+	"github.com/larsmoa/renderdb/repository"
 )
 
 // --------------------------------------------------
@@ -139,3 +140,48 @@ func parseWorldFromBody(r *http.Request) (*db.World, error) {
 	}
 	return &world, nil
 }
+
+// -------------------------------
+// DELETE /worlds/[id]
+// -------------------------------
+
+type deleteWorldHandler struct {
+	repos repository.Repositories
+}
+
+func (h *deleteWorldHandler) Handle(tx *sqlx.Tx, renderer httpext.ResponseRenderer,
+	w http.ResponseWriter, r *http.Request) error {
+
+	var err error
+	vars := mux.Vars(r)
+	worldID, err := httpext.ReadInt64ID(vars, "worldID")
+	if err != nil {
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	worldsDB := getWorldsFromContext(r)
+	world, err := worldsDB.Get(worldID)
+	if err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not retrieve world with id %d (reason: %s)", worldID, err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+	if world == nil {
+		err = httpext.NewHttpError(fmt.Errorf("No world with id %d", worldID), http.StatusNotFound)
+		renderer.WriteError(w, err)
+		return err
+	}
+
+	// Delete world and everything in it. The spatial index is evicted once
+	// the deletion is committed, as requests until then may load it again.
+	if err = worldsDB.Delete(worldID); err != nil {
+		err = httpext.NewHttpError(fmt.Errorf("Could not delete world with id %d (reason: %s)", worldID, err), http.StatusInternalServerError)
+		renderer.WriteError(w, err)
+		return err
+	}
+	httpext.OnCommit(r, func() { h.repos.Evict(worldID) })
+
+	renderer.WriteEmpty(w, http.StatusNoContent)
+	return nil
+}
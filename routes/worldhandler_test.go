@@ -10,9 +10,11 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
 	"github.com/larsmoa/renderdb/db"
 	"github.com/larsmoa/renderdb/httpext"
+	"github.com/larsmoa/renderdb/repository"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -23,6 +25,7 @@ type worldHandlerFixture struct {
 	tx     *sqlx.Tx
 
 	worlds *db.MockWorlds
+	repos  *repository.MockRepositories
 
 	request  *http.Request
 	writer   *httptest.ResponseRecorder
@@ -44,6 +47,7 @@ func (f *worldHandlerFixture) Setup(t *testing.T, r *http.Request) {
 	f.renderer = &httpext.MockResponseRenderer{}
 
 	f.worlds = &db.MockWorlds{}
+	f.repos = &repository.MockRepositories{}
 	context.Set(r, worldsDBKey, f.worlds)
 }
 
@@ -199,3 +203,99 @@ func TestPostWorldHandle_ValidBody_WritesObject(t *testing.T) {
 	f.renderer.AssertExpectations(t)
 	f.worlds.AssertExpectations(t)
 }
+
+// serveDeleteWorld serves the request using deleteWorldHandler in a
+// transaction, as done by the registered route.
+func serveDeleteWorld(f *worldHandlerFixture, r *http.Request) {
+	handler := httpext.NewHttpHandler(f.db, httpext.DefaultRenderers(), &deleteWorldHandler{f.repos})
+	router := mux.NewRouter()
+	router.Handle("/worlds/{worldID}", handler)
+	router.ServeHTTP(f.writer, r)
+}
+
+func TestDeleteWorldHandler_ExistingWorld_DeletesAndEvictsRepositoryAfterCommit(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("DELETE", "/worlds/13", nil)
+	f := worldHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.worlds.On("Get", int64(13)).Return(&db.World{ID: 13}, nil)
+	f.worlds.On("Delete", int64(13)).Return(nil)
+	f.mockDB.ExpectBegin()
+	f.mockDB.ExpectCommit()
+	f.repos.On("Evict", int64(13)).Return()
+	f.mockDB.ExpectClose()
+
+	// Act
+	serveDeleteWorld(&f, r)
+
+	// Assert
+	assert.Equal(t, http.StatusNoContent, f.writer.Code)
+	f.worlds.AssertExpectations(t)
+	f.repos.AssertExpectations(t)
+}
+
+func TestDeleteWorldHandler_CommitFails_DoesNotEvictRepository(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("DELETE", "/worlds/13", nil)
+	f := worldHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.worlds.On("Get", int64(13)).Return(&db.World{ID: 13}, nil)
+	f.worlds.On("Delete", int64(13)).Return(nil)
+	f.mockDB.ExpectBegin()
+	f.mockDB.ExpectCommit().WillReturnError(errors.New(""))
+	f.mockDB.ExpectClose()
+
+	// Act
+	serveDeleteWorld(&f, r)
+
+	// Assert
+	f.worlds.AssertExpectations(t)
+	f.repos.AssertNotCalled(t, "Evict", mock.Anything)
+}
+
+func TestDeleteWorldHandler_NoWorld_WritesError(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("DELETE", "/worlds/13", nil)
+	f := worldHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.worlds.On("Get", int64(13)).Return(nil, nil)
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := deleteWorldHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "DELETE", "/worlds/{worldID}",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, err.(httpext.HttpError).StatusCode())
+	f.renderer.AssertExpectations(t)
+}
+
+func TestDeleteWorldHandler_DeleteReturnsError_WritesError(t *testing.T) {
+	// Arrange
+	r, _ := http.NewRequest("DELETE", "/worlds/13", nil)
+	f := worldHandlerFixture{}
+	f.Setup(t, r)
+	defer f.Teardown(t)
+
+	f.worlds.On("Get", int64(13)).Return(&db.World{ID: 13}, nil)
+	f.worlds.On("Delete", int64(13)).Return(errors.New(""))
+	f.renderer.On("WriteError", f.writer, mock.Anything)
+	handler := deleteWorldHandler{f.repos}
+
+	// Act
+	err := httpext.InvokeHandler(&handler, "DELETE", "/worlds/{worldID}",
+		f.writer, r, f.tx, f.renderer)
+
+	// Assert
+	assert.Error(t, err)
+	f.repos.AssertNotCalled(t, "Evict", mock.Anything)
+	f.renderer.AssertExpectations(t)
+}
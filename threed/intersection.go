@@ -15,31 +15,45 @@ func toPtr(v vec3.T) *vec3.T {
 }
 
 // RayTriangleIntersects performs an intersection between a ray and a triangle.
-// Algorithm from http://www.scratchapixel.com/lessons/3d-basic-rendering/ray-tracing-rendering-a-triangle/moller-trumbore-ray-triangle-intersection
+// Intersections behind the origin of the ray are ignored.
 func RayTriangleIntersects(v0, v1, v2 *vec3.T, orig, dir *vec3.T) bool {
-	v0v1 := v1.Sub(v0)
-	v0v2 := v2.Sub(v0)
+	_, intersects := RayTriangleIntersection(v0, v1, v2, orig, dir)
+	return intersects
+}
+
+// RayTriangleIntersection performs an intersection between a ray and a triangle. Returns
+// true and the distance from the ray origin to the intersection, measured in units of the
+// length of dir, if the ray intersects the triangle. Intersections behind the origin of the
+// ray are ignored. None of the arguments are modified.
+// Algorithm from http://www.scratchapixel.com/lessons/3d-basic-rendering/ray-tracing-rendering-a-triangle/moller-trumbore-ray-triangle-intersection
+func RayTriangleIntersection(v0, v1, v2 *vec3.T, orig, dir *vec3.T) (float64, bool) {
+	v0v1 := toPtr(vec3.Sub(v1, v0))
+	v0v2 := toPtr(vec3.Sub(v2, v0))
 	pvec := toPtr(vec3.Cross(dir, v0v2))
 	det := vec3.Dot(v0v1, pvec)
 
 	// Ray and triangle are parallel if det is close to 0
 	if math.Abs(det) < epsilon {
-		return false
+		return 0, false
 	}
 
 	invDet := 1 / det
-	tvec := orig.Sub(v0)
+	tvec := toPtr(vec3.Sub(orig, v0))
 
 	u := vec3.Dot(tvec, pvec) * invDet
 	if u < 0 || u > 1 {
-		return false
+		return 0, false
 	}
 
 	qvec := toPtr(vec3.Cross(tvec, v0v1))
 	v := vec3.Dot(dir, qvec) * invDet
 	if v < 0 || u+v > 1 {
-		return false
+		return 0, false
 	}
 
-	return true
+	t := vec3.Dot(v0v2, qvec) * invDet
+	if t < 0 {
+		return 0, false
+	}
+	return t, true
 }
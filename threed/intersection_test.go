@@ -41,3 +41,33 @@ func TestRayTriangleIntersects_DegeneratedTriangle_DoesNotPanic(t *testing.T) {
 	assert.NotPanics(t, func() { RayTriangleIntersects(&v2, &v1, &v3, &o, &d) })
 	assert.NotPanics(t, func() { RayTriangleIntersects(&v3, &v1, &v2, &o, &d) })
 }
+
+func TestRayTriangleIntersects_TriangleBehindOrigin_ReturnsFalse(t *testing.T) {
+	// Arrange
+	v1, v2, v3 := vec3.T{0, 0, 0}, vec3.T{1, 0, 0}, vec3.T{0, 1, 0}
+	o, d := vec3.T{0.2, 0.2, 1}, vec3.T{0, 0, 1}
+
+	// Act
+	intersects := RayTriangleIntersects(&v1, &v2, &v3, &o, &d)
+
+	// Assert
+	assert.False(t, intersects)
+}
+
+func TestRayTriangleIntersection_IntersectingRay_ReturnsDistanceAndDoesNotModifyArguments(t *testing.T) {
+	// Arrange
+	v1, v2, v3 := vec3.T{0, 0, 0}, vec3.T{1, 0, 0}, vec3.T{0, 1, 0}
+	o, d := vec3.T{0.2, 0.2, -4}, vec3.T{0, 0, 2}
+
+	// Act
+	distance, intersects := RayTriangleIntersection(&v1, &v2, &v3, &o, &d)
+
+	// Assert
+	assert.True(t, intersects)
+	assert.InDelta(t, 2.0, distance, 1e-9)
+	assert.Equal(t, vec3.T{0, 0, 0}, v1)
+	assert.Equal(t, vec3.T{1, 0, 0}, v2)
+	assert.Equal(t, vec3.T{0, 1, 0}, v3)
+	assert.Equal(t, vec3.T{0.2, 0.2, -4}, o)
+	assert.Equal(t, vec3.T{0, 0, 2}, d)
+}